@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"monkey/lexer"
 	"monkey/token"
 	"strings"
 )
@@ -17,6 +18,16 @@ type Node interface {
 	// String 方法返回节点的字符串表示形式
 	// 该方法用于将 AST 节点转换回可读的源代码格式，便于调试和测试
 	String() string
+
+	// Pos 返回节点第一个词法单元在源代码中的位置
+	// End 返回节点最后一个词法单元在源代码中的位置（该词法单元的起始位置）
+	// 由语法分析器合成、没有对应源代码的节点返回零值
+	Pos() token.Position
+	End() token.Position
+
+	// Kind 返回节点类型的名称，如 "LetStatement"、"CallExpression"
+	// 名称不含 Go 的包路径，可以稳定地用于调试输出和工具；全部名称见 Kinds()
+	Kind() string
 }
 
 // All statement nodes implement this
@@ -47,6 +58,7 @@ type Expression interface {
 // 作为抽象语法树（AST）的根节点，包含程序中的所有语句
 type Program struct {
 	Statements []Statement // 语句切片，存储程序中的所有语句节点
+	Comments   []*Comment  // 程序中的全部注释，按出现顺序排列；只有词法分析器输出注释时才会收集
 }
 
 // TokenLiteral 方法实现Node接口，返回Program的标记字面量
@@ -61,25 +73,59 @@ func (p *Program) TokenLiteral() string {
 
 // String 方法实现Node接口，返回Program的字符串表示
 // 通过遍历所有语句并调用其String()方法，拼接成完整的程序字符串
+// 输出可以被重新解析为结构相同的程序
 func (p *Program) String() string {
 	var out bytes.Buffer // 创建字节缓冲区用于字符串拼接
 
-	for _, s := range p.Statements {
-		out.WriteString(s.String()) // 将每个语句的字符串表示写入缓冲区
-	}
+	writeStatements(&out, p.Statements) // 将每个语句的字符串表示写入缓冲区
 
 	return out.String() // 返回拼接后的完整程序字符串
 }
 
+// writeStatements 把语句序列写入缓冲区，语句之间用空格分隔
+// 表达式语句的字符串表示不带分号，后面还有语句时补上分号，
+// 否则重新解析时相邻的两条语句会连在一起（如 x 和 (-1) 变成 x(-1)）
+func writeStatements(out *bytes.Buffer, stmts []Statement) {
+	for i, s := range stmts {
+		if i > 0 {
+			out.WriteString(" ")
+		}
+		str := nodeString(s)
+		out.WriteString(str)
+		if i < len(stmts)-1 && !strings.HasSuffix(str, ";") {
+			out.WriteString(";")
+		}
+	}
+}
+
+// missing 是字符串表示中缺失子节点的占位符
+// 语法分析出错时可能得到子节点为nil的不完整语法树，输出它时不应panic
+const missing = "<missing>"
+
+// nodeString 返回节点的字符串表示，节点为nil时返回占位符
+func nodeString(node Node) string {
+	if isNilNode(node) {
+		return missing
+	}
+	return node.String()
+}
+
 // Statements
 // LetStatement 结构体表示Monkey语言中的变量声明语句
 // 语法格式：let <identifier> = <expression>;
+// 解构形式：let [a, b] = <expression>; 或 let {name, age} = <expression>;
+// 常量声明 const <identifier> = <expression>; 同样用LetStatement表示，Token为const关键字
 type LetStatement struct {
-	Token token.Token // the token.LET token - let关键字对应的词法标记
-	Name  *Identifier // 变量名标识符，指向Identifier表达式节点
-	Value Expression  // 赋值表达式，可以是任意类型的表达式节点
+	Token   token.Token // the token.LET token - let关键字对应的词法标记，常量声明时为const
+	Name    *Identifier // 变量名标识符，指向Identifier表达式节点（解构形式下为nil）
+	Pattern Expression  // 解构模式，ArrayPattern或HashPattern（普通形式下为nil）
+	Value   Expression  // 赋值表达式，可以是任意类型的表达式节点
+	Doc     []*Comment  // 紧挨在语句上方、单独成行的注释（可选）
 }
 
+// IsConst 判断语句是否为常量声明 const x = ...;
+func (ls *LetStatement) IsConst() bool { return ls.Token.Type == token.CONST }
+
 // statementNode 方法实现Statement接口，作为LetStatement的标记方法
 // 该方法没有实际逻辑，仅用于类型断言和接口区分
 func (ls *LetStatement) statementNode() {}
@@ -94,11 +140,15 @@ func (ls *LetStatement) String() string {
 	var out bytes.Buffer // 创建字节缓冲区用于字符串拼接
 
 	out.WriteString(ls.TokenLiteral() + " ") // 写入"let"关键字和空格
-	out.WriteString(ls.Name.String())        // 写入变量名标识符
-	out.WriteString(" = ")                   // 写入赋值运算符和空格
+	if ls.Pattern != nil {
+		out.WriteString(nodeString(ls.Pattern)) // 写入解构模式
+	} else {
+		out.WriteString(nodeString(ls.Name)) // 写入变量名标识符
+	}
 
 	if ls.Value != nil {
-		out.WriteString(ls.Value.String()) // 写入赋值表达式（如果存在）
+		out.WriteString(" = ")                // 写入赋值运算符和空格
+		out.WriteString(nodeString(ls.Value)) // 写入赋值表达式（如果存在）
 	}
 
 	out.WriteString(";") // 写入语句结束分号
@@ -106,12 +156,87 @@ func (ls *LetStatement) String() string {
 	return out.String() // 返回拼接后的完整语句字符串
 }
 
+// MultiLetStatement 表示同时声明多个变量的let语句
+// 语法格式：let <name1>, <name2>, ... = <expression1>, <expression2>, ...;
+// 求值时先求出右侧所有表达式再依次绑定，因此 let a, b = b, a; 可以安全地交换两个值
+type MultiLetStatement struct {
+	Token  token.Token   // let关键字对应的词法标记
+	Names  []*Identifier // 依次绑定的变量名
+	Values []Expression  // 与Names一一对应的赋值表达式（没有初始值时为nil）
+	Doc    []*Comment    // 紧挨在语句上方、单独成行的注释（可选）
+}
+
+func (ms *MultiLetStatement) statementNode()       {}
+func (ms *MultiLetStatement) TokenLiteral() string { return ms.Token.Literal }
+
+// String 方法实现Node接口，返回多变量let语句的字符串表示
+// 返回值格式：let a, b = 1, 2; 没有初始值时为 let a, b;
+func (ms *MultiLetStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ms.TokenLiteral() + " ")
+	out.WriteString(joinIdentifiers(ms.Names))
+
+	if ms.Values != nil {
+		values := []string{}
+		for _, v := range ms.Values {
+			values = append(values, nodeString(v))
+		}
+		out.WriteString(" = ")
+		out.WriteString(strings.Join(values, ", "))
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// ArrayPattern 表示let语句左侧的数组解构模式
+// 按位置把数组元素依次绑定到各个名称上
+// 语法格式：[<name1>, <name2>, ...]
+type ArrayPattern struct {
+	Token    token.Token   // 左方括号 '[' 的词法标记
+	Names    []*Identifier // 依次绑定的变量名
+	RBracket token.Token   // 右方括号 ']' 的词法标记
+}
+
+func (ap *ArrayPattern) expressionNode()      {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) String() string {
+	return "[" + joinIdentifiers(ap.Names) + "]"
+}
+
+// HashPattern 表示let语句左侧的哈希表解构模式
+// 每个名称绑定到哈希表中同名字符串键对应的值
+// 语法格式：{<name1>, <name2>, ...}
+type HashPattern struct {
+	Token  token.Token   // 左花括号 '{' 的词法标记
+	Names  []*Identifier // 需要取出的键名，同时也是绑定的变量名
+	RBrace token.Token   // 右花括号 '}' 的词法标记
+}
+
+func (hp *HashPattern) expressionNode()      {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) String() string {
+	return "{" + joinIdentifiers(hp.Names) + "}"
+}
+
+// joinIdentifiers 把标识符列表格式化为逗号分隔的字符串
+func joinIdentifiers(idents []*Identifier) string {
+	names := []string{}
+	for _, ident := range idents {
+		names = append(names, nodeString(ident))
+	}
+	return strings.Join(names, ", ")
+}
+
 // ReturnStatement 结构体表示 Monkey 语言中的返回语句
 // 语法格式为：return <expression>;
 // 该语句用于从函数中返回一个值，是函数执行流程控制的一部分
 type ReturnStatement struct {
 	Token       token.Token // 存储 'return' 关键字的词法标记，用于标识语句类型和位置信息
 	ReturnValue Expression  // 存储要返回的表达式，可以是任意类型的表达式节点（如标识符、字面量、函数调用等）
+	Doc         []*Comment  // 紧挨在语句上方、单独成行的注释（可选）
 }
 
 // statementNode 方法是 ReturnStatement 结构体实现 Statement 接口的标记方法
@@ -130,13 +255,13 @@ func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
-	// 写入 "return" 关键字和空格
-	out.WriteString(rs.TokenLiteral() + " ")
+	// 写入 "return" 关键字
+	out.WriteString(rs.TokenLiteral())
 
-	// 检查返回值表达式是否存在，避免空指针异常
+	// 检查返回值表达式是否存在，避免空指针异常；不带返回值时输出 return;
 	if rs.ReturnValue != nil {
 		// 递归调用返回值表达式的 String 方法，获取其字符串表示
-		out.WriteString(rs.ReturnValue.String())
+		out.WriteString(" " + nodeString(rs.ReturnValue))
 	}
 
 	// 写入语句结束的分号
@@ -146,12 +271,35 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// BreakStatement 表示跳出最内层循环的break语句
+// 语法格式：break;
+type BreakStatement struct {
+	Token token.Token // 'break' 关键字的词法标记
+	Doc   []*Comment  // 紧挨在语句上方、单独成行的注释（可选）
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) String() string       { return bs.TokenLiteral() + ";" }
+
+// ContinueStatement 表示跳过最内层循环本次剩余部分的continue语句
+// 语法格式：continue;
+type ContinueStatement struct {
+	Token token.Token // 'continue' 关键字的词法标记
+	Doc   []*Comment  // 紧挨在语句上方、单独成行的注释（可选）
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) String() string       { return cs.TokenLiteral() + ";" }
+
 // ExpressionStatement 结构体表示 Monkey 语言中的表达式语句
 // 语法格式为：<expression>;
 // 该语句将表达式包装为独立的语句，允许表达式在语句上下文中使用
 type ExpressionStatement struct {
 	Token      token.Token // 存储表达式第一个词法标记，用于标识语句类型和位置信息
 	Expression Expression  // 存储被包装的表达式节点，可以是任意类型的表达式
+	Doc        []*Comment  // 紧挨在语句上方、单独成行的注释（可选）
 }
 
 // statementNode 方法是 ExpressionStatement 结构体实现 Statement 接口的标记方法
@@ -168,8 +316,8 @@ func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
 // 该方法通过递归调用 Expression 字段的 String 方法，返回表达式的完整字符串表示
 // 作用：为调试输出、代码生成和测试验证提供表达式语句的字符串表示
 func (es *ExpressionStatement) String() string {
-	// 检查表达式是否存在，避免空指针异常
-	if es.Expression != nil {
+	// 检查表达式是否存在，避免空指针异常（包括带类型的nil指针）
+	if !isNilNode(es.Expression) {
 		// 递归调用表达式的 String 方法，获取其完整字符串表示
 		return es.Expression.String()
 	}
@@ -183,6 +331,7 @@ func (es *ExpressionStatement) String() string {
 type BlockStatement struct {
 	Token      token.Token // 代码块的起始标记，通常是左花括号 '{'
 	Statements []Statement // 代码块中包含的语句序列，可以为空
+	RBrace     token.Token // 右花括号 '}' 的词法标记，else if 生成的语句块没有右花括号
 }
 
 // statementNode 是 BlockStatement 实现 Statement 接口的标记方法
@@ -197,15 +346,13 @@ func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
 
 // String 返回 BlockStatement 的字符串表示
 // 实现 Node 接口，通过遍历 Statements 切片并递归调用每个语句的 String() 方法
-// 将代码块中的所有语句拼接成完整的字符串表示
+// 将代码块中的所有语句拼接成完整的字符串表示，语句之间的分隔方式与 Program 相同
+// 输出不含花括号，由包含语句块的 if、fn 等节点负责添加
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
-	// 遍历代码块中的所有语句
-	for _, s := range bs.Statements {
-		// 递归调用每个语句的 String() 方法，将结果写入缓冲区
-		out.WriteString(s.String())
-	}
+	// 递归调用每个语句的 String() 方法，将结果写入缓冲区
+	writeStatements(&out, bs.Statements)
 
 	return out.String()
 }
@@ -267,6 +414,17 @@ func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+// FloatLiteral 表示 Monkey 语言中的浮点数字面量表达式
+// 语法格式：<digits>.<digits>，如 3.14、0.5
+type FloatLiteral struct {
+	Token token.Token // 浮点数字面量的词法标记，类型为 token.FLOAT
+	Value float64     // 浮点数字面量的实际数值
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
 // PrefixExpression 表示 Monkey 语言中的前缀表达式
 // 前缀表达式是操作符位于操作数之前的表达式
 // 语法格式：<operator><operand>，如 !true、-5 等
@@ -283,7 +441,7 @@ func (pe *PrefixExpression) String() string {
 
 	out.WriteString("(")
 	out.WriteString(pe.Operator)
-	out.WriteString(pe.Right.String())
+	out.WriteString(nodeString(pe.Right))
 	out.WriteString(")")
 
 	return out.String()
@@ -292,8 +450,9 @@ func (pe *PrefixExpression) String() string {
 // InfixExpression 表示 Monkey 语言中的中缀表达式
 // 中缀表达式是操作符位于两个操作数之间的表达式
 // 语法格式：<left_operand> <operator> <right_operand>，如 5 + 3、x == y 等
+// 插值字符串 "a ${x} b" 被解析为以TEMPLATE token为标记的 + 表达式链 (("a " + x) + " b")
 type InfixExpression struct {
-	Token    token.Token // 中缀操作符的词法标记，如 +、-、*、/、==、!= 等
+	Token    token.Token // 中缀操作符的词法标记，如 +、-、*、/、==、!= 等；插值字符串为TEMPLATE
 	Left     Expression  // 左侧的操作数表达式
 	Operator string      // 中缀操作符的字符串表示，如 "+"、"-"、"=="、"!=" 等
 	Right    Expression  // 右侧的操作数表达式
@@ -304,18 +463,47 @@ func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
+	// 由插值字符串展开而来的表达式还原为插值写法
+	if ie.Token.Type == token.TEMPLATE {
+		out.WriteString("\"")
+		ie.writeTemplate(&out)
+		out.WriteString("\"")
+		return out.String()
+	}
+
 	out.WriteString("(")
-	out.WriteString(ie.Left.String())
+	out.WriteString(nodeString(ie.Left))
 	out.WriteString(" " + ie.Operator + " ")
-	out.WriteString(ie.Right.String())
+	out.WriteString(nodeString(ie.Right))
 	out.WriteString(")")
 
 	return out.String()
 }
 
+// writeTemplate 把插值字符串展开后的 + 表达式链按原始的插值写法写入out
+// 链向左嵌套，左侧是更靠前的片段，右侧是当前片段
+func (ie *InfixExpression) writeTemplate(out *bytes.Buffer) {
+	if left, ok := ie.Left.(*InfixExpression); ok && left.Token.Type == token.TEMPLATE {
+		left.writeTemplate(out)
+	} else {
+		writeTemplatePart(out, ie.Left)
+	}
+	writeTemplatePart(out, ie.Right)
+}
+
+// writeTemplatePart 写入插值字符串的一个片段
+// 文本片段是标记为TEMPLATE的StringLiteral，原样写入；其他表达式写成 ${...}
+func writeTemplatePart(out *bytes.Buffer, exp Expression) {
+	if sl, ok := exp.(*StringLiteral); ok && sl.Token.Type == token.TEMPLATE {
+		out.WriteString(lexer.Escape(sl.Value))
+		return
+	}
+	out.WriteString("${" + nodeString(exp) + "}")
+}
+
 // IfExpression 表示 Monkey 语言中的条件表达式
 // 条件表达式根据条件执行不同的代码块
-// 语法格式：if <condition> { <consequence> } [else { <alternative> }]
+// 语法格式：if <condition> { <consequence> } [else if ...] [else { <alternative> }]
 type IfExpression struct {
 	Token       token.Token     // 'if' 关键字的词法标记
 	Condition   Expression      // 条件表达式，计算结果为布尔值
@@ -328,26 +516,206 @@ func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
-	out.WriteString("if")
-	out.WriteString(ie.Condition.String())
-	out.WriteString(" ")
-	out.WriteString(ie.Consequence.String())
+	out.WriteString("if (")
+	out.WriteString(nodeString(ie.Condition))
+	out.WriteString(") { ")
+	out.WriteString(nodeString(ie.Consequence))
+	out.WriteString(" }")
 
 	if ie.Alternative != nil {
-		out.WriteString("else ")
-		out.WriteString(ie.Alternative.String())
+		out.WriteString(" else ")
+		if elseIf := ie.ElseIf(); elseIf != nil {
+			// else if 分支直接输出嵌套的if表达式，保持与源代码一致的写法
+			out.WriteString(elseIf.String())
+		} else {
+			out.WriteString("{ ")
+			out.WriteString(ie.Alternative.String())
+			out.WriteString(" }")
+		}
+	}
+
+	return out.String()
+}
+
+// ElseIf 返回由 else if 语法生成的嵌套if表达式
+// 解析器会把 else if 包装成以 if 词法标记开头、只含一条语句的语句块；
+// 如果Alternative不是这种形式（普通else分支或没有else分支），返回nil
+func (ie *IfExpression) ElseIf() *IfExpression {
+	alt := ie.Alternative
+	if alt == nil || alt.Token.Type != token.IF || len(alt.Statements) != 1 {
+		return nil
+	}
+
+	stmt, ok := alt.Statements[0].(*ExpressionStatement)
+	if !ok || stmt == nil {
+		return nil
 	}
 
+	nested, _ := stmt.Expression.(*IfExpression)
+	return nested
+}
+
+// WhileExpression 表示 Monkey 语言中的while循环表达式
+// 条件为真时反复执行循环体，表达式的值是最后一次执行循环体的结果
+// 语法格式：while (<condition>) { <body> }
+type WhileExpression struct {
+	Token     token.Token     // 'while' 关键字的词法标记
+	Condition Expression      // 循环条件，每次执行循环体之前求值
+	Body      *BlockStatement // 循环体
+}
+
+func (we *WhileExpression) expressionNode()      {}
+func (we *WhileExpression) TokenLiteral() string { return we.Token.Literal }
+func (we *WhileExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while (")
+	out.WriteString(nodeString(we.Condition))
+	out.WriteString(") { ")
+	out.WriteString(nodeString(we.Body))
+	out.WriteString(" }")
+
 	return out.String()
 }
 
+// ForExpression 表示 Monkey 语言中C风格的for循环表达式
+// 先执行一次Init，之后每次循环求值Condition、执行循环体、再求值Post；三部分都可以省略，
+// 省略Condition时一直循环。Init中用let声明的变量只在循环内可见
+// 语法格式：for (<init>; <condition>; <post>) { <body> }
+type ForExpression struct {
+	Token     token.Token     // 'for' 关键字的词法标记
+	Init      Statement       // 初始化语句，let语句或表达式语句，省略时为nil
+	Condition Expression      // 循环条件，省略时为nil
+	Post      Expression      // 每次执行循环体之后求值的表达式，省略时为nil
+	Body      *BlockStatement // 循环体
+}
+
+func (fe *ForExpression) expressionNode()      {}
+func (fe *ForExpression) TokenLiteral() string { return fe.Token.Literal }
+func (fe *ForExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fe.Init != nil {
+		// let语句的字符串表示自带分号
+		out.WriteString(strings.TrimSuffix(nodeString(fe.Init), ";"))
+	}
+	out.WriteString("; ")
+	if fe.Condition != nil {
+		out.WriteString(nodeString(fe.Condition))
+	}
+	out.WriteString("; ")
+	if fe.Post != nil {
+		out.WriteString(nodeString(fe.Post))
+	}
+	out.WriteString(") { ")
+	out.WriteString(nodeString(fe.Body))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// SwitchExpression 表示 Monkey 语言中的switch多分支表达式
+// 先求值Subject，再按顺序把它与各分支的值比较（与 == 的规则相同），执行第一个匹配的分支；
+// 没有分支匹配时执行default分支，没有default分支时结果为null
+// 语法格式：switch (<subject>) { case <value>, <value> { <body> } default { <body> } }
+type SwitchExpression struct {
+	Token   token.Token     // 'switch' 关键字的词法标记
+	Subject Expression      // 被比较的表达式
+	Cases   []SwitchCase    // case分支，按源码中出现的顺序排列
+	Default *BlockStatement // default分支，省略时为nil
+	RBrace  token.Token     // 右花括号 '}' 的词法标记
+}
+
+// SwitchCase 表示switch表达式中的一个case分支
+type SwitchCase struct {
+	Token  token.Token     // 'case' 关键字的词法标记
+	Values []Expression    // 与Subject比较的值，任意一个相等即匹配
+	Body   *BlockStatement // 分支体
+}
+
+func (se *SwitchExpression) expressionNode()      {}
+func (se *SwitchExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SwitchExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("switch (")
+	out.WriteString(nodeString(se.Subject))
+	out.WriteString(") {")
+	for _, c := range se.Cases {
+		values := []string{}
+		for _, v := range c.Values {
+			values = append(values, nodeString(v))
+		}
+		out.WriteString(" case ")
+		out.WriteString(strings.Join(values, ", "))
+		out.WriteString(" { ")
+		out.WriteString(nodeString(c.Body))
+		out.WriteString(" }")
+	}
+	if se.Default != nil {
+		out.WriteString(" default { ")
+		out.WriteString(nodeString(se.Default))
+		out.WriteString(" }")
+	}
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// TryExpression 表示 Monkey 语言中的错误处理表达式
+// 先执行Body，结果是错误时执行Rescue分支并把错误信息绑定到Param，否则结果就是Body的值；
+// Body中的return、break和continue照常向外传递，不会被rescue拦截
+// 语法格式：try { <body> } rescue (<param>) { <rescue> }
+type TryExpression struct {
+	Token  token.Token     // 'try' 关键字的词法标记
+	Body   *BlockStatement // 被保护的语句块
+	Param  *Identifier     // 绑定错误信息的变量名
+	Rescue *BlockStatement // 出错时执行的语句块
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try { ")
+	out.WriteString(nodeString(te.Body))
+	out.WriteString(" } rescue (")
+	out.WriteString(nodeString(te.Param))
+	out.WriteString(") { ")
+	out.WriteString(nodeString(te.Rescue))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// AssignExpression 表示 Monkey 语言中的赋值表达式
+// 赋值修改已经存在的变量、数组或哈希表中的元素，表达式的值是赋给目标的新值；
+// 赋值是右结合的，a = b = 1 先给b赋值
+// 语法格式：<identifier> = <expression> 或 <expression>[<expression>] = <expression>
+type AssignExpression struct {
+	Token  token.Token // '=' 的词法标记
+	Target Expression  // 被赋值的目标，标识符或索引表达式
+	Value  Expression  // 新值的表达式
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+
+// String 返回赋值表达式的字符串表示，与中缀表达式一样用括号包围，如 (x = (x + 1))
+func (ae *AssignExpression) String() string {
+	return "(" + nodeString(ae.Target) + " = " + nodeString(ae.Value) + ")"
+}
+
 // FunctionLiteral 表示 Monkey 语言中的函数字面量表达式
-// 函数字面量是定义匿名函数的表达式
+// 函数字面量是定义匿名函数的表达式；直接作为let的值时，语法分析器把变量名记录在Name中
 // 语法格式：fn(<parameters>) { <body> }
 type FunctionLiteral struct {
 	Token      token.Token     // 'fn' 关键字的词法标记
 	Parameters []*Identifier   // 函数参数列表，每个参数是一个标识符
 	Body       *BlockStatement // 函数体，包含函数执行的语句序列
+	Name       string          // 绑定该函数的变量名，用于错误信息和调用栈；匿名函数为空
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -357,14 +725,44 @@ func (fl *FunctionLiteral) String() string {
 
 	params := []string{}
 	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+		params = append(params, nodeString(p))
 	}
 
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") ")
-	out.WriteString(fl.Body.String())
+	out.WriteString(") { ")
+	out.WriteString(nodeString(fl.Body))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// MacroLiteral 表示 Monkey 语言中的宏字面量表达式
+// 宏与函数的写法相同，但只能在顶层用let绑定；宏在求值之前展开，参数以未求值的语法树传入
+// 语法格式：macro(<parameters>) { <body> }
+type MacroLiteral struct {
+	Token      token.Token     // 'macro' 关键字的词法标记
+	Parameters []*Identifier   // 宏参数列表，每个参数是一个标识符
+	Body       *BlockStatement // 宏体，求值结果必须是quote得到的语法树
+}
+
+func (ml *MacroLiteral) expressionNode()      {}
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, nodeString(p))
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") { ")
+	out.WriteString(nodeString(ml.Body))
+	out.WriteString(" }")
 
 	return out.String()
 }
@@ -376,6 +774,7 @@ type CallExpression struct {
 	Token     token.Token  // 左括号 '(' 的词法标记
 	Function  Expression   // 被调用的函数，可以是标识符或函数字面量
 	Arguments []Expression // 传递给函数的参数列表
+	RParen    token.Token  // 右括号 ')' 的词法标记
 }
 
 func (ce *CallExpression) expressionNode()      {}
@@ -385,10 +784,10 @@ func (ce *CallExpression) String() string {
 
 	args := []string{}
 	for _, a := range ce.Arguments {
-		args = append(args, a.String())
+		args = append(args, nodeString(a))
 	}
 
-	out.WriteString(ce.Function.String())
+	out.WriteString(nodeString(ce.Function))
 	out.WriteString("(")
 	out.WriteString(strings.Join(args, ", "))
 	out.WriteString(")")
@@ -396,6 +795,18 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// SpreadExpression 表示函数调用实参中的展开表达式
+// 求值时会把数组的各个元素展开为独立的实参
+// 语法格式：<function>(<expression>...)
+type SpreadExpression struct {
+	Token token.Token // 展开运算符 '...' 的词法标记
+	Value Expression  // 被展开的表达式，求值结果必须是数组
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) String() string       { return nodeString(se.Value) + "..." }
+
 // StringLiteral 表示 Monkey 语言中的字符串字面量表达式
 // 字符串字面量用于表示文本数据，由双引号包围的字符序列组成
 // 语法格式："<string_content>"
@@ -406,7 +817,15 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
-func (sl *StringLiteral) String() string       { return sl.Token.Literal }
+
+// String 返回带双引号的字符串字面量，内容中的特殊字符会被转义
+// 哈希表的裸标识符键保持不带引号的写法
+func (sl *StringLiteral) String() string {
+	if sl.Token.Type == token.IDENT {
+		return sl.Value
+	}
+	return `"` + lexer.Escape(sl.Value) + `"`
+}
 
 // ArrayLiteral 表示 Monkey 语言中的数组字面量表达式
 // 数组字面量用于表示有序的元素集合，由方括号包围的元素列表组成
@@ -414,6 +833,7 @@ func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 type ArrayLiteral struct {
 	Token    token.Token  // 左方括号 '[' 的词法标记
 	Elements []Expression // 数组中的元素列表，支持任意表达式类型
+	RBracket token.Token  // 右方括号 ']' 的词法标记
 }
 
 func (al *ArrayLiteral) expressionNode()      {}
@@ -427,7 +847,7 @@ func (al *ArrayLiteral) String() string {
 
 	elements := []string{}
 	for _, el := range al.Elements {
-		elements = append(elements, el.String())
+		elements = append(elements, nodeString(el))
 	}
 
 	out.WriteString("[")
@@ -439,11 +859,12 @@ func (al *ArrayLiteral) String() string {
 
 // IndexExpression 表示 Monkey 语言中的索引表达式
 // 索引表达式用于访问数组或哈希表中的特定元素
-// 语法格式：<left_expression>[<index_expression>]
+// 语法格式：<left_expression>[<index_expression>] 或 <left_expression>.<identifier>
 type IndexExpression struct {
-	Token token.Token // 左方括号 '[' 的词法标记
-	Left  Expression  // 被索引的表达式（数组或哈希表）
-	Index Expression  // 索引表达式（整数或键值）
+	Token    token.Token // 左方括号 '[' 或点号 '.' 的词法标记
+	Left     Expression  // 被索引的表达式（数组或哈希表）
+	Index    Expression  // 索引表达式（整数或键值）
+	RBracket token.Token // 右方括号 ']' 的词法标记，点号语法糖没有右方括号
 }
 
 func (ie *IndexExpression) expressionNode()      {}
@@ -451,14 +872,60 @@ func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
 
 // String 方法实现 Node 接口，返回索引表达式的字符串表示
 // 该方法将索引表达式格式化为括号包围的完整语法结构
-// 返回值格式：(left_expression[index_expression])
+// 返回值格式：(left_expression[index_expression])，点号语法糖输出为 (left_expression.key)
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
+	if ie.Token.Type == token.DOT {
+		out.WriteString("(")
+		out.WriteString(nodeString(ie.Left))
+		out.WriteString(".")
+		if isNilNode(ie.Index) {
+			out.WriteString(missing)
+		} else {
+			out.WriteString(ie.Index.TokenLiteral())
+		}
+		out.WriteString(")")
+
+		return out.String()
+	}
+
 	out.WriteString("(")
-	out.WriteString(ie.Left.String())
+	out.WriteString(nodeString(ie.Left))
 	out.WriteString("[")
-	out.WriteString(ie.Index.String())
+	out.WriteString(nodeString(ie.Index))
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// SliceExpression 表示数组或字符串的切片表达式
+// 语法格式：<left_expression>[<low>:<high>]，low 和 high 都可以省略，如 arr[:2]、arr[2:]、arr[:]
+type SliceExpression struct {
+	Token    token.Token // 左方括号 '[' 的词法标记
+	Left     Expression  // 被切片的表达式（数组或字符串）
+	Low      Expression  // 起始下标（包含），省略时为nil
+	High     Expression  // 结束下标（不包含），省略时为nil
+	RBracket token.Token // 右方括号 ']' 的词法标记
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+
+// String 返回切片表达式的字符串表示，格式为 (left[low:high])，省略的下标不输出
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(nodeString(se.Left))
+	out.WriteString("[")
+	if se.Low != nil {
+		out.WriteString(nodeString(se.Low))
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(nodeString(se.High))
+	}
 	out.WriteString("])")
 
 	return out.String()
@@ -468,8 +935,15 @@ func (ie *IndexExpression) String() string {
 // 哈希表字面量用于表示键值对集合，由花括号包围的键值对列表组成
 // 语法格式：{<key1>: <value1>, <key2>: <value2>, ..., <keyN>: <valueN>}
 type HashLiteral struct {
-	Token token.Token               // 左花括号 '{' 的词法标记
-	Pairs map[Expression]Expression // 哈希表的键值对映射
+	Token  token.Token // 左花括号 '{' 的词法标记
+	Pairs  []HashPair  // 哈希表的键值对，按源码中出现的顺序排列
+	RBrace token.Token // 右花括号 '}' 的词法标记
+}
+
+// HashPair 表示哈希表字面量中的一个键值对
+type HashPair struct {
+	Key   Expression // 键表达式
+	Value Expression // 值表达式
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -482,8 +956,8 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, nodeString(pair.Key)+":"+nodeString(pair.Value))
 	}
 
 	out.WriteString("{")
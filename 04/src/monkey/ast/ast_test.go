@@ -2,6 +2,7 @@ package ast
 
 import (
 	"monkey/token"
+	"strings"
 	"testing"
 )
 
@@ -26,3 +27,416 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestLetStatementWithoutValueString(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "myVar"},
+					Value: "myVar",
+				},
+			},
+		},
+	}
+
+	if program.String() != "let myVar;" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+// nodeCollector 记录Walk访问节点的顺序
+type nodeCollector struct {
+	visited []string
+}
+
+func (c *nodeCollector) Visit(node Node) Visitor {
+	if node != nil {
+		c.visited = append(c.visited, node.Kind())
+	}
+	return c
+}
+
+func TestWalk(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+
+	// let x = if (a) { b } ;
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name:  ident("x"),
+				Value: &IfExpression{
+					Token:     token.Token{Type: token.IF, Literal: "if"},
+					Condition: ident("a"),
+					Consequence: &BlockStatement{
+						Statements: []Statement{
+							&ExpressionStatement{Expression: ident("b")},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	c := &nodeCollector{}
+	Walk(c, program)
+
+	expected := []string{
+		"Program",
+		"LetStatement",
+		"Identifier",
+		"IfExpression",
+		"Identifier",
+		"BlockStatement",
+		"ExpressionStatement",
+		"Identifier",
+	}
+
+	if len(c.visited) != len(expected) {
+		t.Fatalf("wrong number of visited nodes. want=%d, got=%d (%q)",
+			len(expected), len(c.visited), c.visited)
+	}
+
+	for i, s := range expected {
+		if c.visited[i] != s {
+			t.Errorf("visited[%d] wrong. want=%q, got=%q", i, s, c.visited[i])
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	block := func(exp Expression) *BlockStatement {
+		return &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: exp}}}
+	}
+
+	// if (a) { b } else { c + d }; e
+	ifExp := &IfExpression{
+		Condition:   ident("a"),
+		Consequence: block(ident("b")),
+		Alternative: block(&InfixExpression{Left: ident("c"), Operator: "+", Right: ident("d")}),
+	}
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{Expression: ifExp},
+			&ExpressionStatement{Expression: ident("e")},
+		},
+	}
+
+	collect := func(prune Node) string {
+		names := []string{}
+		Inspect(program, func(node Node) bool {
+			if ident, ok := node.(*Identifier); ok {
+				names = append(names, ident.Value)
+			}
+			return node != prune
+		})
+		return strings.Join(names, ",")
+	}
+
+	tests := []struct {
+		prune    Node
+		expected string
+	}{
+		{nil, "a,b,c,d,e"},
+		{ifExp.Alternative, "a,b,e"},
+		{ifExp, "e"},
+		{program, ""},
+	}
+
+	for _, tt := range tests {
+		if got := collect(tt.prune); got != tt.expected {
+			t.Errorf("visited identifiers wrong. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	integer := func(v int64) *IntegerLiteral {
+		return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: v}
+	}
+	str := func(s string) *StringLiteral {
+		return &StringLiteral{Token: token.Token{Type: token.STRING, Literal: s}, Value: s}
+	}
+
+	// let f = fn(x) { if (x) { [1] } else { {"a": x} } }; f(1);
+	fn := &FunctionLiteral{
+		Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+		Parameters: []*Identifier{ident("x")},
+		Body: &BlockStatement{Statements: []Statement{
+			&ExpressionStatement{Expression: &IfExpression{
+				Condition: ident("x"),
+				Consequence: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &ArrayLiteral{Elements: []Expression{integer(1)}}},
+				}},
+				Alternative: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &HashLiteral{Pairs: []HashPair{{Key: str("a"), Value: ident("x")}}}},
+				}},
+			}},
+		}},
+	}
+	program := &Program{Statements: []Statement{
+		&LetStatement{Token: token.Token{Type: token.LET, Literal: "let"}, Name: ident("f"), Value: fn},
+		&ExpressionStatement{Expression: &CallExpression{Function: ident("f"), Arguments: []Expression{integer(1)}}},
+	}}
+
+	original := program.String()
+
+	clone, ok := Clone(program).(*Program)
+	if !ok {
+		t.Fatalf("Clone did not return *Program. got=%T", Clone(program))
+	}
+	if clone.String() != original {
+		t.Fatalf("clone.String() wrong. want=%q, got=%q", original, clone.String())
+	}
+
+	// 修改复制结果的各个部分
+	cloneFn := clone.Statements[0].(*LetStatement).Value.(*FunctionLiteral)
+	cloneFn.Parameters[0].Value = "y"
+	cloneFn.Parameters = append(cloneFn.Parameters, ident("z"))
+	cloneIf := cloneFn.Body.Statements[0].(*ExpressionStatement).Expression.(*IfExpression)
+	cloneIf.Consequence.Statements[0].(*ExpressionStatement).Expression.(*ArrayLiteral).Elements[0].(*IntegerLiteral).Value = 2
+	cloneHash := cloneIf.Alternative.Statements[0].(*ExpressionStatement).Expression.(*HashLiteral)
+	cloneHash.Pairs[0].Key.(*StringLiteral).Value = "b"
+	cloneHash.Pairs[0].Value = integer(3)
+	cloneIf.Alternative = nil
+	clone.Statements[1].(*ExpressionStatement).Expression.(*CallExpression).Arguments[0] = ident("q")
+	clone.Statements = append(clone.Statements, &ReturnStatement{Token: token.Token{Type: token.RETURN, Literal: "return"}})
+
+	if program.String() != original {
+		t.Errorf("original changed after mutating clone.\nwant=%q\ngot=%q", original, program.String())
+	}
+	if len(fn.Parameters) != 1 || fn.Parameters[0].Value != "x" {
+		t.Errorf("original parameters changed. got=%v", fn.Parameters)
+	}
+
+	origIf := fn.Body.Statements[0].(*ExpressionStatement).Expression.(*IfExpression)
+	origElem := origIf.Consequence.Statements[0].(*ExpressionStatement).Expression.(*ArrayLiteral).Elements[0]
+	if origElem.(*IntegerLiteral).Value != 1 {
+		t.Errorf("original integer literal changed. got=%d", origElem.(*IntegerLiteral).Value)
+	}
+	if origIf.Alternative == nil {
+		t.Errorf("original Alternative was removed")
+	}
+
+	if Clone(nil) != nil {
+		t.Errorf("Clone(nil) is not nil. got=%v", Clone(nil))
+	}
+}
+
+func TestEqual(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	block := func(name string) *BlockStatement {
+		return &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: ident(name)}}}
+	}
+
+	withElse := &IfExpression{Condition: ident("a"), Consequence: block("b"), Alternative: block("c")}
+	withoutElse := &IfExpression{Condition: ident("a"), Consequence: block("b")}
+	otherElse := &IfExpression{Condition: ident("a"), Consequence: block("b"), Alternative: block("d")}
+
+	// 位置不同的token不影响比较结果
+	moved := ident("a")
+	moved.Token.Line, moved.Token.Column = 3, 7
+
+	tests := []struct {
+		a, b     Node
+		expected bool
+	}{
+		{nil, nil, true},
+		{ident("a"), nil, false},
+		{nil, ident("a"), false},
+		{ident("a"), moved, true},
+		{ident("a"), ident("b"), false},
+		{withElse, Clone(withElse), true},
+		{withElse, withoutElse, false},
+		{withoutElse, withElse, false},
+		{withElse, otherElse, false},
+		{withoutElse, (*IfExpression)(nil), false},
+		{(*BlockStatement)(nil), nil, true},
+		{ident("a"), &StringLiteral{Value: "a"}, false},
+		{
+			&LetStatement{Name: ident("x")},
+			&LetStatement{Name: ident("x"), Value: ident("y")},
+			false,
+		},
+	}
+
+	for i, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("tests[%d]: Equal() wrong. want=%t, got=%t", i, tt.expected, got)
+		}
+	}
+}
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+	block := func(exp Expression) *BlockStatement {
+		return &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: exp}}}
+	}
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		return &IntegerLiteral{Value: 2}
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{&PrefixExpression{Operator: "-", Right: one()}, &PrefixExpression{Operator: "-", Right: two()}},
+		{&IndexExpression{Left: one(), Index: one()}, &IndexExpression{Left: two(), Index: two()}},
+		{&SliceExpression{Left: one(), High: one()}, &SliceExpression{Left: two(), High: two()}},
+		{
+			&IfExpression{Condition: one(), Consequence: block(one()), Alternative: block(one())},
+			&IfExpression{Condition: two(), Consequence: block(two()), Alternative: block(two())},
+		},
+		// 没有else分支时Alternative保持nil
+		{
+			&IfExpression{Condition: one(), Consequence: block(one())},
+			&IfExpression{Condition: two(), Consequence: block(two())},
+		},
+		{
+			&WhileExpression{Condition: one(), Body: block(one())},
+			&WhileExpression{Condition: two(), Body: block(two())},
+		},
+		{
+			&ForExpression{Init: &ExpressionStatement{Expression: one()}, Post: one(), Body: block(one())},
+			&ForExpression{Init: &ExpressionStatement{Expression: two()}, Post: two(), Body: block(two())},
+		},
+		{&ReturnStatement{ReturnValue: one()}, &ReturnStatement{ReturnValue: two()}},
+		{&LetStatement{Name: ident("x"), Value: one()}, &LetStatement{Name: ident("x"), Value: two()}},
+		{
+			&MultiLetStatement{Names: []*Identifier{ident("x"), ident("y")}, Values: []Expression{one(), one()}},
+			&MultiLetStatement{Names: []*Identifier{ident("x"), ident("y")}, Values: []Expression{two(), two()}},
+		},
+		{&AssignExpression{Target: ident("x"), Value: one()}, &AssignExpression{Target: ident("x"), Value: two()}},
+		{
+			&FunctionLiteral{Parameters: []*Identifier{}, Body: block(one())},
+			&FunctionLiteral{Parameters: []*Identifier{}, Body: block(two())},
+		},
+		{
+			&CallExpression{Function: ident("f"), Arguments: []Expression{one(), &SpreadExpression{Value: one()}}},
+			&CallExpression{Function: ident("f"), Arguments: []Expression{two(), &SpreadExpression{Value: two()}}},
+		},
+		{&ArrayLiteral{Elements: []Expression{one(), one()}}, &ArrayLiteral{Elements: []Expression{two(), two()}}},
+		{
+			&HashLiteral{Pairs: []HashPair{{Key: one(), Value: one()}}},
+			&HashLiteral{Pairs: []HashPair{{Key: two(), Value: two()}}},
+		},
+	}
+
+	for i, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+		if !Equal(modified, tt.expected) {
+			t.Errorf("tests[%d]: not equal. got=%s, want=%s", i, Sexpr(modified), Sexpr(tt.expected))
+		}
+	}
+
+	// 子节点改写完成后才对父节点调用modifier
+	var order []string
+	Modify(&InfixExpression{Left: ident("a"), Operator: "+", Right: ident("b")}, func(node Node) Node {
+		order = append(order, node.Kind())
+		return node
+	})
+	if got := strings.Join(order, " "); got != "Identifier Identifier InfixExpression" {
+		t.Errorf("wrong modify order. got=%q", got)
+	}
+}
+
+func TestChildren(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	block := &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: ident("b")}}}
+	other := &BlockStatement{}
+
+	tests := []struct {
+		node     Node
+		expected []Node
+	}{
+		{&IfExpression{Condition: ident("a"), Consequence: block}, []Node{ident("a"), block}},
+		{&IfExpression{Condition: ident("a"), Consequence: block, Alternative: other}, []Node{ident("a"), block, other}},
+		{&CallExpression{Function: ident("f"), Arguments: []Expression{ident("x"), ident("y")}},
+			[]Node{ident("f"), ident("x"), ident("y")}},
+		{&HashLiteral{Pairs: []HashPair{{Key: ident("k"), Value: ident("v")}}}, []Node{ident("k"), ident("v")}},
+		{&LetStatement{Name: ident("x"), Value: (*Identifier)(nil)}, []Node{ident("x")}},
+		{&PrefixExpression{Operator: "-"}, nil},
+		{ident("a"), nil},
+		{nil, nil},
+	}
+
+	for i, tt := range tests {
+		got := Children(tt.node)
+		if len(got) != len(tt.expected) {
+			t.Errorf("tests[%d]: wrong number of children. want=%d, got=%d", i, len(tt.expected), len(got))
+			continue
+		}
+		for j := range got {
+			if !Equal(got[j], tt.expected[j]) {
+				t.Errorf("tests[%d]: children[%d] wrong. want=%s, got=%s", i, j, tt.expected[j].Kind(), got[j].Kind())
+			}
+		}
+	}
+}
+
+func TestStringWithMissingChildren(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+
+	tests := []struct {
+		node     Node
+		expected string
+	}{
+		{&PrefixExpression{Operator: "-"}, "(-<missing>)"},
+		{&InfixExpression{Left: ident("a"), Operator: "+"}, "(a + <missing>)"},
+		{&InfixExpression{Left: (*Identifier)(nil), Operator: "*", Right: ident("b")}, "(<missing> * b)"},
+		{&IndexExpression{Left: ident("a")}, "(a[<missing>])"},
+		{&IndexExpression{Token: token.Token{Type: token.DOT, Literal: "."}}, "(<missing>.<missing>)"},
+		{&CallExpression{Arguments: []Expression{nil, ident("x")}}, "<missing>(<missing>, x)"},
+		{&IfExpression{Token: token.Token{Type: token.IF, Literal: "if"}}, "if (<missing>) { <missing> }"},
+		{&FunctionLiteral{Token: token.Token{Type: token.FUNCTION, Literal: "fn"}}, "fn() { <missing> }"},
+		{&LetStatement{Token: token.Token{Type: token.LET, Literal: "let"}, Value: ident("x")}, "let <missing> = x;"},
+		{&ReturnStatement{Token: token.Token{Type: token.RETURN, Literal: "return"}, ReturnValue: (*CallExpression)(nil)}, "return <missing>;"},
+		{&HashLiteral{Pairs: []HashPair{{Key: ident("k")}}}, "{k:<missing>}"},
+		{&ArrayLiteral{Elements: []Expression{nil}}, "[<missing>]"},
+		{&SpreadExpression{}, "<missing>..."},
+		{&ExpressionStatement{Expression: (*Identifier)(nil)}, ""},
+		{&Program{Statements: []Statement{nil, &ExpressionStatement{Expression: ident("a")}}}, "<missing>; a"},
+	}
+
+	for i, tt := range tests {
+		if got := tt.node.String(); got != tt.expected {
+			t.Errorf("tests[%d]: String() wrong. want=%q, got=%q", i, tt.expected, got)
+		}
+	}
+}
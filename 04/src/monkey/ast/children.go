@@ -0,0 +1,155 @@
+package ast
+
+// Children 返回节点的直接子节点，顺序与它们在源代码中出现的顺序一致
+// 为nil的子节点（如没有else分支时的Alternative、解析出错后残留的空节点）不包含在结果中；
+// 哈希字面量按键、值、键、值……的顺序返回；Walk和Inspect都基于本函数实现
+// 参数 node: 要查询的节点
+// 返回值: 子节点列表，叶子节点或node为nil时返回nil
+func Children(node Node) []Node {
+	if isNilNode(node) {
+		return nil
+	}
+
+	var c children
+	switch n := node.(type) {
+	// 语句
+	case *Program:
+		for _, stmt := range n.Statements {
+			c.add(stmt)
+		}
+
+	case *LetStatement:
+		c.add(n.Name)
+		c.add(n.Pattern)
+		c.add(n.Value)
+
+	case *MultiLetStatement:
+		for _, name := range n.Names {
+			c.add(name)
+		}
+		for _, value := range n.Values {
+			c.add(value)
+		}
+
+	case *ReturnStatement:
+		c.add(n.ReturnValue)
+
+	case *BreakStatement, *ContinueStatement:
+		// 叶子节点，没有子节点
+
+	case *ExpressionStatement:
+		c.add(n.Expression)
+
+	case *BlockStatement:
+		for _, stmt := range n.Statements {
+			c.add(stmt)
+		}
+
+	// 解构模式
+	case *ArrayPattern:
+		for _, name := range n.Names {
+			c.add(name)
+		}
+
+	case *HashPattern:
+		for _, name := range n.Names {
+			c.add(name)
+		}
+
+	// 表达式
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean:
+		// 叶子节点，没有子节点
+
+	case *PrefixExpression:
+		c.add(n.Right)
+
+	case *InfixExpression:
+		c.add(n.Left)
+		c.add(n.Right)
+
+	case *IfExpression:
+		c.add(n.Condition)
+		c.add(n.Consequence)
+		c.add(n.Alternative)
+
+	case *WhileExpression:
+		c.add(n.Condition)
+		c.add(n.Body)
+
+	case *ForExpression:
+		c.add(n.Init)
+		c.add(n.Condition)
+		c.add(n.Post)
+		c.add(n.Body)
+
+	case *SwitchExpression:
+		c.add(n.Subject)
+		for _, sc := range n.Cases {
+			for _, v := range sc.Values {
+				c.add(v)
+			}
+			c.add(sc.Body)
+		}
+		c.add(n.Default)
+
+	case *TryExpression:
+		c.add(n.Body)
+		c.add(n.Param)
+		c.add(n.Rescue)
+
+	case *AssignExpression:
+		c.add(n.Target)
+		c.add(n.Value)
+
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			c.add(param)
+		}
+		c.add(n.Body)
+
+	case *MacroLiteral:
+		for _, param := range n.Parameters {
+			c.add(param)
+		}
+		c.add(n.Body)
+
+	case *CallExpression:
+		c.add(n.Function)
+		for _, arg := range n.Arguments {
+			c.add(arg)
+		}
+
+	case *SpreadExpression:
+		c.add(n.Value)
+
+	case *ArrayLiteral:
+		for _, elem := range n.Elements {
+			c.add(elem)
+		}
+
+	case *IndexExpression:
+		c.add(n.Left)
+		c.add(n.Index)
+
+	case *SliceExpression:
+		c.add(n.Left)
+		c.add(n.Low)
+		c.add(n.High)
+
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			c.add(pair.Key)
+			c.add(pair.Value)
+		}
+	}
+	return c
+}
+
+// children 收集子节点时跳过nil，包括包装在接口中的带类型nil指针
+type children []Node
+
+func (c *children) add(node Node) {
+	if !isNilNode(node) {
+		*c = append(*c, node)
+	}
+}
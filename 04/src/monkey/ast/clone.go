@@ -0,0 +1,266 @@
+package ast
+
+// Clone 深度复制一棵抽象语法树
+// 所有节点、切片（语句、参数、实参、数组元素、哈希键值对等）都会重新分配，
+// 修改复制结果不会影响原来的树；token.Token 是值类型，直接复制；注释也会被复制
+// 参数 node: 要复制的节点
+// 返回值: 复制得到的节点，node为nil时返回nil
+func Clone(node Node) Node {
+	switch node := node.(type) {
+	case nil:
+		return nil
+	case *Program:
+		return &Program{
+			Statements: cloneStatements(node.Statements),
+			Comments:   cloneComments(node.Comments),
+		}
+	case Statement:
+		return cloneStatement(node)
+	case Expression:
+		return cloneExpression(node)
+	}
+	return nil
+}
+
+// cloneStatement 深度复制语句节点
+func cloneStatement(stmt Statement) Statement {
+	switch stmt := stmt.(type) {
+	case *LetStatement:
+		return &LetStatement{
+			Token:   stmt.Token,
+			Name:    cloneIdentifier(stmt.Name),
+			Pattern: cloneExpression(stmt.Pattern),
+			Value:   cloneExpression(stmt.Value),
+			Doc:     cloneComments(stmt.Doc),
+		}
+	case *MultiLetStatement:
+		return &MultiLetStatement{
+			Token:  stmt.Token,
+			Names:  cloneIdentifiers(stmt.Names),
+			Values: cloneExpressions(stmt.Values),
+			Doc:    cloneComments(stmt.Doc),
+		}
+	case *ReturnStatement:
+		return &ReturnStatement{
+			Token:       stmt.Token,
+			ReturnValue: cloneExpression(stmt.ReturnValue),
+			Doc:         cloneComments(stmt.Doc),
+		}
+	case *BreakStatement:
+		return &BreakStatement{Token: stmt.Token, Doc: cloneComments(stmt.Doc)}
+	case *ContinueStatement:
+		return &ContinueStatement{Token: stmt.Token, Doc: cloneComments(stmt.Doc)}
+	case *ExpressionStatement:
+		return &ExpressionStatement{
+			Token:      stmt.Token,
+			Expression: cloneExpression(stmt.Expression),
+			Doc:        cloneComments(stmt.Doc),
+		}
+	case *BlockStatement:
+		return cloneBlock(stmt)
+	}
+	return nil
+}
+
+// cloneExpression 深度复制表达式节点
+func cloneExpression(exp Expression) Expression {
+	switch exp := exp.(type) {
+	case *Identifier:
+		return cloneIdentifier(exp)
+	case *IntegerLiteral:
+		return &IntegerLiteral{Token: exp.Token, Value: exp.Value}
+	case *FloatLiteral:
+		return &FloatLiteral{Token: exp.Token, Value: exp.Value}
+	case *StringLiteral:
+		return &StringLiteral{Token: exp.Token, Value: exp.Value}
+	case *Boolean:
+		return &Boolean{Token: exp.Token, Value: exp.Value}
+	case *PrefixExpression:
+		return &PrefixExpression{
+			Token:    exp.Token,
+			Operator: exp.Operator,
+			Right:    cloneExpression(exp.Right),
+		}
+	case *InfixExpression:
+		return &InfixExpression{
+			Token:    exp.Token,
+			Left:     cloneExpression(exp.Left),
+			Operator: exp.Operator,
+			Right:    cloneExpression(exp.Right),
+		}
+	case *IfExpression:
+		return &IfExpression{
+			Token:       exp.Token,
+			Condition:   cloneExpression(exp.Condition),
+			Consequence: cloneBlock(exp.Consequence),
+			Alternative: cloneBlock(exp.Alternative),
+		}
+	case *WhileExpression:
+		return &WhileExpression{
+			Token:     exp.Token,
+			Condition: cloneExpression(exp.Condition),
+			Body:      cloneBlock(exp.Body),
+		}
+	case *ForExpression:
+		return &ForExpression{
+			Token:     exp.Token,
+			Init:      cloneStatement(exp.Init),
+			Condition: cloneExpression(exp.Condition),
+			Post:      cloneExpression(exp.Post),
+			Body:      cloneBlock(exp.Body),
+		}
+	case *SwitchExpression:
+		var cases []SwitchCase
+		if exp.Cases != nil {
+			cases = make([]SwitchCase, len(exp.Cases))
+			for i, c := range exp.Cases {
+				cases[i] = SwitchCase{Token: c.Token, Values: cloneExpressions(c.Values), Body: cloneBlock(c.Body)}
+			}
+		}
+		return &SwitchExpression{
+			Token:   exp.Token,
+			Subject: cloneExpression(exp.Subject),
+			Cases:   cases,
+			Default: cloneBlock(exp.Default),
+			RBrace:  exp.RBrace,
+		}
+	case *TryExpression:
+		return &TryExpression{
+			Token:  exp.Token,
+			Body:   cloneBlock(exp.Body),
+			Param:  cloneIdentifier(exp.Param),
+			Rescue: cloneBlock(exp.Rescue),
+		}
+	case *AssignExpression:
+		return &AssignExpression{
+			Token:  exp.Token,
+			Target: cloneExpression(exp.Target),
+			Value:  cloneExpression(exp.Value),
+		}
+	case *FunctionLiteral:
+		return &FunctionLiteral{
+			Token:      exp.Token,
+			Parameters: cloneIdentifiers(exp.Parameters),
+			Body:       cloneBlock(exp.Body),
+			Name:       exp.Name,
+		}
+	case *MacroLiteral:
+		return &MacroLiteral{
+			Token:      exp.Token,
+			Parameters: cloneIdentifiers(exp.Parameters),
+			Body:       cloneBlock(exp.Body),
+		}
+	case *CallExpression:
+		return &CallExpression{
+			Token:     exp.Token,
+			Function:  cloneExpression(exp.Function),
+			Arguments: cloneExpressions(exp.Arguments),
+			RParen:    exp.RParen,
+		}
+	case *SpreadExpression:
+		return &SpreadExpression{Token: exp.Token, Value: cloneExpression(exp.Value)}
+	case *ArrayLiteral:
+		return &ArrayLiteral{
+			Token:    exp.Token,
+			Elements: cloneExpressions(exp.Elements),
+			RBracket: exp.RBracket,
+		}
+	case *IndexExpression:
+		return &IndexExpression{
+			Token:    exp.Token,
+			Left:     cloneExpression(exp.Left),
+			Index:    cloneExpression(exp.Index),
+			RBracket: exp.RBracket,
+		}
+	case *SliceExpression:
+		return &SliceExpression{
+			Token:    exp.Token,
+			Left:     cloneExpression(exp.Left),
+			Low:      cloneExpression(exp.Low),
+			High:     cloneExpression(exp.High),
+			RBracket: exp.RBracket,
+		}
+	case *HashLiteral:
+		var pairs []HashPair
+		if exp.Pairs != nil {
+			pairs = make([]HashPair, len(exp.Pairs))
+			for i, pair := range exp.Pairs {
+				pairs[i] = HashPair{Key: cloneExpression(pair.Key), Value: cloneExpression(pair.Value)}
+			}
+		}
+		return &HashLiteral{Token: exp.Token, Pairs: pairs, RBrace: exp.RBrace}
+	case *ArrayPattern:
+		return &ArrayPattern{Token: exp.Token, Names: cloneIdentifiers(exp.Names), RBracket: exp.RBracket}
+	case *HashPattern:
+		return &HashPattern{Token: exp.Token, Names: cloneIdentifiers(exp.Names), RBrace: exp.RBrace}
+	}
+	return nil
+}
+
+// cloneBlock 深度复制语句块，block为nil时返回nil
+func cloneBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	return &BlockStatement{
+		Token:      block.Token,
+		Statements: cloneStatements(block.Statements),
+		RBrace:     block.RBrace,
+	}
+}
+
+// cloneIdentifier 复制标识符，ident为nil时返回nil
+func cloneIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	return &Identifier{Token: ident.Token, Value: ident.Value}
+}
+
+// cloneStatements 复制语句切片，保持nil切片为nil
+func cloneStatements(stmts []Statement) []Statement {
+	if stmts == nil {
+		return nil
+	}
+	out := make([]Statement, len(stmts))
+	for i, stmt := range stmts {
+		out[i] = cloneStatement(stmt)
+	}
+	return out
+}
+
+// cloneExpressions 复制表达式切片，保持nil切片为nil
+func cloneExpressions(exps []Expression) []Expression {
+	if exps == nil {
+		return nil
+	}
+	out := make([]Expression, len(exps))
+	for i, exp := range exps {
+		out[i] = cloneExpression(exp)
+	}
+	return out
+}
+
+// cloneComments 复制注释切片，保持nil切片为nil
+func cloneComments(comments []*Comment) []*Comment {
+	if comments == nil {
+		return nil
+	}
+	out := make([]*Comment, len(comments))
+	for i, c := range comments {
+		out[i] = &Comment{Token: c.Token, Text: c.Text}
+	}
+	return out
+}
+
+// cloneIdentifiers 复制标识符切片，保持nil切片为nil
+func cloneIdentifiers(idents []*Identifier) []*Identifier {
+	if idents == nil {
+		return nil
+	}
+	out := make([]*Identifier, len(idents))
+	for i, ident := range idents {
+		out[i] = cloneIdentifier(ident)
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package ast
+
+import "monkey/token"
+
+// Comment 表示源代码中的一条注释
+// 注释不是语法树的一部分：Walk 不会访问它们，Equal 也不比较它们；
+// String() 输出在一行之内，无法容纳行注释，因此只有 Format 会重新输出注释
+type Comment struct {
+	Token token.Token // COMMENT 词法标记，记录注释的位置
+	Text  string      // 注释原文，包含开头的 #
+}
+
+func (c *Comment) Pos() token.Position { return c.Token.Pos() }
+func (c *Comment) End() token.Position { return c.Token.Pos() }
+
+// Doc 返回语句的文档注释，即紧挨在语句上方、单独成行的注释
+// 参数 stmt: 语句节点
+// 返回值: 文档注释列表，没有文档注释时返回nil
+func Doc(stmt Statement) []*Comment {
+	switch stmt := stmt.(type) {
+	case *LetStatement:
+		return stmt.Doc
+	case *MultiLetStatement:
+		return stmt.Doc
+	case *ReturnStatement:
+		return stmt.Doc
+	case *BreakStatement:
+		return stmt.Doc
+	case *ContinueStatement:
+		return stmt.Doc
+	case *ExpressionStatement:
+		return stmt.Doc
+	}
+	return nil
+}
+
+// collectComments 返回格式化节点时需要输出的注释，按出现顺序排列
+// 程序节点使用解析时收集的全部注释，其余节点只能使用各条语句的文档注释
+func collectComments(node Node) []*Comment {
+	if program, ok := node.(*Program); ok {
+		return append([]*Comment(nil), program.Comments...)
+	}
+
+	var comments []*Comment
+	Inspect(node, func(n Node) bool {
+		if stmt, ok := n.(Statement); ok {
+			comments = append(comments, Doc(stmt)...)
+		}
+		return n != nil
+	})
+	return comments
+}
@@ -0,0 +1,178 @@
+package ast
+
+import "reflect"
+
+// Equal 判断两棵抽象语法树在结构上是否相同
+// 比较节点类型、运算符、字面量的值以及所有子节点，忽略token（包括位置和字面写法）和注释，
+// 因此 a.b 与 a["b"]、{name: 1} 与 {"name": 1} 被视为相同；
+// 两侧都为nil时相同，只有一侧为nil（如只有一侧有else分支）时不同
+// 参数 a, b: 要比较的两个节点
+// 返回值: 结构相同时返回true
+func Equal(a, b Node) bool {
+	if isNilNode(a) || isNilNode(b) {
+		return isNilNode(a) && isNilNode(b)
+	}
+
+	switch a := a.(type) {
+	case *Program:
+		b, ok := b.(*Program)
+		return ok && equalStatements(a.Statements, b.Statements)
+	case *LetStatement:
+		b, ok := b.(*LetStatement)
+		return ok && a.IsConst() == b.IsConst() &&
+			Equal(a.Name, b.Name) && Equal(a.Pattern, b.Pattern) && Equal(a.Value, b.Value)
+	case *MultiLetStatement:
+		b, ok := b.(*MultiLetStatement)
+		return ok && equalIdentifiers(a.Names, b.Names) &&
+			(a.Values == nil) == (b.Values == nil) && equalExpressions(a.Values, b.Values)
+	case *ReturnStatement:
+		b, ok := b.(*ReturnStatement)
+		return ok && Equal(a.ReturnValue, b.ReturnValue)
+	case *BreakStatement:
+		_, ok := b.(*BreakStatement)
+		return ok
+	case *ContinueStatement:
+		_, ok := b.(*ContinueStatement)
+		return ok
+	case *ExpressionStatement:
+		b, ok := b.(*ExpressionStatement)
+		return ok && Equal(a.Expression, b.Expression)
+	case *BlockStatement:
+		b, ok := b.(*BlockStatement)
+		return ok && equalStatements(a.Statements, b.Statements)
+	case *Identifier:
+		b, ok := b.(*Identifier)
+		return ok && a.Value == b.Value
+	case *IntegerLiteral:
+		b, ok := b.(*IntegerLiteral)
+		return ok && a.Value == b.Value
+	case *FloatLiteral:
+		b, ok := b.(*FloatLiteral)
+		return ok && a.Value == b.Value
+	case *StringLiteral:
+		b, ok := b.(*StringLiteral)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *PrefixExpression:
+		b, ok := b.(*PrefixExpression)
+		return ok && a.Operator == b.Operator && Equal(a.Right, b.Right)
+	case *InfixExpression:
+		b, ok := b.(*InfixExpression)
+		return ok && a.Operator == b.Operator && Equal(a.Left, b.Left) && Equal(a.Right, b.Right)
+	case *IfExpression:
+		b, ok := b.(*IfExpression)
+		return ok && Equal(a.Condition, b.Condition) &&
+			Equal(a.Consequence, b.Consequence) && Equal(a.Alternative, b.Alternative)
+	case *WhileExpression:
+		b, ok := b.(*WhileExpression)
+		return ok && Equal(a.Condition, b.Condition) && Equal(a.Body, b.Body)
+	case *ForExpression:
+		b, ok := b.(*ForExpression)
+		return ok && Equal(a.Init, b.Init) && Equal(a.Condition, b.Condition) &&
+			Equal(a.Post, b.Post) && Equal(a.Body, b.Body)
+	case *SwitchExpression:
+		b, ok := b.(*SwitchExpression)
+		if !ok || len(a.Cases) != len(b.Cases) ||
+			!Equal(a.Subject, b.Subject) || !Equal(a.Default, b.Default) {
+			return false
+		}
+		for i := range a.Cases {
+			if !equalExpressions(a.Cases[i].Values, b.Cases[i].Values) || !Equal(a.Cases[i].Body, b.Cases[i].Body) {
+				return false
+			}
+		}
+		return true
+	case *TryExpression:
+		b, ok := b.(*TryExpression)
+		return ok && Equal(a.Body, b.Body) && Equal(a.Param, b.Param) && Equal(a.Rescue, b.Rescue)
+	case *AssignExpression:
+		b, ok := b.(*AssignExpression)
+		return ok && Equal(a.Target, b.Target) && Equal(a.Value, b.Value)
+	case *FunctionLiteral:
+		b, ok := b.(*FunctionLiteral)
+		return ok && equalIdentifiers(a.Parameters, b.Parameters) && Equal(a.Body, b.Body)
+	case *MacroLiteral:
+		b, ok := b.(*MacroLiteral)
+		return ok && equalIdentifiers(a.Parameters, b.Parameters) && Equal(a.Body, b.Body)
+	case *CallExpression:
+		b, ok := b.(*CallExpression)
+		return ok && Equal(a.Function, b.Function) && equalExpressions(a.Arguments, b.Arguments)
+	case *SpreadExpression:
+		b, ok := b.(*SpreadExpression)
+		return ok && Equal(a.Value, b.Value)
+	case *ArrayLiteral:
+		b, ok := b.(*ArrayLiteral)
+		return ok && equalExpressions(a.Elements, b.Elements)
+	case *IndexExpression:
+		b, ok := b.(*IndexExpression)
+		return ok && Equal(a.Left, b.Left) && Equal(a.Index, b.Index)
+	case *SliceExpression:
+		b, ok := b.(*SliceExpression)
+		return ok && Equal(a.Left, b.Left) && Equal(a.Low, b.Low) && Equal(a.High, b.High)
+	case *HashLiteral:
+		b, ok := b.(*HashLiteral)
+		if !ok || len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		for i := range a.Pairs {
+			if !Equal(a.Pairs[i].Key, b.Pairs[i].Key) || !Equal(a.Pairs[i].Value, b.Pairs[i].Value) {
+				return false
+			}
+		}
+		return true
+	case *ArrayPattern:
+		b, ok := b.(*ArrayPattern)
+		return ok && equalIdentifiers(a.Names, b.Names)
+	case *HashPattern:
+		b, ok := b.(*HashPattern)
+		return ok && equalIdentifiers(a.Names, b.Names)
+	}
+	return false
+}
+
+// isNilNode 判断节点是否为nil，包括包装在接口中的带类型nil指针
+func isNilNode(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+func equalStatements(a, b []Statement) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalExpressions(a, b []Expression) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalIdentifiers(a, b []*Identifier) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
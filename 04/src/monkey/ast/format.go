@@ -0,0 +1,615 @@
+package ast
+
+import (
+	"bytes"
+	"monkey/lexer"
+	"monkey/token"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// indentUnit 是格式化输出中每一层语句块的缩进
+const indentUnit = "  "
+
+// lineWidth 是格式化输出的目标行宽，超过行宽的哈希字面量拆成多行
+const lineWidth = 80
+
+// binaryPrecedences 是格式化时判断是否需要加括号所用的中缀运算符优先级
+// 数值越大绑定越紧密，与语法分析器中的优先级顺序一致
+var binaryPrecedences = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3,
+	"!=": 3,
+	"<":  4,
+	">":  4,
+	"<=": 4,
+	">=": 4,
+	"+":  5,
+	"-":  5,
+	"*":  6,
+	"/":  6,
+	"%":  6,
+	"//": 6,
+}
+
+// maxBinaryPrecedence 是binaryPrecedences中的最高优先级
+const maxBinaryPrecedence = 6
+
+// Format 把抽象语法树格式化为便于阅读的Monkey源代码
+// 每条语句单独一行并以分号结尾，语句块使用两个空格缩进，逗号后加空格，
+// 表达式只在改变运算顺序时才加括号；与String()不同，输出的是合法的Monkey代码
+// 放不进一行（超过lineWidth）的哈希字面量每个键值对占一行；语句之间最多保留一个空行
+// 注释尽量保留在原来的位置：语句上方的注释单独成行，行尾注释跟在语句后面，
+// 其余表达式内部的注释移到下一条语句之前
+// 输出只取决于语法树和注释的相对位置，因此格式化已格式化过的代码会得到相同的结果
+// 参数 node: 要格式化的节点
+// 返回值: 格式化后的源代码，节点为nil时返回空字符串
+func Format(node Node) string {
+	if node == nil {
+		return ""
+	}
+
+	f := &formatter{comments: collectComments(node)}
+	f.node(node)
+	return f.out.String()
+}
+
+// formatter 保存格式化过程中的输出缓冲区、当前缩进层数和尚未输出的注释
+type formatter struct {
+	out      bytes.Buffer
+	indent   int
+	comments []*Comment
+
+	// line 是最近输出的语句或注释在源代码中的结束行号，用于判断两者之间是否有空行；
+	// 0 表示不保留空行（如语句块的开头）
+	line int
+}
+
+func (f *formatter) write(s string) {
+	f.out.WriteString(s)
+}
+
+// indentation 返回当前缩进层数对应的缩进
+func (f *formatter) indentation() string {
+	return strings.Repeat(indentUnit, f.indent)
+}
+
+// column 返回输出中当前行已有的字符数
+func (f *formatter) column() int {
+	b := f.out.Bytes()
+	return utf8.RuneCount(b[bytes.LastIndexByte(b, '\n')+1:])
+}
+
+// node 格式化任意节点：语句按语句格式输出，其余按表达式输出
+func (f *formatter) node(node Node) {
+	switch node := node.(type) {
+	case *Program:
+		for i, stmt := range node.Statements {
+			if i > 0 {
+				f.write("\n")
+			}
+			f.statementLine(stmt, nextPos(node.Statements, i))
+		}
+		// 最后一条语句之后的注释
+		for len(f.comments) > 0 {
+			if f.out.Len() > 0 {
+				f.write("\n")
+			}
+			f.blankLine(f.comments[0].Pos())
+			f.comment(f.comments[0])
+			f.comments = f.comments[1:]
+		}
+	case *BlockStatement:
+		f.block(node)
+	case Statement:
+		f.statementLine(node, token.Position{})
+	case Expression:
+		f.expression(node)
+	}
+}
+
+// statementLine 格式化语句及其前后的注释，包括行首的缩进，不含行尾的换行
+// 参数 limit: 下一个token的位置，行尾注释必须在它之前；零值表示没有限制
+func (f *formatter) statementLine(stmt Statement, limit token.Position) {
+	f.leadingComments(stmt.Pos())
+	f.blankLine(stmt.Pos())
+	f.write(f.indentation())
+	f.statement(stmt)
+
+	end := stmt.End()
+	f.line = end.Line
+	f.trailingComment(end, limit)
+}
+
+// leadingComments 输出位置在pos之前的注释，每条注释单独一行
+func (f *formatter) leadingComments(pos token.Position) {
+	for len(f.comments) > 0 && f.comments[0].Pos().Before(pos) {
+		c := f.comments[0]
+		f.comments = f.comments[1:]
+		f.blankLine(c.Pos())
+		f.write(f.indentation())
+		f.comment(c)
+		f.write("\n")
+	}
+}
+
+// trailingComment 输出与end同一行、位于end之后且在limit之前的行尾注释
+func (f *formatter) trailingComment(end, limit token.Position) {
+	for i, c := range f.comments {
+		if c.Pos().Line == end.Line && end.Before(c.Pos()) &&
+			(!limit.IsValid() || c.Pos().Before(limit)) {
+			f.write(" ")
+			f.comment(c)
+			f.comments = append(f.comments[:i], f.comments[i+1:]...)
+			return
+		}
+	}
+}
+
+// comment 输出一条注释，去掉行尾的空白
+func (f *formatter) comment(c *Comment) {
+	f.write(strings.TrimRight(c.Text, " \t\r"))
+	f.line = c.Pos().Line
+}
+
+// blankLine 源代码中pos与上一条语句或注释之间有空行时输出一个空行
+func (f *formatter) blankLine(pos token.Position) {
+	if f.line > 0 && pos.Line > f.line+1 {
+		f.write("\n")
+	}
+	f.line = pos.Line
+}
+
+// nextPos 返回第i条语句之后那条语句的起始位置，没有后续语句时返回零值
+func nextPos(stmts []Statement, i int) token.Position {
+	if i+1 < len(stmts) {
+		return stmts[i+1].Pos()
+	}
+	return token.Position{}
+}
+
+// statement 格式化单条语句，末尾带分号，不含缩进和换行
+func (f *formatter) statement(stmt Statement) {
+	switch stmt := stmt.(type) {
+	case *LetStatement:
+		if stmt.IsConst() {
+			f.write("const ")
+		} else {
+			f.write("let ")
+		}
+		if stmt.Pattern != nil {
+			f.expression(stmt.Pattern)
+		} else {
+			f.expression(stmt.Name)
+		}
+		if stmt.Value != nil {
+			f.write(" = ")
+			f.expression(stmt.Value)
+		}
+	case *MultiLetStatement:
+		f.write("let ")
+		for i, name := range stmt.Names {
+			if i > 0 {
+				f.write(", ")
+			}
+			f.expression(name)
+		}
+		if stmt.Values != nil {
+			f.write(" = ")
+			f.expressionList(stmt.Values)
+		}
+	case *ReturnStatement:
+		f.write("return")
+		if stmt.ReturnValue != nil {
+			f.write(" ")
+			f.expression(stmt.ReturnValue)
+		}
+	case *BreakStatement:
+		f.write("break")
+	case *ContinueStatement:
+		f.write("continue")
+	case *ExpressionStatement:
+		if stmt.Expression != nil {
+			f.expression(stmt.Expression)
+		}
+	case *BlockStatement:
+		f.block(stmt)
+		return
+	}
+	f.write(";")
+}
+
+// block 格式化语句块：花括号内每条语句单独一行并增加一层缩进
+func (f *formatter) block(block *BlockStatement) {
+	end := block.End()
+	if len(block.Statements) == 0 && !f.hasCommentBefore(end) {
+		f.write("{ }")
+		return
+	}
+
+	f.write("{\n")
+	f.indent++
+	f.line = 0
+	for i, stmt := range block.Statements {
+		limit := nextPos(block.Statements, i)
+		if !limit.IsValid() {
+			limit = end
+		}
+		f.statementLine(stmt, limit)
+		f.write("\n")
+	}
+	// 右花括号之前剩余的注释放在语句块的末尾
+	f.leadingComments(end)
+	f.indent--
+	f.write(f.indentation() + "}")
+	f.line = end.Line
+}
+
+// hasCommentBefore 判断是否还有位置在pos之前、尚未输出的注释
+func (f *formatter) hasCommentBefore(pos token.Position) bool {
+	return len(f.comments) > 0 && f.comments[0].Pos().Before(pos)
+}
+
+// hash 格式化哈希字面量
+// 能放进当前行时写成一行，否则（或者其中有注释时）每个键值对单独一行，末尾带逗号
+func (f *formatter) hash(exp *HashLiteral) {
+	if len(exp.Pairs) == 0 {
+		f.write("{}")
+		return
+	}
+
+	if !f.hasCommentBefore(exp.End()) {
+		inline := &formatter{indent: f.indent}
+		inline.hashInline(exp)
+		if s := inline.out.String(); !strings.Contains(s, "\n") && f.column()+utf8.RuneCountInString(s) <= lineWidth {
+			f.write(s)
+			return
+		}
+	}
+
+	f.write("{\n")
+	f.indent++
+	f.line = 0
+	for i, pair := range exp.Pairs {
+		f.leadingComments(pair.Key.Pos())
+		f.write(f.indentation())
+		f.hashPair(pair)
+		f.write(",")
+
+		limit := exp.RBrace.Pos()
+		if i+1 < len(exp.Pairs) {
+			limit = exp.Pairs[i+1].Key.Pos()
+		}
+		f.trailingComment(pair.Value.End(), limit)
+		f.write("\n")
+	}
+	f.leadingComments(exp.End())
+	f.indent--
+	f.write(f.indentation() + "}")
+}
+
+// hashInline 把哈希字面量写成一行
+func (f *formatter) hashInline(exp *HashLiteral) {
+	f.write("{")
+	for i, pair := range exp.Pairs {
+		if i > 0 {
+			f.write(", ")
+		}
+		f.hashPair(pair)
+	}
+	f.write("}")
+}
+
+func (f *formatter) hashPair(pair HashPair) {
+	// 裸标识符键保持原来的写法
+	if key, ok := pair.Key.(*StringLiteral); ok && key.Token.Type == token.IDENT {
+		f.write(key.Value)
+	} else {
+		f.expression(pair.Key)
+	}
+	f.write(": ")
+	f.expression(pair.Value)
+}
+
+// template 把插值字符串展开后的 + 表达式链还原为插值写法，插值中的表达式同样格式化
+func (f *formatter) template(exp *InfixExpression) {
+	f.write(`"`)
+	f.templateParts(exp)
+	f.write(`"`)
+}
+
+func (f *formatter) templateParts(exp *InfixExpression) {
+	if left, ok := exp.Left.(*InfixExpression); ok && left.Token.Type == token.TEMPLATE {
+		f.templateParts(left)
+	} else {
+		f.templatePart(exp.Left)
+	}
+	f.templatePart(exp.Right)
+}
+
+func (f *formatter) templatePart(exp Expression) {
+	if sl, ok := exp.(*StringLiteral); ok && sl.Token.Type == token.TEMPLATE {
+		f.write(lexer.Escape(sl.Value))
+		return
+	}
+	f.write("${")
+	f.expression(exp)
+	f.write("}")
+}
+
+// expression 格式化表达式
+func (f *formatter) expression(exp Expression) {
+	switch exp := exp.(type) {
+	case *Identifier:
+		f.write(exp.Value)
+	case *IntegerLiteral:
+		f.write(strconv.FormatInt(exp.Value, 10))
+	case *FloatLiteral:
+		f.write(formatFloat(exp.Value))
+	case *Boolean:
+		f.write(strconv.FormatBool(exp.Value))
+	case *StringLiteral:
+		f.write(`"` + lexer.Escape(exp.Value) + `"`)
+	case *PrefixExpression:
+		f.write(exp.Operator)
+		f.operand(exp.Right, needsParensAsOperand(exp.Right))
+	case *InfixExpression:
+		f.infix(exp)
+	case *IfExpression:
+		f.ifExpression(exp)
+	case *WhileExpression:
+		f.write("while (")
+		f.expression(exp.Condition)
+		f.write(") ")
+		f.block(exp.Body)
+	case *ForExpression:
+		f.forExpression(exp)
+	case *SwitchExpression:
+		f.switchExpression(exp)
+	case *TryExpression:
+		f.write("try ")
+		f.block(exp.Body)
+		f.write(" rescue (")
+		f.expression(exp.Param)
+		f.write(") ")
+		f.block(exp.Rescue)
+	case *AssignExpression:
+		f.expression(exp.Target)
+		f.write(" = ")
+		f.expression(exp.Value)
+	case *FunctionLiteral:
+		f.write("fn(")
+		for i, param := range exp.Parameters {
+			if i > 0 {
+				f.write(", ")
+			}
+			f.expression(param)
+		}
+		f.write(") ")
+		f.block(exp.Body)
+	case *MacroLiteral:
+		f.write("macro(")
+		for i, param := range exp.Parameters {
+			if i > 0 {
+				f.write(", ")
+			}
+			f.expression(param)
+		}
+		f.write(") ")
+		f.block(exp.Body)
+	case *CallExpression:
+		// 源代码中写成 recv.f(x) 的调用保持方法调用语法
+		if isMethodCall(exp) {
+			recv := exp.Arguments[0]
+			f.operand(recv, needsParensAsOperand(recv))
+			f.write("." + exp.Function.(*Identifier).Value + "(")
+			f.expressionList(exp.Arguments[1:])
+			f.write(")")
+			return
+		}
+		// (obj.f)(x) 去掉括号后会变成方法调用语法 f(obj, x)，因此保留括号
+		dot, isDot := exp.Function.(*IndexExpression)
+		f.operand(exp.Function, needsParensAsOperand(exp.Function) || isDot && dot.Token.Type == token.DOT)
+		f.write("(")
+		f.expressionList(exp.Arguments)
+		f.write(")")
+	case *SpreadExpression:
+		f.operand(exp.Value, needsParensAsOperand(exp.Value))
+		f.write("...")
+	case *ArrayLiteral:
+		f.write("[")
+		f.expressionList(exp.Elements)
+		f.write("]")
+	case *IndexExpression:
+		f.operand(exp.Left, needsParensAsOperand(exp.Left))
+		if exp.Token.Type == token.DOT {
+			f.write("." + exp.Index.(*StringLiteral).Value)
+			return
+		}
+		f.write("[")
+		f.expression(exp.Index)
+		f.write("]")
+	case *SliceExpression:
+		f.operand(exp.Left, needsParensAsOperand(exp.Left))
+		f.write("[")
+		if exp.Low != nil {
+			f.expression(exp.Low)
+		}
+		f.write(":")
+		if exp.High != nil {
+			f.expression(exp.High)
+		}
+		f.write("]")
+	case *HashLiteral:
+		f.hash(exp)
+	case *ArrayPattern:
+		f.write("[")
+		f.identifierList(exp.Names)
+		f.write("]")
+	case *HashPattern:
+		f.write("{")
+		f.identifierList(exp.Names)
+		f.write("}")
+	default:
+		if exp != nil {
+			f.write(exp.String())
+		}
+	}
+}
+
+// infix 格式化中缀表达式，只在改变运算顺序时给操作数加括号
+// 运算符都是左结合的，因此右操作数在优先级相同时也需要括号
+func (f *formatter) infix(exp *InfixExpression) {
+	// 插值字符串的展开结果还原为插值写法
+	if exp.Token.Type == token.TEMPLATE {
+		f.template(exp)
+		return
+	}
+
+	prec := binaryPrecedences[exp.Operator]
+	f.operand(exp.Left, infixPrecedence(exp.Left) < prec)
+	f.write(" " + exp.Operator + " ")
+	f.operand(exp.Right, infixPrecedence(exp.Right) <= prec)
+}
+
+// ifExpression 格式化条件表达式，else if 链保持平铺的写法
+func (f *formatter) ifExpression(exp *IfExpression) {
+	f.write("if (")
+	f.expression(exp.Condition)
+	f.write(") ")
+	f.block(exp.Consequence)
+
+	if exp.Alternative == nil {
+		return
+	}
+	f.write(" else ")
+	if elseIf := exp.ElseIf(); elseIf != nil {
+		f.ifExpression(elseIf)
+	} else {
+		f.block(exp.Alternative)
+	}
+}
+
+// forExpression 格式化for循环表达式，省略的部分保持为空，如 for (;;)
+func (f *formatter) forExpression(exp *ForExpression) {
+	f.write("for (")
+	if exp.Init != nil {
+		// statement会输出结尾的分号
+		f.statement(exp.Init)
+	} else {
+		f.write(";")
+	}
+	if exp.Condition != nil {
+		f.write(" ")
+		f.expression(exp.Condition)
+	}
+	f.write(";")
+	if exp.Post != nil {
+		f.write(" ")
+		f.expression(exp.Post)
+	}
+	f.write(") ")
+	f.block(exp.Body)
+}
+
+// switchExpression 格式化switch表达式，每个分支单独一行并缩进一层
+func (f *formatter) switchExpression(exp *SwitchExpression) {
+	f.write("switch (")
+	f.expression(exp.Subject)
+	f.write(") {\n")
+	f.indent++
+	for _, c := range exp.Cases {
+		f.leadingComments(c.Token.Pos())
+		f.write(f.indentation() + "case ")
+		f.expressionList(c.Values)
+		f.write(" ")
+		f.block(c.Body)
+		f.write("\n")
+	}
+	if exp.Default != nil {
+		f.leadingComments(exp.Default.Pos())
+		f.write(f.indentation() + "default ")
+		f.block(exp.Default)
+		f.write("\n")
+	}
+	f.leadingComments(exp.RBrace.Pos())
+	f.indent--
+	f.write(f.indentation() + "}")
+	f.line = exp.RBrace.Pos().Line
+}
+
+// operand 格式化作为操作数的表达式，parens为true时外加括号
+func (f *formatter) operand(exp Expression, parens bool) {
+	if parens {
+		f.write("(")
+	}
+	f.expression(exp)
+	if parens {
+		f.write(")")
+	}
+}
+
+func (f *formatter) expressionList(list []Expression) {
+	for i, exp := range list {
+		if i > 0 {
+			f.write(", ")
+		}
+		f.expression(exp)
+	}
+}
+
+func (f *formatter) identifierList(names []*Identifier) {
+	for i, name := range names {
+		if i > 0 {
+			f.write(", ")
+		}
+		f.write(name.Value)
+	}
+}
+
+// formatFloat 把浮点数输出为Monkey的浮点数字面量写法，总是带小数点且不使用指数形式
+func formatFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// infixPrecedence 返回表达式作为中缀运算操作数时的优先级
+// 赋值绑定得比任何中缀运算符都松，其余非中缀表达式绑定得比任何中缀运算符都紧
+func infixPrecedence(exp Expression) int {
+	switch exp := exp.(type) {
+	case *InfixExpression:
+		if exp.Token.Type != token.TEMPLATE {
+			return binaryPrecedences[exp.Operator]
+		}
+	case *AssignExpression:
+		return 0
+	}
+	return maxBinaryPrecedence + 1
+}
+
+// isMethodCall 判断调用是否由方法调用语法 recv.f(args) 解析而来
+// 这种调用的第一个实参（接收者）在源代码中出现在函数名之前
+func isMethodCall(exp *CallExpression) bool {
+	if _, ok := exp.Function.(*Identifier); !ok || len(exp.Arguments) == 0 {
+		return false
+	}
+	recv := nodePos(exp.Arguments[0])
+	return recv.IsValid() && recv.Before(exp.Function.Pos())
+}
+
+// needsParensAsOperand 判断表达式作为前缀运算、调用、索引等的操作数时是否需要括号
+func needsParensAsOperand(exp Expression) bool {
+	switch exp := exp.(type) {
+	case *InfixExpression:
+		return exp.Token.Type != token.TEMPLATE
+	case *PrefixExpression, *IfExpression, *WhileExpression, *ForExpression, *SwitchExpression,
+		*TryExpression, *AssignExpression, *FunctionLiteral, *MacroLiteral:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package ast
+
+// kinds 列出所有节点类型的名称，顺序与 ast.go 中的定义一致
+var kinds = []string{
+	"Program",
+	"LetStatement",
+	"MultiLetStatement",
+	"ArrayPattern",
+	"HashPattern",
+	"ReturnStatement",
+	"BreakStatement",
+	"ContinueStatement",
+	"ExpressionStatement",
+	"BlockStatement",
+	"Identifier",
+	"Boolean",
+	"IntegerLiteral",
+	"FloatLiteral",
+	"PrefixExpression",
+	"InfixExpression",
+	"IfExpression",
+	"WhileExpression",
+	"ForExpression",
+	"SwitchExpression",
+	"TryExpression",
+	"AssignExpression",
+	"FunctionLiteral",
+	"MacroLiteral",
+	"CallExpression",
+	"SpreadExpression",
+	"StringLiteral",
+	"ArrayLiteral",
+	"IndexExpression",
+	"SliceExpression",
+	"HashLiteral",
+}
+
+// Kinds 返回所有节点类型的名称，即各节点 Kind() 可能返回的全部值
+// 返回的是副本，修改它不会影响之后的调用
+func Kinds() []string {
+	return append([]string(nil), kinds...)
+}
+
+func (p *Program) Kind() string              { return "Program" }
+func (ls *LetStatement) Kind() string        { return "LetStatement" }
+func (ms *MultiLetStatement) Kind() string   { return "MultiLetStatement" }
+func (ap *ArrayPattern) Kind() string        { return "ArrayPattern" }
+func (hp *HashPattern) Kind() string         { return "HashPattern" }
+func (rs *ReturnStatement) Kind() string     { return "ReturnStatement" }
+func (bs *BreakStatement) Kind() string      { return "BreakStatement" }
+func (cs *ContinueStatement) Kind() string   { return "ContinueStatement" }
+func (es *ExpressionStatement) Kind() string { return "ExpressionStatement" }
+func (bs *BlockStatement) Kind() string      { return "BlockStatement" }
+func (i *Identifier) Kind() string           { return "Identifier" }
+func (b *Boolean) Kind() string              { return "Boolean" }
+func (il *IntegerLiteral) Kind() string      { return "IntegerLiteral" }
+func (fl *FloatLiteral) Kind() string        { return "FloatLiteral" }
+func (pe *PrefixExpression) Kind() string    { return "PrefixExpression" }
+func (ie *InfixExpression) Kind() string     { return "InfixExpression" }
+func (ie *IfExpression) Kind() string        { return "IfExpression" }
+func (we *WhileExpression) Kind() string     { return "WhileExpression" }
+func (fe *ForExpression) Kind() string       { return "ForExpression" }
+func (se *SwitchExpression) Kind() string    { return "SwitchExpression" }
+func (te *TryExpression) Kind() string       { return "TryExpression" }
+func (ae *AssignExpression) Kind() string    { return "AssignExpression" }
+func (fl *FunctionLiteral) Kind() string     { return "FunctionLiteral" }
+func (ml *MacroLiteral) Kind() string        { return "MacroLiteral" }
+func (ce *CallExpression) Kind() string      { return "CallExpression" }
+func (se *SpreadExpression) Kind() string    { return "SpreadExpression" }
+func (sl *StringLiteral) Kind() string       { return "StringLiteral" }
+func (al *ArrayLiteral) Kind() string        { return "ArrayLiteral" }
+func (ie *IndexExpression) Kind() string     { return "IndexExpression" }
+func (se *SliceExpression) Kind() string     { return "SliceExpression" }
+func (hl *HashLiteral) Kind() string         { return "HashLiteral" }
@@ -0,0 +1,89 @@
+package ast
+
+import (
+	"monkey/token"
+	"reflect"
+)
+
+// Append 把语句追加到程序末尾
+// 语句和注释的位置保持不变，需要让位置连续时使用 Merge
+func (p *Program) Append(stmts ...Statement) {
+	p.Statements = append(p.Statements, stmts...)
+}
+
+// Merge 把多个程序按顺序合并为一个新程序，如把REPL中逐行输入的代码累积起来
+// 各程序先被复制，不会修改参数；后一个程序的行号整体后移，
+// 使它从前一个程序最后一条语句或注释的下一行开始，
+// 因此合并结果的位置、String() 和 Format 的输出与解析用换行拼接起来的源代码一致
+// 词法标记的字节偏移量不调整，Range 得到的仍是各自源代码中的字节范围
+// 参数 progs: 要合并的程序，nil会被跳过
+// 返回值: 合并后的程序，TokenLiteral 返回其中第一条语句的字面量
+func Merge(progs ...*Program) *Program {
+	merged := &Program{}
+	line := 0
+	for _, prog := range progs {
+		if prog == nil {
+			continue
+		}
+		clone := Clone(prog).(*Program)
+		shiftLines(clone, line)
+
+		merged.Append(clone.Statements...)
+		merged.Comments = append(merged.Comments, clone.Comments...)
+		if last := lastLine(clone); last > line {
+			line = last
+		}
+	}
+	return merged
+}
+
+// lastLine 返回程序中最后一条语句或注释所在的行号，程序为空时返回0
+func lastLine(p *Program) int {
+	line := p.End().Line
+	for _, c := range p.Comments {
+		if c.Pos().Line > line {
+			line = c.Pos().Line
+		}
+	}
+	return line
+}
+
+var (
+	tokenType    = reflect.TypeOf(token.Token{})
+	commentsType = reflect.TypeOf([]*Comment(nil))
+)
+
+// shiftLines 把语法树中所有词法标记和注释的行号加上delta，没有位置的词法标记保持不变
+// 通过反射找出节点中token.Token和注释类型的字段，新增节点类型时无需修改；
+// 注释不能与其他节点共享，否则会被移动两次
+func shiftLines(node Node, delta int) {
+	if delta == 0 {
+		return
+	}
+
+	shift := func(tok *token.Token) {
+		if tok.Line > 0 {
+			tok.Line += delta
+		}
+	}
+
+	Inspect(node, func(n Node) bool {
+		if isNilNode(n) {
+			return false
+		}
+		v := reflect.ValueOf(n).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			switch field.Type() {
+			case tokenType:
+				shift(field.Addr().Interface().(*token.Token))
+			case commentsType:
+				// 程序的注释列表和语句的文档注释；Clone 后两者是各自独立的副本
+				for _, c := range field.Interface().([]*Comment) {
+					shift(&c.Token)
+				}
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,148 @@
+package ast
+
+// ModifierFunc 是 Modify 对每个节点调用的改写函数
+// 返回值替换原来的节点，不需要改写时原样返回参数即可
+type ModifierFunc func(Node) Node
+
+// Modify 以后序遍历的方式改写抽象语法树
+// 先递归改写子节点并把结果写回父节点，再对节点本身调用modifier，返回modifier的结果；
+// 树被原地修改，需要保留原树时先用 Clone 复制；为nil的子节点保持nil；
+// 绑定的变量名（let和解构模式中的名称、函数形参）不会被改写
+// 参数 node: 要改写的节点
+// 参数 modifier: 改写函数
+// 返回值: 改写后的节点
+func Modify(node Node, modifier ModifierFunc) Node {
+	if isNilNode(node) {
+		return node
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for i, stmt := range node.Statements {
+			node.Statements[i] = modifyStatement(stmt, modifier)
+		}
+
+	case *LetStatement:
+		node.Value = modifyExpression(node.Value, modifier)
+
+	case *MultiLetStatement:
+		for i, value := range node.Values {
+			node.Values[i] = modifyExpression(value, modifier)
+		}
+
+	case *ReturnStatement:
+		node.ReturnValue = modifyExpression(node.ReturnValue, modifier)
+
+	case *ExpressionStatement:
+		node.Expression = modifyExpression(node.Expression, modifier)
+
+	case *BlockStatement:
+		for i, stmt := range node.Statements {
+			node.Statements[i] = modifyStatement(stmt, modifier)
+		}
+
+	case *PrefixExpression:
+		node.Right = modifyExpression(node.Right, modifier)
+
+	case *InfixExpression:
+		node.Left = modifyExpression(node.Left, modifier)
+		node.Right = modifyExpression(node.Right, modifier)
+
+	case *IfExpression:
+		node.Condition = modifyExpression(node.Condition, modifier)
+		node.Consequence = modifyBlock(node.Consequence, modifier)
+		node.Alternative = modifyBlock(node.Alternative, modifier)
+
+	case *WhileExpression:
+		node.Condition = modifyExpression(node.Condition, modifier)
+		node.Body = modifyBlock(node.Body, modifier)
+
+	case *ForExpression:
+		node.Init = modifyStatement(node.Init, modifier)
+		node.Condition = modifyExpression(node.Condition, modifier)
+		node.Post = modifyExpression(node.Post, modifier)
+		node.Body = modifyBlock(node.Body, modifier)
+
+	case *SwitchExpression:
+		node.Subject = modifyExpression(node.Subject, modifier)
+		for i, c := range node.Cases {
+			for j, value := range c.Values {
+				node.Cases[i].Values[j] = modifyExpression(value, modifier)
+			}
+			node.Cases[i].Body = modifyBlock(c.Body, modifier)
+		}
+		node.Default = modifyBlock(node.Default, modifier)
+
+	case *TryExpression:
+		node.Body = modifyBlock(node.Body, modifier)
+		node.Rescue = modifyBlock(node.Rescue, modifier)
+
+	case *AssignExpression:
+		node.Target = modifyExpression(node.Target, modifier)
+		node.Value = modifyExpression(node.Value, modifier)
+
+	case *FunctionLiteral:
+		node.Body = modifyBlock(node.Body, modifier)
+
+	case *MacroLiteral:
+		node.Body = modifyBlock(node.Body, modifier)
+
+	case *CallExpression:
+		node.Function = modifyExpression(node.Function, modifier)
+		for i, arg := range node.Arguments {
+			node.Arguments[i] = modifyExpression(arg, modifier)
+		}
+
+	case *SpreadExpression:
+		node.Value = modifyExpression(node.Value, modifier)
+
+	case *ArrayLiteral:
+		for i, elem := range node.Elements {
+			node.Elements[i] = modifyExpression(elem, modifier)
+		}
+
+	case *IndexExpression:
+		node.Left = modifyExpression(node.Left, modifier)
+		node.Index = modifyExpression(node.Index, modifier)
+
+	case *SliceExpression:
+		node.Left = modifyExpression(node.Left, modifier)
+		node.Low = modifyExpression(node.Low, modifier)
+		node.High = modifyExpression(node.High, modifier)
+
+	case *HashLiteral:
+		for i, pair := range node.Pairs {
+			node.Pairs[i].Key = modifyExpression(pair.Key, modifier)
+			node.Pairs[i].Value = modifyExpression(pair.Value, modifier)
+		}
+	}
+
+	return modifier(node)
+}
+
+// modifyStatement 改写语句节点，modifier返回的不是语句时结果为nil
+func modifyStatement(stmt Statement, modifier ModifierFunc) Statement {
+	if isNilNode(stmt) {
+		return stmt
+	}
+	modified, _ := Modify(stmt, modifier).(Statement)
+	return modified
+}
+
+// modifyExpression 改写表达式节点，modifier返回的不是表达式时结果为nil
+func modifyExpression(exp Expression, modifier ModifierFunc) Expression {
+	if isNilNode(exp) {
+		return exp
+	}
+	modified, _ := Modify(exp, modifier).(Expression)
+	return modified
+}
+
+// modifyBlock 改写语句块，modifier返回的不是语句块时结果为nil
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	modified, _ := Modify(block, modifier).(*BlockStatement)
+	return modified
+}
@@ -0,0 +1,323 @@
+package ast
+
+import "monkey/token"
+
+// 本文件实现各节点的 Pos 和 End 方法以及字节范围 Range
+// Pos 是节点第一个词法单元的位置：中缀、调用、索引等以左操作数开头的表达式取左操作数的位置，
+// 因此位置会落在 a + b 的 a 上而不是运算符上；括号分组不产生节点，(a + b) 的位置是 a
+// End 是节点最后一个词法单元的起始位置，语句末尾可选的分号不计入
+// 三者都由 firstToken 和 lastToken 推导，保证结果一致
+
+func (p *Program) Pos() token.Position { return firstToken(p).Pos() }
+func (p *Program) End() token.Position { return lastToken(p).Pos() }
+
+func (ls *LetStatement) Pos() token.Position { return firstToken(ls).Pos() }
+func (ls *LetStatement) End() token.Position { return lastToken(ls).Pos() }
+
+func (ms *MultiLetStatement) Pos() token.Position { return firstToken(ms).Pos() }
+func (ms *MultiLetStatement) End() token.Position { return lastToken(ms).Pos() }
+
+func (ap *ArrayPattern) Pos() token.Position { return firstToken(ap).Pos() }
+func (ap *ArrayPattern) End() token.Position { return lastToken(ap).Pos() }
+
+func (hp *HashPattern) Pos() token.Position { return firstToken(hp).Pos() }
+func (hp *HashPattern) End() token.Position { return lastToken(hp).Pos() }
+
+func (rs *ReturnStatement) Pos() token.Position { return firstToken(rs).Pos() }
+func (rs *ReturnStatement) End() token.Position { return lastToken(rs).Pos() }
+
+func (bs *BreakStatement) Pos() token.Position { return firstToken(bs).Pos() }
+func (bs *BreakStatement) End() token.Position { return lastToken(bs).Pos() }
+
+func (cs *ContinueStatement) Pos() token.Position { return firstToken(cs).Pos() }
+func (cs *ContinueStatement) End() token.Position { return lastToken(cs).Pos() }
+
+func (es *ExpressionStatement) Pos() token.Position { return firstToken(es).Pos() }
+func (es *ExpressionStatement) End() token.Position { return lastToken(es).Pos() }
+
+func (bs *BlockStatement) Pos() token.Position { return firstToken(bs).Pos() }
+func (bs *BlockStatement) End() token.Position { return lastToken(bs).Pos() }
+
+func (i *Identifier) Pos() token.Position { return firstToken(i).Pos() }
+func (i *Identifier) End() token.Position { return lastToken(i).Pos() }
+
+func (b *Boolean) Pos() token.Position { return firstToken(b).Pos() }
+func (b *Boolean) End() token.Position { return lastToken(b).Pos() }
+
+func (il *IntegerLiteral) Pos() token.Position { return firstToken(il).Pos() }
+func (il *IntegerLiteral) End() token.Position { return lastToken(il).Pos() }
+
+func (fl *FloatLiteral) Pos() token.Position { return firstToken(fl).Pos() }
+func (fl *FloatLiteral) End() token.Position { return lastToken(fl).Pos() }
+
+func (sl *StringLiteral) Pos() token.Position { return firstToken(sl).Pos() }
+func (sl *StringLiteral) End() token.Position { return lastToken(sl).Pos() }
+
+func (pe *PrefixExpression) Pos() token.Position { return firstToken(pe).Pos() }
+func (pe *PrefixExpression) End() token.Position { return lastToken(pe).Pos() }
+
+func (ie *InfixExpression) Pos() token.Position { return firstToken(ie).Pos() }
+func (ie *InfixExpression) End() token.Position { return lastToken(ie).Pos() }
+
+func (ie *IfExpression) Pos() token.Position { return firstToken(ie).Pos() }
+func (ie *IfExpression) End() token.Position { return lastToken(ie).Pos() }
+
+func (we *WhileExpression) Pos() token.Position { return firstToken(we).Pos() }
+func (we *WhileExpression) End() token.Position { return lastToken(we).Pos() }
+
+func (se *SwitchExpression) Pos() token.Position { return firstToken(se).Pos() }
+func (se *SwitchExpression) End() token.Position { return lastToken(se).Pos() }
+
+func (te *TryExpression) Pos() token.Position { return firstToken(te).Pos() }
+func (te *TryExpression) End() token.Position { return lastToken(te).Pos() }
+
+func (fe *ForExpression) Pos() token.Position { return firstToken(fe).Pos() }
+func (fe *ForExpression) End() token.Position { return lastToken(fe).Pos() }
+
+func (ae *AssignExpression) Pos() token.Position { return firstToken(ae).Pos() }
+func (ae *AssignExpression) End() token.Position { return lastToken(ae).Pos() }
+
+func (fl *FunctionLiteral) Pos() token.Position { return firstToken(fl).Pos() }
+func (fl *FunctionLiteral) End() token.Position { return lastToken(fl).Pos() }
+func (ml *MacroLiteral) Pos() token.Position    { return firstToken(ml).Pos() }
+func (ml *MacroLiteral) End() token.Position    { return lastToken(ml).Pos() }
+
+func (ce *CallExpression) Pos() token.Position { return firstToken(ce).Pos() }
+func (ce *CallExpression) End() token.Position { return lastToken(ce).Pos() }
+
+func (se *SpreadExpression) Pos() token.Position { return firstToken(se).Pos() }
+func (se *SpreadExpression) End() token.Position { return lastToken(se).Pos() }
+
+func (al *ArrayLiteral) Pos() token.Position { return firstToken(al).Pos() }
+func (al *ArrayLiteral) End() token.Position { return lastToken(al).Pos() }
+
+func (ie *IndexExpression) Pos() token.Position { return firstToken(ie).Pos() }
+func (ie *IndexExpression) End() token.Position { return lastToken(ie).Pos() }
+
+func (se *SliceExpression) Pos() token.Position { return firstToken(se).Pos() }
+func (se *SliceExpression) End() token.Position { return lastToken(se).Pos() }
+
+func (hl *HashLiteral) Pos() token.Position { return firstToken(hl).Pos() }
+func (hl *HashLiteral) End() token.Position { return lastToken(hl).Pos() }
+
+// Range 返回节点在源代码中的字节范围 [start, end)，即从第一个词法单元的首字节
+// 到最后一个词法单元之后的位置，可用于语法高亮、跳转到定义等编辑器功能
+// 参数 node: 要查询的节点
+// 返回值: 起止字节偏移量；节点为nil或位置未知（如语法分析器合成的节点）时返回 0, 0
+func Range(node Node) (start, end int) {
+	first, last := firstToken(node), lastToken(node)
+	if !first.Pos().IsValid() || !last.Pos().IsValid() {
+		return 0, 0
+	}
+	return first.Offset, last.Offset + last.Length
+}
+
+// firstToken 返回节点的第一个词法单元，节点为nil时返回零值
+// 解析出错时树中可能残留nil子节点
+func firstToken(node Node) token.Token {
+	if isNilNode(node) {
+		return token.Token{}
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		if len(n.Statements) == 0 {
+			return token.Token{}
+		}
+		return firstToken(n.Statements[0])
+	case *LetStatement:
+		return n.Token
+	case *MultiLetStatement:
+		return n.Token
+	case *ArrayPattern:
+		return n.Token
+	case *HashPattern:
+		return n.Token
+	case *ReturnStatement:
+		return n.Token
+	case *BreakStatement:
+		return n.Token
+	case *ContinueStatement:
+		return n.Token
+	case *ExpressionStatement:
+		return n.Token
+	case *BlockStatement:
+		return n.Token
+	case *Identifier:
+		return n.Token
+	case *Boolean:
+		return n.Token
+	case *IntegerLiteral:
+		return n.Token
+	case *FloatLiteral:
+		return n.Token
+	case *StringLiteral:
+		return n.Token
+	case *PrefixExpression:
+		return n.Token
+	case *InfixExpression:
+		// 插值字符串展开后的表达式整体对应一个TEMPLATE词法单元
+		if n.Token.Type == token.TEMPLATE {
+			return n.Token
+		}
+		return firstToken(n.Left)
+	case *IfExpression:
+		return n.Token
+	case *WhileExpression:
+		return n.Token
+	case *ForExpression:
+		return n.Token
+	case *SwitchExpression:
+		return n.Token
+	case *TryExpression:
+		return n.Token
+	case *AssignExpression:
+		return firstToken(n.Target)
+	case *FunctionLiteral:
+		return n.Token
+	case *MacroLiteral:
+		return n.Token
+	case *CallExpression:
+		// 方法调用语法 recv.f(args) 中接收者是第一个实参，却出现在函数名之前
+		fn := firstToken(n.Function)
+		if len(n.Arguments) > 0 {
+			if recv := firstToken(n.Arguments[0]); recv.Pos().IsValid() && recv.Pos().Before(fn.Pos()) {
+				return recv
+			}
+		}
+		return fn
+	case *SpreadExpression:
+		return firstToken(n.Value)
+	case *ArrayLiteral:
+		return n.Token
+	case *IndexExpression:
+		return firstToken(n.Left)
+	case *SliceExpression:
+		return firstToken(n.Left)
+	case *HashLiteral:
+		return n.Token
+	}
+	return token.Token{}
+}
+
+// lastToken 返回节点的最后一个词法单元，节点为nil时返回零值
+func lastToken(node Node) token.Token {
+	if isNilNode(node) {
+		return token.Token{}
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		if len(n.Statements) == 0 {
+			return token.Token{}
+		}
+		return lastToken(n.Statements[len(n.Statements)-1])
+	case *LetStatement:
+		switch {
+		case n.Value != nil:
+			return lastToken(n.Value)
+		case n.Pattern != nil:
+			return lastToken(n.Pattern)
+		case n.Name != nil:
+			return lastToken(n.Name)
+		}
+		return n.Token
+	case *MultiLetStatement:
+		switch {
+		case len(n.Values) > 0:
+			return lastToken(n.Values[len(n.Values)-1])
+		case len(n.Names) > 0:
+			return lastToken(n.Names[len(n.Names)-1])
+		}
+		return n.Token
+	case *ArrayPattern:
+		return n.RBracket
+	case *HashPattern:
+		return n.RBrace
+	case *ReturnStatement:
+		if n.ReturnValue != nil {
+			return lastToken(n.ReturnValue)
+		}
+		return n.Token
+	case *BreakStatement:
+		return n.Token
+	case *ContinueStatement:
+		return n.Token
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			return lastToken(n.Expression)
+		}
+		return n.Token
+	case *BlockStatement:
+		// else if 生成的语句块没有右花括号，取其中最后一条语句的最后一个词法单元
+		if n.RBrace.Pos().IsValid() {
+			return n.RBrace
+		}
+		if len(n.Statements) > 0 {
+			return lastToken(n.Statements[len(n.Statements)-1])
+		}
+		return n.Token
+	case *Identifier:
+		return n.Token
+	case *Boolean:
+		return n.Token
+	case *IntegerLiteral:
+		return n.Token
+	case *FloatLiteral:
+		return n.Token
+	case *StringLiteral:
+		return n.Token
+	case *PrefixExpression:
+		return lastToken(n.Right)
+	case *InfixExpression:
+		if n.Token.Type == token.TEMPLATE {
+			return n.Token
+		}
+		return lastToken(n.Right)
+	case *IfExpression:
+		if n.Alternative != nil {
+			return lastToken(n.Alternative)
+		}
+		return lastToken(n.Consequence)
+	case *WhileExpression:
+		return lastToken(n.Body)
+	case *ForExpression:
+		return lastToken(n.Body)
+	case *SwitchExpression:
+		return n.RBrace
+	case *TryExpression:
+		return lastToken(n.Rescue)
+	case *AssignExpression:
+		return lastToken(n.Value)
+	case *FunctionLiteral:
+		return lastToken(n.Body)
+	case *MacroLiteral:
+		return lastToken(n.Body)
+	case *CallExpression:
+		return n.RParen
+	case *SpreadExpression:
+		return n.Token
+	case *ArrayLiteral:
+		return n.RBracket
+	case *IndexExpression:
+		if n.Token.Type == token.DOT {
+			return lastToken(n.Index)
+		}
+		return n.RBracket
+	case *SliceExpression:
+		return n.RBracket
+	case *HashLiteral:
+		return n.RBrace
+	}
+	return token.Token{}
+}
+
+// nodePos 返回节点的起始位置，节点为nil时返回零值
+func nodePos(node Node) token.Position {
+	return firstToken(node).Pos()
+}
+
+// nodeEnd 返回节点的结束位置，节点为nil时返回零值
+func nodeEnd(node Node) token.Position {
+	return lastToken(node).Pos()
+}
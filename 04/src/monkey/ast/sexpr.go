@@ -0,0 +1,255 @@
+package ast
+
+import (
+	"bytes"
+	"monkey/lexer"
+	"strconv"
+)
+
+// Sexpr 把抽象语法树输出为单行、完全加括号的S表达式，便于检查运算符优先级和编写测试
+// 例如 let x = 1 + 2 * 3; 输出 (let x (+ 1 (* 2 3)))
+// 表达式语句直接输出其中的表达式；程序中的多条语句用空格分隔；
+// 字符串总是带引号，因此 h.key 与 h["key"] 的输出相同；为nil的节点输出 nil
+// 参数 node: 要输出的节点
+// 返回值: S表达式字符串
+func Sexpr(node Node) string {
+	var out bytes.Buffer
+	writeSexpr(&out, node)
+	return out.String()
+}
+
+func writeSexpr(out *bytes.Buffer, node Node) {
+	if isNilNode(node) {
+		out.WriteString("nil")
+		return
+	}
+
+	switch n := node.(type) {
+	// 语句
+	case *Program:
+		for i, stmt := range n.Statements {
+			if i > 0 {
+				out.WriteString(" ")
+			}
+			writeSexpr(out, stmt)
+		}
+
+	case *LetStatement:
+		if n.IsConst() {
+			out.WriteString("(const ")
+		} else {
+			out.WriteString("(let ")
+		}
+		if n.Pattern != nil {
+			writeSexpr(out, n.Pattern)
+		} else {
+			writeSexpr(out, n.Name)
+		}
+		if n.Value != nil {
+			out.WriteString(" ")
+			writeSexpr(out, n.Value)
+		}
+		out.WriteString(")")
+
+	case *MultiLetStatement:
+		// (let (a b) 1 2)
+		out.WriteString("(let (")
+		for i, name := range n.Names {
+			if i > 0 {
+				out.WriteString(" ")
+			}
+			writeSexpr(out, name)
+		}
+		out.WriteString(")")
+		for _, value := range n.Values {
+			out.WriteString(" ")
+			writeSexpr(out, value)
+		}
+		out.WriteString(")")
+
+	case *ReturnStatement:
+		out.WriteString("(return")
+		if n.ReturnValue != nil {
+			out.WriteString(" ")
+			writeSexpr(out, n.ReturnValue)
+		}
+		out.WriteString(")")
+
+	case *BreakStatement:
+		out.WriteString("(break)")
+
+	case *ContinueStatement:
+		out.WriteString("(continue)")
+
+	case *ExpressionStatement:
+		writeSexpr(out, n.Expression)
+
+	case *BlockStatement:
+		writeList(out, "block", statementNodes(n.Statements))
+
+	// 解构模式沿用源代码中的括号
+	case *ArrayPattern:
+		writeNames(out, "[", n.Names, "]")
+
+	case *HashPattern:
+		writeNames(out, "{", n.Names, "}")
+
+	// 表达式
+	case *Identifier:
+		out.WriteString(n.Value)
+
+	case *IntegerLiteral:
+		out.WriteString(strconv.FormatInt(n.Value, 10))
+
+	case *FloatLiteral:
+		out.WriteString(formatFloat(n.Value))
+
+	case *StringLiteral:
+		out.WriteString(`"` + lexer.Escape(n.Value) + `"`)
+
+	case *Boolean:
+		out.WriteString(strconv.FormatBool(n.Value))
+
+	case *PrefixExpression:
+		writeList(out, n.Operator, []Node{n.Right})
+
+	case *InfixExpression:
+		writeList(out, n.Operator, []Node{n.Left, n.Right})
+
+	case *IfExpression:
+		children := []Node{n.Condition, n.Consequence}
+		if n.Alternative != nil {
+			children = append(children, n.Alternative)
+		}
+		writeList(out, "if", children)
+
+	case *WhileExpression:
+		writeList(out, "while", []Node{n.Condition, n.Body})
+
+	case *ForExpression:
+		// 省略的部分输出为 nil：(for nil nil nil (block))
+		writeList(out, "for", []Node{n.Init, n.Condition, n.Post, n.Body})
+
+	case *SwitchExpression:
+		// (switch x (case (1 2) (block a)) (default (block b)))
+		out.WriteString("(switch ")
+		writeSexpr(out, n.Subject)
+		for _, c := range n.Cases {
+			out.WriteString(" (case (")
+			for i, v := range c.Values {
+				if i > 0 {
+					out.WriteString(" ")
+				}
+				writeSexpr(out, v)
+			}
+			out.WriteString(") ")
+			writeSexpr(out, c.Body)
+			out.WriteString(")")
+		}
+		if n.Default != nil {
+			out.WriteString(" ")
+			writeList(out, "default", []Node{n.Default})
+		}
+		out.WriteString(")")
+
+	case *TryExpression:
+		// (try (block a) (rescue err (block b)))
+		out.WriteString("(try ")
+		writeSexpr(out, n.Body)
+		out.WriteString(" ")
+		writeList(out, "rescue", []Node{n.Param, n.Rescue})
+		out.WriteString(")")
+
+	case *AssignExpression:
+		writeList(out, "=", []Node{n.Target, n.Value})
+
+	case *FunctionLiteral:
+		out.WriteString("(fn (")
+		for i, param := range n.Parameters {
+			if i > 0 {
+				out.WriteString(" ")
+			}
+			writeSexpr(out, param)
+		}
+		out.WriteString(") ")
+		writeSexpr(out, n.Body)
+		out.WriteString(")")
+
+	case *MacroLiteral:
+		out.WriteString("(macro (")
+		for i, param := range n.Parameters {
+			if i > 0 {
+				out.WriteString(" ")
+			}
+			writeSexpr(out, param)
+		}
+		out.WriteString(") ")
+		writeSexpr(out, n.Body)
+		out.WriteString(")")
+
+	case *CallExpression:
+		writeList(out, "call", append([]Node{n.Function}, expressionNodes(n.Arguments)...))
+
+	case *SpreadExpression:
+		writeList(out, "...", []Node{n.Value})
+
+	case *ArrayLiteral:
+		writeList(out, "array", expressionNodes(n.Elements))
+
+	case *IndexExpression:
+		writeList(out, "index", []Node{n.Left, n.Index})
+
+	case *SliceExpression:
+		// 省略的下标输出为 nil：(slice arr nil 2)
+		writeList(out, "slice", []Node{n.Left, n.Low, n.High})
+
+	case *HashLiteral:
+		// (hash ("a" 1) ("b" 2))
+		out.WriteString("(hash")
+		for _, pair := range n.Pairs {
+			out.WriteString(" (")
+			writeSexpr(out, pair.Key)
+			out.WriteString(" ")
+			writeSexpr(out, pair.Value)
+			out.WriteString(")")
+		}
+		out.WriteString(")")
+	}
+}
+
+// writeList 输出 (head child1 child2 ...)
+func writeList(out *bytes.Buffer, head string, children []Node) {
+	out.WriteString("(" + head)
+	for _, child := range children {
+		out.WriteString(" ")
+		writeSexpr(out, child)
+	}
+	out.WriteString(")")
+}
+
+func writeNames(out *bytes.Buffer, open string, names []*Identifier, close string) {
+	out.WriteString(open)
+	for i, name := range names {
+		if i > 0 {
+			out.WriteString(" ")
+		}
+		writeSexpr(out, name)
+	}
+	out.WriteString(close)
+}
+
+func statementNodes(stmts []Statement) []Node {
+	nodes := make([]Node, len(stmts))
+	for i, stmt := range stmts {
+		nodes[i] = stmt
+	}
+	return nodes
+}
+
+func expressionNodes(exps []Expression) []Node {
+	nodes := make([]Node, len(exps))
+	for i, exp := range exps {
+		nodes[i] = exp
+	}
+	return nodes
+}
@@ -0,0 +1,51 @@
+package ast
+
+// statsVisitor 在遍历中统计各类节点的数量、节点总数和最大嵌套深度
+type statsVisitor struct {
+	counts   map[string]int
+	total    int
+	depth    int
+	maxDepth int
+}
+
+func (s *statsVisitor) Visit(node Node) Visitor {
+	if node == nil {
+		// 一个节点的子节点遍历结束
+		s.depth--
+		return nil
+	}
+
+	s.counts[node.Kind()]++
+	s.total++
+	s.depth++
+	if s.depth > s.maxDepth {
+		s.maxDepth = s.depth
+	}
+	return s
+}
+
+// collectStats 遍历node统计节点信息；基于Walk实现，新增节点类型时无需修改
+func collectStats(node Node) *statsVisitor {
+	s := &statsVisitor{counts: make(map[string]int)}
+	if !isNilNode(node) {
+		Walk(s, node)
+	}
+	return s
+}
+
+// Stats 统计语法树中每一种节点出现的次数
+// 参数 node: 遍历的起始节点
+// 返回值: 以 Kind() 为键的计数，未出现的节点类型不在结果中
+func Stats(node Node) map[string]int {
+	return collectStats(node).counts
+}
+
+// CountNodes 返回语法树中节点的总数，包括node本身
+func CountNodes(node Node) int {
+	return collectStats(node).total
+}
+
+// Depth 返回语法树的最大嵌套深度，只有一个节点时为1，node为nil时为0
+func Depth(node Node) int {
+	return collectStats(node).maxDepth
+}
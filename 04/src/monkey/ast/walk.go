@@ -0,0 +1,42 @@
+package ast
+
+// Visitor 是遍历抽象语法树时使用的访问者接口，用法与 go/ast 的 Visitor 相同
+// Walk 对每个节点调用 Visit：返回的访问者 w 不为 nil 时，
+// 用 w 依次遍历该节点的子节点，最后再调用 w.Visit(nil)
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk 以深度优先的顺序遍历抽象语法树
+// 子节点由 Children 给出，按它们在源代码中出现的顺序访问，为nil的子节点跳过
+// 参数 v: 访问者
+// 参数 node: 遍历的起始节点
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	for _, child := range Children(node) {
+		Walk(v, child)
+	}
+
+	v.Visit(nil)
+}
+
+// inspector 把回调函数适配为Visitor，供Inspect使用
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect 以深度优先的顺序遍历抽象语法树，对每个节点调用f
+// f返回false时跳过该节点的子节点；与Walk相同，遍历完子节点后还会调用一次f(nil)
+// 参数 node: 遍历的起始节点
+// 参数 f: 回调函数
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,131 @@
+package evaluator
+
+// 求值器的基准测试，作为性能回归的参照
+//
+// 在CI机器（单核 Intel Xeon）上，BenchmarkFib25 的目标是每次不超过 250ms，
+// 加入本文件时的实测约为 150ms；修改求值器的热点路径（Eval、函数调用、环境）后应重新运行：
+//
+//	go test -run xxx -bench . -benchmem ./evaluator
+
+import (
+	"monkey/object"
+	"testing"
+)
+
+// fibSource 定义递归的斐波那契函数fib
+const fibSource = `let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };`
+
+// benchmarkProgram 反复在新的环境中求值input，程序只解析一次，不计入时间
+func benchmarkProgram(b *testing.B, input string) {
+	program := testParseProgram(input)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result := New(Options{}).Eval(program, object.NewEnvironment())
+		if isError(result) {
+			b.Fatal(result.Inspect())
+		}
+	}
+}
+
+func BenchmarkFib20(b *testing.B) {
+	benchmarkProgram(b, fibSource+"fib(20)")
+}
+
+// BenchmarkFib25 目标时间见文件开头的说明
+func BenchmarkFib25(b *testing.B) {
+	benchmarkProgram(b, fibSource+"fib(25)")
+}
+
+// BenchmarkWhileLoop 1万次while循环，每次循环给两个变量重新赋值
+func BenchmarkWhileLoop(b *testing.B) {
+	benchmarkProgram(b, `
+	let i = 0;
+	let sum = 0;
+	while (i < 10000) { sum = sum + i; i = i + 1 };
+	sum`)
+}
+
+// BenchmarkStringConcat 在循环中逐个拼接1000个字符
+func BenchmarkStringConcat(b *testing.B) {
+	benchmarkProgram(b, `
+	let s = "";
+	let i = 0;
+	while (i < 1000) { s = s + "x"; i = i + 1 };
+	len(s)`)
+}
+
+// BenchmarkHashInsertLookup 向哈希表插入1000个整数键，再逐个查找
+func BenchmarkHashInsertLookup(b *testing.B) {
+	benchmarkProgram(b, `
+	let h = {};
+	let i = 0;
+	while (i < 1000) { h[i] = i * 2; i = i + 1 };
+	let sum = 0;
+	let j = 0;
+	while (j < 1000) { sum = sum + h[j]; j = j + 1 };
+	sum`)
+}
+
+// BenchmarkFunctionCalls 以大量参数很少的函数调用为主，衡量创建函数调用环境的开销
+func BenchmarkFunctionCalls(b *testing.B) {
+	benchmarkProgram(b, `
+	let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+	let add = fn(a, b) { a + b };
+	let loop = fn(i, acc) { if (i == 0) { acc } else { loop(i - 1, add(acc, i)) } };
+	fib(18) + loop(1000, 0)`)
+}
+
+// recursiveListSource 用rest和push递归实现的map和filter，是Monkey中处理数组的惯用写法
+const recursiveListSource = `
+let map = fn(arr, f) {
+	let iter = fn(arr, acc) {
+		if (len(arr) == 0) { acc } else { iter(rest(arr), push(acc, f(first(arr)))) }
+	};
+	iter(arr, [])
+};
+let filter = fn(arr, f) {
+	let iter = fn(arr, acc) {
+		if (len(arr) == 0) {
+			acc
+		} else {
+			let x = first(arr);
+			iter(rest(arr), if (f(x)) { push(acc, x) } else { acc })
+		}
+	};
+	iter(arr, [])
+};
+`
+
+// benchmarkRecursiveList 在包含1万个整数的数组xs上反复求值input
+func benchmarkRecursiveList(b *testing.B, input string) {
+	const size = 10000
+
+	elements := make([]object.Object, size)
+	for i := range elements {
+		elements[i] = &object.Integer{Value: int64(i)}
+	}
+	env := object.NewEnvironment()
+	env.Set("xs", &object.Array{Elements: elements})
+
+	// 递归的深度与数组长度相同，需要提高调用深度的上限
+	ev := New(Options{MaxCallDepth: 2 * size})
+	ev.Eval(testParseProgram(recursiveListSource), env)
+	program := testParseProgram(input)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result := ev.Eval(program, env)
+		if isError(result) {
+			b.Fatal(result.Inspect())
+		}
+	}
+}
+
+func BenchmarkRecursiveMap(b *testing.B) {
+	benchmarkRecursiveList(b, "map(xs, fn(x) { x * 2 })")
+}
+
+func BenchmarkRecursiveFilter(b *testing.B) {
+	benchmarkRecursiveList(b, "filter(xs, fn(x) { x % 2 == 0 })")
+}
@@ -3,8 +3,19 @@
 package evaluator
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"monkey/lexer"
 	"monkey/object"
+	"monkey/parser"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // builtins 映射定义了 Monkey 语言的所有内置函数
@@ -12,7 +23,7 @@ import (
 var builtins = map[string]*object.Builtin{
 	// len 内置函数：返回数组或字符串的长度
 	// 支持数组和字符串类型，返回整数类型的长度值
-	"len": &object.Builtin{Fn: func(args ...object.Object) object.Object {
+	"len": &object.Builtin{Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
 		// 参数数量检查：len 函数只接受一个参数
 		if len(args) != 1 {
 			return newError("wrong number of arguments. got=%d, want=1",
@@ -25,7 +36,7 @@ var builtins = map[string]*object.Builtin{
 			// 处理数组：返回数组元素的个数
 			return &object.Integer{Value: int64(len(arg.Elements))}
 		case *object.String:
-			// 处理字符串：返回字符串的字符数
+			// 处理字符串：返回字符串的字节数；注意索引和切片按字符（rune）计算位置
 			return &object.Integer{Value: int64(len(arg.Value))}
 		default:
 			// 不支持的类型：返回错误信息
@@ -35,13 +46,13 @@ var builtins = map[string]*object.Builtin{
 	},
 	},
 
-	// puts 内置函数：输出所有参数到标准输出
-	// 支持任意数量的参数，每个参数都会被转换为字符串输出
+	// puts 内置函数：输出所有参数，每个参数占一行
+	// 支持任意数量的参数，每个参数都会被转换为字符串输出到求值器的输出（见 Options.Output）
 	"puts": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
-			// 遍历所有参数，逐个输出到标准输出
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 遍历所有参数，逐个输出
 			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+				fmt.Fprintln(ctx.Out, outputString(arg))
 			}
 
 			// 返回 NULL 表示函数执行成功
@@ -49,10 +60,173 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 
+	// print 内置函数：在同一行输出所有参数的Inspect，参数之间用一个空格分隔，末尾不换行
+	// 用于逐步打印进度或查看值；字符串带引号输出，不带参数时什么也不输出
+	"print": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			parts := make([]string, len(args))
+			for i, arg := range args {
+				parts[i] = arg.Inspect()
+			}
+			io.WriteString(ctx.Out, strings.Join(parts, " "))
+
+			return NULL
+		},
+	},
+
+	// input 内置函数：从求值器的输入（见 Options.Input）读取一行，返回不含换行符的字符串
+	// input(prompt) 先输出提示，不换行，提示的输出方式与puts相同；输入已经结束时返回null
+	"input": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：input 函数只接受可选的提示
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1",
+					len(args))
+			}
+			if len(args) == 1 {
+				io.WriteString(ctx.Out, outputString(args[0]))
+			}
+
+			line, ok, err := readLine(ctx.In)
+			if err != nil {
+				return newError("could not read input: %s", err)
+			}
+			if !ok {
+				return NULL
+			}
+			return &object.String{Value: line}
+		},
+	},
+
+	// exit 内置函数：结束程序的执行，exit(code)指定退出状态，省略时为0
+	// 返回exit信号而不是直接结束进程，信号传递到最外层后由REPL等调用方结束执行
+	"exit": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：exit 函数只接受可选的退出状态
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1",
+					len(args))
+			}
+			if len(args) == 0 {
+				return &object.Exit{Code: 0}
+			}
+			// 参数类型检查：退出状态必须是整数
+			code, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("argument to `exit` must be INTEGER, got %s",
+					args[0].Type())
+			}
+			return &object.Exit{Code: code.Value}
+		},
+	},
+
+	// eval 内置函数：在调用处的环境中求值一段Monkey代码，返回最后一条语句的值
+	// 代码中let定义的变量和函数在eval返回后仍然保留在调用处的环境中；
+	// 语法错误不求值任何代码，所有错误合并为一个错误返回
+	"eval": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：eval 函数只接受一个参数
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			// 参数类型检查：参数必须是字符串类型
+			code, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `eval` must be STRING, got %s",
+					args[0].Type())
+			}
+
+			p := parser.New(lexer.New(code.Value))
+			program := p.ParseProgram()
+			if len(p.Errors()) != 0 {
+				return newError("could not parse code passed to `eval`: %s",
+					strings.Join(p.Errors(), "; "))
+			}
+			return ctx.Eval(program)
+		},
+	},
+
+	// json_encode 内置函数：把值编码为JSON字符串
+	// 哈希表编码为对象（键必须是字符串，按字典序输出），数组编码为数组，
+	// 整数、浮点数、布尔值和null编码为对应的JSON值；函数等其他对象无法编码
+	"json_encode": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：json_encode 函数只接受一个参数
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			encoded, err := encodeJSON(args[0])
+			if err != nil {
+				return err
+			}
+			return &object.String{Value: encoded}
+		},
+	},
+
+	// str 内置函数：把任意对象转换为字符串
+	// 字符串原样返回，不再加引号；其他对象使用Inspect的结果，如 str([1, "a"]) 为 [1, "a"]
+	"str": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：str 函数只接受一个参数
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			if str, ok := args[0].(*object.String); ok {
+				return str
+			}
+			return &object.String{Value: args[0].Inspect()}
+		},
+	},
+
+	// int 内置函数：把字符串、浮点数或布尔值转换为整数
+	// 字符串去掉首尾空白后按十进制解析，浮点数向零截断，true和false分别为1和0，整数原样返回
+	"int": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：int 函数只接受一个参数
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				return arg
+			case *object.String:
+				value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+				if errors.Is(err, strconv.ErrRange) {
+					return newError("integer out of range: %q", arg.Value)
+				}
+				if err != nil {
+					return newError("could not parse %q as integer", arg.Value)
+				}
+				return &object.Integer{Value: value}
+			case *object.Float:
+				truncated, ok := floatToInteger(math.Trunc(arg.Value))
+				if !ok {
+					return newError("integer out of range: %s", arg.Inspect())
+				}
+				return truncated
+			case *object.Boolean:
+				if arg.Value {
+					return &object.Integer{Value: 1}
+				}
+				return &object.Integer{Value: 0}
+			default:
+				return newError("argument to `int` not supported, got %s",
+					args[0].Type())
+			}
+		},
+	},
+
 	// first 内置函数：返回数组的第一个元素
 	// 如果数组为空，返回 NULL
 	"first": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
 			// 参数数量检查：first 函数只接受一个参数
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
@@ -80,7 +254,7 @@ var builtins = map[string]*object.Builtin{
 	// last 内置函数：返回数组的最后一个元素
 	// 如果数组为空，返回 NULL
 	"last": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
 			// 参数数量检查：last 函数只接受一个参数
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
@@ -107,9 +281,10 @@ var builtins = map[string]*object.Builtin{
 	},
 
 	// rest 内置函数：返回除第一个元素外的数组剩余部分
-	// 如果数组为空或只有一个元素，返回空数组
+	// 如果数组只有一个元素，返回空数组；数组为空时返回null。
+	// 结果与原数组共享元素而不复制，见 object.Array.Rest
 	"rest": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
 			// 参数数量检查：rest 函数只接受一个参数
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
@@ -123,13 +298,9 @@ var builtins = map[string]*object.Builtin{
 
 			// 类型断言获取数组对象
 			arr := args[0].(*object.Array)
-			length := len(arr.Elements)
-			// 检查数组是否包含多个元素
-			if length > 0 {
-				// 创建新数组，包含除第一个元素外的所有元素
-				newElements := make([]object.Object, length-1, length-1)
-				copy(newElements, arr.Elements[1:length])
-				return &object.Array{Elements: newElements}
+			// 返回除第一个元素外的所有元素，与原数组共享存储而不复制
+			if rest := arr.Rest(); rest != nil {
+				return rest
 			}
 
 			// 空数组返回 NULL
@@ -138,9 +309,9 @@ var builtins = map[string]*object.Builtin{
 	},
 
 	// push 内置函数：向数组末尾添加一个元素
-	// 返回包含新元素的新数组，原数组保持不变
+	// 返回包含新元素的新数组，原数组保持不变；连续push时不必每次复制，见 object.Array.Push
 	"push": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
 			// 参数数量检查：push 函数需要两个参数（数组和要添加的元素）
 			if len(args) != 2 {
 				return newError("wrong number of arguments. got=%d, want=2",
@@ -154,17 +325,903 @@ var builtins = map[string]*object.Builtin{
 
 			// 类型断言获取数组对象
 			arr := args[0].(*object.Array)
+
+			// 返回包含新元素的新数组，连续push时均摊为O(1)
+			return arr.Push(args[1])
+		},
+	},
+
+	// pop 内置函数：取出数组的最后一个元素
+	// 返回两个元素的数组 [最后一个元素, 其余元素组成的数组]，可以用 let [x, xs] = pop(arr); 解构；
+	// 其余元素复制到新数组中，对它的索引赋值不影响原数组。空数组没有元素可取，返回错误
+	"pop": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：pop 函数只接受一个参数
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			// 参数类型检查：参数必须是数组类型
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `pop` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
 			length := len(arr.Elements)
+			if length == 0 {
+				return newError("cannot pop from empty array")
+			}
+			elements := make([]object.Object, length-1)
+			copy(elements, arr.Elements)
+			remaining := &object.Array{Elements: elements}
+			return &object.Array{Elements: []object.Object{arr.Elements[length-1], remaining}}
+		},
+	},
+
+	// insert 内置函数：返回在index之前插入value后的新数组，原数组保持不变
+	// index等于数组长度时插入到末尾；负数从末尾倒数，-1表示插入到最后一个元素之前；
+	// index超出[-len, len]的范围时返回错误
+	"insert": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：insert 函数需要三个参数（数组、位置和要插入的元素）
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3",
+					len(args))
+			}
+			// 参数类型检查：第一个参数必须是数组，位置必须是整数
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `insert` must be ARRAY, got %s",
+					args[0].Type())
+			}
+			index, ok := args[1].(*object.Integer)
+			if !ok {
+				return newError("index passed to `insert` must be INTEGER, got %s",
+					args[1].Type())
+			}
+
+			length := int64(len(arr.Elements))
+			idx := index.Value
+			if idx < 0 {
+				idx += length
+			}
+			if idx < 0 || idx > length {
+				return newError("index out of range: %d (array length %d)", index.Value, length)
+			}
+
+			elements := make([]object.Object, 0, length+1)
+			elements = append(elements, arr.Elements[:idx]...)
+			elements = append(elements, args[2])
+			elements = append(elements, arr.Elements[idx:]...)
+			return &object.Array{Elements: elements}
+		},
+	},
+
+	// has_key 内置函数：判断哈希表中是否存在指定的键
+	// 键对应的值为 null 时同样返回 true，因此可以区分存储的 null 和不存在的键
+	"has_key": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：has_key 函数需要两个参数（哈希表和键）
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			// 参数类型检查：第一个参数必须是哈希表类型
+			hash, ok := args[0].(*object.Hash)
+			if !ok {
+				return newError("argument to `has_key` must be HASH, got %s",
+					args[0].Type())
+			}
+
+			_, found, err := lookupHashKey(hash, args[1])
+			if err != nil {
+				return err
+			}
+			return nativeBoolToBooleanObject(found)
+		},
+	},
+
+	// contains 内置函数：判断集合中是否包含指定的值
+	// 哈希表判断键是否存在，与 has_key 相同；数组按 == 的规则判断是否有相等的元素；
+	// 字符串判断是否包含子串
+	"contains": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：contains 函数需要两个参数（集合和要查找的值）
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			switch collection := args[0].(type) {
+			case *object.Hash:
+				_, found, err := lookupHashKey(collection, args[1])
+				if err != nil {
+					return err
+				}
+				return nativeBoolToBooleanObject(found)
+			case *object.Array:
+				for _, elem := range collection.Elements {
+					if objectsEqual(elem, args[1]) {
+						return TRUE
+					}
+				}
+				return FALSE
+			case *object.String:
+				substr, ok := args[1].(*object.String)
+				if !ok {
+					return newError("second argument to `contains` must be STRING, got %s",
+						args[1].Type())
+				}
+				return nativeBoolToBooleanObject(strings.Contains(collection.Value, substr.Value))
+			default:
+				return newError("argument to `contains` not supported, got %s",
+					args[0].Type())
+			}
+		},
+	},
+
+	// index_of 内置函数：返回第一次出现的位置，没有找到时返回-1
+	// 字符串查找子串，位置按Unicode字符计数，与substr一致；数组按 == 的规则查找相等的元素
+	"index_of": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：index_of 函数需要两个参数（被查找的容器和要查找的值）
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			switch haystack := args[0].(type) {
+			case *object.String:
+				needle, ok := args[1].(*object.String)
+				if !ok {
+					return newError("second argument to `index_of` must be STRING, got %s",
+						args[1].Type())
+				}
+				i := strings.Index(haystack.Value, needle.Value)
+				if i < 0 {
+					return &object.Integer{Value: -1}
+				}
+				return &object.Integer{Value: int64(utf8.RuneCountInString(haystack.Value[:i]))}
+			case *object.Array:
+				for i, elem := range haystack.Elements {
+					if objectsEqual(elem, args[1]) {
+						return &object.Integer{Value: int64(i)}
+					}
+				}
+				return &object.Integer{Value: -1}
+			default:
+				return newError("argument to `index_of` not supported, got %s",
+					args[0].Type())
+			}
+		},
+	},
+
+	// get 内置函数：返回哈希表中指定键对应的值
+	// 键不存在时返回第三个参数作为默认值，省略默认值时返回 NULL
+	"get": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：get 函数需要哈希表、键和可选的默认值
+			if len(args) != 2 && len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=2 or 3",
+					len(args))
+			}
+			// 参数类型检查：第一个参数必须是哈希表类型
+			hash, ok := args[0].(*object.Hash)
+			if !ok {
+				return newError("argument to `get` must be HASH, got %s",
+					args[0].Type())
+			}
+
+			value, found, err := lookupHashKey(hash, args[1])
+			if err != nil {
+				return err
+			}
+			if found {
+				return value
+			}
+			if len(args) == 3 {
+				return args[2]
+			}
+			return NULL
+		},
+	},
+
+	// sort 内置函数：返回排好序的新数组，原数组保持不变
+	// 不带比较函数时数组只能全是数值（按大小）或全是字符串（按字典序）；
+	// sort(array, fn) 用fn(a, b)决定顺序：返回负数、零、正数表示a小于、等于、大于b，
+	// 或者返回布尔值表示a是否小于b。排序是稳定的，相等的元素保持原来的先后顺序
+	"sort": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：sort 函数需要数组和可选的比较函数
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+			// 参数类型检查：第一个参数必须是数组类型
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `sort` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			elements := make([]object.Object, len(arr.Elements))
+			copy(elements, arr.Elements)
 
-			// 创建新数组，长度比原数组多1
-			newElements := make([]object.Object, length+1, length+1)
-			// 复制原数组的所有元素
-			copy(newElements, arr.Elements)
-			// 在末尾添加新元素
-			newElements[length] = args[1]
+			if len(args) == 1 {
+				if err := checkSortable(elements); err != nil {
+					return err
+				}
+				sort.SliceStable(elements, func(i, j int) bool {
+					return naturalLess(elements[i], elements[j])
+				})
+				return &object.Array{Elements: elements}
+			}
 
-			// 返回包含新元素的新数组
-			return &object.Array{Elements: newElements}
+			// 比较函数出错后不再调用它，排序结束后返回第一个错误
+			var err object.Object
+			sort.SliceStable(elements, func(i, j int) bool {
+				if err != nil {
+					return false
+				}
+				var less bool
+				less, err = compareWith(ctx, args[1], elements[i], elements[j])
+				return less
+			})
+			if err != nil {
+				return err
+			}
+			return &object.Array{Elements: elements}
 		},
 	},
+
+	// join 内置函数：把数组元素的文本用分隔符连接成一个字符串
+	// 字符串元素使用原始内容，其他元素使用Inspect的结果；空数组得到空字符串
+	"join": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：join 函数需要两个参数（数组和分隔符）
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			// 参数类型检查：第一个参数必须是数组，分隔符必须是字符串
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `join` must be ARRAY, got %s",
+					args[0].Type())
+			}
+			sep, ok := args[1].(*object.String)
+			if !ok {
+				return newError("separator passed to `join` must be STRING, got %s",
+					args[1].Type())
+			}
+
+			parts := make([]string, len(arr.Elements))
+			for i, elem := range arr.Elements {
+				parts[i] = outputString(elem)
+			}
+			return &object.String{Value: strings.Join(parts, sep.Value)}
+		},
+	},
+
+	// trim、trim_left 和 trim_right 内置函数：去掉字符串两端、开头或结尾的字符，返回新字符串
+	// 只有一个参数时去掉Unicode空白，第二个参数给出时去掉其中出现的任意字符；中间的字符保持不变
+	"trim":       trimBuiltin("trim", strings.TrimSpace, strings.Trim),
+	"trim_left":  trimBuiltin("trim_left", trimLeftSpace, strings.TrimLeft),
+	"trim_right": trimBuiltin("trim_right", trimRightSpace, strings.TrimRight),
+
+	// upper、lower 和 capitalize 内置函数：转换字符串的大小写，返回新字符串
+	// 按Unicode规则转换，对带重音的字母等非ASCII字符同样有效；capitalize只把第一个字符转为大写
+	"upper":      stringBuiltin("upper", strings.ToUpper),
+	"lower":      stringBuiltin("lower", strings.ToLower),
+	"capitalize": stringBuiltin("capitalize", capitalize),
+
+	// substr 内置函数：返回从第start个字符开始、最多length个字符的子串
+	// 按Unicode字符而不是字节计数，与字符串索引不同，不会截断多字节字符；
+	// 超出字符串末尾的部分被忽略，start不小于字符串长度时返回空字符串
+	"substr": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：substr 函数需要三个参数（字符串、起始位置和长度）
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3",
+					len(args))
+			}
+			// 参数类型检查：第一个参数必须是字符串，起始位置和长度必须是非负整数
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `substr` must be STRING, got %s",
+					args[0].Type())
+			}
+			start, ok := args[1].(*object.Integer)
+			if !ok {
+				return newError("start passed to `substr` must be INTEGER, got %s",
+					args[1].Type())
+			}
+			length, ok := args[2].(*object.Integer)
+			if !ok {
+				return newError("length passed to `substr` must be INTEGER, got %s",
+					args[2].Type())
+			}
+			if start.Value < 0 || length.Value < 0 {
+				return newError("negative start or length passed to `substr`: %d, %d",
+					start.Value, length.Value)
+			}
+
+			runes := []rune(str.Value)
+			if start.Value >= int64(len(runes)) {
+				return &object.String{Value: ""}
+			}
+			end := int64(len(runes))
+			if length.Value < end-start.Value {
+				end = start.Value + length.Value
+			}
+			return &object.String{Value: string(runes[start.Value:end])}
+		},
+	},
+
+	// sum 内置函数：返回数组中所有数值的和，空数组的和为0
+	// 与 + 的规则相同，全是整数时结果为整数，有浮点数时结果为浮点数
+	"sum": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：sum 函数只接受一个参数
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			// 参数类型检查：参数必须是数组类型
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `sum` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			var total object.Object = &object.Integer{Value: 0}
+			for _, elem := range arr.Elements {
+				if !isNumber(elem) {
+					return newError("cannot sum %s elements", elem.Type())
+				}
+				total = evalNumericInfixExpression("+", total, elem)
+			}
+			return total
+		},
+	},
+
+	// min 和 max 内置函数：返回数组中或多个参数中最小或最大的值
+	// min(array) 比较数组的元素，min(a, b, ...) 比较各个参数；
+	// 值必须全是数值（按大小）或全是字符串（按字典序），有多个相同的最值时返回第一个
+	"min": extremumBuiltin("min", func(a, b object.Object) bool { return naturalLess(b, a) }),
+	"max": extremumBuiltin("max", naturalLess),
+
+	// abs 内置函数：返回数值的绝对值，整数仍是整数，浮点数仍是浮点数
+	"abs": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：abs 函数只接受一个参数
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				// 最小的int64没有对应的正数
+				if arg.Value == math.MinInt64 {
+					return newError("absolute value out of range: %s", arg.Inspect())
+				}
+				if arg.Value < 0 {
+					return &object.Integer{Value: -arg.Value}
+				}
+				return arg
+			case *object.Float:
+				return &object.Float{Value: math.Abs(arg.Value)}
+			default:
+				return newError("argument to `abs` must be INTEGER or FLOAT, got %s",
+					args[0].Type())
+			}
+		},
+	},
+
+	// pow 内置函数：返回base的exp次幂
+	// 底数和非负的指数都是整数时按整数计算，结果超出整数范围时改为按浮点数计算；其余情况按浮点数计算
+	"pow": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：pow 函数需要两个参数（底数和指数）
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			// 参数类型检查：两个参数都必须是数值
+			for _, arg := range args {
+				if !isNumber(arg) {
+					return newError("argument to `pow` must be INTEGER or FLOAT, got %s",
+						arg.Type())
+				}
+			}
+
+			base, baseIsInt := args[0].(*object.Integer)
+			exp, expIsInt := args[1].(*object.Integer)
+			if baseIsInt && expIsInt && exp.Value >= 0 {
+				if result, ok := intPow(base.Value, exp.Value); ok {
+					return &object.Integer{Value: result}
+				}
+			}
+			return &object.Float{Value: math.Pow(toFloat(args[0]), toFloat(args[1]))}
+		},
+	},
+
+	// sqrt 内置函数：返回数值的平方根，结果总是浮点数；负数没有实数平方根，返回错误
+	"sqrt": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：sqrt 函数只接受一个参数
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			// 参数类型检查：参数必须是数值
+			if !isNumber(args[0]) {
+				return newError("argument to `sqrt` must be INTEGER or FLOAT, got %s",
+					args[0].Type())
+			}
+
+			value := toFloat(args[0])
+			if value < 0 {
+				return newError("square root of negative number: %s", args[0].Inspect())
+			}
+			return &object.Float{Value: math.Sqrt(value)}
+		},
+	},
+
+	// floor、ceil 和 round 内置函数：把浮点数向下、向上或四舍五入取整为整数
+	// round 在正中间时远离零取整，如 round(2.5) 为3，round(-2.5) 为-3；整数原样返回
+	"floor": roundingBuiltin("floor", math.Floor),
+	"ceil":  roundingBuiltin("ceil", math.Ceil),
+	"round": roundingBuiltin("round", math.Round),
+
+	// flatten 内置函数：把嵌套的数组展开为新数组，原数组保持不变
+	// flatten(array) 只展开一层：数组元素被拆开拼接到结果中，其他元素原样保留；
+	// flatten(array, depth) 展开depth层，depth为-1时完全展开；
+	// 通过索引赋值包含了自身的数组无论展开几层都返回错误
+	"flatten": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：flatten 函数需要数组和可选的展开层数
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+			// 参数类型检查：第一个参数必须是数组，展开层数必须是不小于-1的整数
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `flatten` must be ARRAY, got %s",
+					args[0].Type())
+			}
+			depth := int64(1)
+			if len(args) == 2 {
+				d, ok := args[1].(*object.Integer)
+				if !ok {
+					return newError("depth passed to `flatten` must be INTEGER, got %s",
+						args[1].Type())
+				}
+				if d.Value < -1 {
+					return newError("depth passed to `flatten` must be -1 or at least 0, got %d",
+						d.Value)
+				}
+				depth = d.Value
+			}
+
+			f := &arrayFlattener{out: []object.Object{}, expanding: make(map[*object.Array]bool)}
+			if err := f.flatten(arr, depth); err != nil {
+				return err
+			}
+			return &object.Array{Elements: f.out}
+		},
+	},
+
+	// flat_map 内置函数：对每个元素调用fn，再把结果展开一层拼接成新数组
+	// 与 flatten(map(array, fn)) 相同：fn返回数组时拆开拼接，返回其他值时原样保留
+	"flat_map": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：flat_map 函数需要两个参数（数组和函数）
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			// 参数类型检查：第一个参数必须是数组类型
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `flat_map` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			elements := []object.Object{}
+			for _, elem := range arr.Elements {
+				result := ctx.Call(args[1], elem)
+				if isError(result) {
+					return result
+				}
+				if inner, ok := result.(*object.Array); ok {
+					elements = append(elements, inner.Elements...)
+				} else {
+					elements = append(elements, result)
+				}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+
+	// rand 内置函数：返回[0, 1)之间的随机浮点数
+	"rand": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：rand 函数不接受参数
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0",
+					len(args))
+			}
+			return &object.Float{Value: ctx.Rand.Float64()}
+		},
+	},
+
+	// rand_int 内置函数：返回[0, n)之间的随机整数，n必须为正数
+	"rand_int": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：rand_int 函数只接受一个参数
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			// 参数类型检查：参数必须是正整数
+			n, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("argument to `rand_int` must be INTEGER, got %s",
+					args[0].Type())
+			}
+			if n.Value <= 0 {
+				return newError("argument to `rand_int` must be positive, got %d", n.Value)
+			}
+			return &object.Integer{Value: ctx.Rand.Int63n(n.Value)}
+		},
+	},
+
+	// seed 内置函数：设置随机数种子，之后rand和rand_int的结果序列由种子决定
+	// 只影响当前求值器，返回null
+	"seed": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：seed 函数只接受一个参数
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			// 参数类型检查：种子必须是整数
+			n, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("argument to `seed` must be INTEGER, got %s",
+					args[0].Type())
+			}
+			ctx.Rand.Seed(n.Value)
+			return NULL
+		},
+	},
+
+	// memo 内置函数：返回带缓存的函数包装
+	// 以相同参数再次调用包装后的函数时直接返回上次的结果，适用于递归的纯函数
+	"memo": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：memo 函数只接受一个参数
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			// 参数类型检查：只能包装用户定义函数
+			fn, ok := args[0].(*object.Function)
+			if !ok {
+				return newError("argument to `memo` must be FUNCTION, got %s",
+					args[0].Type())
+			}
+
+			return &object.Memoized{Fn: fn, Cache: make(map[string]object.Object)}
+		},
+	},
+
+	// assert 内置函数：断言参数为真值，用于编写 Monkey 测试脚本
+	// 成功时返回 true；失败时返回包含该值的错误，错误位置由求值器填写为调用处
+	"assert": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：assert 函数只接受一个参数
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			// null 和 false 都是假值，都会使断言失败
+			if !isTruthy(args[0]) {
+				return newError("assertion failed: got %s", args[0].Inspect())
+			}
+			return TRUE
+		},
+	},
+
+	// assert_eq 内置函数：断言两个参数相等，用于编写 Monkey 测试脚本
+	// 按 == 的规则比较（数组和哈希表深度比较），因此 null 与 false 不相等；
+	// 成功时返回 true，失败时返回同时包含两个值的错误
+	"assert_eq": &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：assert_eq 函数需要两个参数（实际值和期望值）
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			got, expected := args[0], args[1]
+			if !objectsEqual(got, expected) {
+				return newError("assertion failed: got %s (%s), expected %s (%s)",
+					got.Inspect(), got.Type(), expected.Inspect(), expected.Type())
+			}
+			return TRUE
+		},
+	},
+}
+
+// outputString 返回puts、input、join和插值字符串使用的对象文本
+// 字符串输出原始内容，不带Inspect添加的引号；其他对象使用Inspect的结果
+func outputString(obj object.Object) string {
+	if str, ok := obj.(*object.String); ok {
+		return str.Value
+	}
+	return obj.Inspect()
+}
+
+// checkSortable 检查数组元素能否不带比较函数排序：必须全是数值或全是字符串
+func checkSortable(elements []object.Object) *object.Error {
+	for _, elem := range elements {
+		if !isNumber(elem) && elem.Type() != object.STRING_OBJ {
+			return newError("cannot sort %s elements without a comparator", elem.Type())
+		}
+		if isNumber(elem) != isNumber(elements[0]) {
+			return newError("cannot sort mixed %s and %s elements",
+				elements[0].Type(), elem.Type())
+		}
+	}
+	return nil
+}
+
+// naturalLess 是sort的默认顺序，数值按大小比较，字符串按字典序比较
+func naturalLess(a, b object.Object) bool {
+	if a, ok := a.(*object.String); ok {
+		return a.Value < b.(*object.String).Value
+	}
+	return evalNumericInfixExpression("<", a, b) == TRUE
+}
+
+// compareWith 调用sort的比较函数判断a是否应排在b之前
+// 返回值: a是否小于b；比较函数出错或返回值类型不对时返回错误
+func compareWith(ctx object.BuiltinContext, fn, a, b object.Object) (bool, object.Object) {
+	result := ctx.Call(fn, a, b)
+	switch result := result.(type) {
+	case *object.Integer:
+		return result.Value < 0, nil
+	case *object.Boolean:
+		return result.Value, nil
+	case *object.Error, *object.Exit:
+		return false, result
+	default:
+		return false, newError("comparator passed to `sort` must return INTEGER or BOOLEAN, got %s",
+			result.Type())
+	}
+}
+
+// trimBuiltin 创建trim系列内置函数
+// 参数 name: 内置函数的名称，用于错误消息
+// 参数 space: 只有一个参数时使用，去掉空白
+// 参数 cutset: 有两个参数时使用，去掉第二个参数中出现的字符
+func trimBuiltin(
+	name string,
+	space func(s string) string,
+	cutset func(s, cutset string) string,
+) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：字符串和可选的字符集合
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+			// 参数类型检查：两个参数都必须是字符串
+			for _, arg := range args {
+				if arg.Type() != object.STRING_OBJ {
+					return newError("argument to `%s` must be STRING, got %s",
+						name, arg.Type())
+				}
+			}
+
+			str := args[0].(*object.String).Value
+			if len(args) == 1 {
+				return &object.String{Value: space(str)}
+			}
+			return &object.String{Value: cutset(str, args[1].(*object.String).Value)}
+		},
+	}
+}
+
+// trimLeftSpace 去掉字符串开头的Unicode空白
+func trimLeftSpace(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) }
+
+// trimRightSpace 去掉字符串结尾的Unicode空白
+func trimRightSpace(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) }
+
+// stringBuiltin 创建只接受一个字符串参数、返回新字符串的内置函数
+// 参数 name: 内置函数的名称，用于错误消息
+// 参数 fn: 对字符串的转换
+func stringBuiltin(name string, fn func(s string) string) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：只接受一个参数
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			// 参数类型检查：参数必须是字符串
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `%s` must be STRING, got %s",
+					name, args[0].Type())
+			}
+
+			return &object.String{Value: fn(str.Value)}
+		},
+	}
+}
+
+// capitalize 把字符串的第一个字符转为大写，其余部分保持不变
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// extremumBuiltin 创建min和max内置函数
+// 参数 name: 内置函数的名称，用于错误消息
+// 参数 replace: 判断候选值是否应替换当前的结果，参数依次为当前结果和候选值
+func extremumBuiltin(name string, replace func(current, candidate object.Object) bool) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：至少需要一个参数
+			if len(args) == 0 {
+				return newError("wrong number of arguments. got=0, want at least 1")
+			}
+
+			values := args
+			if arr, ok := args[0].(*object.Array); ok && len(args) == 1 {
+				values = arr.Elements
+			}
+			if len(values) == 0 {
+				return newError("argument to `%s` must not be empty", name)
+			}
+
+			result := values[0]
+			for _, value := range values {
+				if !isNumber(value) && value.Type() != object.STRING_OBJ {
+					return newError("cannot compare %s values in `%s`", value.Type(), name)
+				}
+				if isNumber(value) != isNumber(result) {
+					return newError("cannot compare mixed %s and %s values in `%s`",
+						result.Type(), value.Type(), name)
+				}
+				if replace(result, value) {
+					result = value
+				}
+			}
+			return result
+		},
+	}
+}
+
+// intPow 用平方求幂计算base的exp次幂，exp必须非负
+// 返回值: 幂；结果超出int64范围时返回false
+func intPow(base, exp int64) (int64, bool) {
+	result := int64(1)
+	ok := true
+	for {
+		if exp&1 == 1 {
+			if result, ok = mulInt64(result, base); !ok {
+				return 0, false
+			}
+		}
+		exp >>= 1
+		if exp == 0 {
+			return result, true
+		}
+		// 只在还需要更高次幂时才平方，避免最后一次平方的溢出误报
+		if base, ok = mulInt64(base, base); !ok {
+			return 0, false
+		}
+	}
+}
+
+// mulInt64 计算两个整数的乘积
+// 返回值: 乘积；结果超出int64范围时返回false
+func mulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	// 最小的int64除以-1仍然得到它自己，需要单独判断
+	if c/b != a || a == -1 && b == math.MinInt64 || b == -1 && a == math.MinInt64 {
+		return 0, false
+	}
+	return c, true
+}
+
+// roundingBuiltin 创建floor、ceil和round内置函数
+// 参数 name: 内置函数的名称，用于错误消息
+// 参数 round: 对浮点数取整的方式
+func roundingBuiltin(name string, round func(float64) float64) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(ctx object.BuiltinContext, args ...object.Object) object.Object {
+			// 参数数量检查：只接受一个参数
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				return arg
+			case *object.Float:
+				rounded, ok := floatToInteger(round(arg.Value))
+				if !ok {
+					return newError("integer out of range: %s", arg.Inspect())
+				}
+				return rounded
+			default:
+				return newError("argument to `%s` must be INTEGER or FLOAT, got %s",
+					name, args[0].Type())
+			}
+		},
+	}
+}
+
+// arrayFlattener 把嵌套的数组展开到out中，见 flatten 内置函数
+type arrayFlattener struct {
+	out []object.Object
+	// expanding 记录正在展开的数组，通过索引赋值形成的循环引用报错而不是无限递归
+	expanding map[*object.Array]bool
+}
+
+// flatten 把arr的元素展开depth层后追加到out中，depth为-1时完全展开，不修改arr和其中的数组
+// 返回值: arr直接或间接包含自身时返回错误
+func (f *arrayFlattener) flatten(arr *object.Array, depth int64) *object.Error {
+	if f.expanding[arr] {
+		return newError("cannot flatten cyclic ARRAY")
+	}
+	f.expanding[arr] = true
+	defer delete(f.expanding, arr)
+
+	for _, elem := range arr.Elements {
+		if inner, ok := elem.(*object.Array); ok && depth != 0 {
+			if err := f.flatten(inner, depth-1); err != nil {
+				return err
+			}
+			continue
+		}
+		f.out = append(f.out, elem)
+	}
+	return nil
+}
+
+// readLine 从in读取一行，去掉末尾的换行符（\n或\r\n）
+// 最后一行没有换行符时也照常返回；输入已经结束时ok为false
+func readLine(in *bufio.Reader) (line string, ok bool, err error) {
+	line, err = in.ReadString('\n')
+	if err == io.EOF {
+		if line == "" {
+			return "", false, nil
+		}
+		err = nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return line, true, nil
 }
@@ -1,9 +1,17 @@
 package evaluator
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
 	"monkey/ast"
 	"monkey/object"
+	"monkey/token"
+	"os"
+	"strings"
+	"time"
 )
 
 // 全局常量定义，表示Monkey语言中的基本值
@@ -11,50 +19,214 @@ var (
 	NULL  = &object.Null{}                // 空值对象
 	TRUE  = &object.Boolean{Value: true}  // 真布尔值对象
 	FALSE = &object.Boolean{Value: false} // 假布尔值对象
+
+	BREAK    = &object.BreakSignal{}    // break语句产生的信号
+	CONTINUE = &object.ContinueSignal{} // continue语句产生的信号
 )
 
-// Eval 是求值器的入口函数，负责对AST节点进行求值
+// DefaultMaxCallDepth 函数调用嵌套深度的默认上限
+// 超过上限时返回错误，避免无限递归耗尽Go调用栈导致整个进程崩溃
+const DefaultMaxCallDepth = 5000
+
+// Options 控制求值器的行为，零值表示全部使用默认设置
+type Options struct {
+	// MaxCallDepth 函数调用的最大嵌套深度，为0时使用DefaultMaxCallDepth
+	MaxCallDepth int
+
+	// MaxSteps 求值步数的上限，每次调用Eval计为一步，为0时不限制
+	// 与按时间计算的超时不同，同一段代码无论在多快的机器上运行，用尽步数的位置都相同
+	MaxSteps int
+
+	// LooseTruthiness 为true时0、空字符串和空数组在条件中也视为假值，类似Python和JavaScript；
+	// 默认关闭，只有null和false为假值。if、while、for、! 以及 && 和 || 都按同一规则判断
+	LooseTruthiness bool
+
+	// Trace 不为nil时，每次进入和离开Eval都会调用它，可以用来观察求值过程（见 NewTracer）
+	// 进入时result为nil，离开时为该节点的求值结果；
+	// depth是Eval的嵌套深度，最外层为0，同一节点进入和离开时的depth相同
+	Trace func(node ast.Node, depth int, result object.Object)
+
+	// Profile 不为nil时，求值过程中的执行计数累加到其中，见 Profile
+	Profile *Profile
+
+	// Output 是puts、print等内置函数写出内容的位置，为nil时使用标准输出
+	Output io.Writer
+
+	// Input 是input内置函数读取输入的位置，为nil时使用标准输入
+	// 不是*bufio.Reader时求值器会为它创建缓冲，调用方还要读取同一输入时应传入*bufio.Reader并共用它
+	Input io.Reader
+}
+
+// Evaluator 保存一次求值过程的选项和状态（如当前的函数调用深度）
+// 同一个Evaluator可以在同一个环境中多次求值，如REPL中逐行输入的代码；
+// 它不是并发安全的，并发求值时每个goroutine应使用自己的Evaluator
+type Evaluator struct {
+	opts  Options
+	stack []activation  // 当前的函数调用栈，最外层的调用在前，长度即调用嵌套深度
+	steps int           // 已经执行的求值步数
+	depth int           // 当前Eval的嵌套深度，只在设置了Trace时维护
+	rng   *rand.Rand    // rand等内置函数使用的随机数生成器，见 New
+	input *bufio.Reader // input内置函数读取的输入，由Options.Input创建
+}
+
+// activation 是调用栈中的一次函数调用
+// 只保存函数和调用表达式，出错需要调用栈时才用callFrame计算函数名和源代码位置
+type activation struct {
+	fn   *object.Function
+	call *ast.CallExpression
+}
+
+// New 创建使用给定选项的求值器
+// 参数 opts: 求值选项
+// 返回值: 新的求值器
+func New(opts Options) *Evaluator {
+	if opts.MaxCallDepth <= 0 {
+		opts.MaxCallDepth = DefaultMaxCallDepth
+	}
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+	if opts.Input == nil {
+		opts.Input = os.Stdin
+	}
+	return &Evaluator{
+		opts: opts,
+		// opts.Input已经是*bufio.Reader时直接使用，不会再包一层缓冲
+		input: bufio.NewReader(opts.Input),
+		// 不使用math/rand的全局生成器，各个求值器的随机数序列互不影响，seed 只影响当前求值器
+		rng: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetProfile 设置之后求值时累加执行计数的Profile，为nil时停止计数
+// 用于在同一个求值器的多次求值之间开启或关闭计数，如REPL的 :profile 命令
+func (e *Evaluator) SetProfile(profile *Profile) {
+	e.opts.Profile = profile
+}
+
+// Steps 返回求值器创建以来已经执行的求值步数
+// 步数在同一个求值器的多次Eval之间累计，MaxSteps限制的是这个总数
+func (e *Evaluator) Steps() int {
+	return e.steps
+}
+
+// Eval 是求值器的入口函数，使用默认选项对AST节点进行求值
 // 参数 node: 要求值的AST节点
 // 参数 env: 当前执行环境（变量作用域）
 // 返回值: 求值结果的对象
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New(Options{}).Eval(node, env)
+}
+
+// Eval 对AST节点进行求值
+// 求值出错时，把产生错误的最内层节点的源代码位置记录到错误对象中
+// 结果总是非nil：let等不产生值的语句返回NULL，无法求值的节点类型返回错误
+// 参数 node: 要求值的AST节点
+// 参数 env: 当前执行环境（变量作用域）
+// 返回值: 求值结果的对象
+func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	if e.opts.Trace != nil {
+		e.opts.Trace(node, e.depth, nil)
+		e.depth++
+	}
+	if e.opts.Profile != nil {
+		e.opts.Profile.Nodes[node.Kind()]++
+	}
+
+	var result object.Object
+	e.steps++
+	if e.opts.MaxSteps > 0 && e.steps > e.opts.MaxSteps {
+		// 步数用尽后每一步都立即返回错误，错误沿调用链向外传递并结束求值
+		result = newError("evaluation budget of %d steps exceeded", e.opts.MaxSteps)
+	} else {
+		result = e.eval(node, env)
+	}
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+
+	if e.opts.Trace != nil {
+		e.depth--
+		e.opts.Trace(node, e.depth, result)
+	}
+	if e.opts.Profile != nil {
+		e.opts.Profile.recordObject(result)
+	}
+	return result
+}
+
+// eval 根据节点类型分派求值，错误位置由Eval统一填写
+func (e *Evaluator) eval(node ast.Node, env *object.Environment) object.Object {
 	// 使用类型switch根据节点类型进行不同的求值处理
 	switch node := node.(type) {
 
 	// 语句求值
 	case *ast.Program:
 		// 程序节点：按顺序求值所有语句
-		return evalProgram(node, env)
+		return e.evalProgram(node, env)
 
 	case *ast.BlockStatement:
 		// 语句块节点：在独立作用域中求值语句序列
-		return evalBlockStatement(node, env)
+		return e.evalBlockStatement(node, env)
 
 	case *ast.ExpressionStatement:
 		// 表达式语句节点：求值其包含的表达式
-		return Eval(node.Expression, env)
+		return e.Eval(node.Expression, env)
 
 	case *ast.ReturnStatement:
 		// return语句：求值返回值并包装为ReturnValue对象
-		val := Eval(node.ReturnValue, env)
+		// 不带返回值的 return; 返回NULL
+		if node.ReturnValue == nil {
+			return &object.ReturnValue{Value: NULL}
+		}
+		val := e.Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
+	case *ast.BreakStatement:
+		// break语句：产生信号，由最内层的循环消耗
+		return BREAK
+
+	case *ast.ContinueStatement:
+		// continue语句：产生信号，由最内层的循环消耗
+		return CONTINUE
+
 	case *ast.LetStatement:
 		// let语句：求值赋值表达式并在环境中设置变量
-		val := Eval(node.Value, env)
-		if isError(val) {
-			return val
+		return e.evalLetStatement(node, env)
+
+	case *ast.MultiLetStatement:
+		// 多变量let语句：先求值右侧所有表达式，再依次绑定，保证 let a, b = b, a; 能正确交换
+		// 没有初始值时（let a, b;）所有变量都绑定为NULL
+		vals := make([]object.Object, len(node.Names))
+		for i := range vals {
+			vals[i] = NULL
+		}
+		if node.Values != nil {
+			vals = e.evalExpressions(node.Values, env)
+			if len(vals) == 1 && isError(vals[0]) {
+				return vals[0]
+			}
 		}
-		env.Set(node.Name.Value, val)
+		if err := checkDeclarations(node.Names, node, env); err != nil {
+			return err
+		}
+		for i, name := range node.Names {
+			env.Declare(name.Value, vals[i], node)
+		}
+		return NULL
 
 	// 表达式求值
 	case *ast.IntegerLiteral:
 		// 整数字面量：直接创建Integer对象
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		// 浮点数字面量：直接创建Float对象
+		return &object.Float{Value: node.Value}
+
 	case *ast.StringLiteral:
 		// 字符串字面量：直接创建String对象
 		return &object.String{Value: node.Value}
@@ -65,29 +237,59 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 	case *ast.PrefixExpression:
 		// 前缀表达式：先求值右侧表达式，再应用前缀运算符
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return e.evalPrefixExpression(node.Operator, right)
 
 	case *ast.InfixExpression:
+		// 逻辑运算符短路求值，右侧只在需要时才求值
+		if node.Operator == "&&" || node.Operator == "||" {
+			return e.evalLogicalExpression(node, env)
+		}
+
 		// 中缀表达式：分别求值左右表达式，再应用中缀运算符
-		left := Eval(node.Left, env)
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 
+		// 插值字符串中嵌入的值先转换为字符串，与puts的输出方式相同
+		if node.Token.Type == token.TEMPLATE {
+			right = &object.String{Value: outputString(right)}
+		}
+
 		return evalInfixExpression(node.Operator, left, right)
 
 	case *ast.IfExpression:
 		// if条件表达式：根据条件求值选择不同的分支
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
+
+	case *ast.WhileExpression:
+		// while循环表达式：条件为真时反复求值循环体
+		return e.evalWhileExpression(node, env)
+
+	case *ast.ForExpression:
+		// for循环表达式：在循环自己的作用域中执行初始化、条件、循环体和后置表达式
+		return e.evalForExpression(node, env)
+
+	case *ast.SwitchExpression:
+		// switch表达式：执行第一个匹配的case分支
+		return e.evalSwitchExpression(node, env)
+
+	case *ast.TryExpression:
+		// try/rescue表达式：捕获try块中产生的错误
+		return e.evalTryExpression(node, env)
+
+	case *ast.AssignExpression:
+		// 赋值表达式：修改已经存在的变量
+		return e.evalAssignExpression(node, env)
 
 	case *ast.Identifier:
 		// 标识符：在环境中查找变量值或内置函数
@@ -97,25 +299,48 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		// 函数字面量：创建Function对象（闭包）
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Parameters: params, Env: env, Body: body, Name: node.Name}
+
+	case *ast.MacroLiteral:
+		// 宏字面量：创建Macro对象，顶层的宏定义通常已经由 DefineMacros 取出
+		return &object.Macro{Parameters: node.Parameters, Env: env, Body: node.Body}
 
 	case *ast.CallExpression:
+		// quote 调用：参数不求值，直接返回语法树
+		if isQuoteCall(node) {
+			if len(node.Arguments) != 1 {
+				return newError("wrong number of arguments to `quote`. got=%d, want=1",
+					len(node.Arguments))
+			}
+			return e.quote(node.Arguments[0], env)
+		}
+
 		// 函数调用：求值函数和参数，然后应用函数
-		function := Eval(node.Function, env)
+		function := e.Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
 
-		args := evalExpressions(node.Arguments, env)
+		// 求值时遇到的宏调用没有被 ExpandMacros 展开（如展开失败或宏定义在函数内），
+		// 此时展开宏并求值展开结果，展开出错时返回错误
+		if macro, ok := function.(*object.Macro); ok {
+			expanded, err := e.expandMacro(macro, node)
+			if err != nil {
+				return err
+			}
+			return e.Eval(expanded, env)
+		}
+
+		args := e.evalExpressions(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		return e.applyFunction(function, args, node, env)
 
 	case *ast.ArrayLiteral:
 		// 数组字面量：求值所有元素并创建Array对象
-		elements := evalExpressions(node.Elements, env)
+		elements := e.evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
@@ -123,76 +348,235 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 	case *ast.IndexExpression:
 		// 索引表达式：求值左侧（数组/哈希）和索引，然后进行索引操作
-		left := Eval(node.Left, env)
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
+		index := e.Eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		return evalIndexExpression(left, index, env.Strict())
+
+	case *ast.SliceExpression:
+		// 切片表达式：求值被切片的数组/字符串和省略以外的下标
+		return e.evalSliceExpression(node, env)
 
 	case *ast.HashLiteral:
 		// 哈希字面量：求值所有键值对并创建Hash对象
-		return evalHashLiteral(node, env)
+		return e.evalHashLiteral(node, env)
+
+	}
+
+	// 解构模式、展开表达式等只能出现在特定位置的节点，以及求值器不认识的节点类型
+	return newError("cannot evaluate %s", node.Kind())
+}
+
+// evalLetStatement 求值let语句，把值绑定到当前环境
+// 没有初始值的声明（let x;）把变量绑定为NULL；解构形式按模式把值拆开后分别绑定。
+// 值是函数字面量或直接调用的函数字面量（let f = fn(n) {...}(5);）时，
+// 先把名称绑定到该函数再继续求值，因此函数体中的同名标识符总是指向这个新的绑定，
+// 而不是外层的同名变量，直接调用时也可以递归；调用完成后名称再绑定为调用的结果。
+// const语句以同样的方式求值，只是名称被声明为常量
+// 参数 node: let语句节点
+// 参数 env: 当前环境
+// 返回值: 正常情况下为NULL，出错时返回错误
+func (e *Evaluator) evalLetStatement(node *ast.LetStatement, env *object.Environment) object.Object {
+	declare := env.Declare
+	if node.IsConst() {
+		declare = env.DeclareConst
+	}
+
+	if node.Name != nil {
+		if err := checkDeclarations([]*ast.Identifier{node.Name}, node, env); err != nil {
+			return err
+		}
+		if lit, ok := selfBindingFunction(node.Value); ok {
+			declare(node.Name.Value, e.Eval(lit, env), node)
+			if lit == node.Value {
+				// 值就是函数字面量本身，绑定已经完成
+				return NULL
+			}
+		}
+	}
+
+	var val object.Object = NULL
+	if node.Value != nil {
+		val = e.Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+	}
 
+	if node.Pattern != nil {
+		if err := e.bindPattern(node.Pattern, val, env); err != nil {
+			return err
+		}
+		return NULL
 	}
+	declare(node.Name.Value, val, node)
+	return NULL
+}
 
+// checkDeclarations 检查一条声明语句中的变量名是否在当前环境中被重复声明
+// 同一环境中的常量总是不能被再次声明；其他变量只有环境禁止重复声明
+// （见 object.Environment.SetNoRedeclare）时才会出错；
+// 在任何变量被绑定之前检查，出错时不会只绑定一部分变量
+// 参数 names: 要声明的变量名
+// 参数 site: 声明这些变量的语法树节点
+// 参数 env: 当前环境
+// 返回值: 有变量被重复声明时返回错误，否则返回nil
+func checkDeclarations(names []*ast.Identifier, site ast.Node, env *object.Environment) *object.Error {
+	for _, name := range names {
+		if env.RedeclaredConstant(name.Value, site) {
+			return newError("cannot redeclare constant %s", name.Value)
+		}
+		if env.Redeclared(name.Value, site) {
+			return newError("%s already declared in this scope", name.Value)
+		}
+	}
 	return nil
 }
 
+// selfBindingFunction 判断let的值是否需要在求值之前先绑定名称
+// 返回值: 值本身或被直接调用的函数字面量
+func selfBindingFunction(value ast.Expression) (*ast.FunctionLiteral, bool) {
+	switch value := value.(type) {
+	case *ast.FunctionLiteral:
+		return value, true
+	case *ast.CallExpression:
+		lit, ok := value.Function.(*ast.FunctionLiteral)
+		return lit, ok
+	}
+	return nil, false
+}
+
 // evalProgram 求值整个程序（语句序列）
+// 顶层的return（包括嵌套在顶层if、循环中的return）结束程序，它的值就是程序的结果
 // 参数 program: 程序AST节点
 // 参数 env: 执行环境
-// 返回值: 最后一个语句的求值结果（遇到return或error时提前返回）
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
-	var result object.Object
+// 返回值: 最后一个语句的求值结果（遇到return或error时提前返回），没有语句时为NULL
+func (e *Evaluator) evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object = NULL
 
 	// 按顺序求值所有语句
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
 		// 检查特殊返回值类型
 		switch result := result.(type) {
 		case *object.ReturnValue:
 			// 遇到return语句，返回其值（解除包装）
 			return result.Value
-		case *object.Error:
-			// 遇到错误，直接返回错误
+		case *object.Error, *object.Exit:
+			// 遇到错误或exit，直接返回
 			return result
+		case *object.BreakSignal, *object.ContinueSignal:
+			// 传递到程序顶层的break或continue不在任何循环中
+			return loopSignalError(result)
 		}
 	}
 
 	return result
 }
 
+// loopSignalError 把没有被循环消耗的break或continue信号转换为错误
+// 参数 signal: BreakSignal或ContinueSignal
+// 返回值: 错误对象
+func loopSignalError(signal object.Object) *object.Error {
+	return newError("%s outside loop", signal.Inspect())
+}
+
+// isLoopSignal 判断对象是否为break或continue信号
+func isLoopSignal(obj object.Object) bool {
+	if obj == nil {
+		return false
+	}
+	return obj.Type() == object.BREAK_SIGNAL_OBJ || obj.Type() == object.CONTINUE_SIGNAL_OBJ
+}
+
 // evalBlockStatement 求值语句块（创建新的作用域）
 // 参数 block: 语句块AST节点
 // 参数 env: 外部执行环境
-// 返回值: 语句块中最后一个语句的求值结果
-func evalBlockStatement(
+// 返回值: 语句块中最后一个语句的求值结果，空语句块为NULL
+func (e *Evaluator) evalBlockStatement(
 	block *ast.BlockStatement,
 	env *object.Environment,
 ) object.Object {
-	var result object.Object
+	var result object.Object = NULL
 
 	// 在语句块作用域中求值所有语句
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = e.Eval(statement, env)
 
-		if result != nil {
-			rt := result.Type()
-			// 如果遇到return或error，提前返回（不解除包装）
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
-				return result
-			}
+		rt := result.Type()
+		// 如果遇到return、error、break、continue或exit，提前返回（不解除包装）
+		if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+			rt == object.BREAK_SIGNAL_OBJ || rt == object.CONTINUE_SIGNAL_OBJ ||
+			rt == object.EXIT_OBJ {
+			return result
 		}
 	}
 
 	return result
 }
 
+// bindPattern 按解构模式把值绑定到环境中
+// 参数 pattern: 解构模式（ArrayPattern或HashPattern）
+// 参数 val: 等号右侧表达式的求值结果
+// 参数 env: 执行环境
+// 返回值: 绑定失败时返回错误对象，成功时返回nil
+func (e *Evaluator) bindPattern(
+	pattern ast.Expression,
+	val object.Object,
+	env *object.Environment,
+) *object.Error {
+	switch pattern := pattern.(type) {
+	case *ast.ArrayPattern:
+		array, ok := val.(*object.Array)
+		if !ok {
+			return newError("cannot destructure %s as ARRAY", val.Type())
+		}
+
+		// 数组元素不足时报错，多余的元素被忽略
+		if len(array.Elements) < len(pattern.Names) {
+			return newError("not enough elements to destructure: want=%d, got=%d",
+				len(pattern.Names), len(array.Elements))
+		}
+
+		if err := checkDeclarations(pattern.Names, pattern, env); err != nil {
+			return err
+		}
+		for i, name := range pattern.Names {
+			env.Declare(name.Value, array.Elements[i], pattern)
+		}
+
+	case *ast.HashPattern:
+		hash, ok := val.(*object.Hash)
+		if !ok {
+			return newError("cannot destructure %s as HASH", val.Type())
+		}
+
+		if err := checkDeclarations(pattern.Names, pattern, env); err != nil {
+			return err
+		}
+		// 与索引操作一致，缺失的键绑定为null
+		for _, name := range pattern.Names {
+			key := &object.String{Value: name.Value}
+			if pair, ok := hash.Pairs[key.HashKey()]; ok {
+				env.Declare(name.Value, pair.Value, pattern)
+			} else {
+				env.Declare(name.Value, NULL, pattern)
+			}
+		}
+
+	default:
+		return newError("unknown destructuring pattern: %s", pattern.String())
+	}
+
+	return nil
+}
+
 // nativeBoolToBooleanObject 将Go布尔值转换为Monkey Boolean对象
 // 参数 input: Go布尔值
 // 返回值: 对应的Boolean对象（TRUE或FALSE）
@@ -207,11 +591,11 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 // 参数 operator: 前缀运算符（"!"或"-"）
 // 参数 right: 右侧表达式求值结果
 // 返回值: 应用前缀运算符后的结果
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func (e *Evaluator) evalPrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
 		// 逻辑非运算符
-		return evalBangOperatorExpression(right)
+		return e.evalBangOperatorExpression(right)
 	case "-":
 		// 负号运算符
 		return evalMinusPrefixOperatorExpression(right)
@@ -232,18 +616,18 @@ func evalInfixExpression(
 ) object.Object {
 	// 根据操作数类型选择不同的求值策略
 	switch {
-	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		// 整数运算
-		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		// 整数和浮点数运算
+		return evalNumericInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		// 字符串运算（仅支持连接）
+		// 字符串连接和比较
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
-		// 相等比较（引用相等）
-		return nativeBoolToBooleanObject(left == right)
+		// 相等比较（数组和哈希表逐个比较元素）
+		return nativeBoolToBooleanObject(objectsEqual(left, right))
 	case operator == "!=":
-		// 不等比较（引用不等）
-		return nativeBoolToBooleanObject(left != right)
+		// 不等比较
+		return nativeBoolToBooleanObject(!objectsEqual(left, right))
 	case left.Type() != right.Type():
 		// 类型不匹配错误
 		return newError("type mismatch: %s %s %s",
@@ -257,36 +641,179 @@ func evalInfixExpression(
 
 // evalBangOperatorExpression 求值逻辑非运算符表达式
 // 参数 right: 右侧表达式求值结果
-// 返回值: 逻辑非运算结果
-func evalBangOperatorExpression(right object.Object) object.Object {
-	switch right {
-	case TRUE:
-		// !true = false
-		return FALSE
-	case FALSE:
-		// !false = true
-		return TRUE
-	case NULL:
-		// !null = true
-		return TRUE
-	default:
-		// 其他值视为真值，!truthy = false
-		return FALSE
-	}
+// 返回值: 逻辑非运算结果，按isTruthy的规则取反：!true = false，!null = true，!5 = false
+func (e *Evaluator) evalBangOperatorExpression(right object.Object) object.Object {
+	return nativeBoolToBooleanObject(!e.isTruthy(right))
 }
 
 // evalMinusPrefixOperatorExpression 求值负号运算符表达式
 // 参数 right: 右侧表达式求值结果
 // 返回值: 负号运算结果
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	// 检查操作数类型
-	if right.Type() != object.INTEGER_OBJ {
+	// 检查操作数类型，对数值取负
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
+}
+
+// objectsEqual 判断两个对象的值是否相等
+// 数组按顺序逐个元素递归比较，哈希表要求键集合相同且每个键对应的值相等；
+// 除整数与浮点数外，类型不同的对象总是不相等，函数等其他对象比较是否为同一个对象；
+// 通过索引赋值可以构造出包含自身的数组或哈希表，比较时再次遇到正在比较的同一对对象视为相等
+func objectsEqual(left, right object.Object) bool {
+	return equalObjects(left, right, make(map[objectPair]bool))
+}
+
+// objectPair 是objectsEqual中正在比较的一对对象
+type objectPair struct {
+	left, right object.Object
+}
+
+// equalObjects 是objectsEqual的实现，comparing记录正在比较的外层数组或哈希表对，用于发现循环引用
+func equalObjects(left, right object.Object, comparing map[objectPair]bool) bool {
+	// 整数与浮点数按数值比较，与 == 运算符一致
+	if isNumber(left) && isNumber(right) {
+		if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
+			return left.(*object.Integer).Value == right.(*object.Integer).Value
+		}
+		return toFloat(left) == toFloat(right)
+	}
+	if left.Type() != right.Type() {
+		return false
+	}
+
+	switch left := left.(type) {
+	case *object.String:
+		return left.Value == right.(*object.String).Value
+	case *object.Boolean:
+		return left.Value == right.(*object.Boolean).Value
+	case *object.Null:
+		return true
+	case *object.Array:
+		right := right.(*object.Array)
+		if len(left.Elements) != len(right.Elements) {
+			return false
+		}
+		pair := objectPair{left, right}
+		if comparing[pair] {
+			return true
+		}
+		comparing[pair] = true
+		defer delete(comparing, pair)
+		for i := range left.Elements {
+			if !equalObjects(left.Elements[i], right.Elements[i], comparing) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		right := right.(*object.Hash)
+		if len(left.Pairs) != len(right.Pairs) {
+			return false
+		}
+		pair := objectPair{left, right}
+		if comparing[pair] {
+			return true
+		}
+		comparing[pair] = true
+		defer delete(comparing, pair)
+		for key, pair := range left.Pairs {
+			other, ok := right.Pairs[key]
+			if !ok || !equalObjects(pair.Value, other.Value, comparing) {
+				return false
+			}
+		}
+		return true
+	}
+	return left == right
+}
+
+// isNumber 判断对象是否为数值（整数或浮点数）
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// toFloat 把数值对象转换为float64，调用前应确认isNumber
+func toFloat(obj object.Object) float64 {
+	if integer, ok := obj.(*object.Integer); ok {
+		return float64(integer.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+// floatToInteger 把已经取整的浮点数转换为整数对象
+// float64(math.MaxInt64) 恰好是2^63，已经超出int64的范围，因此上界不能取等号
+// 返回值: 整数对象；NaN、无穷大或超出int64范围时返回false
+func floatToInteger(f float64) (*object.Integer, bool) {
+	if math.IsNaN(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return nil, false
+	}
+	return &object.Integer{Value: int64(f)}, true
+}
+
+// evalNumericInfixExpression 求值两个数值之间的中缀表达式
+// 两个整数的运算结果仍是整数；只要有一个操作数是浮点数，两个操作数都提升为浮点数再运算，
+// 因此 1 == 1.0 为true，1 + 0.5 为1.5；例外是向下取整除法 //，结果总是整数
+// 参数 operator: 运算符
+// 参数 left: 左侧数值对象
+// 参数 right: 右侧数值对象
+// 返回值: 运算结果
+func evalNumericInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
+		return evalIntegerInfixExpression(operator, left, right)
+	}
+
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
 
-	// 对整数值取负
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		// 与整数除法一致，除数为零时返回错误而不是无穷大
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Float{Value: leftVal / rightVal}
+	case "//":
+		// 向下取整后转换为整数，与整数的 // 一样结果总是整数
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		quotient, ok := floatToInteger(math.Floor(leftVal / rightVal))
+		if !ok {
+			return newError("floor division result out of range: %s // %s",
+				left.Inspect(), right.Inspect())
+		}
+		return quotient
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
 }
 
 // evalIntegerInfixExpression 求值整数中缀表达式
@@ -311,11 +838,37 @@ func evalIntegerInfixExpression(
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		// 整数除法的结果仍是整数，向零截断：7 / 2 == 3，-7 / 2 == -3；
+		// 需要向下取整时使用 //，需要小数结果时让一个操作数为浮点数，如 7 / 2.0
+		// 除数为零时返回错误对象，避免Go运行时panic
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "//":
+		// 向下取整：-7 // 2 == -4，7 // -2 == -4；商为整数时与 / 相同
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		quotient := leftVal / rightVal
+		if leftVal%rightVal != 0 && (leftVal < 0) != (rightVal < 0) {
+			quotient--
+		}
+		return &object.Integer{Value: quotient}
+	case "%":
+		// 余数的符号与被除数相同，与Go的%运算一致：-7 % 3 == -1，7 % -3 == 1
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -335,45 +888,322 @@ func evalStringInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
-	// 字符串只支持连接运算
-	if operator != "+" {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	// 字符串支持连接和比较，比较的是内容而不是对象本身；大小按字节的字典序
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	default:
 		return newError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
-
-	// 字符串连接
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
 }
 
 // evalIfExpression 求值if条件表达式
 // 参数 ie: if表达式AST节点
 // 参数 env: 执行环境
 // 返回值: 选择的分支求值结果
-func evalIfExpression(
+func (e *Evaluator) evalIfExpression(
 	ie *ast.IfExpression,
 	env *object.Environment,
 ) object.Object {
 	// 求值条件表达式
-	condition := Eval(ie.Condition, env)
+	condition := e.Eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
 	// 根据条件真值选择分支
-	if isTruthy(condition) {
+	if e.isTruthy(condition) {
 		// 条件为真，执行consequence分支
-		return Eval(ie.Consequence, env)
+		return e.Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
 		// 条件为假且有else分支，执行alternative分支
-		return Eval(ie.Alternative, env)
+		return e.Eval(ie.Alternative, env)
 	} else {
 		// 条件为假且无else分支，返回null
 		return NULL
 	}
 }
 
+// evalWhileExpression 求值while循环表达式
+// 每次循环先求值条件，条件不为真时结束；循环体中的return和错误立即向外传递，
+// 因此函数内的while循环中的return会从函数返回。break结束循环，continue直接进入下一次循环
+// 参数 we: while循环表达式节点
+// 参数 env: 当前环境，循环体与if分支一样直接在当前环境中求值
+// 返回值: 最后一次完整执行循环体的结果，一次都没有完整执行时返回NULL
+func (e *Evaluator) evalWhileExpression(
+	we *ast.WhileExpression,
+	env *object.Environment,
+) object.Object {
+	var result object.Object = NULL
+
+	for {
+		condition := e.Eval(we.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !e.isTruthy(condition) {
+			return result
+		}
+
+		body := e.Eval(we.Body, env)
+		switch body.(type) {
+		case *object.BreakSignal:
+			return result
+		case *object.ContinueSignal:
+			continue
+		case *object.ReturnValue, *object.Error, *object.Exit:
+			return body
+		default:
+			result = body
+		}
+	}
+}
+
+// evalForExpression 求值for循环表达式
+// 循环在新的封闭环境中执行，初始化语句中let声明的变量不会泄漏到外层作用域；
+// return、错误、break和continue的处理与while循环相同，continue之后仍会求值后置表达式
+// 参数 fe: for循环表达式节点
+// 参数 env: 当前环境
+// 返回值: 最后一次完整执行循环体的结果，一次都没有完整执行时返回NULL
+func (e *Evaluator) evalForExpression(
+	fe *ast.ForExpression,
+	env *object.Environment,
+) object.Object {
+	loopEnv := object.NewEnclosedEnvironment(env)
+
+	if fe.Init != nil {
+		init := e.Eval(fe.Init, loopEnv)
+		if isError(init) {
+			return init
+		}
+	}
+
+	var result object.Object = NULL
+
+	for {
+		// 省略条件时一直循环
+		if fe.Condition != nil {
+			condition := e.Eval(fe.Condition, loopEnv)
+			if isError(condition) {
+				return condition
+			}
+			if !e.isTruthy(condition) {
+				return result
+			}
+		}
+
+		body := e.Eval(fe.Body, loopEnv)
+		switch body.(type) {
+		case *object.BreakSignal:
+			return result
+		case *object.ContinueSignal:
+			// continue之后照常求值后置表达式
+		case *object.ReturnValue, *object.Error, *object.Exit:
+			return body
+		default:
+			result = body
+		}
+
+		if fe.Post != nil {
+			post := e.Eval(fe.Post, loopEnv)
+			if isError(post) {
+				return post
+			}
+		}
+	}
+}
+
+// evalSwitchExpression 求值switch表达式
+// 被匹配的值只求值一次，然后按顺序求值各个case分支中的值，用==的语义（包括字符串和
+// 数组、哈希表的深度相等）与之比较，执行第一个匹配的分支；没有分支匹配时执行default分支。
+// 被匹配的值或case中的值求值出错时立即返回错误，后面的分支不再求值
+// 参数 se: switch表达式节点
+// 参数 env: 当前环境，分支在新的封闭环境中执行，分支中let声明的变量不会泄漏到外层
+// 返回值: 执行的分支的结果，没有分支执行时返回NULL
+func (e *Evaluator) evalSwitchExpression(
+	se *ast.SwitchExpression,
+	env *object.Environment,
+) object.Object {
+	subject := e.Eval(se.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, c := range se.Cases {
+		for _, value := range c.Values {
+			candidate := e.Eval(value, env)
+			if isError(candidate) {
+				return candidate
+			}
+			if evalInfixExpression("==", subject, candidate) == TRUE {
+				return e.Eval(c.Body, object.NewEnclosedEnvironment(env))
+			}
+		}
+	}
+
+	if se.Default != nil {
+		return e.Eval(se.Default, object.NewEnclosedEnvironment(env))
+	}
+	return NULL
+}
+
+// evalTryExpression 求值try/rescue表达式
+// try块的结果是错误时错误不再向外传递，改为执行rescue块，错误信息以哈希表的形式绑定到
+// rescue的参数上，见 errorInfo；try块中的return、break、continue和exit照常向外传递。
+// 步数用尽的错误同样可以被捕获，但之后的每一步仍会出错，因此无法借此绕过MaxSteps
+// 参数 te: try/rescue表达式节点
+// 参数 env: 当前环境，两个语句块都在新的封闭环境中执行
+// 返回值: 没有出错时为try块的值，否则为rescue块的值
+func (e *Evaluator) evalTryExpression(
+	te *ast.TryExpression,
+	env *object.Environment,
+) object.Object {
+	result := e.Eval(te.Body, object.NewEnclosedEnvironment(env))
+	err, ok := result.(*object.Error)
+	if !ok {
+		return result
+	}
+
+	rescueEnv := object.NewEnclosedEnvironment(env)
+	rescueEnv.Set(te.Param.Value, errorInfo(err))
+	return e.Eval(te.Rescue, rescueEnv)
+}
+
+// errorInfo 把错误对象转换为rescue块中可以访问的哈希表
+// 包含 "message"（错误消息）、"line" 和 "column"（出错位置，未知时为0）三个键
+func errorInfo(err *object.Error) *object.Hash {
+	pairs := make(map[object.HashKey]object.HashPair)
+	set := func(key string, value object.Object) {
+		k := &object.String{Value: key}
+		pairs[k.HashKey()] = object.HashPair{Key: k, Value: value}
+	}
+
+	set("message", &object.String{Value: err.Message})
+	set("line", &object.Integer{Value: int64(err.Pos.Line)})
+	set("column", &object.Integer{Value: int64(err.Pos.Column)})
+
+	return &object.Hash{Pairs: pairs}
+}
+
+// evalAssignExpression 求值赋值表达式
+// 赋值只修改已经存在的变量，变量定义在哪一层作用域就修改哪一层；
+// 不会隐式创建新变量，给未定义的变量赋值返回错误；
+// 变量解析到const声明的常量时同样返回错误，无论赋值发生在哪一层作用域（包括闭包中）。
+// 常量只保证绑定不变，常量所指向的数组或哈希表的元素仍然可以通过索引赋值修改
+// 参数 ae: 赋值表达式节点
+// 参数 env: 当前环境
+// 左侧为索引表达式时修改容器中的元素，见 evalIndexAssignment
+// 返回值: 赋给变量的新值
+func (e *Evaluator) evalAssignExpression(
+	ae *ast.AssignExpression,
+	env *object.Environment,
+) object.Object {
+	switch target := ae.Target.(type) {
+	case *ast.Identifier:
+		val := e.Eval(ae.Value, env)
+		if isError(val) {
+			return val
+		}
+
+		if env.Constant(target.Value) {
+			return newError("cannot assign to constant %s", target.Value)
+		}
+		if _, ok := env.Assign(target.Value, val); !ok {
+			return newError("identifier not found: " + target.Value)
+		}
+		return val
+	case *ast.IndexExpression:
+		return e.evalIndexAssignment(target, ae.Value, env)
+	default:
+		return newError("invalid assignment target: %s", ae.Target.String())
+	}
+}
+
+// evalIndexAssignment 求值对索引表达式的赋值（如 h["count"] = 1 或 h.count = 1）
+// 依次求值容器、索引和新值；数组和哈希表被原地修改而不是复制，
+// 因此所有引用同一个容器的变量都能看到新的元素
+// 参数 target: 被赋值的索引表达式
+// 参数 value: 新值的表达式
+// 参数 env: 当前环境
+// 返回值: 赋给元素的新值，容器类型不支持赋值或键不可哈希时返回错误
+func (e *Evaluator) evalIndexAssignment(
+	target *ast.IndexExpression,
+	value ast.Expression,
+	env *object.Environment,
+) object.Object {
+	left := e.Eval(target.Left, env)
+	if isError(left) {
+		return left
+	}
+	index := e.Eval(target.Index, env)
+	if isError(index) {
+		return index
+	}
+	val := e.Eval(value, env)
+	if isError(val) {
+		return val
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		return assignArrayElement(left, index, val)
+	case *object.Hash:
+		return assignHashElement(left, index, val)
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+}
+
+// assignArrayElement 替换数组中已有位置的元素
+// 赋值不会让数组变长，越界的索引无论是否为严格模式都返回错误；
+// rest和push的结果可能与参数数组共享元素（见 object.Array.Rest），修改对共享的数组都可见
+// 参数 array: 被修改的数组
+// 参数 index: 索引对象，必须是整数
+// 参数 val: 新值
+// 返回值: 赋给元素的新值，索引不是整数或越界时返回错误
+func assignArrayElement(array *object.Array, index, val object.Object) object.Object {
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		return newError("array index must be INTEGER, got %s", index.Type())
+	}
+	idx := integer.Value
+	if idx < 0 || idx >= int64(len(array.Elements)) {
+		return newError("index out of range: %d (array length %d)", idx, len(array.Elements))
+	}
+	array.Elements[idx] = val
+	return val
+}
+
+// assignHashElement 在哈希表中插入或覆盖一个键值对
+// 参数 hash: 被修改的哈希表
+// 参数 key: 键对象，必须实现Hashable接口
+// 参数 val: 新值
+// 返回值: 赋给元素的新值，键不可哈希时返回错误
+func assignHashElement(hash *object.Hash, key, val object.Object) object.Object {
+	hashKey, ok := key.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", key.Type())
+	}
+	hash.Pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: val}
+	return val
+}
+
 // evalIdentifier 求值标识符表达式
 // 参数 node: 标识符AST节点
 // 参数 env: 执行环境
@@ -392,10 +1222,56 @@ func evalIdentifier(
 		return builtin
 	}
 
-	// 未找到标识符，返回错误
+	// 未找到标识符，返回错误，有拼写相近的名称时附带提示
+	if suggestion, ok := suggestName(node.Value, env); ok {
+		return newError("identifier not found: %s (did you mean %s?)", node.Value, suggestion)
+	}
 	return newError("identifier not found: " + node.Value)
 }
 
+// evalLogicalExpression 对 && 和 || 进行短路求值
+// 左侧的真值已能决定结果时不再求值右侧，因此 false && f() 不会调用f
+// 参数 node: 运算符为 && 或 || 的中缀表达式
+// 参数 env: 当前环境
+// 返回值: 按isTruthy规则得到的布尔对象
+func (e *Evaluator) evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := e.Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	if node.Operator == "&&" && !e.isTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && e.isTruthy(left) {
+		return TRUE
+	}
+
+	right := e.Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(e.isTruthy(right))
+}
+
+// isTruthy 按求值器的选项判断对象在条件表达式中的真值
+// 开启LooseTruthiness时，整数0、空字符串和空数组也为假值；其余情况见 isTruthy
+// 参数 obj: 要判断的对象
+// 返回值: 对象的真值
+func (e *Evaluator) isTruthy(obj object.Object) bool {
+	if e.opts.LooseTruthiness {
+		switch obj := obj.(type) {
+		case *object.Integer:
+			return obj.Value != 0
+		case *object.String:
+			return obj.Value != ""
+		case *object.Array:
+			return len(obj.Elements) != 0
+		}
+	}
+	return isTruthy(obj)
+}
+
 // isTruthy 判断对象在条件表达式中的真值
 // 参数 obj: 要判断的对象
 // 返回值: 对象的真值（Monkey语言的truthy/falsy规则）
@@ -424,12 +1300,13 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
-// isError 检查对象是否为错误对象
+// isError 检查对象是否为错误对象或exit信号
+// exit信号与错误一样中止求值，所有遇到错误就向外传递的地方都原样传递它
 // 参数 obj: 要检查的对象
-// 返回值: 如果是错误对象返回true
+// 返回值: 如果是错误对象或exit信号返回true
 func isError(obj object.Object) bool {
 	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+		return obj.Type() == object.ERROR_OBJ || obj.Type() == object.EXIT_OBJ
 	}
 	return false
 }
@@ -438,15 +1315,25 @@ func isError(obj object.Object) bool {
 // 参数 exps: 表达式切片
 // 参数 env: 执行环境
 // 返回值: 求值结果的对象切片
-func evalExpressions(
+func (e *Evaluator) evalExpressions(
 	exps []ast.Expression,
 	env *object.Environment,
 ) []object.Object {
 	var result []object.Object
 
 	// 按顺序求值所有表达式
-	for _, e := range exps {
-		evaluated := Eval(e, env)
+	for _, exp := range exps {
+		// 展开表达式：把数组的元素逐个追加到结果中
+		if spread, ok := exp.(*ast.SpreadExpression); ok {
+			elements := e.evalSpreadExpression(spread, env)
+			if len(elements) == 1 && isError(elements[0]) {
+				return elements
+			}
+			result = append(result, elements...)
+			continue
+		}
+
+		evaluated := e.Eval(exp, env)
 		// 如果遇到错误，立即返回错误（包装在切片中）
 		if isError(evaluated) {
 			return []object.Object{evaluated}
@@ -457,23 +1344,111 @@ func evalExpressions(
 	return result
 }
 
+// evalSpreadExpression 求值展开表达式
+// 参数 spread: 展开表达式AST节点
+// 参数 env: 执行环境
+// 返回值: 数组中的所有元素；出错时返回只包含错误对象的切片
+func (e *Evaluator) evalSpreadExpression(
+	spread *ast.SpreadExpression,
+	env *object.Environment,
+) []object.Object {
+	value := e.Eval(spread.Value, env)
+	if isError(value) {
+		return []object.Object{value}
+	}
+
+	// 只有数组可以被展开
+	array, ok := value.(*object.Array)
+	if !ok {
+		return []object.Object{
+			newError("spread operator not supported: %s", value.Type()),
+		}
+	}
+
+	return array.Elements
+}
+
 // applyFunction 应用函数调用
+// 调用用户定义函数时把一帧压入调用栈，函数体中产生的错误会记录下出错时的调用栈
 // 参数 fn: 函数对象（Function或Builtin）
 // 参数 args: 参数对象切片
+// 参数 call: 调用表达式，用于确定调用栈中的函数名和调用位置，可以为nil
+// 参数 env: 调用处的环境，eval等内置函数在其中求值代码
 // 返回值: 函数调用结果
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func (e *Evaluator) applyFunction(
+	fn object.Object,
+	args []object.Object,
+	call *ast.CallExpression,
+	env *object.Environment,
+) object.Object {
 	// 根据函数类型进行不同的处理
 	switch fn := fn.(type) {
 
 	case *object.Function:
+		// 实参个数必须与形参个数一致，多传或少传都是错误
+		if len(args) != len(fn.Parameters) {
+			if fn.Name != "" {
+				return newError("wrong number of arguments to `%s`: expected %d, got %d",
+					fn.Name, len(fn.Parameters), len(args))
+			}
+			return newError("wrong number of arguments: expected %d, got %d",
+				len(fn.Parameters), len(args))
+		}
+
+		// 限制调用深度，无限递归返回错误而不是耗尽Go调用栈
+		if len(e.stack) >= e.opts.MaxCallDepth {
+			if fn.Name != "" {
+				return newError("maximum call depth of %d exceeded in call to `%s`",
+					e.opts.MaxCallDepth, fn.Name)
+			}
+			return newError("maximum call depth of %d exceeded", e.opts.MaxCallDepth)
+		}
+		if e.opts.Profile != nil {
+			e.opts.Profile.Calls[frameName(fn, call)]++
+		}
+		e.stack = append(e.stack, activation{fn: fn, call: call})
+		defer func() { e.stack = e.stack[:len(e.stack)-1] }()
+
 		// 用户定义函数：扩展环境并求值函数体
 		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
+		evaluated := e.Eval(fn.Body, extendedEnv)
+		// break和continue不能穿过函数边界跳出调用方的循环
+		if isLoopSignal(evaluated) {
+			evaluated = loopSignalError(evaluated)
+		}
+		// 错误经过的第一层函数调用就是出错时的调用栈，外层调用不再覆盖
+		if err, ok := evaluated.(*object.Error); ok && err.Stack == nil {
+			err.Stack = e.callStack()
+		}
 		return unwrapReturnValue(evaluated)
 
+	case *object.Memoized:
+		// 带缓存的函数：命中缓存时直接返回，否则调用被包装的函数并记录结果
+		key, err := memoKey(args)
+		if err != nil {
+			return err
+		}
+		if result, ok := fn.Cache[key]; ok {
+			return result
+		}
+		result := e.applyFunction(fn.Fn, args, call, env)
+		// 错误不缓存，调用深度或求值步数超限后可能需要重试
+		if !isError(result) {
+			fn.Cache[key] = result
+		}
+		return result
+
 	case *object.Builtin:
 		// 内置函数：直接调用函数实现
-		return fn.Fn(args...)
+		if e.opts.Profile != nil {
+			e.opts.Profile.Calls[builtinName(call)]++
+		}
+		result := fn.Fn(e.builtinContext(env), args...)
+		// 内置函数没有返回值时按NULL处理，Eval的结果总是非nil
+		if result == nil {
+			return NULL
+		}
+		return result
 
 	default:
 		// 非函数对象错误
@@ -481,16 +1456,109 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 	}
 }
 
+// memoKey 根据实参的哈希键生成带缓存函数的缓存键
+// 参数 args: 参数对象切片
+// 返回值: 缓存键，有参数不可哈希时返回错误
+func memoKey(args []object.Object) (string, *object.Error) {
+	var key strings.Builder
+	for _, arg := range args {
+		hashable, ok := arg.(object.Hashable)
+		if !ok {
+			return "", newError("unusable as memo key: %s", arg.Type())
+		}
+		hashKey := hashable.HashKey()
+		fmt.Fprintf(&key, "%s:%d;", hashKey.Type, hashKey.Value)
+	}
+	return key.String(), nil
+}
+
+// callFrame 根据被调用的函数和调用表达式生成调用栈帧
+// 函数名见 frameName，位置为调用表达式的起始位置
+func callFrame(fn *object.Function, call *ast.CallExpression) object.Frame {
+	frame := object.Frame{Function: frameName(fn, call)}
+	if call != nil {
+		frame.Pos = call.Pos()
+	}
+	return frame
+}
+
+// frameName 返回调用栈中显示的函数名
+// 有名称的函数使用函数名；匿名函数直接按名称调用（包括 recv.f() 方法调用语法）时
+// 使用调用处的名称，其余情况为 "<anonymous>"
+func frameName(fn *object.Function, call *ast.CallExpression) string {
+	if fn.Name != "" {
+		return fn.Name
+	}
+	if call != nil {
+		if ident, ok := call.Function.(*ast.Identifier); ok {
+			return ident.Value
+		}
+	}
+	return "<anonymous>"
+}
+
+// builtinContext 创建调用内置函数时传入的上下文，见 object.BuiltinContext
+// env是调用该内置函数处的环境，回调和eval都与它关联
+func (e *Evaluator) builtinContext(env *object.Environment) object.BuiltinContext {
+	return object.BuiltinContext{
+		Out:  e.opts.Output,
+		In:   e.input,
+		Rand: e.rng,
+		Env:  env,
+		Host: builtinHost{e},
+	}
+}
+
+// builtinHost 为内置函数实现 object.BuiltinHost，不把这两个方法暴露为Evaluator的公开方法
+type builtinHost struct {
+	e *Evaluator
+}
+
+// CallFunction 调用内置函数的参数中传入的函数
+// 回调没有对应的调用表达式，调用栈中匿名的回调函数显示为 "<anonymous>"；
+// env是调用该内置函数处的环境，作为回调传入的eval在其中求值
+func (h builtinHost) CallFunction(env *object.Environment, fn object.Object, args ...object.Object) object.Object {
+	return h.e.applyFunction(fn, args, nil, env)
+}
+
+// EvalProgram 在env中求值程序
+// 程序与REPL的输入一样先定义并展开宏；顶层的return只结束这段程序，
+// 没有被循环消耗的break和continue转换为错误
+func (h builtinHost) EvalProgram(env *object.Environment, program *ast.Program) object.Object {
+	DefineMacros(program, env)
+	expanded := ExpandMacros(program, env)
+	return UnwrapResult(h.e.Eval(expanded, env))
+}
+
+// builtinName 返回调用处使用的内置函数名称，无法确定时为 "<builtin>"
+func builtinName(call *ast.CallExpression) string {
+	if call != nil {
+		if ident, ok := call.Function.(*ast.Identifier); ok {
+			return ident.Value
+		}
+	}
+	return "<builtin>"
+}
+
+// callStack 返回当前调用栈的副本，最内层的调用在前
+func (e *Evaluator) callStack() []object.Frame {
+	stack := make([]object.Frame, len(e.stack))
+	for i, a := range e.stack {
+		stack[len(e.stack)-1-i] = callFrame(a.fn, a.call)
+	}
+	return stack
+}
+
 // extendFunctionEnv 扩展函数环境（创建闭包环境）
 // 参数 fn: 函数对象
-// 参数 args: 参数对象切片
+// 参数 args: 参数对象切片，调用方已保证个数与形参相同
 // 返回值: 扩展后的新环境
 func extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
 ) *object.Environment {
-	// 创建封闭环境（继承函数定义时的环境）
-	env := object.NewEnclosedEnvironment(fn.Env)
+	// 创建封闭环境（继承函数定义时的环境），形参不多时不需要分配映射
+	env := object.NewEnclosedEnvironmentSize(fn.Env, len(fn.Parameters))
 
 	// 将参数绑定到新环境中
 	for paramIdx, param := range fn.Parameters {
@@ -500,6 +1568,19 @@ func extendFunctionEnv(
 	return env
 }
 
+// UnwrapResult 把求值结果整理为可以展示给用户的最终结果
+// 求值Program时已经做了同样的处理；直接求值语句块等其他节点时，
+// 其中的return会以ReturnValue的形式传递出来，break和continue会以信号的形式传递出来，
+// 本函数解除ReturnValue的包装，并把没有被循环消耗的信号转换为错误
+// 参数 obj: Eval的结果，可以为nil
+// 返回值: 最终结果
+func UnwrapResult(obj object.Object) object.Object {
+	if isLoopSignal(obj) {
+		return loopSignalError(obj)
+	}
+	return unwrapReturnValue(obj)
+}
+
 // unwrapReturnValue 解除ReturnValue对象的包装
 // 参数 obj: 可能包装了ReturnValue的对象
 // 返回值: 解除包装后的实际值
@@ -516,16 +1597,20 @@ func unwrapReturnValue(obj object.Object) object.Object {
 // evalIndexExpression 求值索引表达式
 // 参数 left: 左侧表达式求值结果（数组或哈希）
 // 参数 index: 索引表达式求值结果
+// 参数 strict: 是否为严格模式，严格模式下越界或键不存在时返回错误而不是null
 // 返回值: 索引操作结果
-func evalIndexExpression(left, index object.Object) object.Object {
+func evalIndexExpression(left, index object.Object, strict bool) object.Object {
 	// 根据左侧对象类型选择不同的索引策略
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		// 数组索引：使用整数索引访问元素
-		return evalArrayIndexExpression(left, index)
+		return evalArrayIndexExpression(left, index, strict)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		// 字符串索引：使用整数索引取出单个字节
+		return evalStringIndexExpression(left, index, strict)
 	case left.Type() == object.HASH_OBJ:
 		// 哈希索引：使用可哈希键访问值
-		return evalHashIndexExpression(left, index)
+		return evalHashIndexExpression(left, index, strict)
 	default:
 		// 不支持的索引操作错误
 		return newError("index operator not supported: %s", left.Type())
@@ -535,14 +1620,18 @@ func evalIndexExpression(left, index object.Object) object.Object {
 // evalArrayIndexExpression 求值数组索引表达式
 // 参数 array: 数组对象
 // 参数 index: 整数索引对象
-// 返回值: 索引位置的元素或null（越界时）
-func evalArrayIndexExpression(array, index object.Object) object.Object {
+// 参数 strict: 是否为严格模式
+// 返回值: 索引位置的元素；越界时返回null，严格模式下返回错误
+func evalArrayIndexExpression(array, index object.Object, strict bool) object.Object {
 	arrayObject := array.(*object.Array)
 	idx := index.(*object.Integer).Value
 	max := int64(len(arrayObject.Elements) - 1)
 
 	// 检查索引边界
 	if idx < 0 || idx > max {
+		if strict {
+			return newError("index out of range: %d (array length %d)", idx, len(arrayObject.Elements))
+		}
 		// 索引越界，返回null
 		return NULL
 	}
@@ -552,19 +1641,21 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 }
 
 // evalHashLiteral 求值哈希字面量表达式
+// 键值对按源码顺序求值，每一对先求值键再求值值，因此副作用的顺序是确定的，
+// 多个键值对出错时总是返回第一个错误
 // 参数 node: 哈希字面量AST节点
 // 参数 env: 执行环境
 // 返回值: 哈希对象
-func evalHashLiteral(
+func (e *Evaluator) evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
 ) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 
-	// 遍历所有键值对，分别求值
-	for keyNode, valueNode := range node.Pairs {
+	// 按源码顺序遍历所有键值对，分别求值
+	for _, pairNode := range node.Pairs {
 		// 求值键表达式
-		key := Eval(keyNode, env)
+		key := e.Eval(pairNode.Key, env)
 		if isError(key) {
 			return key
 		}
@@ -576,7 +1667,7 @@ func evalHashLiteral(
 		}
 
 		// 求值值表达式
-		value := Eval(valueNode, env)
+		value := e.Eval(pairNode.Value, env)
 		if isError(value) {
 			return value
 		}
@@ -589,26 +1680,137 @@ func evalHashLiteral(
 	return &object.Hash{Pairs: pairs}
 }
 
+// evalStringIndexExpression 求值字符串索引表达式
+// 字符串按字符（rune）索引，与substr、index_of使用的位置一致；注意len返回的是字节数
+// 参数 str: 字符串对象
+// 参数 index: 整数索引对象
+// 参数 strict: 是否为严格模式
+// 返回值: 只包含一个字符的字符串，索引越界（包括负数）时与数组一致，返回null或在严格模式下返回错误
+func evalStringIndexExpression(str, index object.Object, strict bool) object.Object {
+	runes := []rune(str.(*object.String).Value)
+	idx := index.(*object.Integer).Value
+
+	if idx < 0 || idx >= int64(len(runes)) {
+		if strict {
+			return newError("index out of range: %d (string length %d)", idx, len(runes))
+		}
+		return NULL
+	}
+
+	return &object.String{Value: string(runes[idx])}
+}
+
+// evalSliceExpression 求值切片表达式 left[low:high]，返回新的数组或字符串
+// 省略的low为0、high为长度；超出范围的下标被限制到 [0, 长度] 之内，low大于high时结果为空，
+// 与越界索引返回null一样不报错；字符串与索引一样按字符（rune）切片
+// 参数 node: 切片表达式节点
+// 参数 env: 当前环境
+// 返回值: 切片结果，下标不是整数或左侧不支持切片时返回错误
+func (e *Evaluator) evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := e.Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	var length int64
+	var runes []rune
+	switch left := left.(type) {
+	case *object.Array:
+		length = int64(len(left.Elements))
+	case *object.String:
+		runes = []rune(left.Value)
+		length = int64(len(runes))
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+
+	low, err := e.evalSliceBound(node.Low, env, 0, length)
+	if err != nil {
+		return err
+	}
+	high, err := e.evalSliceBound(node.High, env, length, length)
+	if err != nil {
+		return err
+	}
+	if low > high {
+		high = low
+	}
+
+	if array, ok := left.(*object.Array); ok {
+		elements := make([]object.Object, high-low)
+		copy(elements, array.Elements[low:high])
+		return &object.Array{Elements: elements}
+	}
+	return &object.String{Value: string(runes[low:high])}
+}
+
+// evalSliceBound 求值切片的一个下标并限制到 [0, length] 之内
+// 参数 exp: 下标表达式，省略时为nil
+// 参数 def: 省略下标时使用的值
+// 返回值: 下标，以及求值出错或下标不是整数时的错误对象
+func (e *Evaluator) evalSliceBound(exp ast.Expression, env *object.Environment, def, length int64) (int64, object.Object) {
+	if exp == nil {
+		return def, nil
+	}
+
+	bound := e.Eval(exp, env)
+	if isError(bound) {
+		return 0, bound
+	}
+	integer, ok := bound.(*object.Integer)
+	if !ok {
+		return 0, newError("slice index must be INTEGER, got %s", bound.Type())
+	}
+
+	switch {
+	case integer.Value < 0:
+		return 0, nil
+	case integer.Value > length:
+		return length, nil
+	}
+	return integer.Value, nil
+}
+
 // evalHashIndexExpression 求值哈希索引表达式
 // 参数 hash: 哈希对象
 // 参数 index: 索引键对象
-// 返回值: 对应键的值或null（不存在时）
-func evalHashIndexExpression(hash, index object.Object) object.Object {
+// 参数 strict: 是否为严格模式
+// 返回值: 对应键的值；键不存在时返回null，严格模式下返回错误
+func evalHashIndexExpression(hash, index object.Object, strict bool) object.Object {
 	hashObject := hash.(*object.Hash)
 
-	// 检查索引键是否可哈希
-	key, ok := index.(object.Hashable)
-	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
-	}
-
 	// 在哈希中查找键值对
-	pair, ok := hashObject.Pairs[key.HashKey()]
-	if !ok {
+	value, found, err := lookupHashKey(hashObject, index)
+	if err != nil {
+		return err
+	}
+	if !found {
+		if strict {
+			return newError("key not found: %s (hash length %d)", index.Inspect(), len(hashObject.Pairs))
+		}
 		// 键不存在，返回null
 		return NULL
 	}
 
 	// 返回对应的值
-	return pair.Value
+	return value
+}
+
+// lookupHashKey 在哈希表中查找键
+// 与索引表达式不同，它能区分键不存在和键对应的值为null这两种情况
+// 参数 hash: 哈希对象
+// 参数 key: 要查找的键
+// 返回值: 键对应的值、键是否存在；键不可哈希时返回错误对象
+func lookupHashKey(hash *object.Hash, key object.Object) (object.Object, bool, *object.Error) {
+	// 检查键是否可哈希
+	hashable, ok := key.(object.Hashable)
+	if !ok {
+		return nil, false, newError("unusable as hash key: %s", key.Type())
+	}
+
+	pair, ok := hash.Pairs[hashable.HashKey()]
+	if !ok {
+		return nil, false, nil
+	}
+	return pair.Value, true, nil
 }
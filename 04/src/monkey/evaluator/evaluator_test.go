@@ -1,9 +1,16 @@
 package evaluator
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"monkey/ast"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/token"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -27,6 +34,29 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"9 % 3", 0},
+		{"2 + 7 % 4 * 2", 8},
+		{"(2 + 7) % 4", 1},
+		// 负数取模沿用Go的语义：结果的符号与被除数相同
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"-7 % -3", -1},
+		// / 向零截断
+		{"7 / 2", 3},
+		{"-7 / 2", -3},
+		{"7 / -2", -3},
+		{"-7 / -2", 3},
+		// // 向下取整
+		{"7 // 2", 3},
+		{"-7 // 2", -4},
+		{"7 // -2", -4},
+		{"-7 // -2", 3},
+		{"-8 // 2", -4},
+		{"-1 // 3", -1},
+		{"0 // -3", 0},
+		{"1 + 7 // 2 * 2", 7},
+		{"-7 // 2 * 2 + -7 % 2", -9},
 	}
 
 	for _, tt := range tests {
@@ -59,6 +89,18 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"1 <= 2", true},
+		{"2 <= 1", false},
+		{"1 <= 1", true},
+		{"-1 <= -1", true},
+		{"1 >= 2", false},
+		{"2 >= 1", true},
+		{"1 >= 1", true},
+		{"0 >= -1", true},
+		{"1 + 1 <= 2", true},
+		{"2 * 3 >= 7", false},
+		{"(1 <= 2) == (2 >= 1)", true},
+		{"(5 >= 5) != true", false},
 	}
 
 	for _, tt := range tests {
@@ -67,6 +109,257 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"true || false", true},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"false || true && false", false},
+		{"(false || true) && true", true},
+		// 操作数按isTruthy判断，结果总是布尔值
+		{"1 && \"a\"", true},
+		{"0 || false", true},
+		{"if (false) { 1 } || false", false},
+		// 短路：右侧不会被求值
+		{"false && (1 / 0 == 0)", false},
+		{"true || undefinedIdent", true},
+		{"let f = fn() { 1 / 0 }; false && f()", false},
+		{"let f = fn() { undefinedIdent }; true || f()", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+// unknownNode 是求值器不认识的节点类型
+type unknownNode struct{}
+
+func (unknownNode) TokenLiteral() string { return "" }
+func (unknownNode) String() string       { return "?" }
+func (unknownNode) Pos() token.Position  { return token.Position{} }
+func (unknownNode) End() token.Position  { return token.Position{} }
+func (unknownNode) Kind() string         { return "UnknownNode" }
+
+func TestEvalNeverReturnsNil(t *testing.T) {
+	evaluated := Eval(unknownNode{}, object.NewEnvironment())
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "cannot evaluate UnknownNode" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+
+	// 不产生值的语句和空的语句序列返回NULL
+	for _, input := range []string{
+		"let x = 1;",
+		"let a, b = 1, 2;",
+		"let [c] = [1];",
+		"const d = 1;",
+		"let f = fn() { 1 };",
+		"",
+		"fn() { }()",
+		"fn() { let y = 2; }()",
+	} {
+		testNullObject(t, testEval(input))
+	}
+
+	// 程序中的每个节点单独求值时都有结果，解构模式等不能单独求值的节点返回错误
+	program := testParseProgram(`let [a] = [1]; let {b} = {"b": 2}; let c, d = 3, 4;
+let f = fn(n) { return -n + 1; };
+if (true) { f(a) } else { [c][0] };
+{k: d}; [1, 2][1:]; 1.5; "s"; !true;
+let i = 0; while (i < 1) { i = i + 1 }; for (;;) { break; continue };
+let m = macro(q) { q };
+f([1]...);
+return;`)
+	var walk func(node ast.Node)
+	walk = func(node ast.Node) {
+		if evaluated := Eval(node, object.NewEnvironment()); evaluated == nil {
+			t.Errorf("Eval(%s %q) returned nil", node.Kind(), node.String())
+		}
+		for _, child := range ast.Children(node) {
+			walk(child)
+		}
+	}
+	walk(program)
+
+	errObj, ok = Eval(program.Statements[0].(*ast.LetStatement).Pattern, object.NewEnvironment()).(*object.Error)
+	if !ok || errObj.Message != "cannot evaluate ArrayPattern" {
+		t.Errorf("evaluating a pattern did not return the expected error. got=%v", errObj)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var out strings.Builder
+	ev := New(Options{Trace: NewTracer(&out)})
+	evaluated := ev.Eval(testParseProgram("(1 + 2) * 3"), object.NewEnvironment())
+	testIntegerObject(t, evaluated, 9)
+
+	expected := `Program ((1 + 2) * 3)
+  ExpressionStatement ((1 + 2) * 3)
+    InfixExpression ((1 + 2) * 3)
+      InfixExpression (1 + 2)
+        IntegerLiteral 1
+        => 1
+        IntegerLiteral 2
+        => 2
+      => 3
+      IntegerLiteral 3
+      => 3
+    => 9
+  => 9
+=> 9
+`
+	if out.String() != expected {
+		t.Errorf("wrong trace.\nwant:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	// 不产生值的语句离开时的结果为null
+	out.Reset()
+	ev = New(Options{Trace: NewTracer(&out)})
+	ev.Eval(testParseProgram("let x = 1;"), object.NewEnvironment())
+	expected = `Program let x = 1;
+  LetStatement let x = 1;
+    IntegerLiteral 1
+    => 1
+  => null
+=> null
+`
+	if out.String() != expected {
+		t.Errorf("wrong trace.\nwant:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	// 每个节点进入和离开时各调用一次，深度相同，进入时结果为nil
+	var depths []int
+	var entered []ast.Node
+	trace := func(node ast.Node, depth int, result object.Object) {
+		if len(entered) == depth {
+			if result != nil {
+				t.Errorf("entry of %s has result %s", node.Kind(), result.Inspect())
+			}
+			entered = append(entered, node)
+		} else if entered[depth] != node {
+			t.Errorf("exit of %s at depth %d does not match its entry", node.Kind(), depth)
+		} else {
+			entered = entered[:depth]
+		}
+		depths = append(depths, depth)
+	}
+	New(Options{Trace: trace}).Eval(testParseProgram("let f = fn(x) { x }; f(1)"), object.NewEnvironment())
+	if len(entered) != 0 {
+		t.Errorf("%d nodes entered but not exited", len(entered))
+	}
+	if len(depths) == 0 || depths[0] != 0 || depths[len(depths)-1] != 0 {
+		t.Errorf("outermost node not traced at depth 0. got=%v", depths)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	input := `let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } };
+let xs = [1, 2];
+f(len(xs) + 7);
+xs[0];
+xs[0];`
+
+	profile := NewProfile()
+	ev := New(Options{Profile: profile})
+	env := object.NewEnvironment()
+	evaluated := ev.Eval(testParseProgram(input), env)
+	testIntegerObject(t, evaluated, 1)
+
+	// f(9)到f(0)共10次调用，加上len的调用
+	expectedNodes := map[string]int{
+		"CallExpression":  11,
+		"IfExpression":    10,
+		"FunctionLiteral": 1,
+		"ArrayLiteral":    1,
+		"IndexExpression": 2,
+		"LetStatement":    2,
+		"Program":         1,
+	}
+	for kind, expected := range expectedNodes {
+		if profile.Nodes[kind] != expected {
+			t.Errorf("wrong count for %s. want=%d, got=%d", kind, expected, profile.Nodes[kind])
+		}
+	}
+
+	expectedCalls := map[string]int{"f": 10, "len": 1}
+	if !reflect.DeepEqual(profile.Calls, expectedCalls) {
+		t.Errorf("wrong calls. want=%v, got=%v", expectedCalls, profile.Calls)
+	}
+
+	// f中求值的29个整数（每次调用的字面量和 n - 1 的结果）、程序中的5个整数字面量、
+	// len的结果和 len(xs) + 7；读取的数组元素不重复计数
+	expectedObjects := map[object.ObjectType]int{
+		object.INTEGER_OBJ:  36,
+		object.ARRAY_OBJ:    1,
+		object.FUNCTION_OBJ: 1,
+	}
+	if !reflect.DeepEqual(profile.Objects, expectedObjects) {
+		t.Errorf("wrong objects. want=%v, got=%v", expectedObjects, profile.Objects)
+	}
+
+	// 计数在多次求值之间累加，设置为nil后停止计数
+	ev.Eval(testParseProgram("f(0)"), env)
+	ev.SetProfile(nil)
+	ev.Eval(testParseProgram("f(0)"), env)
+	if profile.Calls["f"] != 11 {
+		t.Errorf("wrong count after more evaluations. want=11, got=%d", profile.Calls["f"])
+	}
+
+	report := profile.String()
+	if !strings.HasPrefix(report, "nodes:\n") || !strings.Contains(report, "calls:\n  f ") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+}
+
+func TestLooseTruthiness(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64 // 默认规则下的结果
+		loose    int64 // 开启LooseTruthiness后的结果
+	}{
+		{"if (0) { 1 } else { 2 }", 1, 2},
+		{"if (\"\") { 1 } else { 2 }", 1, 2},
+		{"if ([]) { 1 } else { 2 }", 1, 2},
+		{"if (1) { 1 } else { 2 }", 1, 1},
+		{"if (\"a\") { 1 } else { 2 }", 1, 1},
+		{"if ([0]) { 1 } else { 2 }", 1, 1},
+		{"if (-1) { 1 } else { 2 }", 1, 1},
+		// 浮点数和哈希表不受影响
+		{"if (0.0) { 1 } else { 2 }", 1, 1},
+		{"if ({}) { 1 } else { 2 }", 1, 1},
+		{"if (if (false) { 1 }) { 1 } else { 2 }", 2, 2},
+		{"if (!0) { 1 } else { 2 }", 2, 1},
+		{"if (!\"\") { 1 } else { 2 }", 2, 1},
+		{"if (0 || \"\") { 1 } else { 2 }", 1, 2},
+		{"if (1 && []) { 1 } else { 2 }", 1, 2},
+		{"let n = 3; let i = 0; while (n) { n = n - 1; i = i + 1; if (i > 5) { break } }; i", 6, 3},
+		{"let i = 0; for (let s = \"ab\"; s; s = \"\") { i = i + 1; if (i > 5) { break } }; i", 6, 1},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		evaluated := New(Options{}).Eval(program, object.NewEnvironment())
+		testIntegerObject(t, evaluated, tt.expected)
+
+		program = testParseProgram(tt.input)
+		evaluated = New(Options{LooseTruthiness: true}).Eval(program, object.NewEnvironment())
+		testIntegerObject(t, evaluated, tt.loose)
+	}
+}
+
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -98,6 +391,10 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else if (1 < 2) { 20 } else { 30 }", 20},
+		{"if (1 > 2) { 10 } else if (1 > 2) { 20 } else { 30 }", 30},
+		{"if (1 < 2) { 10 } else if (1 < 2) { 20 } else { 30 }", 10},
+		{"if (1 > 2) { 10 } else if (1 > 2) { 20 }", nil},
 	}
 
 	for _, tt := range tests {
@@ -111,313 +408,3595 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 }
 
-func TestReturnStatements(t *testing.T) {
+func TestWhileExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected int64
+		expected interface{}
 	}{
-		{"return 10;", 10},
-		{"return 10; 9;", 10},
-		{"return 2 * 5; 9;", 10},
-		{"9; return 2 * 5; 9;", 10},
-		{"if (10 > 1) { return 10; }", 10},
-		{
-			`
-if (10 > 1) {
-  if (10 > 1) {
-    return 10;
-  }
+		{"let i = 0; let sum = 0; while (i < 10) { i = i + 1; sum = sum + i }; sum", 55},
+		{"let i = 0; while (i < 3) { i = i + 1 }", 3},
+		{"let i = 0; while (i < 3) { i = i + 1 }; i", 3},
+		{"while (false) { 10 }", nil},
+		{"let i = 0; while (i < 3) { i = i + 1; }", 3},
+		{"let i = 0; while (i < 1) { i = i + 1; let j = 5; }; j", 5},
+		{"let n = 0; while (n > 3) {}; n", 0},
+		// return 会跳出循环并从函数返回
+		{`let find = fn(x) {
+			let i = 0;
+			while (true) {
+				if (i * i >= x) { return i; }
+				i = i + 1;
+			}
+		};
+		find(50)`, 8},
+		{`let f = fn() { let i = 0; while (i < 10) { i = i + 1; if (i == 3) { return i * 100; } }; -1 }; f()`, 300},
+		{"let i = 0; while (i < 5) { i = i + 1; if (i == 2) { return 42; } }; 0", 42},
+	}
 
-  return 1;
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
 }
-`,
-			10,
-		},
-		{
-			`
-let f = fn(x) {
-  return x;
-  x + 10;
-};
-f(10);`,
-			10,
-		},
-		{
-			`
-let f = fn(x) {
-   let result = x + 10;
-   return result;
-   return 10;
-};
-f(10);`,
-			20,
-		},
+
+func TestWhileExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"while (x < 3) { 1 }", "identifier not found: x"},
+		{"let i = 0; while (i < \"3\") { i = i + 1 }", "type mismatch: INTEGER < STRING"},
+		{"let i = 0; while (i < 3) { i = i + 1; if (i == 2) { true + 1 } }", "type mismatch: BOOLEAN + INTEGER"},
+		{"let i = 0; while (i < 3) { i = i + true }; i", "type mismatch: INTEGER + BOOLEAN"},
 	}
 
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
-		testIntegerObject(t, evaluated, tt.expected)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
 	}
 }
 
-func TestErrorHandling(t *testing.T) {
+func TestForExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = 0; for (let i = 1; i <= 10; i = i + 1) { sum = sum + i }; sum", 55},
+		{"for (let i = 0; i < 3; i = i + 1) { i * 10 }", 20},
+		{"for (let i = 0; i < 0; i = i + 1) { i }", nil},
+		{"let i = 5; for (i = 0; i < 3; i = i + 1) {}; i", 3},
+		{"let i = 0; for (; i < 4;) { i = i + 1 }; i", 4},
+		{"let n = 0; for (let i = 0; i < 3; i = i + 1) { n = n + 1; let i = 99; }; n", 1},
+		// 嵌套循环
+		{`let count = 0;
+		for (let i = 0; i < 3; i = i + 1) {
+			for (let j = 0; j < 4; j = j + 1) {
+				count = count + 1;
+			}
+		};
+		count`, 12},
+		{`let sum = 0;
+		for (let i = 1; i <= 3; i = i + 1) {
+			for (let j = 1; j <= i; j = j + 1) { sum = sum + i * j }
+		};
+		sum`, 25},
+		// 省略全部三部分的循环只能通过return结束
+		{"let f = fn() { let i = 0; for (;;) { i = i + 1; if (i == 7) { return i; } } }; f()", 7},
+		{"let f = fn(x) { for (let i = 0; i < 10; i = i + 1) { if (i == x) { return i * 2; } }; -1 }; f(4)", 8},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestForLoopVariableScope(t *testing.T) {
 	tests := []struct {
 		input           string
 		expectedMessage string
 	}{
-		{
-			"5 + true;",
-			"type mismatch: INTEGER + BOOLEAN",
-		},
-		{
-			"5 + true; 5;",
-			"type mismatch: INTEGER + BOOLEAN",
-		},
-		{
-			"-true",
-			"unknown operator: -BOOLEAN",
-		},
-		{
-			"true + false;",
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			"true + false + true + false;",
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			"5; true + false; 5",
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			`"Hello" - "World"`,
-			"unknown operator: STRING - STRING",
-		},
-		{
-			"if (10 > 1) { true + false; }",
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			`
-if (10 > 1) {
-  if (10 > 1) {
-    return true + false;
-  }
+		{"for (let i = 0; i < 3; i = i + 1) {}; i", "identifier not found: i"},
+		{"for (let i = 0; i < 3; i = i + 1) { let j = i }; j", "identifier not found: j"},
+		{"for (let i = 0; i < x; i = i + 1) {}", "identifier not found: x"},
+		{"for (let i = y; i < 3; i = i + 1) {}", "identifier not found: y"},
+		{"for (let i = 0; i < 3; i = i + true) {}", "type mismatch: INTEGER + BOOLEAN"},
+	}
 
-  return 1;
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+
+	// 循环变量遮蔽外层同名变量，循环结束后外层变量保持原值
+	evaluated := testEval("let i = 100; for (let i = 0; i < 3; i = i + 1) {}; i")
+	testIntegerObject(t, evaluated, 100)
 }
-`,
-			"unknown operator: BOOLEAN + BOOLEAN",
-		},
-		{
-			"foobar",
-			"identifier not found: foobar",
-		},
-		{
-			`{"name": "Monkey"}[fn(x) { x }];`,
-			"unusable as hash key: FUNCTION",
-		},
-		{
-			`999[1]`,
-			"index operator not supported: INTEGER",
-		},
+
+func TestSwitchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 执行第一个匹配的分支
+		{"switch (1) { case 1 { 10 } case 1 { 20 } default { 30 } }", 10},
+		{"switch (3) { case 1, 2 { 10 } case 3, 4 { 20 } }", 20},
+		{"let x = 2; switch (x * 2) { case x + 1 { 1 } case x + 2 { 2 } }", 2},
+		// 没有匹配时执行default，没有default时为NULL
+		{"switch (5) { case 1 { 10 } default { 30 } }", 30},
+		{"switch (5) { default { 30 } case 5 { 10 } }", 10},
+		{"switch (5) { case 1 { 10 } }", nil},
+		{"switch (5) {}", nil},
+		{"switch (1) { case 1 {} }", nil},
+		// 与==相同的相等语义：字符串按内容比较，数组和哈希表深度比较，类型不同不相等
+		{`switch ("ab") { case "a" { 1 } case "a" + "b" { 2 } }`, 2},
+		{"switch ([1, [2, 3]]) { case [1, [2]] { 1 } case [1, [2, 3]] { 2 } }", 2},
+		{`switch ({"a": [1]}) { case {"a": [1]} { 1 } default { 2 } }`, 1},
+		{`switch (1) { case "1", true { 1 } default { 2 } }`, 2},
+		// 被匹配的值只求值一次
+		{"let n = 0; let next = fn() { n = n + 1; n }; switch (next()) { case 2 {} case 3 {} case 1 {} }; n", 1},
+		// 不匹配的分支不会执行
+		{`let hits = 0;
+		switch (2) {
+			case 1 { hits = hits + 1 }
+			case 2 { hits = hits + 10 }
+			case 2 { hits = hits + 100 }
+			default { hits = hits + 1000 }
+		};
+		hits`, 10},
+		{"let hits = 0; switch (9) { case 1 { hits = hits + 1 } default { hits = hits + 1000 } }; hits", 1000},
+		// 匹配成功后不再求值后面的case值
+		{"let n = 0; let next = fn() { n = n + 1; n }; switch (1) { case next(), next() {} case next() {} }; n", 1},
+		// 分支中的return从函数返回
+		{"let f = fn(x) { switch (x) { case 1 { return 10; } }; 20 }; f(1) + f(2)", 30},
+		// 分支在自己的作用域中执行，可以修改外层变量但let声明不会泄漏
+		{"let x = 1; switch (x) { case 1 { let x = 5; x } }", 5},
+		{"let x = 1; switch (x) { case 1 { let x = 5; } }; x", 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestSwitchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		// 被匹配的值出错时不求值任何分支
+		{"switch (x) { case 1 { 1 } default { 2 } }", "identifier not found: x"},
+		{"switch (1 + true) { default { 2 } }", "type mismatch: INTEGER + BOOLEAN"},
+		// case中的值出错时立即返回
+		{"switch (1) { case 2 { 2 } case y { 1 } case 1 { 1 } }", "identifier not found: y"},
+		{"switch (1) { case 1 { -true } }", "unknown operator: -BOOLEAN"},
+		{"switch (1) { case 1 { let z = 1; }; z }", "identifier not found: z"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+
+	// 出错的case之后的分支既不求值也不执行
+	env := object.NewEnvironment()
+	program := parser.New(lexer.New(`let n = 0;
+	let next = fn() { n = n + 1; n };
+	switch (5) { case next() { 1 } case missing { 2 } case next(), 5 { n = 100 } }`)).ParseProgram()
+	if _, ok := Eval(program, env).(*object.Error); !ok {
+		t.Fatalf("switch with failing case value did not return an error")
+	}
+	n, _ := env.Get("n")
+	testIntegerObject(t, n, 1)
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 没有出错时结果是try块的值，rescue块不执行
+		{"try { 1 + 1 } rescue (e) { 0 }", 2},
+		{"let n = 0; try { n = 1 } rescue (e) { n = 2 }; n", 1},
+		{"try {} rescue (e) { 0 }", nil},
+		// 出错时执行rescue块
+		{"try { 1 + true } rescue (e) { 0 }", 0},
+		{"try { 1 + true; 2 } rescue (e) { 3 }", 3},
+		{"let f = fn(x) { x.missing + 1 }; try { f({}) } rescue (e) { 7 }", 7},
+		// 错误在rescue处停止传递，程序继续执行
+		{"let r = try { -true } rescue (e) { 5 }; r + 1", 6},
+		{"try { -true } rescue (e) { 0 }; 42", 42},
+		// 错误信息中的行号
+		{"let x = 1;\ntry {\n  x + true\n} rescue (e) { e.line }", 3},
+		{"try { missing } rescue (e) { e.column }", 7},
+		// try块中的return照常从函数返回
+		{"let f = fn() { try { return 1; } rescue (e) { 2 }; 3 }; f()", 1},
+		{"let f = fn() { try { -true } rescue (e) { return 2; }; 3 }; f()", 2},
+		// break和continue也照常作用于外层循环
+		{"let i = 0; while (true) { try { break } rescue (e) { 0 }; i = i + 1 }; i", 0},
+		{"let n = 0; for (let i = 0; i < 3; i = i + 1) { try { continue } rescue (e) { 0 }; n = n + 1 }; n", 0},
+		// 嵌套：内层rescue中的错误由外层捕获
+		{"try { try { -true } rescue (e) { e + 1 } } rescue (e) { 9 }", 9},
+		{"try { try { -true } rescue (e) { 8 } } rescue (e) { 9 }", 8},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestTryErrorMessage(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { 1 + true } rescue (err) { err.message }", "type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fn() { missing }; try { f() } rescue (err) { err.message }", "identifier not found: missing"},
+		{`try { "a" - "b" } rescue (err) { err["message"] }`, "unknown operator: STRING - STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("%q: object is not String. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("%q: wrong message. want=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		// rescue块自己的错误照常向外传递
+		{"try { -true } rescue (e) { e + 1 }", "type mismatch: HASH + INTEGER"},
+		// 两个语句块各自有作用域，其中的变量不会泄漏到外层
+		{"try { let a = 1; a } rescue (e) { 0 }; a", "identifier not found: a"},
+		{"try { -true } rescue (e) { 0 }; e", "identifier not found: e"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestBreakContinue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (true) { i = i + 1; if (i == 5) { break; } }; i", 5},
+		{"let i = 0; while (i < 10) { i = i + 1; if (i == 3) { break } i * 10 }", 20},
+		{"while (true) { break }", nil},
+		{"let i = 0; for (;;) { i = i + 1; if (i > 3) { break } }; i", 4},
+		{"for (let i = 0; i < 10; i = i + 1) { if (i == 4) { break } i }", 3},
+		// continue跳过循环体剩余部分，for循环仍然执行后置表达式
+		{"let sum = 0; for (let i = 0; i < 10; i = i + 1) { if (i % 2 == 0) { continue } sum = sum + i }; sum", 25},
+		{"let i = 0; let sum = 0; while (i < 10) { i = i + 1; if (i % 2 == 1) { continue; } sum = sum + i }; sum", 30},
+		{"let i = 0; while (i < 3) { i = i + 1; continue; i = 100 }; i", 3},
+		// break和continue只作用于最内层的循环
+		{`let count = 0;
+		for (let i = 0; i < 3; i = i + 1) {
+			for (let j = 0; j < 10; j = j + 1) {
+				if (j == 2) { break }
+				count = count + 1;
+			}
+		};
+		count`, 6},
+		{`let count = 0;
+		for (let i = 0; i < 4; i = i + 1) {
+			if (i == 1) { continue }
+			let j = 0;
+			while (true) {
+				j = j + 1;
+				if (j < 3) { continue }
+				break;
+			}
+			count = count + j;
+		};
+		count`, 9},
+		// 函数内的循环可以正常使用break
+		{"let f = fn() { let i = 0; while (true) { i = i + 1; if (i == 2) { break } }; i }; f()", 2},
+		{"let f = fn() { for (;;) { break } }; f()", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestBreakContinueOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"break;", "break outside loop"},
+		{"continue;", "continue outside loop"},
+		{"1; if (true) { break }; 2", "break outside loop"},
+		{"let f = fn() { continue }; f()", "continue outside loop"},
+		// 函数体中的break不能跳出调用方的循环
+		{"let f = fn() { break }; while (true) { f() }", "break outside loop"},
+		{"let f = fn() { if (true) { continue } }; for (let i = 0; i < 3; i = i + 1) { f() }", "continue outside loop"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = 1; a = 2; a", 2},
+		{"let a = 1; a = a + 1", 2},
+		{"let a = 1; let b = 2; a = b = 3; a + b", 6},
+		{"x = 1", "identifier not found: x"},
+		{"let a = 1; a = b", "identifier not found: b"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestHashElementAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 插入新的键
+		{`let h = {}; h["a"] = 1; h["a"]`, 1},
+		{`let h = {}; h[true] = 2; h[true]`, 2},
+		// 覆盖已有的键
+		{`let h = {"a": 1}; h["a"] = 5; h["a"]`, 5},
+		{`let h = {"count": 1}; h["count"] = h["count"] + 1; h["count"]`, 2},
+		{`let h = {"a": 1, "b": 2}; h["a"] = 3; h["b"]`, 2},
+		// 点语法与字符串键等价
+		{`let h = {}; h.name = "monkey"; h["name"]`, "monkey"},
+		// 赋值表达式的值是新值
+		{`let h = {}; h["a"] = 3`, 3},
+		{`let h = {}; let g = {}; h["a"] = g["b"] = 4; h["a"] + g["b"]`, 8},
+		// 哈希表被原地修改，所有引用都能看到变化
+		{`let h = {}; let g = h; g["a"] = 1; h["a"]`, 1},
+		{`let h = {}; let set = fn(k, v) { h[k] = v }; set(1, 7); h[1]`, 7},
+		{`let h = {"inner": {}}; h["inner"]["x"] = 9; h.inner.x`, 9},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("%q: object is not String. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("%q: String has wrong value. got=%q, want=%q", tt.input, str.Value, expected)
+			}
+		}
+	}
+}
+
+func TestArrayElementAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = [1, 2, 3]; a[0] = 99; a[0]", 99},
+		{"let a = [1, 2, 3]; a[2] = 99; a[2]", 99},
+		{"let a = [1, 2, 3]; a[1] = 99; a[0] + a[2]", 4},
+		{"let a = [1, 2, 3]; a[1] = a[1] * 10; a[1]", 20},
+		// 赋值不改变数组长度
+		{"let a = [1, 2, 3]; a[0] = 0; len(a)", 3},
+		// 赋值表达式的值是新值
+		{"let a = [1]; a[0] = 7", 7},
+		// 数组被原地修改，所有引用都能看到变化
+		{"let a = [1, 2]; let b = a; b[0] = 5; a[0]", 5},
+		{"let a = [0]; let inc = fn(xs) { xs[0] = xs[0] + 1 }; inc(a); inc(a); a[0]", 2},
+		{"let m = [[1, 2], [3, 4]]; m[1][0] = 30; m[1][0] + m[0][0]", 31},
+		{`let h = {"xs": [1]}; h.xs[0] = 8; h["xs"][0]`, 8},
+		{"let a = [0, 0, 0]; for (let i = 0; i < 3; i = i + 1) { a[i] = i * i }; a[2]", 4},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestCyclicArrays(t *testing.T) {
+	// 索引赋值可以让数组包含自身，输出和比较都不能无限递归
+	testInspectResults(t, []inspectTest{
+		{"let a = [1]; a[0] = a; a", "[[...]]"},
+		{"let a = [1, 2]; a[1] = a; a", "[1, [...]]"},
+		{"let a = [1]; let b = [a, 2]; a[0] = b; [a, b]", "[[[[...], 2]], [[[...]], 2]]"},
+		{"let a = [1, 2]; a[1] = a; str(a)", `"[1, [...]]"`},
+		{"let a = [0]; a[0] = a; let x = [a, a]; x", "[[[...]], [[...]]]"},
+		{"let a = [1]; a[0] = a; a == a", "true"},
+		{"let a = [1]; a[0] = a; let b = [1]; b[0] = b; a == b", "true"},
+		{"let a = [1]; a[0] = a; let b = [1]; b[0] = b; a != b", "false"},
+		{"let a = [1, 2]; a[0] = a; let b = [1, 3]; b[0] = b; a == b", "false"},
+		{"let a = [1]; a[0] = a; a == [1]", "false"},
+		{"let a = [1]; a[0] = a; contains([1, a], a)", "true"},
+		{"let a = [1]; a[0] = a; assert_eq(a, 2)", "assertion failed: got [[...]] (ARRAY), expected 2 (INTEGER)"},
+	})
+}
+
+func TestCyclicHashes(t *testing.T) {
+	// 索引赋值可以让哈希表包含自身，输出和比较都不能无限递归
+	testInspectResults(t, []inspectTest{
+		{`let h = {}; h["x"] = h; h`, `{"x": {...}}`},
+		{`let h = {}; h.self = [h]; h`, `{"self": [{...}]}`},
+		{`let a = [1]; a[0] = {"a": a}; a`, `[{"a": [...]}]`},
+		{`let h = {}; h["x"] = h; str(h)`, `"{\"x\": {...}}"`},
+		{`let h = {}; h["x"] = h; h == h`, "true"},
+		{`let h = {}; h["x"] = h; let g = {}; g["x"] = g; h == g`, "true"},
+		{`let h = {"n": 1}; h["x"] = h; let g = {"n": 2}; g["x"] = g; h == g`, "false"},
+		{`let h = {}; h["x"] = [h]; let g = {}; g["x"] = [g]; [h == g, h != g]`, "[true, false]"},
+		{`let h = {}; h["x"] = h; h == {"x": {}}`, "false"},
+	})
+}
+
+func TestIndexAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`let h = {}; h[[1]] = 1`, "unusable as hash key: ARRAY"},
+		{`let h = {}; h[fn(x) { x }] = 1`, "unusable as hash key: FUNCTION"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+		{`let a = [1, 2]; a[2] = 3`, "index out of range: 2 (array length 2)"},
+		{`let a = [1, 2]; a[-1] = 3`, "index out of range: -1 (array length 2)"},
+		{`let a = []; a[0] = 1`, "index out of range: 0 (array length 0)"},
+		{`let a = [1, 2]; a["0"] = 3`, "array index must be INTEGER, got STRING"},
+		{`let a = [1, 2]; a[0.0] = 3`, "array index must be INTEGER, got FLOAT"},
+		{`let h = {}; h[missing] = 1`, "identifier not found: missing"},
+		{`missing["a"] = 1`, "identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("%q: wrong error message. expected=%q, got=%q",
+				tt.input, tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestIdentifierSuggestions(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		// 拼错的变量名
+		{"let counter = 1; countr", "identifier not found: countr (did you mean counter?)"},
+		{"let total = 1; let f = fn() { totl }; f()", "identifier not found: totl (did you mean total?)"},
+		{"let f = fn(result) { reslut }; f(1)", "identifier not found: reslut (did you mean result?)"},
+		// 拼错的内置函数名
+		{"lne([1])", "identifier not found: lne (did you mean len?)"},
+		{"psuh([], 1)", "identifier not found: psuh (did you mean push?)"},
+		{"frist([1])", "identifier not found: frist (did you mean first?)"},
+		// 距离相同时取字典序最小的名称
+		{"let abcd = 1; let abce = 2; abcf", "identifier not found: abcf (did you mean abcd?)"},
+		// 没有足够接近的名称时不给出提示
+		{"let counter = 1; cntr_value", "identifier not found: cntr_value"},
+		// 短名称不给出提示
+		{"let ab = 1; ac", "identifier not found: ac"},
+		// 较短的名称只接受距离为1的提示
+		{"foo", "identifier not found: foo"},
+		{"nope", "identifier not found: nope"},
+		{"inner", "identifier not found: inner"},
+		{"let value = 1; valu", "identifier not found: valu (did you mean value?)"},
+		{"let value = 1; vlau", "identifier not found: vlau"},
+		{"let counter = 1; contr", "identifier not found: contr"},
+		{"let counter = 1; cuontr", "identifier not found: cuontr (did you mean counter?)"},
+		{"let x = 1; y", "identifier not found: y"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("%q: wrong error message. expected=%q, got=%q",
+				tt.input, tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"len", "len", 0},
+		{"", "abc", 3},
+		{"lne", "len", 1},
+		{"lenght", "length", 1},
+		{"kitten", "sitting", 3},
+		{"push", "puts", 2},
+		{"变量", "变最", 1},
+	}
+
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.expected {
+			t.Errorf("editDistance(%q, %q) wrong. want=%d, got=%d", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
+
+func TestTopLevelReturn(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"return 5; 6", 5},
+		{"return; 6", nil},
+		{"6; return 7", 7},
+		{"if (true) { return 1 }; 2", 1},
+		{"if (false) { return 1 }; 2", 2},
+		{"if (true) { if (true) { return 3 } }; 4", 3},
+		{"while (true) { return 5 }; 6", 5},
+		{"for (let i = 0; ; i = i + 1) { if (i == 2) { return i } }; 9", 2},
+		{"let f = fn() { return 1 }; f(); 2", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if _, ok := evaluated.(*object.ReturnValue); ok {
+			t.Errorf("%q: ReturnValue leaked out of the program", tt.input)
+			continue
+		}
+		if expected, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(expected))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestReturnInBareBlock(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"return 1; 2", 1},
+		{"1; return; 2", nil},
+		{"if (true) { return 3 }; 4", 3},
+		{"5", 5},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		block := &ast.BlockStatement{Statements: program.Statements}
+
+		// 直接求值语句块时return以ReturnValue的形式传递出来，由UnwrapResult解除包装
+		evaluated := UnwrapResult(Eval(block, object.NewEnvironment()))
+		if _, ok := evaluated.(*object.ReturnValue); ok {
+			t.Errorf("%q: ReturnValue not unwrapped", tt.input)
+			continue
+		}
+		if expected, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(expected))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+
+	// 语句块中没有被循环消耗的break转换为错误
+	block := &ast.BlockStatement{Statements: testParseProgram("break").Statements}
+	evaluated := UnwrapResult(Eval(block, object.NewEnvironment()))
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "break outside loop" {
+		t.Errorf("break in bare block not reported. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if UnwrapResult(nil) != nil {
+		t.Errorf("UnwrapResult(nil) is not nil")
+	}
+}
+
+func TestRedeclaration(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string // 禁止重复声明时的错误，为空表示没有错误
+		expected        int64  // 没有错误时的结果；允许重复声明时总是得到该结果
+	}{
+		{"let x = 1; let x = 2; x", "x already declared in this scope", 2},
+		{"let x = 1; let y, x = 2, 3; x", "x already declared in this scope", 3},
+		{"let x = 1; let [x] = [4]; x", "x already declared in this scope", 4},
+		{`let x = 1; let {x} = {"x": 5}; x`, "x already declared in this scope", 5},
+		{"let f = fn(x) { let x = 2; x }; f(1)", "x already declared in this scope", 2},
+		{"let f = fn() { 1 }; let f = fn() { 2 }; f()", "f already declared in this scope", 2},
+		// 在内层作用域中遮蔽外层变量总是允许的
+		{"let x = 1; let f = fn() { let x = 2; x }; f() + x", "", 3},
+		{"let x = 1; let f = fn(x) { x }; f(5)", "", 5},
+		{"let x = 1; for (let x = 10; x < 11; x = x + 1) { }; x", "", 1},
+		// 循环中同一条let语句再次执行不算重复声明
+		{"let i = 0; let sum = 0; while (i < 3) { let d = i * 2; sum = sum + d; i = i + 1 }; sum", "", 6},
+		{"let f = fn(n) { let y = n; y }; f(1) + f(2)", "", 3},
+		// 内置函数不在环境中，可以用let重新定义
+		{"let len = 7; len", "", 7},
+	}
+
+	for _, tt := range tests {
+		// 默认允许重复声明
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		env.SetNoRedeclare(true)
+		evaluated := Eval(program, env)
+
+		if tt.expectedMessage == "" {
+			testIntegerObject(t, evaluated, tt.expected)
+			continue
+		}
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("%q: wrong error message. expected=%q, got=%q",
+				tt.input, tt.expectedMessage, errObj.Message)
+		}
+	}
+
+	// 出错的多变量let语句不会绑定任何变量
+	env := object.NewEnvironment()
+	env.SetNoRedeclare(true)
+	Eval(testParseProgram("let b = 1; let a, b = 2, 3;"), env)
+	if _, ok := env.Get("a"); ok {
+		t.Errorf("a was bound by the failed let statement")
+	}
+}
+
+func TestConstants(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"const x = 5; x", 5},
+		{"const x = 5; x = 6; x", "cannot assign to constant x"},
+		// 闭包中的赋值同样解析到外层的常量
+		{"const x = 5; let f = fn() { x = 6 }; f(); x", "cannot assign to constant x"},
+		{"const x = 5; let f = fn() { fn() { x = x + 1 } }; f()(); x", "cannot assign to constant x"},
+		{"let f = fn() { const c = 1; fn() { c = 2 } }; f()()", "cannot assign to constant c"},
+		{"const x = 5; let f = fn() { x = 6 }; x", 5},
+		// 在内层作用域中用let或const遮蔽常量是合法的
+		{"const x = 5; let f = fn() { let x = 1; x = x + 1; x }; f() * 10 + x", 25},
+		{"const x = 5; let f = fn() { const x = 7; x }; f() * 10 + x", 75},
+		{"const x = 5; let f = fn(x) { x = x + 1; x }; f(1) * 10 + x", 25},
+		{"const x = 5; for (let x = 0; x < 3; x = x + 1) { }; x", 5},
+		// 同一作用域中不能再次声明常量，即使允许重复声明变量
+		{"const c = 1; let c = 2; c", "cannot redeclare constant c"},
+		{"const c = 1; const c = 2; c", "cannot redeclare constant c"},
+		{"const c = 1; let a, c = 2, 3; c", "cannot redeclare constant c"},
+		{"const c = 1; let [c] = [2]; c", "cannot redeclare constant c"},
+		{`const c = 1; let {c} = {"c": 2}; c`, "cannot redeclare constant c"},
+		{"let f = fn() { const c = 1; let c = 2; c }; f()", "cannot redeclare constant c"},
+		// 每次调用都有新的作用域；同一条const语句再次执行不算重复声明
+		{"let x = 0; let f = fn() { const c = x; x = x + 1; c }; f() + f() * 10", 10},
+		{"let s = 0; for (let i = 0; i < 3; i = i + 1) { const c = i; s = s + c }; s", 3},
+		// 常量函数可以递归
+		{"const fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5)", 120},
+		{`const fact = fn(n) { 1 }; fact = fn(n) { 2 }`, "cannot assign to constant fact"},
+		// 常量所指向的容器仍然可以修改元素
+		{"const a = [1, 2]; a[0] = 5; a[0]", 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("%q: wrong error message. expected=%q, got=%q",
+					tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestReassignmentScope(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 闭包修改捕获的变量，多次调用共享同一个绑定
+		{`let counter = fn() { let c = 0; fn() { c = c + 1; c } };
+		let next = counter();
+		next(); next(); next()`, 3},
+		// 每次调用counter得到独立的计数器
+		{`let counter = fn() { let c = 0; fn() { c = c + 1; c } };
+		let a = counter(); let b = counter();
+		a(); a(); b(); a() * 10 + b()`, 32},
+		// 函数内修改全局变量
+		{"let total = 0; let add = fn(n) { total = total + n }; add(2); add(5); total", 7},
+		// let在内层作用域中遮蔽同名变量，赋值只修改最近的那个绑定
+		{"let x = 1; let f = fn() { let x = 2; x = 3; x }; f() * 10 + x", 31},
+		{"let x = 1; let f = fn(x) { x = x + 1; x }; f(10) * 10 + x", 111},
+		// for循环的变量在循环作用域中，循环体内赋值修改外层变量
+		{"let last = 0; for (let i = 0; i < 4; i = i + 1) { last = i }; last", 3},
+		// 赋值表达式的值是新值
+		{"let x = 1; let y = (x = 5) + 1; x * 10 + y", 56},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestAssignUndefinedIdentifier(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"y = 1", "identifier not found: y"},
+		{"let f = fn() { z = 1 }; f()", "identifier not found: z"},
+		// 函数内不会隐式创建全局变量
+		{"let f = fn() { let w = 1; w = 2 }; f(); w", "identifier not found: w"},
+		{"len = 1", "identifier not found: len"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestFunctionArgumentCount(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let add = fn(x, y) { x + y }; add(1);", "wrong number of arguments to `add`: expected 2, got 1"},
+		{"let add = fn(x, y) { x + y }; add();", "wrong number of arguments to `add`: expected 2, got 0"},
+		{"let add = fn(x, y) { x + y }; add(1, 2, 3);", "wrong number of arguments to `add`: expected 2, got 3"},
+		{"fn() { 1 }(1)", "wrong number of arguments: expected 0, got 1"},
+		{"let f = fn(x) { x }; f([1, 2]...)", "wrong number of arguments to `f`: expected 1, got 2"},
+		{"let inc = fn(x) { x + 1 }; 5.inc(1)", "wrong number of arguments to `inc`: expected 1, got 2"},
+		// 函数名来自定义时的let，而不是调用处的名称
+		{"let add = fn(x, y) { x + y }; let plus = add; plus(1)", "wrong number of arguments to `add`: expected 2, got 1"},
+		{"let a, b = fn(x) { x }, fn() { 1 }; a()", "wrong number of arguments to `a`: expected 1, got 0"},
+		// 其他函数返回的闭包保持匿名
+		{"let adder = fn(x) { fn(y) { x + y } }; let addTwo = adder(2); addTwo()", "wrong number of arguments: expected 1, got 0"},
+		{`let h = {"f": fn(x) { x }}; h["f"]()`, "wrong number of arguments: expected 1, got 0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+
+	// 个数正确时照常调用
+	testIntegerObject(t, testEval("let add = fn(x, y) { x + y }; add(1, 2)"), 3)
+	testIntegerObject(t, testEval("let add = fn(x, y) { x + y }; add([1, 2]...)"), 3)
+}
+
+func TestCallDepthLimit(t *testing.T) {
+	countdown := "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; "
+
+	// 无限递归返回错误而不是耗尽Go调用栈
+	evaluated := testEval("let f = fn(x) { f(x) }; f(1)")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	expected := fmt.Sprintf("maximum call depth of %d exceeded in call to `f`", DefaultMaxCallDepth)
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+	}
+
+	// 匿名函数没有名称可以显示
+	evaluated = testEval("fn(h) { h(h) }(fn(h) { h(h) })")
+	errObj, ok = evaluated.(*object.Error)
+	expected = fmt.Sprintf("maximum call depth of %d exceeded", DefaultMaxCallDepth)
+	if !ok || errObj.Message != expected {
+		t.Errorf("wrong result for anonymous recursion. expected=%q, got=%s", expected, evaluated.Inspect())
+	}
+
+	// f(n) 嵌套调用 n+1 层，刚好达到上限时仍然成功
+	n := DefaultMaxCallDepth - 1
+	testIntegerObject(t, testEval(fmt.Sprintf("%sf(%d)", countdown, n)), int64(n))
+
+	// 自定义上限
+	ev := New(Options{MaxCallDepth: 10})
+	program := parser.New(lexer.New(countdown + "f(9)")).ParseProgram()
+	testIntegerObject(t, ev.Eval(program, object.NewEnvironment()), 9)
+
+	program = parser.New(lexer.New(countdown + "f(10)")).ParseProgram()
+	evaluated = ev.Eval(program, object.NewEnvironment())
+	errObj, ok = evaluated.(*object.Error)
+	if !ok || errObj.Message != "maximum call depth of 10 exceeded in call to `f`" {
+		t.Errorf("wrong result for f(10) with MaxCallDepth 10. got=%s", evaluated.Inspect())
+	}
+
+	// 出错之后调用深度恢复为0，同一个求值器可以继续使用
+	program = parser.New(lexer.New(countdown + "f(9)")).ParseProgram()
+	testIntegerObject(t, ev.Eval(program, object.NewEnvironment()), 9)
+}
+
+func TestStepBudget(t *testing.T) {
+	loop := func(n int) *ast.Program {
+		input := fmt.Sprintf("let i = 0; while (i < %d) { i = i + 1 }; i", n)
+		return parser.New(lexer.New(input)).ParseProgram()
+	}
+
+	// 预算足够时正常结束
+	ev := New(Options{MaxSteps: 10000})
+	testIntegerObject(t, ev.Eval(loop(10), object.NewEnvironment()), 10)
+	if ev.Steps() == 0 || ev.Steps() > 10000 {
+		t.Errorf("wrong step count. got=%d", ev.Steps())
+	}
+
+	// 步数是确定的：同样的程序总是用掉同样多的步数
+	used := ev.Steps()
+	other := New(Options{MaxSteps: 10000})
+	other.Eval(loop(10), object.NewEnvironment())
+	if other.Steps() != used {
+		t.Errorf("step count not deterministic. got=%d and %d", used, other.Steps())
+	}
+
+	// 超出预算时返回包含预算的错误
+	ev = New(Options{MaxSteps: 1000})
+	evaluated := ev.Eval(loop(1000), object.NewEnvironment())
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "evaluation budget of 1000 steps exceeded" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+
+	// 无限循环同样会停下来
+	ev = New(Options{MaxSteps: 500})
+	program := parser.New(lexer.New("while (true) {}")).ParseProgram()
+	if !isError(ev.Eval(program, object.NewEnvironment())) {
+		t.Errorf("infinite loop did not run out of budget")
+	}
+
+	// try/rescue捕获步数用尽的错误后，rescue块的第一步仍然出错
+	ev = New(Options{MaxSteps: 500})
+	program = parser.New(lexer.New("try { while (true) {} } rescue (e) { 1 }")).ParseProgram()
+	if !isError(ev.Eval(program, object.NewEnvironment())) {
+		t.Errorf("rescue escaped the step budget")
+	}
+
+	// 默认不限制步数
+	testIntegerObject(t, testEval("let i = 0; while (i < 100000) { i = i + 1 }; i"), 100000)
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { return 10; }", 10},
+		{
+			`
+if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+
+  return 1;
+}
+`,
+			10,
+		},
+		{
+			`
+let f = fn(x) {
+  return x;
+  x + 10;
+};
+f(10);`,
+			10,
+		},
+		{
+			`
+let f = fn(x) {
+   let result = x + 10;
+   return result;
+   return 10;
+};
+f(10);`,
+			20,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalProgramWithParseErrors(t *testing.T) {
+	// 解析失败的语句不会出现在AST中，对部分程序求值不应panic
+	tests := []string{
+		"let = 5;",
+		"let = 5; let x 5;",
+		"let = 5; 7",
+		"fn(x) { let = 1; x }",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", input)
+		}
+
+		_ = program.String()
+		Eval(program, object.NewEnvironment())
+	}
+
+	testIntegerObject(t, testEval("let = 5; 7"), 7)
+}
+
+func TestBareReturn(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"return; 5;", nil},
+		{"let f = fn() { return; 5 }; f();", nil},
+		{"let f = fn(x) { if (x > 0) { return; } x }; f(1);", nil},
+		{"let f = fn(x) { if (x > 0) { return; } x }; f(-1);", -1},
+		{"let f = fn() { return }; let g = fn() { f(); 7 }; g();", 7},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if expected, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(expected))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{
+			"5 + true;",
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			"5 + true; 5;",
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			"-true",
+			"unknown operator: -BOOLEAN",
+		},
+		{
+			"true + false;",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			"true + false + true + false;",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			"5; true + false; 5",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			`"Hello" - "World"`,
+			"unknown operator: STRING - STRING",
+		},
+		{
+			`"a" < 1`,
+			"type mismatch: STRING < INTEGER",
+		},
+		{
+			`1 > "a"`,
+			"type mismatch: INTEGER > STRING",
+		},
+		{
+			"if (10 > 1) { true + false; }",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			`
+if (10 > 1) {
+  if (10 > 1) {
+    return true + false;
+  }
+
+  return 1;
+}
+`,
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			"foobar",
+			"identifier not found: foobar",
+		},
+		{
+			`{"name": "Monkey"}[fn(x) { x }];`,
+			"unusable as hash key: FUNCTION",
+		},
+		{
+			`999[1]`,
+			"index operator not supported: INTEGER",
+		},
+		{
+			`"abc"["a"]`,
+			"index operator not supported: STRING",
+		},
+		{
+			"5 / 0",
+			"division by zero",
+		},
+		{
+			"0 / 0",
+			"division by zero",
+		},
+		{
+			"5 % 0",
+			"division by zero",
+		},
+		{
+			"true && (1 / 0 == 0)",
+			"division by zero",
+		},
+		{
+			"false || undefinedIdent",
+			"identifier not found: undefinedIdent",
+		},
+		{
+			"5 <= true",
+			"type mismatch: INTEGER <= BOOLEAN",
+		},
+		{
+			`"a" >= 1`,
+			"type mismatch: STRING >= INTEGER",
+		},
+		{
+			`"a" % "b"`,
+			"unknown operator: STRING % STRING",
+		},
+		{
+			"true % false",
+			"unknown operator: BOOLEAN % BOOLEAN",
+		},
+		{
+			"let half = fn(x, d) { x / d }; let r = half(10, 0) + 1; r * 2",
+			"division by zero",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)",
+				evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedInspect string
+	}{
+		{
+			"let x = 1;\nlet y = x +\n  foobar;",
+			"ERROR: 3:3: identifier not found: foobar",
+		},
+		{
+			"let f = fn() {\n  true + 1\n};\nf();",
+			"ERROR: 2:3: type mismatch: BOOLEAN + INTEGER\n  at f (4:1)",
+		},
+		{
+			"let a = [1, 2];\nlen(a, a);",
+			"ERROR: 2:1: wrong number of arguments. got=2, want=1",
+		},
+		// 插值中的表达式报告它在源代码中的位置
+		{
+			"let a = 1;\nlet t = \"x ${a + missing}\";",
+			"ERROR: 2:18: identifier not found: missing",
+		},
+		{
+			"let t = 1 + \"${1 + true}\";",
+			"ERROR: 1:16: type mismatch: INTEGER + BOOLEAN",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Inspect() != tt.expectedInspect {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expectedInspect, errObj.Inspect())
+		}
+	}
+}
+
+func TestErrorCallStack(t *testing.T) {
+	input := `let c = fn(x) {
+  x + "a"
+};
+let b = fn(x) { c(x) };
+let a = fn() { b(1) };
+a();`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	expectedStack := []object.Frame{
+		{Function: "c", Pos: token.Position{Line: 4, Column: 17}},
+		{Function: "b", Pos: token.Position{Line: 5, Column: 16}},
+		{Function: "a", Pos: token.Position{Line: 6, Column: 1}},
+	}
+	if !reflect.DeepEqual(errObj.Stack, expectedStack) {
+		t.Errorf("wrong stack. want=%+v, got=%+v", expectedStack, errObj.Stack)
+	}
+
+	expected := `ERROR: 2:3: type mismatch: INTEGER + STRING
+  at c (4:17)
+  at b (5:16)
+  at a (6:1)`
+	if errObj.Inspect() != expected {
+		t.Errorf("wrong Inspect.\nwant=%q\ngot= %q", expected, errObj.Inspect())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 顶层代码中出错没有调用栈
+		{`1 + "a"`, `ERROR: 1:1: type mismatch: INTEGER + STRING`},
+		// 不是按名称调用的函数显示为 <anonymous>
+		{`fn() { -true }()`, "ERROR: 1:8: unknown operator: -BOOLEAN\n  at <anonymous> (1:1)"},
+		{`let h = {"f": fn() { -true }}; h["f"]()`, "ERROR: 1:22: unknown operator: -BOOLEAN\n  at <anonymous> (1:32)"},
+		// 实参个数错误属于调用方
+		{`let f = fn(x) { x }; let g = fn() { f() }; g()`,
+			"ERROR: 1:37: wrong number of arguments to `f`: expected 1, got 0\n  at g (1:44)"},
+		// 调用栈中使用函数定义时的名称
+		{`let f = fn() { -true }; let g = f; g()`, "ERROR: 1:16: unknown operator: -BOOLEAN\n  at f (1:36)"},
+		// 函数中没有循环的break
+		{`let f = fn() { break }; f()`, "ERROR: 1:25: break outside loop\n  at f (1:25)"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong Inspect.\nwant=%q\ngot= %q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// 无限递归的调用栈很深，Inspect只显示最内层的部分
+	evaluated = testEval("let f = fn(x) { f(x) }; f(1)")
+	errObj = evaluated.(*object.Error)
+	if len(errObj.Stack) != DefaultMaxCallDepth {
+		t.Errorf("wrong stack depth. want=%d, got=%d", DefaultMaxCallDepth, len(errObj.Stack))
+	}
+	if lines := strings.Split(errObj.Inspect(), "\n"); len(lines) != 22 ||
+		lines[21] != fmt.Sprintf("  ... %d more frames", DefaultMaxCallDepth-20) {
+		t.Errorf("stack trace not truncated. got %d lines, last=%q", len(lines), lines[len(lines)-1])
+	}
+
+	// 调用栈在出错之后恢复，同一个求值器可以继续使用
+	ev := New(Options{})
+	env := object.NewEnvironment()
+	ev.Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	evaluated = ev.Eval(parser.New(lexer.New(`c(true)`)).ParseProgram(), env)
+	if evaluated.Inspect() != "ERROR: 2:3: type mismatch: BOOLEAN + STRING\n  at c (1:1)" {
+		t.Errorf("stack not reset after error. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let [a, b] = [1, 2]; a;", 1},
+		{"let [a, b] = [1, 2]; b;", 2},
+		{"let [a] = [1, 2, 3]; a;", 1},
+		{"let pair = fn() { [3, 4] }; let [x, y] = pair(); x * y;", 12},
+		{`let {name, age} = {"name": 1, "age": 2}; name + age;`, 3},
+		{`let {missing} = {"name": 1}; missing;`, nil},
+		{"let [a, b] = [1];", "not enough elements to destructure: want=2, got=1"},
+		{"let [a] = 5;", "cannot destructure INTEGER as ARRAY"},
+		{"let {a} = [1];", "cannot destructure ARRAY as HASH"},
+		{"let [a] = b;", "identifier not found: b"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)",
+					evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestMultiLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a, b = 1, 2; a;", 1},
+		{"let a, b = 1, 2; b;", 2},
+		{"let a, b = 1, 2; let a, b = b, a; a * 10 + b;", 21},
+		{"let x = 5; let x, y = x + 1, x + 2; y;", 7},
+		{"let a, b; b;", nil},
+		{"let a, b = 1, c; a;", "identifier not found: c"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestLetStatementWithoutValue(t *testing.T) {
+	tests := []string{
+		"let x; x;",
+		"let x; let y = x; y;",
+		"let f = fn() { let x; x }; f();",
+	}
+
+	for _, input := range tests {
+		evaluated := testEval(input)
+		if evaluated != NULL {
+			t.Errorf("object is not NULL for %q. got=%T (%+v)", input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v",
+			fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+
+	expectedBody := "(x + 2)"
+
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestFunctionName(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedName    string
+		expectedInspect string
+	}{
+		{"let add = fn(x, y) { x + y }; add", "add", "fn add(x, y) {\n(x + y)\n}"},
+		{"let a, b = 1, fn() { 2 }; b", "b", "fn b() {\n2\n}"},
+		{"fn(x) { x }", "", "fn(x) {\nx\n}"},
+		{"let f = [fn(x) { x }][0]; f", "", "fn(x) {\nx\n}"},
+		{"let outer = fn() { fn() { 1 } }; let inner = outer(); inner", "", "fn() {\n1\n}"},
+		{"let outer = fn() { let local = fn() { 1 }; local }; let inner = outer(); inner", "local", "fn local() {\n1\n}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		fn, ok := evaluated.(*object.Function)
+		if !ok {
+			t.Errorf("%q: object is not Function. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if fn.Name != tt.expectedName {
+			t.Errorf("%q: wrong name. want=%q, got=%q", tt.input, tt.expectedName, fn.Name)
+		}
+		if fn.Inspect() != tt.expectedInspect {
+			t.Errorf("%q: wrong Inspect. want=%q, got=%q", tt.input, tt.expectedInspect, fn.Inspect())
+		}
+	}
+}
+
+func TestLetBoundRecursion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 自递归
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5)", 120},
+		// 直接调用的函数字面量同样可以递归，调用完成后名称绑定为结果
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }(5); fact", 120},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + 2 } }(3); f", 6},
+		// 两个let定义的函数互相递归
+		{`let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+		let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+		isEven(10)`, true},
+		{`let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+		let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+		isOdd(7)`, true},
+		// 函数内的同名定义指向新的绑定，而不是外层的同名变量
+		{`let fact = fn(n) { 0 };
+		let g = fn() {
+			let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };
+			fact(4)
+		};
+		g()`, 24},
+		{`let fact = 10;
+		let g = fn() {
+			let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }(4);
+			fact
+		};
+		g() + fact`, 34},
+		// 外层的同名函数不受影响
+		{`let fact = fn(n) { 0 };
+		let g = fn() { let fact = fn(n) { 1 }; fact(1) };
+		g() + fact(1)`, 1},
+		// 值不是函数时，右侧的同名标识符仍然指向外层变量
+		{"let x = 1; let f = fn() { let x = x + 1; x }; f() + x", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSpreadArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let add = fn(a, b, c) { a + b + c }; add([1, 2, 3]...);", 6},
+		{"let add = fn(a, b, c) { a + b + c }; add(1, [2]..., 3);", 6},
+		{"let add = fn(a, b, c) { a + b + c }; add(1, [2, 3]...);", 6},
+		{"let sub = fn(a, b, c) { a - b - c }; sub(10, []..., 2, [3]...);", 5},
+		{"let args = [5]; let id = fn(x) { x }; id(args...);", 5},
+		{"len([1, 2]...)", "wrong number of arguments. got=2, want=1"},
+		{"len([[1, 2]]...)", 2},
+		{"last(push([1], [2]...))", 2},
+		{"puts([1, 2]...)", nil},
+		{"let id = fn(x) { x }; id(5...)", "spread operator not supported: INTEGER"},
+		{"let id = fn(x) { x }; id(y...)", "identifier not found: y"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)",
+					evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestMethodCallSyntax(t *testing.T) {
+	mapFn := `
+let map = fn(arr, f) {
+	let iter = fn(arr, accumulated) {
+		if (len(arr) == 0) {
+			accumulated
+		} else {
+			iter(rest(arr), push(accumulated, f(first(arr))));
+		}
+	};
+	iter(arr, []);
+};
+`
+
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"[1, 2, 3].len()", 3},
+		{"[1, 2].push(3).last()", 3},
+		{"let add = fn(a, b) { a + b }; let one = 1; one.add(2).add(3)", 6},
+		{mapFn + "[1, 2, 3].map(fn(x) { x * 2 }).last()", 6},
+		{mapFn + "[1, 2, 3].map(fn(x) { x * 2 }).map(fn(x) { x + 1 }).first()", 3},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestEnclosingEnvironments(t *testing.T) {
+	input := `
+let first = 10;
+let second = 10;
+let third = 10;
+
+let ourFunction = fn(first) {
+  let second = 20;
+
+  first + second + third;
+};
+
+ourFunction(20) + first + second;`
+
+	testIntegerObject(t, testEval(input), 70)
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+let newAdder = fn(x) {
+  fn(y) { x + y };
+};
+
+let addTwo = newAdder(2);
+addTwo(2);`
+
+	testIntegerObject(t, testEval(input), 4)
+}
+
+// TestStringLiteral 测试字符串字面量的求值功能
+// 验证 Monkey 语言解释器能够正确解析和求值字符串字面量表达式
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello World!"` // 测试输入：包含字符串字面量的 Monkey 代码
+
+	evaluated := testEval(input)          // 调用求值器对输入进行求值
+	str, ok := evaluated.(*object.String) // 断言求值结果应为 String 类型对象
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" { // 验证字符串对象的值为期望的 "Hello World!"
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	input := `"Hello" + " " + "World!"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "a"`, false},
+		{`"a" != "b"`, true},
+		{`"" == ""`, true},
+		{`"ab" + "c" == "a" + "bc"`, true},
+		{`let s = "monkey"; s == "monkey"`, true},
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"a" < "a"`, false},
+		{`"abc" > "abd"`, false},
+		{`"ab" < "abc"`, true},
+		{`"" < "a"`, true},
+		{`"Z" < "a"`, true},
+		{`"a" <= "a"`, true},
+		{`"b" >= "a"`, true},
+		{`"10" < "9"`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestDeepEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] != [1, 2]", false},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] == [1, 2, 3]", false},
+		{"[] == []", true},
+		{"[[1, [2]], \"a\"] == [[1, [2]], \"a\"]", true},
+		{"[[1, [2]]] == [[1, [3]]]", false},
+		{"let a = [1, 2]; let b = a; a == b", true},
+		{`{"a": 1} == {"a": 1}`, true},
+		{`{"a": 1, "b": 2} == {"b": 2, "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`{"a": 1} == {"a": 1, "b": 2}`, false},
+		{`{"a": 1} != {"a": 2}`, true},
+		{`{1: [true, {"x": "y"}]} == {1: [true, {"x": "y"}]}`, true},
+		{`{1: [true, {"x": "y"}]} == {1: [true, {"x": "z"}]}`, false},
+		{"[1, 2][5] == {}[1]", true},
+		// 类型不同的值不相等
+		{`[1] == ["1"]`, false},
+		{`[1] == {1: 1}`, false},
+		{`{"a": 1} == {"a": "1"}`, false},
+		{`[true] == [1]`, false},
+		{`[1] != 1`, true},
+		{"let f = fn() { 1 }; f == f", true},
+		{"fn() { 1 } == fn() { 1 }", false},
+		// 整数与浮点数按数值比较
+		{"[1, 2] == [1.0, 2.0]", true},
+		{`{"a": 1.5} == {"a": 1.5}`, true},
+		{`{"a": 1} == {"a": 1.5}`, false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestNumericInfixExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 整数与整数保持整数运算
+		{"7 + 2", int64(9)},
+		{"7 - 2", int64(5)},
+		{"7 * 2", int64(14)},
+		{"7 / 2", int64(3)},
+		{"7 % 2", int64(1)},
+		// 浮点数与浮点数
+		{"1.5 + 2.25", 3.75},
+		{"1.5 - 2.25", -0.75},
+		{"1.5 * 2.0", 3.0},
+		{"7.0 / 2.0", 3.5},
+		{"-1.5", -1.5},
+		{"-(-2.5)", 2.5},
+		// 整数与浮点数混合时提升为浮点数
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"3 - 0.5", 2.5},
+		{"0.5 - 3", -2.5},
+		{"2 * 1.25", 2.5},
+		{"1.25 * 2", 2.5},
+		{"7 / 2.0", 3.5},
+		{"7.0 / 2", 3.5},
+		{"1 / 4.0", 0.25},
+		{"2 * 3 + 0.5", 6.5},
+		{"(1 + 2) / 2.0", 1.5},
+		{"let x = 10; x / 4.0", 2.5},
+		{"let half = fn(n) { n / 2.0 }; half(5)", 2.5},
+		// 比较运算
+		{"1 < 1.5", true},
+		{"1.5 < 1", false},
+		{"2 > 1.5", true},
+		{"1.5 > 2", false},
+		{"1.5 <= 1.5", true},
+		{"1 <= 0.5", false},
+		{"2.0 >= 2", true},
+		{"1.9 >= 2", false},
+		{"1 == 1.0", true},
+		{"1.0 == 1", true},
+		{"1 == 1.5", false},
+		{"1.5 == 1.5", true},
+		{"1 != 1.0", false},
+		{"1 != 1.5", true},
+		{"0.1 + 0.2 == 0.3", false},
+		// 除数为零
+		{"1.5 / 0", "division by zero"},
+		{"1 / 0.0", "division by zero"},
+		{"1.0 / 0.0", "division by zero"},
+		// // 的结果总是整数，浮点数的商向下取整
+		{"7.5 // 2", int64(3)},
+		{"-7.5 // 2", int64(-4)},
+		{"7 // 2.5", int64(2)},
+		{"-0.5 // 1.0", int64(-1)},
+		{"6.0 // 2.0", int64(3)},
+		{"1 // 0", "division by zero"},
+		{"1.5 // 0", "division by zero"},
+		{"99999999999999999999.0 // 0.5", "floor division result out of range: 1e+20 // 0.5"},
+		{`"a" // "b"`, "unknown operator: STRING // STRING"},
+		{"true // 1", "type mismatch: BOOLEAN // INTEGER"},
+		// 真正的类型错误保留准确的类型名
+		{`1.5 + "a"`, "type mismatch: FLOAT + STRING"},
+		{`"a" + 1.5`, "type mismatch: STRING + FLOAT"},
+		{"[1] + 1.5", "type mismatch: ARRAY + FLOAT"},
+		{"1.5 % 2", "unknown operator: FLOAT % INTEGER"},
+		{"2 % 1.5", "unknown operator: INTEGER % FLOAT"},
+		{"1.5 % 0.5", "unknown operator: FLOAT % FLOAT"},
+		{"1.5 == true", false},
+		{"1.5 && 2", true},
+		{"!1.5", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int64:
+			testIntegerObject(t, evaluated, expected)
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: no error object returned. got=%T (%+v)",
+					tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("%s: wrong error message. expected=%q, got=%q",
+					tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1.5", "1.5"},
+		{"2.0", "2.0"},
+		{"1 + 1.0", "2.0"},
+		{"0.1 + 0.2", "0.30000000000000004"},
+		{"-0.25", "-0.25"},
+		{"[1, 2.5]", "[1, 2.5]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong Inspect. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3, 4][1:3]", []int64{2, 3}},
+		{"[1, 2, 3, 4][:2]", []int64{1, 2}},
+		{"[1, 2, 3, 4][2:]", []int64{3, 4}},
+		{"[1, 2, 3, 4][:]", []int64{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][3:1]", []int64{}},
+		{"[1, 2, 3, 4][2:2]", []int64{}},
+		{"[1, 2, 3, 4][-5:2]", []int64{1, 2}},
+		{"[1, 2, 3, 4][1:100]", []int64{2, 3, 4}},
+		{"[1, 2, 3, 4][9:]", []int64{}},
+		{"let a = [1, 2, 3]; let i = 1; a[i:i + 1]", []int64{2}},
+		{`"hello"[1:3]`, "el"},
+		{`"hello"[:2]`, "he"},
+		{`"hello"[2:]`, "llo"},
+		{`"hello"[:]`, "hello"},
+		{`"hello"[4:1]`, ""},
+		{`"hello"[-1:99]`, "hello"},
+		// 字符串按字符切片
+		{`"héllo"[1:3]`, "él"},
+		{`"你好，世界"[3:]`, "世界"},
+		{`"你好，世界"[:2]`, "你好"},
+		{`"a😀b"[1:2]`, "😀"},
+		{`"héllo"[4:99]`, "o"},
+		{`let s = "héllo wörld"; let i = index_of(s, "wö"); s[i:i + 5]`, "wörld"},
+		{"[1, 2, 3][1:]", []int64{2, 3}},
+		{`[1, 2, 3][true:]`, "slice index must be INTEGER, got BOOLEAN"},
+		{`"abc"[:"b"]`, "slice index must be INTEGER, got STRING"},
+		{`{"a": 1}[0:1]`, "slice operator not supported: HASH"},
+		{"[1][missing:]", "identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case []int64:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("%s: object is not Array. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("%s: wrong number of elements. want=%d, got=%d", tt.input, len(expected), len(array.Elements))
+				continue
+			}
+			for i, v := range expected {
+				testIntegerObject(t, array.Elements[i], v)
+			}
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("%s: String has wrong value. want=%q, got=%q", tt.input, expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("%s: wrong error message. want=%q, got=%q", tt.input, expected, obj.Message)
+				}
+			default:
+				t.Errorf("%s: unexpected object. got=%T (%+v)", tt.input, evaluated, evaluated)
+			}
+		}
+	}
+
+	// 完整切片得到的新数组与原数组的元素相同
+	input := "let a = [1, 2, 3]; let b = a[:]; a == b"
+	testBooleanObject(t, testEval(input), true)
+}
+
+func TestStrictMode(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedStrict string // 严格模式下的错误信息；为空表示两种模式结果相同
+	}{
+		{"[1, 2, 3][3]", "index out of range: 3 (array length 3)"},
+		{"[1, 2, 3][-1]", "index out of range: -1 (array length 3)"},
+		{"[][0]", "index out of range: 0 (array length 0)"},
+		{`"abc"[5]`, "index out of range: 5 (string length 3)"},
+		{`"héllo"[5]`, "index out of range: 5 (string length 5)"},
+		{`{"a": 1}["b"]`, `key not found: "b" (hash length 1)`},
+		{`{1: 1, 2: 2}[3]`, "key not found: 3 (hash length 2)"},
+		// 函数体内的索引同样受严格模式约束
+		{"let first = fn(a) { a[0] }; first([])", "index out of range: 0 (array length 0)"},
+		{"[1, 2, 3][2]", ""},
+		{`{"a": 1}["a"]`, ""},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		lenient := Eval(program, object.NewEnvironment())
+		strictEnv := object.NewEnvironment()
+		strictEnv.SetStrict(true)
+		strict := Eval(program, strictEnv)
+
+		if tt.expectedStrict == "" {
+			if lenient.Inspect() != strict.Inspect() {
+				t.Errorf("%s: results differ. default=%s, strict=%s", tt.input, lenient.Inspect(), strict.Inspect())
+			}
+			continue
+		}
+
+		// 默认模式保持原来的行为，返回null
+		testNullObject(t, lenient)
+
+		errObj, ok := strict.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned in strict mode. got=%T (%+v)", tt.input, strict, strict)
+			continue
+		}
+		if errObj.Message != tt.expectedStrict {
+			t.Errorf("%s: wrong error message. want=%q, got=%q", tt.input, tt.expectedStrict, errObj.Message)
+		}
+	}
+}
+
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"hello"[0]`, "h"},
+		{`"hello"[1]`, "e"},
+		{`let s = "hello"; s[len(s) - 1]`, "o"},
+		{`"hello"[1 + 1]`, "l"},
+		{`"hello"[5]`, nil},
+		{`"hello"[-1]`, nil},
+		{`""[0]`, nil},
+		// 按字符索引：é 虽然占两个字节，但只算一个字符
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[2]`, "l"},
+		{`"héllo"[4]`, "o"},
+		{`"héllo"[5]`, nil},
+		{`"你好，世界"[3]`, "世"},
+		{`"a😀b"[1]`, "😀"},
+		// 与index_of返回的位置一致
+		{`let s = "héllo wörld"; s[index_of(s, "w")]`, "w"},
+		{`let s = "héllo"; s[index_of(s, "l")]`, "l"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if expected, ok := tt.expected.(string); ok {
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("%s: object is not String. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("%s: String has wrong value. want=%q, got=%q", tt.input, expected, str.Value)
+			}
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let name = "World"; "Hello ${name}!"`, "Hello World!"},
+		{`let a = "x"; let b = "y"; "${a}${b}"`, "xy"},
+		{`let h = {"k": "v"}; "${h["k"]}-${h.k}"`, "v-v"},
+		{`let who = "you"; "outer ${"inner ${who}"} end"`, "outer inner you end"},
+		{`let f = fn(s) { s + "!" }; "${f("hi")}"`, "hi!"},
+		// 非字符串的值转换为字符串：字符串嵌套时不带引号，其他值使用Inspect
+		{`let t = "n=${1 + 2}"; t`, "n=3"},
+		{`"${"a${1}"}b"`, "a1b"},
+		{`"${2.5}|${-7}"`, "2.5|-7"},
+		{`"ok: ${1 < 2}, ${!true}"`, "ok: true, false"},
+		{`let a = [1, "b"]; "a=${a}"`, `a=[1, "b"]`},
+		{`"${{"k": "v"}}"`, `{"k": "v"}`},
+		{`"v=${if (false) { 1 }}"`, "v=null"},
+		{`let f = fn() {}; "${f()}!"`, "null!"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if str.Value != tt.expected {
+			t.Errorf("String has wrong value. want=%q, got=%q", tt.expected, str.Value)
+		}
+	}
+}
+
+func TestMemo(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// 以相同参数重复调用时函数体只执行一次
+		{`let calls = 0;
+		let sq = memo(fn(x) { calls = calls + 1; x * x });
+		sq(3); sq(3); sq(4); sq(3);
+		calls`, 2},
+		{`let sq = memo(fn(x) { x * x }); sq(3) + sq(3)`, 18},
+		// 递归调用经过包装后的名称，每个n只计算一次
+		{`let calls = 0;
+		let fib = memo(fn(n) { calls = calls + 1; if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } });
+		fib(30);
+		calls`, 31},
+		{`let fib = memo(fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }); fib(50)`, 12586269025},
+		// 多个参数共同组成缓存键
+		{`let calls = 0;
+		let add = memo(fn(a, b) { calls = calls + 1; a + b });
+		add(1, 2); add(2, 1); add(1, 2); add("a", "b"); add("a", "b");
+		calls`, 3},
+		// 不同类型哈希值相同的参数不会共用缓存
+		{`let calls = 0;
+		let f = memo(fn(x) { calls = calls + 1; x });
+		f(1); f(true); f(1); f(true);
+		calls`, 2},
+		// 分别包装同一个函数得到的缓存互不共享
+		{`let calls = 0;
+		let g = fn(x) { calls = calls + 1; x };
+		let a = memo(g); let b = memo(g);
+		a(1); b(1); a(1); b(1);
+		calls`, 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestMemoErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`memo(1)`, "argument to `memo` must be FUNCTION, got INTEGER"},
+		{`memo(len)`, "argument to `memo` must be FUNCTION, got BUILTIN"},
+		{`memo()`, "wrong number of arguments. got=0, want=1"},
+		{`let f = memo(fn(x) { x }); f([1])`, "unusable as memo key: ARRAY"},
+		{`let f = memo(fn(x) { x }); f(1, 2)`, "wrong number of arguments: expected 1, got 2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("%q: wrong error message. expected=%q, got=%q",
+				tt.input, tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestHashLiteralEvaluationOrder(t *testing.T) {
+	input := `let log = "";
+	let f = fn(x) { log = log + x; x };
+	{f("a"): f("b"), f("c"): f("d"), f("e"): f("f")};
+	log`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+	if str.Value != "abcdef" {
+		t.Errorf("hash literal evaluated in wrong order. got=%q, want=%q", str.Value, "abcdef")
+	}
+
+	errorTests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`{"a": foo, "b": bar}`, "identifier not found: foo"},
+		{`{"a" + foo: 1, "b" + bar: 2}`, "identifier not found: foo"},
+		// 同一对中先求值键再求值值
+		{`{"a" + foo: bar}`, "identifier not found: foo"},
+		{`{"a": 1 + true, [1]: 2, "c": baz}`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	// 重复多次，确保报告的错误不依赖于随机的顺序
+	for i := 0; i < 20; i++ {
+		for _, tt := range errorTests {
+			evaluated := testEval(tt.input)
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Fatalf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			}
+			if errObj.Message != tt.expectedMessage {
+				t.Fatalf("%q: wrong error message. expected=%q, got=%q",
+					tt.input, tt.expectedMessage, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+		{`quote(fn(x) { x * 2 })`, `fn(x) { (x * 2) }`},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(4))`, `4`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`let foobar = 8; quote(foobar)`, `foobar`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true))`, `true`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote("monkey"))`, `"monkey"`},
+		{`quote(unquote(1.5 * 2.0))`, `3.0`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{
+			`let quotedInfixExpression = quote(4 + 4);
+			quote(unquote(4 + 4) + unquote(quotedInfixExpression))`,
+			`(8 + (4 + 4))`,
+		},
+		// 函数体中的quote每次调用都基于原始的语法树
+		{`let f = fn(x) { quote(unquote(x)) }; f(1); f(2)`, `2`},
+		// 同一个Quote对象可以多次插入
+		{`let q = quote(a); quote(unquote(q) + unquote(q))`, `(a + a)`},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteUnquoteErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`quote()`, "wrong number of arguments to `quote`. got=0, want=1"},
+		{`quote(1, 2)`, "wrong number of arguments to `quote`. got=2, want=1"},
+		{`quote(unquote(1, 2))`, "wrong number of arguments to `unquote`. got=2, want=1"},
+		{`quote(unquote(missing))`, "identifier not found: missing"},
+		{`quote(unquote([1, 2]))`, "cannot unquote ARRAY"},
+		{`quote(unquote(fn(x) { x }))`, "cannot unquote FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("%q: wrong error message. expected=%q, got=%q",
+				tt.input, tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func testQuoteObject(t *testing.T, obj object.Object, expected string) bool {
+	quote, ok := obj.(*object.Quote)
+	if !ok {
+		t.Errorf("expected *object.Quote. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if quote.Node == nil {
+		t.Errorf("quote.Node is nil")
+		return false
+	}
+	if quote.Node.String() != expected {
+		t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), expected)
+		return false
+	}
+	if quote.Inspect() != "QUOTE("+expected+")" {
+		t.Errorf("wrong Inspect. got=%q", quote.Inspect())
+		return false
+	}
+	return true
+}
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := object.NewEnvironment()
+	program := testParseProgram(input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	_, ok := env.Get("number")
+	if ok {
+		t.Fatalf("number should not be defined")
+	}
+	_, ok = env.Get("function")
+	if ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("Wrong number of macro parameters. got=%d", len(macro.Parameters))
+	}
+
+	if macro.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", macro.Parameters[0])
+	}
+	if macro.Parameters[1].String() != "y" {
+		t.Fatalf("parameter is not 'y'. got=%q", macro.Parameters[1])
+	}
+
+	expectedBody := "(x + y)"
+
+	if macro.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+			let infixExpression = macro() { quote(1 + 2); };
+
+			infixExpression();
+			`,
+			`(1 + 2)`,
+		},
+		{
+			`
+			let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+
+			reverse(2 + 2, 10 - 5);
+			`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`
+			let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+
+			unless(10 > 5, puts("not greater"), puts("greater"));
+			`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		// 宏的实参中的宏调用同样被展开
+		{
+			`
+			let double = macro(x) { quote(unquote(x) * 2); };
+
+			double(double(1));
+			`,
+			`(1 * 2) * 2`,
+		},
+		// 不是宏调用的表达式保持不变
+		{
+			`
+			let m = macro() { quote(1); };
+			let f = fn() { 2 };
+
+			f() + m();
+			`,
+			`let f = fn() { 2 }; f() + 1`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(tt.expected)
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded := ExpandMacros(program, env)
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q", expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestMacroEvaluation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`
+		let unless = macro(condition, consequence, alternative) {
+			quote(if (!(unquote(condition))) { unquote(consequence) } else { unquote(alternative) });
+		};
+		unless(10 > 5, "not greater", "greater");
+		`, "greater"},
+		// 只有被选中的分支会被求值
+		{`
+		let unless = macro(condition, consequence, alternative) {
+			quote(if (!(unquote(condition))) { unquote(consequence) } else { unquote(alternative) });
+		};
+		let calls = 0;
+		let count = fn(x) { calls = calls + 1; x };
+		unless(false, count(1), count(2));
+		calls
+		`, 1},
+		// 实参在展开的位置求值，而不是在调用前求值一次
+		{`
+		let twice = macro(x) { quote(unquote(x) + unquote(x)); };
+		let n = 0;
+		let next = fn() { n = n + 1; n };
+		twice(next())
+		`, 3},
+		// 宏定义在函数内时，求值到宏调用才展开
+		{`
+		let f = fn(x) {
+			let swap = macro(a, b) { quote(unquote(b) - unquote(a)) };
+			swap(1, x)
+		};
+		f(10)
+		`, 9},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		evaluated := Eval(ExpandMacros(program, env), env)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. got=%q, want=%q", str.Value, expected)
+			}
+		}
+	}
+}
+
+func TestMacroExpansionErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`let m = macro(x) { quote(x) }; m()`, "wrong number of arguments: expected 1, got 0"},
+		{`let m = macro(x) { 1 }; m(2)`, "macro must return QUOTE, got INTEGER"},
+		{`let m = macro() { }; m()`, "macro must return QUOTE, got NULL"},
+		{`let m = macro() { missing }; m()`, "identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		evaluated := Eval(ExpandMacros(program, env), env)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("%q: wrong error message. expected=%q, got=%q",
+				tt.input, tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func testParseProgram(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func TestHashMembership(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`has_key({"a": 1}, "a")`, true},
+		{`has_key({"a": 1}, "b")`, false},
+		{`has_key({}, 1)`, false},
+		{`has_key({1: "x", true: "y"}, true)`, true},
+		{`has_key({1: "x"}, 1)`, true},
+		{`contains({"a": 1}, "a")`, true},
+		{`contains({"a": 1}, "b")`, false},
+		{`contains({"a": 1}, 1)`, false},
+		{`get({"a": 1}, "a", 0)`, 1},
+		{`get({"a": 1}, "b", 0)`, 0},
+		{`get({"a": 1}, "b")`, nil},
+		{`let h = {"n": 5}; get(h, "n", 0) + get(h, "m", 10)`, 15},
+		// 存储的null与不存在的键：索引表达式都返回null，has_key和get可以区分
+		{`let h = {"a": first([])}; h["a"] == h["b"]`, true},
+		{`let h = {"a": first([])}; has_key(h, "a")`, true},
+		{`let h = {"a": first([])}; has_key(h, "b")`, false},
+		{`let h = {"a": first([])}; contains(h, "a")`, true},
+		{`let h = {"a": first([])}; contains(h, "b")`, false},
+		{`let h = {"a": first([])}; get(h, "a", 1)`, nil},
+		{`let h = {"a": first([])}; get(h, "b", 1)`, 1},
+		// 错误
+		{`has_key({}, [1])`, "unusable as hash key: ARRAY"},
+		{`get({}, fn(x) { x }, 1)`, "unusable as hash key: FUNCTION"},
+		{`contains({}, {})`, "unusable as hash key: HASH"},
+		{`has_key([1], 0)`, "argument to `has_key` must be HASH, got ARRAY"},
+		{`get("abc", 0, 1)`, "argument to `get` must be HASH, got STRING"},
+		{`has_key({})`, "wrong number of arguments. got=1, want=2"},
+		{`get({}, 1, 2, 3)`, "wrong number of arguments. got=4, want=2 or 3"},
+		{`contains({"a": 1})`, "wrong number of arguments. got=1, want=2"},
+		// contains 同样适用于数组和字符串
+		{`contains([1, "a", [2]], "a")`, true},
+		{`contains([1, "a", [2]], [2])`, true},
+		{`contains([1, 2], 2.0)`, true},
+		{`contains([1, 2], 3)`, false},
+		{`contains([], first([]))`, false},
+		{`contains([first([])], false)`, false},
+		{`contains("monkey", "key")`, true},
+		{`contains("monkey", "")`, true},
+		{`contains("monkey", "Key")`, false},
+		{`contains("monkey", 1)`, "second argument to `contains` must be STRING, got INTEGER"},
+		{`contains(1, 1)`, "argument to `contains` not supported, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: object is not Error. got=%T (%+v)",
+					tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`puts("hello", "world!")`, nil},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, nil},
+		{`push([], 1)`, []int{1}},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)",
+					evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d",
+					len(expected), len(array.Elements))
+				continue
+			}
+
+			for i, expectedElem := range expected {
+				testIntegerObject(t, array.Elements[i], int64(expectedElem))
+			}
+		}
+	}
+}
+
+func TestStrBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"str(5)", "5"},
+		{"str(-12)", "-12"},
+		{"str(2.5)", "2.5"},
+		{"str(true)", "true"},
+		{"str(1 > 2)", "false"},
+		{"str(if (false) { 1 })", "null"},
+		// 字符串原样返回，不加引号
+		{`str("abc")`, "abc"},
+		{`str("")`, ""},
+		{`str("say \"hi\"")`, `say "hi"`},
+		// 数组和哈希表使用Inspect的结果，其中的字符串带引号
+		{`str([1, "a", [true]])`, `[1, "a", [true]]`},
+		{`str({"k": 1})`, `{"k": 1}`},
+		{"str([])", "[]"},
+		// 在字符串拼接中使用
+		{`"count: " + str(5)`, "count: 5"},
+		{`let n = 3; "n=" + str(n) + ", ok=" + str(n > 2)`, "n=3, ok=true"},
+		{`str(1) + str(2)`, "12"},
 	}
 
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("%q: object is not String. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("%q: wrong value. want=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"str()", "wrong number of arguments. got=0, want=1"},
+		{"str(1, 2)", "wrong number of arguments. got=2, want=1"},
+		{`"count: " + 5`, "type mismatch: STRING + INTEGER"},
+	}
 
+	for _, tt := range errors {
+		evaluated := testEval(tt.input)
 		errObj, ok := evaluated.(*object.Error)
 		if !ok {
-			t.Errorf("no error object returned. got=%T(%+v)",
-				evaluated, evaluated)
+			t.Errorf("%q: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
 			continue
 		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
 
-		if errObj.Message != tt.expectedMessage {
-			t.Errorf("wrong error message. expected=%q, got=%q",
-				tt.expectedMessage, errObj.Message)
+func TestIntBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 整数原样返回
+		{"int(5)", 5},
+		{"int(-5)", -5},
+		// 字符串按十进制解析，忽略首尾空白
+		{`int("42")`, 42},
+		{`int("-17")`, -17},
+		{`int("+8")`, 8},
+		{`int("  12\n")`, 12},
+		{`int("007")`, 7},
+		{`int("9223372036854775807")`, 9223372036854775807},
+		{`int("abc")`, `could not parse "abc" as integer`},
+		{`int("")`, `could not parse "" as integer`},
+		{`int("1.5")`, `could not parse "1.5" as integer`},
+		{`int("1 2")`, `could not parse "1 2" as integer`},
+		{`int("0x10")`, `could not parse "0x10" as integer`},
+		{`int("9223372036854775808")`, `integer out of range: "9223372036854775808"`},
+		{`int("-99999999999999999999999")`, `integer out of range: "-99999999999999999999999"`},
+		// 浮点数向零截断
+		{"int(2.9)", 2},
+		{"int(-2.9)", -2},
+		{"int(0.5)", 0},
+		{"int(7.0)", 7},
+		{"int(99999999999999999999.0)", "integer out of range: 1e+20"},
+		// 布尔值
+		{"int(true)", 1},
+		{"int(false)", 0},
+		// 不支持的类型
+		{"int([1])", "argument to `int` not supported, got ARRAY"},
+		{"int(if (false) { 1 })", "argument to `int` not supported, got NULL"},
+		{"int()", "wrong number of arguments. got=0, want=1"},
+		{`int("1", "2")`, "wrong number of arguments. got=2, want=1"},
+		// 与try/rescue配合处理无法解析的输入
+		{`try { int("x") } rescue (e) { -1 }`, -1},
+		{`int("3") + int(" 4 ")`, 7},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
 		}
 	}
 }
 
-func TestLetStatements(t *testing.T) {
+func TestOutputBuiltins(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected int64
+		expected string
 	}{
-		{"let a = 5; a;", 5},
-		{"let a = 5 * 5; a;", 25},
-		{"let a = 5; let b = a; b;", 5},
-		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		// print 输出每个参数的Inspect，用空格分隔，末尾不换行
+		{"print()", ""},
+		{`print("")`, `""`},
+		{`print("a")`, `"a"`},
+		{`print("count:", 3)`, `"count:" 3`},
+		{`print("a", 1, 2.5, true, [1, "b"], {"k": "v"})`, `"a" 1 2.5 true [1, "b"] {"k": "v"}`},
+		{`print("a\n"); print([])`, `"a\n"[]`},
+		{`print(1); print(2); print()`, "12"},
+		{`for (let i = 0; i < 3; i = i + 1) { print(i) }; print(3)`, "0123"},
+		// puts 每个参数占一行
+		{"puts()", ""},
+		{`puts("a", 1, [1, "b"])`, "a\n1\n[1, \"b\"]\n"},
+		{`print("loading"); puts(" ok"); print(1)`, "\"loading\" ok\n1"},
 	}
 
 	for _, tt := range tests {
-		testIntegerObject(t, testEval(tt.input), tt.expected)
+		var out bytes.Buffer
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := New(Options{Output: &out}).Eval(program, object.NewEnvironment())
+
+		testNullObject(t, evaluated)
+		if out.String() != tt.expected {
+			t.Errorf("%q: wrong output. want=%q, got=%q", tt.input, tt.expected, out.String())
+		}
 	}
 }
 
-func TestFunctionObject(t *testing.T) {
-	input := "fn(x) { x + 2; };"
+func TestInputBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		stdin    string
+		expected string // 求值结果的Inspect
+		output   string
+	}{
+		{"input()", "hello\nworld\n", `"hello"`, ""},
+		{`input("name: ")`, "Ada\n", `"Ada"`, "name: "},
+		{`input(42)`, "x\n", `"x"`, "42"},
+		{"[input(), input()]", "a\nb\nc\n", `["a", "b"]`, ""},
+		// \r\n和没有换行符的最后一行
+		{"[input(), input()]", "a\r\nlast", `["a", "last"]`, ""},
+		{"input()", "\n", `""`, ""},
+		// 输入结束时返回null，之后仍然是null
+		{"input()", "", "null", ""},
+		{`[input("> "), input("> "), input("> ")]`, "only\n", `["only", null, null]`, "> > > "},
+		{`let n = int(input("n? ")); n * 2`, " 21 \n", "42", "n? "},
+		{"input(1, 2)", "", "wrong number of arguments. got=2, want=0 or 1", ""},
+	}
 
-	evaluated := testEval(input)
-	fn, ok := evaluated.(*object.Function)
-	if !ok {
-		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	for _, tt := range tests {
+		in := bytes.NewBufferString(tt.stdin)
+		var out bytes.Buffer
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := New(Options{Input: in, Output: &out}).Eval(program, object.NewEnvironment())
+
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%q: wrong result. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+		if out.String() != tt.output {
+			t.Errorf("%q: wrong output. want=%q, got=%q", tt.input, tt.output, out.String())
+		}
 	}
+}
 
-	if len(fn.Parameters) != 1 {
-		t.Fatalf("function has wrong parameters. Parameters=%+v",
-			fn.Parameters)
+func TestEvalBuiltin(t *testing.T) {
+	testInspectResults(t, []inspectTest{
+		{`eval("1 + 2")`, "3"},
+		{`eval("")`, "null"},
+		{`eval("let a = 1; a * 10")`, "10"},
+		{`eval("[1, \"a\"]")`, `[1, "a"]`},
+		// 代码在调用处的环境中求值，可以读取和修改已有的变量
+		{`let x = 5; eval("x * 2")`, "10"},
+		{`let x = 5; eval("x = x + 1"); x`, "6"},
+		// eval中的定义在之后仍然可用
+		{`eval("let y = 7;"); y`, "7"},
+		{`eval("let double = fn(n) { n * 2 };"); double(21)`, "42"},
+		{`eval("let m = macro(a) { quote(unquote(a) + 1) };"); m(1)`, "2"},
+		{`let code = "let z = 1;"; eval(code); eval("z + 1")`, "2"},
+		// 在函数中调用时定义保存在函数的环境中，不会泄漏到外层
+		{`let f = fn() { eval("let inner = 3;"); inner }; f()`, "3"},
+		{`let f = fn() { eval("let inner = 3;") }; f(); inner`, "identifier not found: inner"},
+		{`let f = fn(n) { eval("n + 1") }; f(41)`, "42"},
+		// 顶层的return只结束eval中的代码
+		{`let f = fn() { let v = eval("return 1; 2"); v + 10 }; f()`, "11"},
+		{`eval("break")`, "break outside loop"},
+		{`eval("eval(\"1 + 1\") * 2")`, "4"},
+		// 作为回调传入时在调用内置函数处的环境中求值
+		{`let k = 100; flat_map(["k", "[k, 1]"], eval)`, "[100, 100, 1]"},
+		// 错误
+		{`eval("1 +")`, "could not parse code passed to `eval`: no prefix parse function for EOF found"},
+		{`eval("let = 1; 2 +")`, "could not parse code passed to `eval`: " +
+			"expected next token to be IDENT, got = instead; no prefix parse function for EOF found"},
+		{`eval("1 / 0")`, "division by zero"},
+		{`try { eval("1 / 0") } rescue (e) { e["message"] }`, `"division by zero"`},
+		{"eval(1)", "argument to `eval` must be STRING, got INTEGER"},
+		{"eval()", "wrong number of arguments. got=0, want=1"},
+	})
+
+	// 有语法错误时代码一条也不执行
+	env := object.NewEnvironment()
+	Eval(testParseProgram(`eval("let p = 1; 1 +")`), env)
+	if _, ok := env.Get("p"); ok {
+		t.Errorf("eval with parse errors defined p")
 	}
 
-	if fn.Parameters[0].String() != "x" {
-		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	exit, ok := testEval(`eval("exit(4)"); 1`).(*object.Exit)
+	if !ok || exit.Code != 4 {
+		t.Errorf("exit inside eval did not propagate. got=%v", exit)
 	}
+}
 
-	expectedBody := "(x + 2)"
+func TestJSONEncodeBuiltin(t *testing.T) {
+	testInspectResults(t, []inspectTest{
+		{"json_encode(if (false) { 1 })", `"null"`},
+		{"json_encode(true)", `"true"`},
+		{"json_encode(-42)", `"-42"`},
+		{"json_encode(2.5)", `"2.5"`},
+		{"json_encode(2.0)", `"2.0"`},
+		{`json_encode("hi")`, `"\"hi\""`},
+		{"json_encode([])", `"[]"`},
+		{"json_encode({})", `"{}"`},
+		{`let nothing = if (false) { 1 }; json_encode([1, "a", [true, nothing]])`, `"[1,\"a\",[true,null]]"`},
+		// 键按字典序输出，与哈希字面量中的顺序无关
+		{`json_encode({"b": 1, "a": 2, "c": {"z": 1, "y": 2}})`, `"{\"a\":2,\"b\":1,\"c\":{\"y\":2,\"z\":1}}"`},
+		{`json_encode({"c": 3, "a": 1, "b": 2}) == json_encode({"a": 1, "b": 2, "c": 3})`, "true"},
+		// 错误
+		{"json_encode({1: 2})", "hash key must be STRING to encode as JSON, got INTEGER"},
+		{`json_encode([{"a": {true: 1}}])`, "hash key must be STRING to encode as JSON, got BOOLEAN"},
+		{"json_encode(fn(x) { x })", "cannot encode FUNCTION as JSON"},
+		{`json_encode({"f": len})`, "cannot encode BUILTIN as JSON"},
+		{"json_encode([1, memo(fn(x) { x })])", "cannot encode MEMOIZED as JSON"},
+		{"json_encode(pow(10.0, 400))", "cannot encode +Inf as JSON"},
+		{"let a = [1, 2]; a[0] = a; json_encode(a)", "cannot encode cyclic ARRAY as JSON"},
+		{`let h = {"k": 1}; h["self"] = [h]; json_encode(h)`, "cannot encode cyclic HASH as JSON"},
+		{"json_encode()", "wrong number of arguments. got=0, want=1"},
+	})
 
-	if fn.Body.String() != expectedBody {
-		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	// 同一个值出现多次不是循环引用
+	testInspectResults(t, []inspectTest{
+		{"let a = [1]; json_encode([a, a])", `"[[1],[1]]"`},
+	})
+
+	// 输出是合法的JSON，用encoding/json解码后与原来的结构一致
+	input := `let nothing = if (false) { 1 };
+	json_encode({
+		"name": "monkey \"lang\"",
+		"escapes": "tab\there\nnew <line> & \\ back",
+		"unicode": "héllo, 世界",
+		"numbers": [1, -2, 3.25, 0.0, 99999999999999999999.0],
+		"flags": {"on": true, "off": false, "none": nothing},
+		"ragged": [[], [[]], [1, [2, [3]]], {}]
+	})`
+	encoded, ok := testEval(input).(*object.String)
+	if !ok {
+		t.Fatalf("json_encode did not return a String. got=%s", testEval(input).Inspect())
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(encoded.Value), &decoded); err != nil {
+		t.Fatalf("json_encode produced invalid JSON %q: %s", encoded.Value, err)
+	}
+	expected := map[string]interface{}{
+		"name":    `monkey "lang"`,
+		"escapes": "tab\there\nnew <line> & \\ back",
+		"unicode": "héllo, 世界",
+		"numbers": []interface{}{1.0, -2.0, 3.25, 0.0, 1e20},
+		"flags":   map[string]interface{}{"on": true, "off": false, "none": nil},
+		"ragged": []interface{}{
+			[]interface{}{},
+			[]interface{}{[]interface{}{}},
+			[]interface{}{1.0, []interface{}{2.0, []interface{}{3.0}}},
+			map[string]interface{}{},
+		},
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("wrong decoded value.\nwant=%#v\ngot=%#v", expected, decoded)
 	}
 }
 
-func TestFunctionApplication(t *testing.T) {
+func TestExitBuiltin(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected int64
 	}{
-		{"let identity = fn(x) { x; }; identity(5);", 5},
-		{"let identity = fn(x) { return x; }; identity(5);", 5},
-		{"let double = fn(x) { x * 2; }; double(5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
-		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
-		{"fn(x) { x; }(5)", 5},
+		{"exit()", 0},
+		{"exit(3)", 3},
+		{"exit(-1)", -1},
+		{"exit(2); 5", 2},
+		{"let x = exit(4); x", 4},
+		{"1 + exit(5)", 5},
+		{"[1, exit(6), 3]", 6},
+		{`{"a": exit(7)}`, 7},
+		{"if (true) { exit(8); 1 }", 8},
+		// 穿过函数调用、循环、try和回调
+		{"let f = fn() { exit(9); 1 }; f(); 2", 9},
+		{"let f = fn(n) { if (n == 0) { exit(10) }; f(n - 1) }; f(5)", 10},
+		{"while (true) { exit(11) }", 11},
+		{"for (let i = 0; i < 10; i = i + 1) { if (i == 3) { exit(i) } }", 3},
+		{"try { exit(12) } rescue (e) { 0 }", 12},
+		{"let r = try { 1 } rescue (e) { 0 }; exit(r + 12)", 13},
+		{"switch (1) { case 1 { exit(14) } }", 14},
+		{"sort([3, 1, 2], fn(a, b) { exit(15) })", 15},
+		{"flat_map([1, 2], fn(x) { exit(x + 15) })", 16},
+		{"let g = memo(fn(x) { exit(x) }); g(17)", 17},
 	}
 
 	for _, tt := range tests {
-		testIntegerObject(t, testEval(tt.input), tt.expected)
+		evaluated := testEval(tt.input)
+		exit, ok := evaluated.(*object.Exit)
+		if !ok {
+			t.Errorf("%q: object is not Exit. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if exit.Code != tt.expected {
+			t.Errorf("%q: wrong exit code. want=%d, got=%d", tt.input, tt.expected, exit.Code)
+		}
 	}
-}
 
-func TestEnclosingEnvironments(t *testing.T) {
-	input := `
-let first = 10;
-let second = 10;
-let third = 10;
+	// exit之后的代码不再执行
+	var out bytes.Buffer
+	program := testParseProgram(`puts("before"); let f = fn() { exit(1); puts("in f") }; f(); puts("after")`)
+	New(Options{Output: &out}).Eval(program, object.NewEnvironment())
+	if out.String() != "before\n" {
+		t.Errorf("wrong output. want=%q, got=%q", "before\n", out.String())
+	}
 
-let ourFunction = fn(first) {
-  let second = 20;
+	testInspectResults(t, []inspectTest{
+		{`exit("1")`, "argument to `exit` must be INTEGER, got STRING"},
+		{"exit(1, 2)", "wrong number of arguments. got=2, want=0 or 1"},
+		{"exit", "builtin function"},
+	})
+}
 
-  first + second + third;
-};
+func TestSortBuiltin(t *testing.T) {
+	testInspectResults(t, []inspectTest{
+		// 默认顺序：数值按大小，字符串按字典序
+		{"sort([3, 1, 2])", "[1, 2, 3]"},
+		{"sort([-1, 10, 0, -20])", "[-20, -1, 0, 10]"},
+		{"sort([2.5, 1, -0.5, 2])", "[-0.5, 1, 2, 2.5]"},
+		{`sort(["pear", "apple", "Banana", "app"])`, `["Banana", "app", "apple", "pear"]`},
+		{"sort([])", "[]"},
+		{"sort([1])", "[1]"},
+		// 不修改原数组
+		{"let a = [3, 1, 2]; let b = sort(a); a", "[3, 1, 2]"},
+		{"let a = [3, 1, 2]; let b = sort(a, fn(x, y) { y - x }); [a, b]", "[[3, 1, 2], [3, 2, 1]]"},
+		// 比较函数返回整数或布尔值
+		{"sort([3, 1, 2], fn(a, b) { b - a })", "[3, 2, 1]"},
+		{"sort([3, 1, 2], fn(a, b) { a > b })", "[3, 2, 1]"},
+		{`sort(["ccc", "a", "bb"], fn(a, b) { len(a) - len(b) })`, `["a", "bb", "ccc"]`},
+		// 按字段排序哈希表
+		{`let people = [{"name": "bo", "age": 30}, {"name": "al", "age": 25}, {"name": "cy", "age": 41}];
+		let byAge = sort(people, fn(a, b) { a.age - b.age });
+		[byAge[0].name, byAge[1].name, byAge[2].name]`, `["al", "bo", "cy"]`},
+		// 稳定排序：相等的元素保持原来的先后顺序
+		{`let items = [["b", 2], ["a", 1], ["c", 2], ["d", 1], ["e", 2]];
+		let sorted = sort(items, fn(x, y) { x[1] - y[1] });
+		[sorted[0][0], sorted[1][0], sorted[2][0], sorted[3][0], sorted[4][0]]`, `["a", "d", "b", "c", "e"]`},
+		{`let items = [["b", 2], ["a", 1], ["c", 2], ["d", 1]];
+		let sorted = sort(items, fn(x, y) { x[1] < y[1] });
+		[sorted[0][0], sorted[1][0], sorted[2][0], sorted[3][0]]`, `["a", "d", "b", "c"]`},
+		// 内置函数也可以作为比较函数
+		{"sort([[2], [1, 1], []], fn(a, b) { len(a) - len(b) })", "[[], [2], [1, 1]]"},
+		// 错误
+		{`sort([1, "a"])`, "cannot sort mixed INTEGER and STRING elements"},
+		{`sort(["a", 2.5])`, "cannot sort mixed STRING and FLOAT elements"},
+		{"sort([[1], [2]])", "cannot sort ARRAY elements without a comparator"},
+		{"sort([1, true])", "cannot sort BOOLEAN elements without a comparator"},
+		{"sort(1)", "argument to `sort` must be ARRAY, got INTEGER"},
+		{"sort()", "wrong number of arguments. got=0, want=1 or 2"},
+		{"sort([1], fn(a, b) { 0 }, 3)", "wrong number of arguments. got=3, want=1 or 2"},
+		// 比较函数的错误向外传递
+		{"sort([1, 2], fn(a, b) { a + true })", "type mismatch: INTEGER + BOOLEAN"},
+		{`sort([1, 2], fn(a, b) { "x" })`, "comparator passed to `sort` must return INTEGER or BOOLEAN, got STRING"},
+		{"sort([1, 2], fn(a) { 0 })", "wrong number of arguments: expected 1, got 2"},
+		{"sort([1, 2], 3)", "not a function: INTEGER"},
+	})
+}
 
-ourFunction(20) + first + second;`
+func TestJoinBuiltin(t *testing.T) {
+	testInspectResults(t, []inspectTest{
+		{`join(["a", "b", "c"], ", ")`, `"a, b, c"`},
+		{`join(["a", "b", "c"], "")`, `"abc"`},
+		{`join(["only"], "-")`, `"only"`},
+		{`join([], ", ")`, `""`},
+		{`join([], "")`, `""`},
+		// 字符串元素不加引号，其他元素使用Inspect的结果
+		{`join([1, "two", 3.5, true, [4, "five"], {"k": "v"}], " ")`, `"1 two 3.5 true [4, \"five\"] {\"k\": \"v\"}"`},
+		{`join(["", "", ""], ",")`, `",,"`},
+		{`join([if (false) { 1 }, 2], "|")`, `"null|2"`},
+		{`join(["a", "b"], "\n")`, `"a\nb"`},
+		{`let words = ["x", "y"]; "<" + join(words, "><") + ">"`, `"<x><y>"`},
+		// 错误
+		{`join(["a"], 1)`, "separator passed to `join` must be STRING, got INTEGER"},
+		{`join(["a"], ["b"])`, "separator passed to `join` must be STRING, got ARRAY"},
+		{`join("ab", "")`, "argument to `join` must be ARRAY, got STRING"},
+		{`join(["a"])`, "wrong number of arguments. got=1, want=2"},
+	})
+}
 
-	testIntegerObject(t, testEval(input), 70)
+func TestTrimBuiltins(t *testing.T) {
+	testInspectResults(t, []inspectTest{
+		{`trim("  hello  ")`, `"hello"`},
+		{`trim_left("  hello  ")`, `"hello  "`},
+		{`trim_right("  hello  ")`, `"  hello"`},
+		// 中间的空白保持不变
+		{`trim(" \t hello   world \n")`, `"hello   world"`},
+		{`trim_left("\n a b ")`, `"a b "`},
+		{`trim_right(" a b \r\n")`, `" a b"`},
+		// 只有空白的字符串和空字符串
+		{`trim(" \t\n ")`, `""`},
+		{`trim_left("   ")`, `""`},
+		{`trim_right("   ")`, `""`},
+		{`trim("")`, `""`},
+		{`trim("none")`, `"none"`},
+		// Unicode空白（全角空格）
+		{`trim("　中文　")`, `"中文"`},
+		// 去掉字符集合中的任意字符
+		{`trim("xxhixyx", "xy")`, `"hi"`},
+		{`trim_left("--a-b--", "-")`, `"a-b--"`},
+		{`trim_right("--a-b--", "-")`, `"--a-b"`},
+		{`trim("  padded  ", "")`, `"  padded  "`},
+		{`trim("aaaa", "a")`, `""`},
+		{`trim(" x ", " ")`, `"x"`},
+		// 原字符串不变
+		{`let s = "  s  "; let t = trim(s); s`, `"  s  "`},
+		// 错误
+		{"trim(1)", "argument to `trim` must be STRING, got INTEGER"},
+		{`trim_left(["a"])`, "argument to `trim_left` must be STRING, got ARRAY"},
+		{`trim_right("a", 1)`, "argument to `trim_right` must be STRING, got INTEGER"},
+		{"trim()", "wrong number of arguments. got=0, want=1 or 2"},
+		{`trim_left("a", "b", "c")`, "wrong number of arguments. got=3, want=1 or 2"},
+	})
 }
 
-func TestClosures(t *testing.T) {
-	input := `
-let newAdder = fn(x) {
-  fn(y) { x + y };
-};
+func TestCaseBuiltins(t *testing.T) {
+	testInspectResults(t, []inspectTest{
+		{`upper("Hello, World")`, `"HELLO, WORLD"`},
+		{`lower("Hello, World")`, `"hello, world"`},
+		{`capitalize("hello world")`, `"Hello world"`},
+		{`capitalize("hELLO")`, `"HELLO"`},
+		{`capitalize("123abc")`, `"123abc"`},
+		// 非ASCII字符
+		{`upper("crème brûlée")`, `"CRÈME BRÛLÉE"`},
+		{`lower("ÀÉÎÕÜ")`, `"àéîõü"`},
+		{`capitalize("élan")`, `"Élan"`},
+		{`capitalize("ßtraße")`, `"ßtraße"`},
+		{`upper("中文abc")`, `"中文ABC"`},
+		// 空字符串
+		{`upper("")`, `""`},
+		{`lower("")`, `""`},
+		{`capitalize("")`, `""`},
+		// 忽略大小写的比较
+		{`lower("MonKey") == lower("monkey")`, "true"},
+		{`upper("a") == "a"`, "false"},
+		// 错误
+		{"upper(1)", "argument to `upper` must be STRING, got INTEGER"},
+		{`lower(["A"])`, "argument to `lower` must be STRING, got ARRAY"},
+		{"capitalize(true)", "argument to `capitalize` must be STRING, got BOOLEAN"},
+		{"upper()", "wrong number of arguments. got=0, want=1"},
+		{`capitalize("a", "b")`, "wrong number of arguments. got=2, want=1"},
+	})
+}
 
-let addTwo = newAdder(2);
-addTwo(2);`
+func TestSubstrBuiltin(t *testing.T) {
+	testInspectResults(t, []inspectTest{
+		{`substr("monkey", 0, 3)`, `"mon"`},
+		{`substr("monkey", 3, 3)`, `"key"`},
+		{`substr("monkey", 1, 1)`, `"o"`},
+		// 长度超出末尾时截到末尾
+		{`substr("monkey", 3, 100)`, `"key"`},
+		{`substr("monkey", 0, 9223372036854775807)`, `"monkey"`},
+		// 起始位置在末尾或之后时为空字符串
+		{`substr("monkey", 6, 1)`, `""`},
+		{`substr("monkey", 100, 1)`, `""`},
+		{`substr("", 0, 1)`, `""`},
+		// 长度为零
+		{`substr("monkey", 2, 0)`, `""`},
+		// 多字节字符按字符计数
+		{`substr("你好，世界", 3, 2)`, `"世界"`},
+		{`substr("héllo", 1, 3)`, `"éll"`},
+		{`substr("a😀b", 1, 1)`, `"😀"`},
+		// 取出的是完整的字符，len按字节计数，一个中文字符占3个字节
+		{`len(substr("你好", 0, 1))`, "3"},
+		// 错误
+		{`substr("abc", -1, 2)`, "negative start or length passed to `substr`: -1, 2"},
+		{`substr("abc", 0, -2)`, "negative start or length passed to `substr`: 0, -2"},
+		{"substr(123, 0, 1)", "argument to `substr` must be STRING, got INTEGER"},
+		{`substr("abc", "0", 1)`, "start passed to `substr` must be INTEGER, got STRING"},
+		{`substr("abc", 0, 1.5)`, "length passed to `substr` must be INTEGER, got FLOAT"},
+		{`substr("abc", 0)`, "wrong number of arguments. got=2, want=3"},
+	})
+}
 
-	testIntegerObject(t, testEval(input), 4)
+func TestIndexOfBuiltin(t *testing.T) {
+	testInspectResults(t, []inspectTest{
+		// 字符串：按字符计数的位置
+		{`index_of("monkey", "key")`, "3"},
+		{`index_of("monkey", "m")`, "0"},
+		{`index_of("monkey", "")`, "0"},
+		{`index_of("banana", "an")`, "1"},
+		{`index_of("monkey", "ape")`, "-1"},
+		{`index_of("", "a")`, "-1"},
+		{`index_of("你好，世界", "世界")`, "3"},
+		{`let s = "héllo wörld"; substr(s, index_of(s, "wö"), 5)`, `"wörld"`},
+		// 数组：按 == 的规则比较元素
+		{"index_of([1, 2, 3], 2)", "1"},
+		{"index_of([1, 2, 3, 2], 2)", "1"},
+		{"index_of([1, 2, 3], 4)", "-1"},
+		{"index_of([], 1)", "-1"},
+		{`index_of(["a", "b", "c"], "c")`, "2"},
+		{`index_of(["1", 1], 1)`, "1"},
+		{"index_of([1, 2.5], 2.5)", "1"},
+		{"index_of([0, 1], 1.0)", "1"},
+		{"index_of([false, if (false) { 1 }], if (false) { 1 })", "1"},
+		// 数组和哈希表元素深度比较
+		{"index_of([[1], [1, 2], [1, 2, 3]], [1, 2])", "1"},
+		{`index_of([{"a": 1}, {"a": [2]}], {"a": [2]})`, "1"},
+		{`index_of([{"a": 1}], {"a": 2})`, "-1"},
+		// 错误
+		{`index_of("abc", 1)`, "second argument to `index_of` must be STRING, got INTEGER"},
+		{`index_of({"a": 1}, "a")`, "argument to `index_of` not supported, got HASH"},
+		{"index_of(12, 1)", "argument to `index_of` not supported, got INTEGER"},
+		{"index_of([1])", "wrong number of arguments. got=1, want=2"},
+	})
 }
 
-// TestStringLiteral 测试字符串字面量的求值功能
-// 验证 Monkey 语言解释器能够正确解析和求值字符串字面量表达式
-func TestStringLiteral(t *testing.T) {
-	input := `"Hello World!"` // 测试输入：包含字符串字面量的 Monkey 代码
+func TestSumMinMaxBuiltins(t *testing.T) {
+	testInspectResults(t, []inspectTest{
+		// sum
+		{"sum([1, 2, 3])", "6"},
+		{"sum([])", "0"},
+		{"sum([7])", "7"},
+		{"sum([-5, 5])", "0"},
+		{"sum([1, 2.5])", "3.5"},
+		{"sum([0.5, 0.25])", "0.75"},
+		// min和max比较数组的元素
+		{"min([3, 1, 2])", "1"},
+		{"max([3, 1, 2])", "3"},
+		{"min([42])", "42"},
+		{"max([42])", "42"},
+		{"min([-1, -5, 0])", "-5"},
+		{"max([1, 2.5, 2])", "2.5"},
+		{"min([1, 0.5])", "0.5"},
+		{`min(["pear", "apple", "fig"])`, `"apple"`},
+		{`max(["pear", "apple", "fig"])`, `"pear"`},
+		// 可变参数形式
+		{"min(1, 2, 3)", "1"},
+		{"max(1, 2, 3)", "3"},
+		{"min(5)", "5"},
+		{`max("a", "b")`, `"b"`},
+		{"max(2, 1.5)", "2"},
+		// 相等的最值返回第一个
+		{"min([1, 1.0])", "1"},
+		{"max([2.0, 2])", "2.0"},
+		// 错误
+		{`sum([1, "2"])`, "cannot sum STRING elements"},
+		{"sum([[1]])", "cannot sum ARRAY elements"},
+		{"sum(1)", "argument to `sum` must be ARRAY, got INTEGER"},
+		{"sum([1], [2])", "wrong number of arguments. got=2, want=1"},
+		{"min([])", "argument to `min` must not be empty"},
+		{"max([])", "argument to `max` must not be empty"},
+		{`min([1, "a"])`, "cannot compare mixed INTEGER and STRING values in `min`"},
+		{`max("a", 2.5)`, "cannot compare mixed STRING and FLOAT values in `max`"},
+		{"min([true, false])", "cannot compare BOOLEAN values in `min`"},
+		{"max([1], [2])", "cannot compare ARRAY values in `max`"},
+		{"min()", "wrong number of arguments. got=0, want at least 1"},
+	})
+}
 
-	evaluated := testEval(input)          // 调用求值器对输入进行求值
-	str, ok := evaluated.(*object.String) // 断言求值结果应为 String 类型对象
-	if !ok {
-		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
-	}
+// inspectTest 是按结果的文本比较的测试用例
+// 结果是错误时与错误消息比较，否则与Inspect的结果比较
+type inspectTest struct {
+	input    string
+	expected string
+}
 
-	if str.Value != "Hello World!" { // 验证字符串对象的值为期望的 "Hello World!"
-		t.Errorf("String has wrong value. got=%q", str.Value)
+func testInspectResults(t *testing.T, tests []inspectTest) {
+	t.Helper()
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%q: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
 	}
 }
 
-func TestStringConcatenation(t *testing.T) {
-	input := `"Hello" + " " + "World!"`
+func TestAbsBuiltin(t *testing.T) {
+	testInspectResults(t, []inspectTest{
+		{"abs(5)", "5"},
+		{"abs(-5)", "5"},
+		{"abs(0)", "0"},
+		{"abs(-2.5)", "2.5"},
+		{"abs(2.5)", "2.5"},
+		{"abs(-0.0)", "0.0"},
+		{"(3 - 10).abs()", "7"},
+		{"abs(-9223372036854775807)", "9223372036854775807"},
+		{"abs(-9223372036854775807 - 1)", "absolute value out of range: -9223372036854775808"},
+		{`abs("1")`, "argument to `abs` must be INTEGER or FLOAT, got STRING"},
+		{"abs(true)", "argument to `abs` must be INTEGER or FLOAT, got BOOLEAN"},
+		{"abs()", "wrong number of arguments. got=0, want=1"},
+		{"abs(1, 2)", "wrong number of arguments. got=2, want=1"},
+	})
+}
 
-	evaluated := testEval(input)
-	str, ok := evaluated.(*object.String)
-	if !ok {
-		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+func TestPowBuiltin(t *testing.T) {
+	testInspectResults(t, []inspectTest{
+		// 整数底数和非负整数指数得到整数
+		{"pow(2, 10)", "1024"},
+		{"pow(3, 0)", "1"},
+		{"pow(0, 0)", "1"},
+		{"pow(-2, 3)", "-8"},
+		{"pow(10, 18)", "1000000000000000000"},
+		{"pow(2, 62)", "4611686018427387904"},
+		{"pow(-2, 63)", "-9223372036854775808"},
+		{"pow(-1, 9223372036854775807)", "-1"},
+		{"pow(1, 9223372036854775807)", "1"},
+		// 超出整数范围时按浮点数计算，不会回绕
+		{"pow(2, 63)", "9.223372036854776e+18"},
+		{"pow(-2, 64)", "1.8446744073709552e+19"},
+		{"pow(10, 19) > 0", "true"},
+		{"pow(3, 40)", "1.2157665459056929e+19"},
+		// 其余情况按浮点数计算
+		{"pow(2, -1)", "0.5"},
+		{"pow(2.0, 3)", "8.0"},
+		{"pow(4, 0.5)", "2.0"},
+		{"pow(1.5, 2)", "2.25"},
+		{`pow("2", 2)`, "argument to `pow` must be INTEGER or FLOAT, got STRING"},
+		{"pow(2, [1])", "argument to `pow` must be INTEGER or FLOAT, got ARRAY"},
+		{"pow(2)", "wrong number of arguments. got=1, want=2"},
+	})
+}
+
+func TestSqrtBuiltin(t *testing.T) {
+	testInspectResults(t, []inspectTest{
+		{"sqrt(16)", "4.0"},
+		{"sqrt(2.25)", "1.5"},
+		{"sqrt(0)", "0.0"},
+		{"sqrt(2) * sqrt(2) > 1.99", "true"},
+		{"sqrt(-1)", "square root of negative number: -1"},
+		{"sqrt(-0.25)", "square root of negative number: -0.25"},
+		{`sqrt("4")`, "argument to `sqrt` must be INTEGER or FLOAT, got STRING"},
+		{"sqrt()", "wrong number of arguments. got=0, want=1"},
+	})
+}
+
+func TestRoundingBuiltins(t *testing.T) {
+	testInspectResults(t, []inspectTest{
+		{"floor(2.7)", "2"},
+		{"floor(-2.2)", "-3"},
+		{"floor(3.0)", "3"},
+		{"floor(5)", "5"},
+		{"ceil(2.2)", "3"},
+		{"ceil(-2.7)", "-2"},
+		{"ceil(5)", "5"},
+		{"round(2.4)", "2"},
+		{"round(2.5)", "3"},
+		{"round(-2.5)", "-3"},
+		{"round(-2.4)", "-2"},
+		{"round(7)", "7"},
+		{"floor(99999999999999999999.0)", "integer out of range: 1e+20"},
+		{`floor("1.5")`, "argument to `floor` must be INTEGER or FLOAT, got STRING"},
+		{"ceil([1.5])", "argument to `ceil` must be INTEGER or FLOAT, got ARRAY"},
+		{"round(true)", "argument to `round` must be INTEGER or FLOAT, got BOOLEAN"},
+		{"round(1.5, 2)", "wrong number of arguments. got=2, want=1"},
+	})
+}
+
+func TestPopBuiltin(t *testing.T) {
+	testInspectResults(t, []inspectTest{
+		{"pop([1, 2, 3])", "[3, [1, 2]]"},
+		{`pop(["only"])`, `["only", []]`},
+		{"pop([[1, 2], [3]])", "[[3], [[1, 2]]]"},
+		{"let [x, xs] = pop([1, 2, 3]); [x, xs]", "[3, [1, 2]]"},
+		{"[1, 2, 3].pop()[0]", "3"},
+		// 反复pop直到取完
+		{`let drain = fn(arr, acc) {
+			if (len(arr) == 0) { return acc; }
+			let [x, xs] = pop(arr);
+			drain(xs, push(acc, x))
+		};
+		drain([1, 2, 3, 4], [])`, "[4, 3, 2, 1]"},
+		// 不修改原数组
+		{"let a = [1, 2, 3]; let p = pop(a); a", "[1, 2, 3]"},
+		{"let a = [1, 2, 3]; let [x, xs] = pop(a); let b = push(xs, 9); [a, b]", "[[1, 2, 3], [1, 2, 9]]"},
+		{"let a = [1, 2, 3]; let [x, xs] = pop(a); let b = push(push(xs, 8), 9); [a, b]", "[[1, 2, 3], [1, 2, 8, 9]]"},
+		{"let a = [1, 2, 3]; let r = pop(a)[1]; r[0] = 99; [a, r]", "[[1, 2, 3], [99, 2]]"},
+		{"let a = [1, 2, 3]; let [x, xs] = pop(a); a[1] = 0; xs", "[1, 2]"},
+		// 错误
+		{"pop([])", "cannot pop from empty array"},
+		{"let [x, xs] = pop([1]); pop(xs)", "cannot pop from empty array"},
+		{`pop("abc")`, "argument to `pop` must be ARRAY, got STRING"},
+		{"pop()", "wrong number of arguments. got=0, want=1"},
+		{"pop([1], [2])", "wrong number of arguments. got=2, want=1"},
+	})
+}
+
+func TestInsertBuiltin(t *testing.T) {
+	testInspectResults(t, []inspectTest{
+		{"insert([1, 2, 3], 0, 0)", "[0, 1, 2, 3]"},
+		{"insert([1, 2, 3], 1, 9)", "[1, 9, 2, 3]"},
+		{"insert([1, 2, 3], 3, 4)", "[1, 2, 3, 4]"},
+		{`insert([], 0, "a")`, `["a"]`},
+		{"insert([1], 0, [2, 3])", "[[2, 3], 1]"},
+		// 负数从末尾倒数
+		{"insert([1, 2, 3], -1, 9)", "[1, 2, 9, 3]"},
+		{"insert([1, 2, 3], -3, 9)", "[9, 1, 2, 3]"},
+		{"[1, 2].insert(1, 5)", "[1, 5, 2]"},
+		// 不修改原数组
+		{"let a = [1, 2, 3]; let b = insert(a, 1, 9); a", "[1, 2, 3]"},
+		{"let a = push([1, 2], 3); let b = insert(a, 3, 4); let c = push(a, 5); [a, b, c]",
+			"[[1, 2, 3], [1, 2, 3, 4], [1, 2, 3, 5]]"},
+		// 错误
+		{"insert([1, 2, 3], 4, 0)", "index out of range: 4 (array length 3)"},
+		{"insert([1, 2, 3], -4, 0)", "index out of range: -4 (array length 3)"},
+		{"insert([], 1, 0)", "index out of range: 1 (array length 0)"},
+		{`insert([1], "0", 0)`, "index passed to `insert` must be INTEGER, got STRING"},
+		{`insert("abc", 0, "x")`, "argument to `insert` must be ARRAY, got STRING"},
+		{"insert([1], 0)", "wrong number of arguments. got=2, want=3"},
+	})
+}
+
+func TestFlattenBuiltins(t *testing.T) {
+	testInspectResults(t, []inspectTest{
+		// 默认展开一层
+		{"flatten([1, [2, 3], [4, [5, [6]]]])", "[1, 2, 3, 4, [5, [6]]]"},
+		{"flatten([[1], [], [2, 3], []])", "[1, 2, 3]"},
+		{"flatten([])", "[]"},
+		{"flatten([[]])", "[]"},
+		{`flatten(["a", {"k": [1]}, [true]])`, `["a", {"k": [1]}, true]`},
+		// 指定展开层数
+		{"flatten([1, [2, [3, [4]]]], 0)", "[1, [2, [3, [4]]]]"},
+		{"flatten([1, [2, [3, [4]]]], 1)", "[1, 2, [3, [4]]]"},
+		{"flatten([1, [2, [3, [4]]]], 2)", "[1, 2, 3, [4]]"},
+		{"flatten([1, [2, [3, [4]]]], 10)", "[1, 2, 3, 4]"},
+		{"flatten([1, [2, [3, [4, [], [[5]]]]]], -1)", "[1, 2, 3, 4, 5]"},
+		{"flatten([[[[]]], [[]]], -1)", "[]"},
+		// 不修改原数组
+		{"let a = [1, [2, [3]]]; let b = flatten(a, -1); a", "[1, [2, [3]]]"},
+		{"let inner = [2]; let b = flatten([1, inner]); let c = push(b, 3); inner", "[2]"},
+		// flat_map
+		{"flat_map([1, 2, 3], fn(x) { [x, x * 10] })", "[1, 10, 2, 20, 3, 30]"},
+		{"flat_map([1, 2, 3], fn(x) { if (x == 2) { [] } else { [x] } })", "[1, 3]"},
+		{"flat_map([1, 2], fn(x) { x * 2 })", "[2, 4]"},
+		{"flat_map([1, 2], fn(x) { [[x]] })", "[[1], [2]]"},
+		{"flat_map([], fn(x) { [x] })", "[]"},
+		{`flat_map(["ab", "c"], fn(s) { [s, len(s)] })`, `["ab", 2, "c", 1]`},
+		{"let a = [[1], [2]]; let b = flat_map(a, fn(x) { x }); a", "[[1], [2]]"},
+		// 错误
+		{"flatten(1)", "argument to `flatten` must be ARRAY, got INTEGER"},
+		{`flatten([1], "1")`, "depth passed to `flatten` must be INTEGER, got STRING"},
+		{"flatten([1], -2)", "depth passed to `flatten` must be -1 or at least 0, got -2"},
+		{"flatten()", "wrong number of arguments. got=0, want=1 or 2"},
+		// 包含自身的数组
+		{"let b = [1]; b[0] = b; flatten(b, -1)", "cannot flatten cyclic ARRAY"},
+		{"let b = [1, [2]]; b[1][0] = b; flatten(b, -1)", "cannot flatten cyclic ARRAY"},
+		{"let b = [1]; b[0] = b; flatten(b)", "cannot flatten cyclic ARRAY"},
+		{"let b = [1]; b[0] = b; flatten([b], 0)", "[[[...]]]"},
+		{"let a = [1, 2]; flatten([a, [a, a]], -1)", "[1, 2, 1, 2, 1, 2]"},
+		{"let b = [1]; b[0] = b; flat_map([1], fn(x) { b })", "[[[...]]]"},
+		{"flat_map([1, 2], fn(x) { x + true })", "type mismatch: INTEGER + BOOLEAN"},
+		{"flat_map([1], fn(x, y) { x })", "wrong number of arguments: expected 2, got 1"},
+		{"flat_map({}, fn(x) { x })", "argument to `flat_map` must be ARRAY, got HASH"},
+		{"flat_map([1])", "wrong number of arguments. got=1, want=2"},
+	})
+
+	// 回调出错后不再处理后面的元素
+	env := object.NewEnvironment()
+	program := testParseProgram(`let calls = 0;
+	flat_map([1, 2, 3], fn(x) { calls = calls + 1; if (x == 2) { -true } else { [x] } })`)
+	if !isError(Eval(program, env)) {
+		t.Fatalf("flat_map with failing callback did not return an error")
 	}
+	calls, _ := env.Get("calls")
+	testIntegerObject(t, calls, 2)
+}
 
-	if str.Value != "Hello World!" {
-		t.Errorf("String has wrong value. got=%q", str.Value)
+func TestRandomBuiltins(t *testing.T) {
+	testInspectResults(t, []inspectTest{
+		// 相同的种子得到相同的序列
+		{"seed(42); [rand_int(100), rand_int(100), rand_int(100), rand_int(100), rand_int(100)]",
+			"[75, 11, 60, 9, 57]"},
+		{"seed(7); [rand(), rand()]", "[0.9188921592527635, 0.23150717404875204]"},
+		{"seed(42); let a = rand_int(1000); seed(42); a == rand_int(1000)", "true"},
+		{"seed(1); rand_int(1)", "0"},
+		{"let r = rand(); r >= 0.0 && r < 1.0", "true"},
+		{"seed(3)", "null"},
+		// 错误
+		{"rand_int(0)", "argument to `rand_int` must be positive, got 0"},
+		{"rand_int(-5)", "argument to `rand_int` must be positive, got -5"},
+		{"rand_int(1.5)", "argument to `rand_int` must be INTEGER, got FLOAT"},
+		{"rand_int()", "wrong number of arguments. got=0, want=1"},
+		{"rand(1)", "wrong number of arguments. got=1, want=0"},
+		{`seed("x")`, "argument to `seed` must be INTEGER, got STRING"},
+	})
+
+	// 每个求值器有自己的随机数生成器，交替使用两个求值器不会互相影响
+	first, second := New(Options{}), New(Options{})
+	firstEnv, secondEnv := object.NewEnvironment(), object.NewEnvironment()
+	first.Eval(testParseProgram("seed(42)"), firstEnv)
+	second.Eval(testParseProgram("seed(42)"), secondEnv)
+	for i, expected := range []int64{75, 11, 60, 9, 57} {
+		program := testParseProgram("rand_int(100)")
+		if !testIntegerObject(t, first.Eval(program, firstEnv), expected) {
+			t.Fatalf("first evaluator: wrong value at %d", i)
+		}
+		if !testIntegerObject(t, second.Eval(program, secondEnv), expected) {
+			t.Fatalf("second evaluator: wrong value at %d", i)
+		}
 	}
 }
 
-func TestBuiltinFunctions(t *testing.T) {
+func TestAssertBuiltins(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected interface{}
 	}{
-		{`len("")`, 0},
-		{`len("four")`, 4},
-		{`len("hello world")`, 11},
-		{`len(1)`, "argument to `len` not supported, got INTEGER"},
-		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
-		{`len([1, 2, 3])`, 3},
-		{`len([])`, 0},
-		{`puts("hello", "world!")`, nil},
-		{`first([1, 2, 3])`, 1},
-		{`first([])`, nil},
-		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
-		{`last([1, 2, 3])`, 3},
-		{`last([])`, nil},
-		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
-		{`rest([1, 2, 3])`, []int{2, 3}},
-		{`rest([])`, nil},
-		{`push([], 1)`, []int{1}},
-		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		// 断言成功时返回true
+		{"assert(true)", true},
+		{"assert(1 < 2)", true},
+		{"assert(0)", true},
+		{`assert_eq(1 + 1, 2)`, true},
+		{`assert_eq("a" + "b", "ab")`, true},
+		{`assert_eq([1, {"a": [2]}], [1, {"a": [2]}])`, true},
+		{"assert_eq(2, 2.0)", true},
+		{"assert_eq(if (false) { 1 }, if (false) { 2 })", true},
+		// 断言失败时返回包含相关值的错误
+		{"assert(false)", "assertion failed: got false"},
+		{"assert(if (false) { 1 })", "assertion failed: got null"},
+		{"assert(1 > 2)", "assertion failed: got false"},
+		{"assert_eq(1 + 1, 3)", "assertion failed: got 2 (INTEGER), expected 3 (INTEGER)"},
+		{`assert_eq("1", 1)`, `assertion failed: got "1" (STRING), expected 1 (INTEGER)`},
+		{"assert_eq([1, 2], [1, 2, 3])", "assertion failed: got [1, 2] (ARRAY), expected [1, 2, 3] (ARRAY)"},
+		// null 和 false 不相等
+		{"assert_eq(if (false) { 1 }, false)", "assertion failed: got null (NULL), expected false (BOOLEAN)"},
+		{"assert_eq(false, if (false) { 1 })", "assertion failed: got false (BOOLEAN), expected null (NULL)"},
+		// 参数个数错误
+		{"assert()", "wrong number of arguments. got=0, want=1"},
+		{"assert(true, false)", "wrong number of arguments. got=2, want=1"},
+		{"assert_eq(1)", "wrong number of arguments. got=1, want=2"},
+		{"assert_eq(1, 1, 1)", "wrong number of arguments. got=3, want=2"},
+		// 失败的断言中止程序，后面的语句不再执行
+		{"assert_eq(1, 2); 3", "assertion failed: got 1 (INTEGER), expected 2 (INTEGER)"},
 	}
 
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
 
 		switch expected := tt.expected.(type) {
-		case int:
-			testIntegerObject(t, evaluated, int64(expected))
-		case nil:
-			testNullObject(t, evaluated)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
 		case string:
 			errObj, ok := evaluated.(*object.Error)
 			if !ok {
-				t.Errorf("object is not Error. got=%T (%+v)",
-					evaluated, evaluated)
+				t.Errorf("%q: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
 				continue
 			}
 			if errObj.Message != expected {
-				t.Errorf("wrong error message. expected=%q, got=%q",
-					expected, errObj.Message)
-			}
-		case []int:
-			array, ok := evaluated.(*object.Array)
-			if !ok {
-				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
-				continue
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
 			}
+		}
+	}
 
-			if len(array.Elements) != len(expected) {
-				t.Errorf("wrong num of elements. want=%d, got=%d",
-					len(expected), len(array.Elements))
-				continue
-			}
+	// 失败的断言报告调用处的位置
+	evaluated := testEval("let x = 1;\nlet y = 2;\n  assert_eq(x, y);")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Pos.Line != 3 || errObj.Pos.Column != 3 {
+		t.Errorf("wrong error position. want=3:3, got=%s", errObj.Pos)
+	}
+}
 
-			for i, expectedElem := range expected {
-				testIntegerObject(t, array.Elements[i], int64(expectedElem))
-			}
+func TestArrayBuiltinsSharing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// push不修改原数组
+		{"let a = [1, 2]; let b = push(a, 3); a", "[1, 2]"},
+		{"let a = [1, 2]; let b = push(a, 3); b", "[1, 2, 3]"},
+		// 对同一个数组push两次，两个结果互不覆盖
+		{"let a = push(push([], 1), 2); let b = push(a, 3); let c = push(a, 4); [a, b, c]",
+			"[[1, 2], [1, 2, 3], [1, 2, 4]]"},
+		{"let a = push([], 1); let b = push(a, 2); let c = push(b, 3); let d = push(a, 9); [a, b, c, d]",
+			"[[1], [1, 2], [1, 2, 3], [1, 9]]"},
+		// 对rest的结果push不会覆盖原数组
+		{"let a = [1, 2, 3]; let r = rest(rest(a)); let p = push(r, 9); [a, r, p]",
+			"[[1, 2, 3], [3], [3, 9]]"},
+		{"let a = [1, 2, 3]; let r = rest(a); [r, rest(r), rest(rest(r)), rest(rest(rest(r)))]",
+			"[[2, 3], [3], [], null]"},
+		// rest的结果与原数组共享元素，索引赋值对两者都可见
+		{"let a = [1, 2, 3]; let r = rest(a); r[0] = 9; a", "[1, 9, 3]"},
+		// 递归的map得到完整的结果
+		{`let map = fn(arr, f) {
+			let iter = fn(arr, acc) {
+				if (len(arr) == 0) { acc } else { iter(rest(arr), push(acc, f(first(arr)))) }
+			};
+			iter(arr, [])
+		};
+		let xs = [1, 2, 3, 4];
+		let doubled = map(xs, fn(x) { x * 2 });
+		[xs, doubled, map(doubled, fn(x) { x + 1 })]`,
+			"[[1, 2, 3, 4], [2, 4, 6, 8], [3, 5, 7, 9]]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
 		}
 	}
 }
@@ -572,6 +4151,34 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{name: 1}["name"]`,
+			1,
+		},
+		{
+			`let name = "other"; {name: 1}["other"]`,
+			nil,
+		},
+		{
+			`{true: 1}["true"]`,
+			nil,
+		},
+		{
+			`let person = {"age": 5}; person.age`,
+			5,
+		},
+		{
+			`let person = {"age": 5}; person.name`,
+			nil,
+		},
+		{
+			`let outer = {"inner": {"value": 5}}; outer.inner.value`,
+			5,
+		},
+		{
+			`let obj = {"f": fn(x) { x * 5 }}; (obj.f)(1)`,
+			5,
+		},
 	}
 
 	for _, tt := range tests {
@@ -584,6 +4191,7 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -608,6 +4216,21 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g",
+			result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	result, ok := obj.(*object.Boolean)
 	if !ok {
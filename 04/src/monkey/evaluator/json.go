@@ -0,0 +1,121 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"monkey/object"
+	"sort"
+	"strconv"
+)
+
+// jsonEncoder 把Monkey对象编码为JSON文本，见 json_encode 内置函数
+type jsonEncoder struct {
+	out bytes.Buffer
+	// visiting 记录正在编码的数组和哈希表，通过索引赋值形成的循环引用报错而不是无限递归
+	visiting map[object.Object]bool
+}
+
+// encodeJSON 把obj编码为JSON文本
+// 哈希表的键必须是字符串，按字典序输出，同一个值的编码结果总是相同
+// 返回值: JSON文本；遇到无法编码的值时返回错误
+func encodeJSON(obj object.Object) (string, *object.Error) {
+	enc := &jsonEncoder{visiting: make(map[object.Object]bool)}
+	if err := enc.encode(obj); err != nil {
+		return "", err
+	}
+	return enc.out.String(), nil
+}
+
+// encode 把obj的JSON表示追加到输出中
+func (enc *jsonEncoder) encode(obj object.Object) *object.Error {
+	switch obj := obj.(type) {
+	case *object.Null:
+		enc.out.WriteString("null")
+	case *object.Boolean:
+		enc.out.WriteString(strconv.FormatBool(obj.Value))
+	case *object.Integer:
+		enc.out.WriteString(strconv.FormatInt(obj.Value, 10))
+	case *object.Float:
+		// JSON没有NaN和无穷大
+		if math.IsNaN(obj.Value) || math.IsInf(obj.Value, 0) {
+			return newError("cannot encode %s as JSON", obj.Inspect())
+		}
+		enc.out.WriteString(obj.Inspect())
+	case *object.String:
+		enc.encodeString(obj.Value)
+	case *object.Array:
+		return enc.encodeArray(obj)
+	case *object.Hash:
+		return enc.encodeHash(obj)
+	default:
+		return newError("cannot encode %s as JSON", obj.Type())
+	}
+	return nil
+}
+
+// encodeString 输出带引号并转义的JSON字符串，<、>和&不转义
+func (enc *jsonEncoder) encodeString(s string) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	// 编码字符串不会出错
+	encoder.Encode(s)
+	// Encode在末尾加了换行符
+	enc.out.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
+
+// encodeArray 按顺序输出数组的元素
+func (enc *jsonEncoder) encodeArray(arr *object.Array) *object.Error {
+	if enc.visiting[arr] {
+		return newError("cannot encode cyclic ARRAY as JSON")
+	}
+	enc.visiting[arr] = true
+	defer delete(enc.visiting, arr)
+
+	enc.out.WriteString("[")
+	for i, elem := range arr.Elements {
+		if i > 0 {
+			enc.out.WriteString(",")
+		}
+		if err := enc.encode(elem); err != nil {
+			return err
+		}
+	}
+	enc.out.WriteString("]")
+	return nil
+}
+
+// encodeHash 按键的字典序输出哈希表的键值对
+func (enc *jsonEncoder) encodeHash(hash *object.Hash) *object.Error {
+	if enc.visiting[hash] {
+		return newError("cannot encode cyclic HASH as JSON")
+	}
+	enc.visiting[hash] = true
+	defer delete(enc.visiting, hash)
+
+	pairs := make([]object.HashPair, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		if pair.Key.Type() != object.STRING_OBJ {
+			return newError("hash key must be STRING to encode as JSON, got %s", pair.Key.Type())
+		}
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Key.(*object.String).Value < pairs[j].Key.(*object.String).Value
+	})
+
+	enc.out.WriteString("{")
+	for i, pair := range pairs {
+		if i > 0 {
+			enc.out.WriteString(",")
+		}
+		enc.encodeString(pair.Key.(*object.String).Value)
+		enc.out.WriteString(":")
+		if err := enc.encode(pair.Value); err != nil {
+			return err
+		}
+	}
+	enc.out.WriteString("}")
+	return nil
+}
@@ -0,0 +1,126 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// DefineMacros 取出程序顶层的宏定义并保存到环境中
+// 形如 let name = macro(...) { ... }; 的语句从程序中删除，对应的Macro对象以name绑定到env，
+// 其余语句保持原来的顺序；只处理顶层语句，嵌套在函数或语句块中的宏定义在求值时才绑定
+// 参数 program: 要处理的程序，被原地修改
+// 参数 env: 保存宏的环境
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := program.Statements[:0]
+
+	for _, statement := range program.Statements {
+		if isMacroDefinition(statement) {
+			addMacro(statement, env)
+			continue
+		}
+		statements = append(statements, statement)
+	}
+
+	program.Statements = statements
+}
+
+// isMacroDefinition 判断语句是否为绑定宏字面量的let语句
+func isMacroDefinition(node ast.Statement) bool {
+	letStatement, ok := node.(*ast.LetStatement)
+	if !ok || letStatement.Name == nil {
+		return false
+	}
+
+	_, ok = letStatement.Value.(*ast.MacroLiteral)
+	return ok
+}
+
+// addMacro 根据宏定义语句创建Macro对象并绑定到环境
+func addMacro(stmt ast.Statement, env *object.Environment) {
+	letStatement := stmt.(*ast.LetStatement)
+	macroLiteral := letStatement.Value.(*ast.MacroLiteral)
+
+	macro := &object.Macro{
+		Parameters: macroLiteral.Parameters,
+		Env:        env,
+		Body:       macroLiteral.Body,
+	}
+
+	env.Set(letStatement.Name.Value, macro)
+}
+
+// ExpandMacros 展开语法树中对已定义宏的调用
+// 宏调用的实参不求值，以Quote对象绑定到宏参数上，宏体返回的语法树替换整个调用；
+// 展开失败（实参个数不对、宏体出错或没有返回quote的结果）的调用保持原样，
+// 求值到该调用时会再次展开并把错误作为求值结果返回
+// 参数 program: 要展开的语法树，被原地修改
+// 参数 env: 保存宏的环境，通常先用 DefineMacros 填充
+// 返回值: 展开后的语法树
+func ExpandMacros(program ast.Node, env *object.Environment) ast.Node {
+	e := New(Options{})
+
+	return ast.Modify(program, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+
+		macro, ok := isMacroCall(call, env)
+		if !ok {
+			return node
+		}
+
+		expanded, err := e.expandMacro(macro, call)
+		if err != nil {
+			return node
+		}
+		return expanded
+	})
+}
+
+// isMacroCall 判断调用表达式是否按名称调用了环境中的宏
+func isMacroCall(exp *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	identifier, ok := exp.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+
+	obj, ok := env.Get(identifier.Value)
+	if !ok {
+		return nil, false
+	}
+
+	macro, ok := obj.(*object.Macro)
+	return macro, ok
+}
+
+// expandMacro 展开一次宏调用
+// 参数 macro: 被调用的宏
+// 参数 call: 宏调用表达式，其实参被复制后以Quote对象传给宏
+// 返回值: 宏体返回的语法树；出错时返回错误
+func (e *Evaluator) expandMacro(macro *object.Macro, call *ast.CallExpression) (ast.Node, *object.Error) {
+	if len(call.Arguments) != len(macro.Parameters) {
+		return nil, newError("wrong number of arguments: expected %d, got %d",
+			len(macro.Parameters), len(call.Arguments))
+	}
+
+	env := object.NewEnclosedEnvironment(macro.Env)
+	for i, param := range macro.Parameters {
+		env.Set(param.Value, &object.Quote{Node: ast.Clone(call.Arguments[i])})
+	}
+
+	evaluated := e.Eval(macro.Body, env)
+	if isLoopSignal(evaluated) {
+		evaluated = loopSignalError(evaluated)
+	}
+	evaluated = unwrapReturnValue(evaluated)
+
+	switch evaluated := evaluated.(type) {
+	case *object.Error:
+		return nil, evaluated
+	case *object.Quote:
+		return evaluated.Node, nil
+	default:
+		return nil, newError("macro must return QUOTE, got %s", evaluated.Type())
+	}
+}
@@ -0,0 +1,88 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/object"
+	"sort"
+	"strings"
+)
+
+// Profile 记录一次或多次求值过程中的执行计数，用于找出脚本中执行最频繁的部分
+// 通过 Options.Profile 或 Evaluator.SetProfile 交给求值器，求值结束后读取各字段或用String输出
+type Profile struct {
+	// Nodes 每种语法树节点被Eval求值的次数，键为节点的Kind()
+	Nodes map[string]int
+
+	// Calls 每个函数被调用的次数，键与调用栈中的函数名相同，匿名函数为 "<anonymous>"；
+	// 内置函数按调用处的名称记录
+	Calls map[string]int
+
+	// Objects 求值过程中新产生的各类型对象的个数，键为对象类型
+	// 同一个对象只在它第一次作为求值结果出现时计数，因此读取变量或数组元素不会重复计数；
+	// true、false、null和内置函数等共享的对象不计数，只在内置函数内部使用、没有成为求值结果的对象也不计数
+	Objects map[object.ObjectType]int
+
+	// seen: 已经计数过的对象；Profile会让这些对象一直存活，分析长时间运行的程序时需要注意内存
+	seen map[object.Object]bool
+}
+
+// NewProfile 创建一个空的执行计数
+func NewProfile() *Profile {
+	return &Profile{
+		Nodes:   make(map[string]int),
+		Calls:   make(map[string]int),
+		Objects: make(map[object.ObjectType]int),
+		seen:    make(map[object.Object]bool),
+	}
+}
+
+// recordObject 记录一个求值结果，第一次出现的对象计入Objects
+func (p *Profile) recordObject(obj object.Object) {
+	switch obj {
+	case TRUE, FALSE, NULL, BREAK, CONTINUE:
+		return
+	}
+	if _, ok := obj.(*object.Builtin); ok {
+		return
+	}
+	if p.seen[obj] {
+		return
+	}
+	p.seen[obj] = true
+	p.Objects[obj.Type()]++
+}
+
+// String 返回适合直接输出的计数报告
+// 分为节点、函数调用和对象三部分，每部分按次数从多到少排列，次数相同时按名称排列
+func (p *Profile) String() string {
+	var out strings.Builder
+
+	objects := make(map[string]int, len(p.Objects))
+	for typ, count := range p.Objects {
+		objects[string(typ)] = count
+	}
+
+	writeCounts(&out, "nodes", p.Nodes)
+	writeCounts(&out, "calls", p.Calls)
+	writeCounts(&out, "objects", objects)
+	return out.String()
+}
+
+// writeCounts 按次数从多到少输出一组计数，没有任何计数时只输出标题
+func writeCounts(out *strings.Builder, title string, counts map[string]int) {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	fmt.Fprintf(out, "%s:\n", title)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-24s %d\n", name, counts[name])
+	}
+}
@@ -0,0 +1,101 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+)
+
+// isQuoteCall 判断调用表达式是否为 quote(...)
+// quote 不是普通的内置函数：它的参数不被求值，因此需要在求值调用之前识别出来
+func isQuoteCall(node *ast.CallExpression) bool {
+	ident, ok := node.Function.(*ast.Identifier)
+	return ok && ident.Value == "quote"
+}
+
+// isUnquoteCall 判断节点是否为 unquote(...) 调用
+func isUnquoteCall(node ast.Node) bool {
+	call, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == "unquote"
+}
+
+// quote 求值 quote 调用，返回未求值的语法树
+// 参数在被引用之前先复制一份，因此函数体中的 quote 每次调用都基于原始的语法树；
+// 语法树中的 unquote(expr) 调用在当前环境中求值，结果转换回语法树节点替换该调用
+// 参数 node: quote 调用的参数
+// 参数 env: 当前环境，unquote 中的表达式在其中求值
+// 返回值: Quote对象，unquote 求值出错或结果无法转换为语法树时返回错误
+func (e *Evaluator) quote(node ast.Node, env *object.Environment) object.Object {
+	node, err := e.evalUnquoteCalls(ast.Clone(node), env)
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node}
+}
+
+// evalUnquoteCalls 求值语法树中所有的 unquote 调用并用结果替换它们
+// 返回值: 替换后的语法树；出现错误时返回遇到的第一个错误
+func (e *Evaluator) evalUnquoteCalls(quoted ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	var err *object.Error
+
+	modified := ast.Modify(quoted, func(node ast.Node) ast.Node {
+		if err != nil || !isUnquoteCall(node) {
+			return node
+		}
+
+		call := node.(*ast.CallExpression)
+		if len(call.Arguments) != 1 {
+			err = newError("wrong number of arguments to `unquote`. got=%d, want=1",
+				len(call.Arguments))
+			return node
+		}
+
+		unquoted := e.Eval(call.Arguments[0], env)
+		if errObj, ok := unquoted.(*object.Error); ok {
+			err = errObj
+			return node
+		}
+
+		converted, ok := convertObjectToASTNode(unquoted)
+		if !ok {
+			err = newError("cannot unquote %s", unquoted.Type())
+			return node
+		}
+		return converted
+	})
+
+	return modified, err
+}
+
+// convertObjectToASTNode 把 unquote 的求值结果转换为对应的字面量节点
+// 支持整数、浮点数、布尔值、字符串和Quote对象（直接使用其中的语法树）
+// 返回值: 语法树节点；不支持的对象类型返回false
+func convertObjectToASTNode(obj object.Object) (ast.Node, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		t := token.Token{Type: token.INT, Literal: fmt.Sprintf("%d", obj.Value)}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}, true
+	case *object.Float:
+		t := token.Token{Type: token.FLOAT, Literal: obj.Inspect()}
+		return &ast.FloatLiteral{Token: t, Value: obj.Value}, true
+	case *object.Boolean:
+		t := token.Token{Type: token.FALSE, Literal: "false"}
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true"}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}, true
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}, true
+	case *object.Quote:
+		// 复制一份，同一个Quote对象被多次unquote时各处的语法树互不影响
+		return ast.Clone(obj.Node), true
+	default:
+		return nil, false
+	}
+}
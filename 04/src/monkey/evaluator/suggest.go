@@ -0,0 +1,91 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"sort"
+)
+
+// 拼写提示的参数
+const (
+	minSuggestLength   = 3 // 短于该长度的名称不给出提示，避免 x、y 之类的名称产生无意义的建议
+	maxSuggestDistance = 2 // 编辑距离不超过该值的名称才作为提示
+	shortNameLength    = 5 // 不超过该长度的名称只接受距离为1的提示，避免 foo 被提示为 floor
+)
+
+// suggestDistance 返回名称允许的最大编辑距离，名称越短允许的距离越小
+func suggestDistance(name string) int {
+	if len([]rune(name)) <= shortNameLength {
+		return 1
+	}
+	return maxSuggestDistance
+}
+
+// suggestName 为未找到的标识符寻找拼写最接近的可见名称
+// 候选名称包括环境链中的所有变量和内置函数；距离相同时取字典序最小的名称，保证结果稳定
+// 参数 name: 未找到的标识符
+// 参数 env: 当前环境
+// 返回值: 最接近的名称，没有足够接近的名称时返回false
+func suggestName(name string, env *object.Environment) (string, bool) {
+	if len([]rune(name)) < minSuggestLength {
+		return "", false
+	}
+
+	candidates := env.Names()
+	for builtin := range builtins {
+		candidates = append(candidates, builtin)
+	}
+	sort.Strings(candidates)
+
+	best, bestDistance := "", suggestDistance(name)+1
+	for _, candidate := range candidates {
+		if candidate == name {
+			continue
+		}
+		if d := editDistance(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best, best != ""
+}
+
+// editDistance 计算两个字符串之间的编辑距离
+// 插入、删除、替换一个字符以及交换相邻的两个字符各计为一次编辑，
+// 因此 lne 与 len 的距离为1
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+
+	// d[i][j] 是 s[:i] 与 t[:j] 之间的距离
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+// minInt 返回参数中的最小值
+func minInt(first int, rest ...int) int {
+	m := first
+	for _, v := range rest {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
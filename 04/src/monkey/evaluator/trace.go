@@ -0,0 +1,25 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/object"
+	"strings"
+)
+
+// NewTracer 返回一个把求值过程写到w的跟踪函数，可以直接用作 Options.Trace
+// 每个节点输出两行，按嵌套深度缩进，形成一棵求值树：
+// 进入时输出节点类型和源代码，离开时输出 "=> " 和求值结果
+// 参数 w: 跟踪输出的目标
+// 返回值: 跟踪函数
+func NewTracer(w io.Writer) func(node ast.Node, depth int, result object.Object) {
+	return func(node ast.Node, depth int, result object.Object) {
+		indent := strings.Repeat("  ", depth)
+		if result == nil {
+			fmt.Fprintf(w, "%s%s %s\n", indent, node.Kind(), node.String())
+			return
+		}
+		fmt.Fprintf(w, "%s=> %s\n", indent, result.Inspect())
+	}
+}
@@ -0,0 +1,31 @@
+// Package format 把 Monkey 源代码格式化为规范的形式，功能类似 gofmt
+package format
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+)
+
+// Source 解析源代码并输出规范格式的代码
+// 格式由 ast.Format 决定：两个空格缩进、每条语句一行、统一的空格和括号、
+// 过长的哈希字面量每个键值对一行，注释保留；非空输出以换行符结尾
+// 对已经格式化过的代码再次格式化，结果逐字节相同
+// 参数 src: Monkey 源代码
+// 返回值: 格式化后的代码；源代码有语法错误时返回 *parser.SyntaxError，其中包含全部错误信息
+func Source(src string) (string, error) {
+	l := lexer.New(src)
+	l.SetEmitComments(true)
+
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 0 {
+		return "", &parser.SyntaxError{Messages: errors}
+	}
+
+	out := ast.Format(program)
+	if out == "" {
+		return "", nil
+	}
+	return out + "\n", nil
+}
@@ -0,0 +1,122 @@
+package format
+
+import (
+	"io/ioutil"
+	"monkey/parser"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoldenFiles(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no golden files found in testdata")
+	}
+
+	for _, input := range inputs {
+		src, err := ioutil.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden, err := ioutil.ReadFile(strings.TrimSuffix(input, ".input") + ".golden")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := Source(string(src))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", input, err)
+			continue
+		}
+		if out != string(golden) {
+			t.Errorf("%s: output differs from golden file.\nwant:\n%s\ngot:\n%s", input, golden, out)
+		}
+
+		// 格式化后的代码再格式化一次应保持不变
+		again, err := Source(string(golden))
+		if err != nil {
+			t.Errorf("%s: golden file does not parse: %s", input, err)
+			continue
+		}
+		if again != string(golden) {
+			t.Errorf("%s: formatting the golden file changed it.\nwant:\n%s\ngot:\n%s", input, golden, again)
+		}
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	// 取自语法分析器测试中的各类语法
+	corpus := []string{
+		"let x = 5; let y = true; let foobar = y;",
+		"let [a, b] = pair; let {name, age} = person; let x;",
+		"let a, b = 1, 2; let c, d;",
+		"return 5; return;",
+		"-a * b; !-a; a + b + c; a + b * c + d / e - f; 3 + 4; -5 * 5",
+		"5 > 4 == 3 < 4; (5 + 5) * 2; -(5 + 5); !(true == true); a % b * c",
+		"a + add(b * c) + d; add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))",
+		"a * [1, 2, 3, 4][b * c] * d; add(a * b[2], b[1], 2 * [1, 2][1])",
+		"if (x < y) { x }; if (x < y) { x } else { y }",
+		"if (a) { 1 } else if (b) { 2 } else if (c) { 3 } else { 4 }",
+		"fn() {}; fn(x) {}; fn(x, y, z) { x + y; z }; fn(x, y,) { x }",
+		"add(1, 2 * 3, 4 + 5); add(xs...); f(1, rest...,)",
+		`"hello world"; "a ${x} b"; "${f("}")}"; "say \"hi\"\n"`,
+		"[1, 2 * 2, 3 + 3]; []; myArray[1 + 1]; h.key; h.a.b; (obj.f)(1)",
+		`{"one": 1, "two": 2, "three": 3}; {}; {true: 1, false: 2}; {1: 1, 2: 2}`,
+		`{"one": 0 + 1, "two": 10 - 8, "three": 15 / 5}; {name: "Ann", age: 3}`,
+		"arr.map(f).filter(g); 5.add(3); (a + b).f(c)",
+		"a[1:2]; a[:n]; a[n:]; a[:]; (-a)[1:][0]",
+		"1.5 + 2.0 * x; -0.25; [3.14, 10.0]",
+		"let i = 0; while (i < 10) { i = i + 1; if (i == 5) { return i; } }",
+		"a = b = c; (x = 1) + 2; f(x = 1); -(x = 1); while (a) {}",
+		`h["count"] = h["count"] + 1; h.a = h.b = 2; h[k][0] = x`,
+		"for (let i = 0; i < 3; i = i + 1) { puts(i) }; for (;;) {}; for (i = 0; ; ) { x }; for (; a;) {}",
+		"while (true) { if (a) { break; } # skip\n continue }",
+		"let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) }; unless(x, 1, 2)",
+		"let f = fn(x) { if (x) { return 1; } x }; let g = fn() { return; 1 };",
+		"let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(5);",
+		"let x = 1; # one\n\n\n# two\nlet y = 2;\n# end",
+		"let h = {a: 1, # one\n b: fn() { # inside\n 2 }};",
+		"if (x) { # only a comment\n}",
+		"let config = {name: \"monkey\", version: 1, features: [\"interpolation\", \"destructuring\", \"spread\"]};",
+	}
+
+	for _, src := range corpus {
+		once, err := Source(src)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", src, err)
+			continue
+		}
+		twice, err := Source(once)
+		if err != nil {
+			t.Errorf("%q: formatted output does not parse: %s\n%s", src, err, once)
+			continue
+		}
+		if once != twice {
+			t.Errorf("%q: formatting is not idempotent.\nfirst:\n%s\nsecond:\n%s", src, once, twice)
+		}
+	}
+}
+
+func TestSourceSyntaxErrors(t *testing.T) {
+	_, err := Source("let x = ;\nlet = 5;")
+	syntaxErr, ok := err.(*parser.SyntaxError)
+	if !ok {
+		t.Fatalf("expected *parser.SyntaxError. got=%T (%v)", err, err)
+	}
+	if len(syntaxErr.Messages) != 2 {
+		t.Errorf("expected 2 error messages. got=%d (%q)", len(syntaxErr.Messages), syntaxErr.Messages)
+	}
+}
+
+func TestSourceEmpty(t *testing.T) {
+	for _, src := range []string{"", "  \n\n"} {
+		out, err := Source(src)
+		if err != nil || out != "" {
+			t.Errorf("Source(%q) wrong. got=%q, %v", src, out, err)
+		}
+	}
+}
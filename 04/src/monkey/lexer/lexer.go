@@ -1,6 +1,10 @@
 package lexer
 
-import "monkey/token"
+import (
+	"fmt"
+	"monkey/token"
+	"strings"
+)
 
 // Lexer 结构体是 Monkey 编程语言的词法分析器
 // 它负责将源代码字符串转换为一系列 Token
@@ -16,6 +20,19 @@ type Lexer struct {
 
 	// ch 是当前正在检查的字符
 	ch byte // current char under examination
+
+	// line 是当前字符所在的行号，从 1 开始
+	line int
+
+	// lineStart 是当前行第一个字符在输入字符串中的位置，用于计算列号
+	lineStart int
+
+	// baseOffset 是输入字符串第一个字节在整个源代码中的字节偏移量
+	// 只有用 NewAt 分析源代码的一部分时才不为 0
+	baseOffset int
+
+	// emitComments 为 true 时注释作为 COMMENT Token 返回，否则跳过
+	emitComments bool
 }
 
 // New 函数是 Lexer 的构造函数，用于创建并初始化一个新的词法分析器实例
@@ -23,7 +40,7 @@ type Lexer struct {
 // 返回值是一个指向新创建的 Lexer 结构体的指针
 func New(input string) *Lexer {
 	// 创建一个新的 Lexer 实例，并设置输入字符串
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 
 	// 调用 readChar 方法初始化词法分析器的状态
 	// 这会设置 position、readPosition 和 ch 字段的初始值
@@ -33,16 +50,64 @@ func New(input string) *Lexer {
 	return l
 }
 
+// NewAt 函数创建分析源代码中一段文本的词法分析器，如插值字符串中 ${...} 的内容
+// 产生的 Token 的行号、列号和字节偏移量都相对于整个源代码
+// 参数 input 是要分析的文本，line、column 和 offset 是文本第一个字符在源代码中的位置
+// 返回值是一个指向新创建的 Lexer 结构体的指针
+func NewAt(input string, line, column, offset int) *Lexer {
+	l := New(input)
+	l.line = line
+	// 第一行的列号从 column 开始计数
+	l.lineStart = 1 - column
+	l.baseOffset = offset
+	return l
+}
+
+// SetEmitComments 设置是否把注释作为 COMMENT Token 返回
+// 默认跳过注释；格式化等需要保留注释的工具可以开启
+func (l *Lexer) SetEmitComments(emit bool) {
+	l.emitComments = emit
+}
+
 // NextToken 方法是 Lexer 的核心方法，负责从输入字符串中读取并返回下一个 Token
 // 该方法实现了词法分析的主要逻辑，通过逐个字符分析来识别不同的 Token 类型
 // 返回值是一个 token.Token 结构体，包含 Token 的类型和字面量值
 func (l *Lexer) NextToken() token.Token {
-	// 创建一个空的 Token 变量，用于存储将要返回的 Token
-	var tok token.Token
-
 	// 首先跳过所有空白字符（空格、制表符、换行符等）
-	// 确保从非空白字符开始分析
+	// 确保从非空白字符开始分析；不输出注释时注释也一并跳过
 	l.skipWhitespace()
+	for l.ch == '#' && !l.emitComments {
+		l.readComment()
+		l.skipWhitespace()
+	}
+
+	// 记录 Token 第一个字符的行号、列号和字节偏移量
+	line, column, offset := l.line, l.position-l.lineStart+1, l.position
+
+	tok := l.readToken()
+	tok.Line = line
+	tok.Column = column
+	// 读到输入末尾后 position 会越过输入长度，EOF 位于输入末尾、长度为 0
+	tok.Offset = l.clampOffset(offset)
+	tok.Length = l.clampOffset(l.position) - tok.Offset
+	tok.Offset += l.baseOffset
+
+	return tok
+}
+
+// clampOffset 把越过输入末尾的位置限制为输入的长度
+func (l *Lexer) clampOffset(pos int) int {
+	if pos > len(l.input) {
+		return len(l.input)
+	}
+	return pos
+}
+
+// readToken 方法从当前字符开始读取一个 Token
+// 调用前应已跳过空白字符
+func (l *Lexer) readToken() token.Token {
+	// 创建一个空的 Token 变量，用于存储将要返回的 Token
+	var tok token.Token
 
 	// 使用 switch 语句根据当前字符进行分支处理
 	// 每个 case 对应一种特定的字符或字符组合
@@ -79,17 +144,53 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '/':
-		// 处理除法运算符 '/'
-		tok = newToken(token.SLASH, l.ch)
+		// 处理除法运算符 '/' 和向下取整除法运算符 '//'
+		if l.peekChar() == '/' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch) // 组合字面量 "//"
+			tok = token.Token{Type: token.FLOOR_DIV, Literal: literal}
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '*':
 		// 处理乘法运算符 '*'
 		tok = newToken(token.ASTERISK, l.ch)
+	case '%':
+		// 处理取模运算符 '%'
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
-		// 处理小于运算符 '<'
-		tok = newToken(token.LT, l.ch)
+		// 处理小于运算符 '<' 和小于等于运算符 '<='
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.LT_EQ, Literal: "<="}
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		// 处理大于运算符 '>'
-		tok = newToken(token.GT, l.ch)
+		// 处理大于运算符 '>' 和大于等于运算符 '>='
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.GT_EQ, Literal: ">="}
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		// 处理逻辑与运算符 '&&'，单独的 '&' 是非法字符
+		if l.peekChar() == '&' {
+			l.readChar()
+			tok = token.Token{Type: token.AND, Literal: "&&"}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '|':
+		// 处理逻辑或运算符 '||'，单独的 '|' 是非法字符
+		if l.peekChar() == '|' {
+			l.readChar()
+			tok = token.Token{Type: token.OR, Literal: "||"}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case ';':
 		// 处理分号 ';'
 		tok = newToken(token.SEMICOLON, l.ch)
@@ -99,6 +200,16 @@ func (l *Lexer) NextToken() token.Token {
 	case ',':
 		// 处理逗号 ','
 		tok = newToken(token.COMMA, l.ch)
+	case '.':
+		// 处理点号 '.' 和展开运算符 '...'
+		if l.peekChar() == '.' && l.peekCharAt(2) == '.' {
+			// 连续三个点号组成 ELLIPSIS Token
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	case '{':
 		// 处理左花括号 '{'
 		tok = newToken(token.LBRACE, l.ch)
@@ -114,14 +225,29 @@ func (l *Lexer) NextToken() token.Token {
 	case '"':
 		// 处理字符串字面量，以双引号开头
 		// 调用 readString() 方法读取完整的字符串内容
+		// 包含 ${...} 插值的字符串作为 TEMPLATE 交给语法分析器拆分
+		literal, interpolated := l.readString()
 		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		if interpolated {
+			tok.Type = token.TEMPLATE
+		}
+		// 读到输入末尾还没有遇到结束双引号
+		if l.ch == 0 {
+			tok.Type = token.UNTERMINATED_STRING
+		}
+		tok.Literal = literal
 	case '[':
 		// 处理左方括号 '['
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
 		// 处理右方括号 ']'
 		tok = newToken(token.RBRACKET, l.ch)
+	case '#':
+		// 处理注释，从 # 一直到行尾
+		tok.Type = token.COMMENT
+		tok.Literal = l.readComment()
+		// readComment() 停在换行符或EOF上，不需要再读取下一个字符
+		return tok
 	case 0:
 		// 处理文件结束符（EOF）
 		// 当 readPosition 超出输入字符串长度时，ch 被设置为 0
@@ -137,9 +263,12 @@ func (l *Lexer) NextToken() token.Token {
 			// 直接返回，因为 readIdentifier() 已经移动了位置指针
 			return tok
 		} else if isDigit(l.ch) {
-			// 如果是数字，则读取数字字面量
+			// 如果是数字，则读取整数或浮点数字面量
 			tok.Type = token.INT
 			tok.Literal = l.readNumber()
+			if strings.Contains(tok.Literal, ".") {
+				tok.Type = token.FLOAT
+			}
 			// 直接返回，因为 readNumber() 已经移动了位置指针
 			return tok
 		} else {
@@ -156,6 +285,16 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
+// readComment 方法读取从 # 开始到行尾的注释
+// 返回注释的原文（不含换行符），返回时当前字符是换行符或EOF
+func (l *Lexer) readComment() string {
+	position := l.position
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	return l.input[position:l.position]
+}
+
 // skipWhitespace 方法用于跳过输入字符串中的所有空白字符
 // 空白字符包括：空格(' ')、制表符('\t')、换行符('\n')和回车符('\r')
 // 该方法在词法分析过程中被调用，确保 Token 分析从非空白字符开始
@@ -174,6 +313,12 @@ func (l *Lexer) skipWhitespace() {
 // 该方法更新词法分析器的内部状态，包括当前字符、当前位置和下一个读取位置
 // 当到达输入字符串末尾时，将当前字符设置为 0（EOF 标记）
 func (l *Lexer) readChar() {
+	// 越过换行符时行号加一，新的一行从下一个字符开始
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+	}
+
 	// 检查是否已经到达或超过输入字符串的末尾
 	// readPosition 表示下一个要读取的字符位置
 	if l.readPosition >= len(l.input) {
@@ -213,6 +358,17 @@ func (l *Lexer) peekChar() byte {
 	}
 }
 
+// peekCharAt 方法查看当前字符之后第 n 个字符而不移动位置指针
+// peekCharAt(1) 等价于 peekChar()，用于识别 '...' 这类多字符运算符
+// 如果超出输入字符串末尾则返回 0
+func (l *Lexer) peekCharAt(n int) byte {
+	pos := l.position + n
+	if pos >= len(l.input) {
+		return 0
+	}
+	return l.input[pos]
+}
+
 // readIdentifier 方法用于从输入字符串中读取一个完整的标识符
 // 标识符由字母、下划线组成，用于表示变量名、函数名等
 // 返回值是标识符的字符串表示
@@ -251,6 +407,15 @@ func (l *Lexer) readNumber() string {
 		l.readChar()
 	}
 
+	// 小数点后紧跟数字时是浮点数；否则小数点属于后面的 . 或 ...，
+	// 如方法调用 5.add(3) 和展开 xs...
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		l.readChar()
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+
 	// 使用字符串切片提取数字字面量
 	// 从记录的起始位置 position 到当前的位置 l.position
 	// 返回数字的完整字符串表示
@@ -259,11 +424,13 @@ func (l *Lexer) readNumber() string {
 
 // readString 方法用于从输入字符串中读取一个完整的字符串字面量
 // 字符串字面量以双引号(")开头和结尾，包含任意字符序列
-// 返回值是字符串内容的字符串表示（不包含两端的双引号）
-func (l *Lexer) readString() string {
+// ${...} 插值部分整体跳过，其中可以包含带双引号的嵌套字符串
+// 返回值是字符串内容的字符串表示（不包含两端的双引号），以及字符串中是否包含插值
+func (l *Lexer) readString() (string, bool) {
 	// 记录字符串内容的起始位置
 	// position + 1 跳过开头的双引号，直接指向字符串内容
 	position := l.position + 1
+	interpolated := false
 
 	// 使用无限循环持续读取字符，直到遇到结束双引号或文件结束
 	for {
@@ -271,6 +438,27 @@ func (l *Lexer) readString() string {
 		// 这会移动 position 和 readPosition 指针
 		l.readChar()
 
+		// 转义序列整体跳过，使 \" 不会结束字符串、\${ 不会开始插值
+		// 转义序列的含义由 Unescape 解释
+		if l.ch == '\\' {
+			l.readChar()
+			if l.ch == 0 {
+				break
+			}
+			continue
+		}
+
+		// 遇到插值的开头 ${，跳到与之匹配的右花括号
+		if l.ch == '$' && l.peekChar() == '{' {
+			interpolated = true
+			l.readChar()
+			l.skipInterpolation()
+			if l.ch == 0 {
+				break
+			}
+			continue
+		}
+
 		// 检查是否遇到字符串结束标记
 		// l.ch == '"' 表示遇到结束双引号
 		// l.ch == 0 表示遇到文件结束（EOF），防止无限循环
@@ -283,7 +471,143 @@ func (l *Lexer) readString() string {
 	// 使用字符串切片提取字符串内容
 	// 从记录的起始位置 position（跳过开头的双引号）到当前的位置 l.position
 	// 返回字符串内容的完整字符串表示（不包含两端的双引号）
-	return l.input[position:l.position]
+	return l.input[position:l.position], interpolated
+}
+
+// skipInterpolation 方法从插值的左花括号开始，跳到与之匹配的右花括号
+// 插值中的花括号按嵌套层数配对，嵌套字符串（包括其中的插值）整体跳过
+// 返回时当前字符是匹配的右花括号，输入提前结束时为0
+func (l *Lexer) skipInterpolation() {
+	depth := 1
+	for depth > 0 {
+		l.readChar()
+		switch l.ch {
+		case 0:
+			return
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '"':
+			l.readString()
+			if l.ch == 0 {
+				return
+			}
+		}
+	}
+}
+
+// TemplatePart 表示插值字符串拆分后的一个片段
+type TemplatePart struct {
+	Text   string // 片段内容：普通文本，或插值中的表达式源码
+	IsExpr bool   // 是否为 ${...} 中的表达式
+	Offset int    // 片段内容在字面值中的字节偏移量
+}
+
+// SplitTemplate 函数把 TEMPLATE token 的字面值拆分为文本片段和插值表达式片段
+// 空文本片段会被省略
+// 参数 literal 是 TEMPLATE token 的字面值
+// 返回值是按顺序排列的片段，以及所有插值是否都有匹配的右花括号
+func SplitTemplate(literal string) ([]TemplatePart, bool) {
+	l := New(literal)
+	parts := []TemplatePart{}
+	start := 0
+
+	for l.ch != 0 {
+		// 转义的 \${ 属于普通文本
+		if l.ch == '\\' {
+			l.readChar()
+			l.readChar()
+			continue
+		}
+		if l.ch == '$' && l.peekChar() == '{' {
+			if start < l.position {
+				parts = append(parts, TemplatePart{Text: literal[start:l.position], Offset: start})
+			}
+
+			l.readChar()
+			exprStart := l.position + 1
+			l.skipInterpolation()
+			if l.ch == 0 {
+				return parts, false
+			}
+
+			parts = append(parts, TemplatePart{Text: literal[exprStart:l.position], IsExpr: true, Offset: exprStart})
+			start = l.position + 1
+		}
+		l.readChar()
+	}
+
+	if start < len(literal) {
+		parts = append(parts, TemplatePart{Text: literal[start:], Offset: start})
+	}
+
+	return parts, true
+}
+
+// Escape 函数把字符串转换为可以写在双引号之间的形式，是 Unescape 的逆操作
+// 反斜杠、双引号、换行等控制字符以及插值开头 ${ 都会被转义
+// 参数 s 是字符串的实际内容
+// 返回值是转义后的内容，不含两端的双引号
+func Escape(s string) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '$':
+			if i+1 < len(s) && s[i+1] == '{' {
+				out.WriteByte('\\')
+			}
+			out.WriteByte(c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+// Unescape 函数解释字符串字面值中的转义序列
+// 支持 \\、\"、\n、\t、\r 和 \$（用于写出不作为插值的 ${）
+// 参数 s 是双引号之间的原始内容
+// 返回值是字符串的实际内容；遇到不支持的转义序列时返回错误
+func Unescape(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			out.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		if i == len(s) {
+			return "", fmt.Errorf("unterminated escape sequence in string")
+		}
+		switch c := s[i]; c {
+		case '\\', '"', '$':
+			out.WriteByte(c)
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case 'r':
+			out.WriteByte('\r')
+		default:
+			return "", fmt.Errorf("unknown escape sequence \\%c in string", c)
+		}
+	}
+	return out.String(), nil
 }
 
 // isLetter 函数用于判断一个字符是否为字母或下划线
@@ -34,6 +34,19 @@ if (5 < 10) {
 "foo bar"
 [1, 2];
 {"foo": "bar"}
+10 % 3;
+7 // 2;
+5 <= 10 >= 5;
+a && b || c & d | e;
+person.name;
+add(args...);
+3.14 * 2.0 + 5.abs;
+"a ${x} b"
+"${f("${y}")}"
+macro(x, y) { x + y; };
+const max = 10;
+switch (x) { case 1 {} default {} }
+try {} rescue (e) {}
 `
 
 	// 定义期望的 Token 序列，包含每个 Token 的类型和字面值
@@ -150,6 +163,114 @@ if (5 < 10) {
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
 
+		// 取模运算符测试：10 % 3;
+		{token.INT, "10"},
+		{token.PERCENT, "%"},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+
+		// 向下取整除法运算符测试：7 // 2;
+		{token.INT, "7"},
+		{token.FLOOR_DIV, "//"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+
+		// 小于等于、大于等于运算符测试：5 <= 10 >= 5;
+		{token.INT, "5"},
+		{token.LT_EQ, "<="},
+		{token.INT, "10"},
+		{token.GT_EQ, ">="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+
+		// 逻辑运算符测试，单个 & 和 | 是非法字符：a && b || c & d | e;
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.IDENT, "c"},
+		{token.ILLEGAL, "&"},
+		{token.IDENT, "d"},
+		{token.ILLEGAL, "|"},
+		{token.IDENT, "e"},
+		{token.SEMICOLON, ";"},
+
+		// 点号成员访问测试：person.name;
+		{token.IDENT, "person"},
+		{token.DOT, "."},
+		{token.IDENT, "name"},
+		{token.SEMICOLON, ";"},
+
+		// 展开运算符测试：add(args...);
+		{token.IDENT, "add"},
+		{token.LPAREN, "("},
+		{token.IDENT, "args"},
+		{token.ELLIPSIS, "..."},
+		{token.RPAREN, ")"},
+		{token.SEMICOLON, ";"},
+
+		// 浮点数测试：小数点后必须是数字，否则仍是整数加点号
+		{token.FLOAT, "3.14"},
+		{token.ASTERISK, "*"},
+		{token.FLOAT, "2.0"},
+		{token.PLUS, "+"},
+		{token.INT, "5"},
+		{token.DOT, "."},
+		{token.IDENT, "abs"},
+		{token.SEMICOLON, ";"},
+
+		// 插值字符串测试，嵌套字符串中的插值也属于同一个token
+		{token.TEMPLATE, "a ${x} b"},
+		{token.TEMPLATE, `${f("${y}")}`},
+
+		// 宏字面量测试：macro(x, y) { x + y; };
+		{token.MACRO, "macro"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.COMMA, ","},
+		{token.IDENT, "y"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.PLUS, "+"},
+		{token.IDENT, "y"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+
+		// 常量声明测试：const max = 10;
+		{token.CONST, "const"},
+		{token.IDENT, "max"},
+		{token.ASSIGN, "="},
+		{token.INT, "10"},
+		{token.SEMICOLON, ";"},
+
+		// switch表达式测试：switch (x) { case 1 {} default {} }
+		{token.SWITCH, "switch"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.CASE, "case"},
+		{token.INT, "1"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.DEFAULT, "default"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.RBRACE, "}"},
+
+		// 错误处理测试：try {} rescue (e) {}
+		{token.TRY, "try"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.RESCUE, "rescue"},
+		{token.LPAREN, "("},
+		{token.IDENT, "e"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+
 		// 文件结束标记
 		{token.EOF, ""},
 	}
@@ -175,3 +296,258 @@ if (5 < 10) {
 		}
 	}
 }
+
+// TestSplitTemplate 测试插值字符串的拆分
+func TestSplitTemplate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []TemplatePart
+		ok       bool
+	}{
+		{"a ${x} b", []TemplatePart{{"a ", false, 0}, {"x", true, 4}, {" b", false, 6}}, true},
+		{"${x}${y}", []TemplatePart{{"x", true, 2}, {"y", true, 6}}, true},
+		{"${ {1: 2}[1] }", []TemplatePart{{" {1: 2}[1] ", true, 2}}, true},
+		{`n=${f("}${y}")}`, []TemplatePart{{"n=", false, 0}, {`f("}${y}")`, true, 4}}, true},
+		{"${}", []TemplatePart{{"", true, 2}}, true},
+		{"a ${x", []TemplatePart{{"a ", false, 0}}, false},
+		{`a \${x} ${y}`, []TemplatePart{{`a \${x} `, false, 0}, {"y", true, 10}}, true},
+	}
+
+	for _, tt := range tests {
+		parts, ok := SplitTemplate(tt.input)
+		if ok != tt.ok {
+			t.Errorf("SplitTemplate(%q) ok wrong. expected=%t, got=%t", tt.input, tt.ok, ok)
+		}
+
+		if len(parts) != len(tt.expected) {
+			t.Errorf("SplitTemplate(%q) wrong number of parts. expected=%d, got=%d (%+v)",
+				tt.input, len(tt.expected), len(parts), parts)
+			continue
+		}
+
+		for i, part := range parts {
+			if part != tt.expected[i] {
+				t.Errorf("SplitTemplate(%q) parts[%d] wrong. expected=%+v, got=%+v",
+					tt.input, i, tt.expected[i], part)
+			}
+		}
+	}
+}
+
+// TestEscape 测试字符串转义序列的读取、转义和解释
+func TestEscape(t *testing.T) {
+	// 转义的双引号不结束字符串，转义的 ${ 不开始插值
+	l := New(`"a\"b" "\${x}" 1`)
+	for _, expected := range []token.Token{
+		{Type: token.STRING, Literal: `a\"b`},
+		{Type: token.STRING, Literal: `\${x}`},
+		{Type: token.INT, Literal: "1"},
+	} {
+		tok := l.NextToken()
+		if tok.Type != expected.Type || tok.Literal != expected.Literal {
+			t.Errorf("wrong token. expected=%s %q, got=%s %q",
+				expected.Type, expected.Literal, tok.Type, tok.Literal)
+		}
+	}
+
+	tests := []struct {
+		value   string
+		escaped string
+	}{
+		{"plain", "plain"},
+		{`say "hi"`, `say \"hi\"`},
+		{"a\\b", `a\\b`},
+		{"line1\nline2\ttab\r", `line1\nline2\ttab\r`},
+		{"${x} and $y", `\${x} and $y`},
+	}
+
+	for _, tt := range tests {
+		if escaped := Escape(tt.value); escaped != tt.escaped {
+			t.Errorf("Escape(%q) wrong. expected=%q, got=%q", tt.value, tt.escaped, escaped)
+		}
+		value, err := Unescape(tt.escaped)
+		if err != nil {
+			t.Errorf("Unescape(%q) returned error: %s", tt.escaped, err)
+			continue
+		}
+		if value != tt.value {
+			t.Errorf("Unescape(%q) wrong. expected=%q, got=%q", tt.escaped, tt.value, value)
+		}
+	}
+
+	for _, input := range []string{`\q`, `abc\`} {
+		if _, err := Unescape(input); err == nil {
+			t.Errorf("Unescape(%q) did not return an error", input)
+		}
+	}
+}
+
+// TestUnterminatedString 测试读到输入末尾仍未结束的字符串
+func TestUnterminatedString(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"abc`, token.UNTERMINATED_STRING, "abc"},
+		{`"a\"`, token.UNTERMINATED_STRING, `a\"`},
+		{`"a\`, token.UNTERMINATED_STRING, `a\`},
+		{`"x ${y}`, token.UNTERMINATED_STRING, "x ${y}"},
+		{`"x ${"y`, token.UNTERMINATED_STRING, `x ${"y`},
+		{`"x ${y`, token.UNTERMINATED_STRING, "x ${y"},
+		{`""`, token.STRING, ""},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Errorf("%q: wrong token. expected=%s %q, got=%s %q",
+				tt.input, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok.Offset+tok.Length != len(tt.input) {
+			t.Errorf("%q: token does not extend to the end of input. length=%d", tt.input, tok.Length)
+		}
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("%q: expected EOF after the string. got=%s %q", tt.input, next.Type, next.Literal)
+		}
+	}
+}
+
+// TestTokenPositions 测试 Token 的行号和列号
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x + \"a\nb\";\n\tfoo"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"x", 2, 3},
+		{"+", 2, 5},
+		{"a\nb", 2, 7},
+		{";", 3, 3},
+		{"foo", 4, 2},
+		{"", 4, 5},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+// TestTokenOffsets 测试Token的字节偏移量和长度覆盖它在源代码中的原文
+func TestTokenOffsets(t *testing.T) {
+	input := "let s = \"a\\\"é ${x}\";  # note\nf(xs...) != 10"
+
+	expected := []string{
+		"let", "s", "=", `"a\"é ${x}"`, ";", "# note",
+		"f", "(", "xs", "...", ")", "!=", "10", "", "",
+	}
+
+	l := New(input)
+	l.SetEmitComments(true)
+
+	for i, want := range expected {
+		tok := l.NextToken()
+		if tok.Offset < 0 || tok.Length < 0 || tok.Offset+tok.Length > len(input) {
+			t.Fatalf("tests[%d] - range out of bounds. offset=%d, length=%d", i, tok.Offset, tok.Length)
+		}
+		if got := input[tok.Offset : tok.Offset+tok.Length]; got != want {
+			t.Errorf("tests[%d] - source text wrong. expected=%q, got=%q", i, want, got)
+		}
+	}
+}
+
+// TestNewAt 测试从源代码中间开始分析时Token的位置
+func TestNewAt(t *testing.T) {
+	// 文本从源代码第3行第7列、偏移量20处开始，换行后列号重新从1开始计数
+	l := NewAt("a + b\n  c", 3, 7, 20)
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+		expectedOffset  int
+	}{
+		{"a", 3, 7, 20},
+		{"+", 3, 9, 22},
+		{"b", 3, 11, 24},
+		{"c", 4, 3, 28},
+		{"", 4, 4, 29},
+	}
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn || tok.Offset != tt.expectedOffset {
+			t.Errorf("tests[%d] - position wrong. expected=%d:%d@%d, got=%d:%d@%d", i,
+				tt.expectedLine, tt.expectedColumn, tt.expectedOffset, tok.Line, tok.Column, tok.Offset)
+		}
+	}
+}
+
+// TestComments 测试注释的跳过和输出
+func TestComments(t *testing.T) {
+	input := "# leading\nlet x = 5; # trailing\n#last"
+
+	// 默认把注释当作空白跳过
+	l := New(input)
+	for _, expected := range []token.TokenType{token.LET, token.IDENT, token.ASSIGN,
+		token.INT, token.SEMICOLON, token.EOF} {
+		if tok := l.NextToken(); tok.Type != expected {
+			t.Fatalf("wrong token type. expected=%q, got=%q (%q)", expected, tok.Type, tok.Literal)
+		}
+	}
+
+	// 开启后注释作为COMMENT token返回
+	l = New(input)
+	l.SetEmitComments(true)
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{token.COMMENT, "# leading", 1, 1},
+		{token.LET, "let", 2, 1},
+		{token.IDENT, "x", 2, 5},
+		{token.ASSIGN, "=", 2, 7},
+		{token.INT, "5", 2, 9},
+		{token.SEMICOLON, ";", 2, 10},
+		{token.COMMENT, "# trailing", 2, 12},
+		{token.COMMENT, "#last", 3, 1},
+		{token.EOF, "", 3, 6},
+	}
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - wrong position. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"monkey/evaluator"
+	"monkey/object"
 	"monkey/repl"
 	"os"
 	"os/user"
@@ -10,6 +13,12 @@ import (
 // main 函数是 Monkey 编程语言的入口点
 // 它启动一个 REPL（Read-Eval-Print Loop）交互式环境
 func main() {
+	// --strict 开启严格模式：索引越界和不存在的哈希键报错而不是返回null
+	strict := flag.Bool("strict", false, "report out-of-range indexes and missing hash keys as errors")
+	// --loose-truthiness 让0、空字符串和空数组在条件中视为假值
+	looseTruthiness := flag.Bool("loose-truthiness", false, "treat 0, \"\" and [] as false in conditions")
+	flag.Parse()
+
 	// 获取当前系统用户信息
 	user, err := user.Current()
 	if err != nil {
@@ -25,5 +34,9 @@ func main() {
 	fmt.Printf("Feel free to type in commands\n")
 
 	// 启动 REPL 环境，使用标准输入和标准输出
-	repl.Start(os.Stdin, os.Stdout)
+	env := object.NewEnvironment()
+	env.SetStrict(*strict)
+	// REPL结束后以其退出状态结束进程，exit内置函数指定的状态由此成为进程的退出码
+	code := repl.StartWithOptions(os.Stdin, os.Stdout, env, evaluator.Options{LooseTruthiness: *looseTruthiness})
+	os.Exit(code)
 }
@@ -1,28 +1,65 @@
 package object
 
+import (
+	"monkey/ast"
+	"sort"
+)
+
 // NewEnclosedEnvironment 创建一个新的封闭环境，用于实现嵌套作用域
 // 参数 outer: 外部环境指针，新创建的环境将继承该环境的变量查找能力
 // 返回值: 指向新创建的封闭环境的指针
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
+	return &Environment{outer: outer}
+}
+
+// NewEnclosedEnvironmentSize 与 NewEnclosedEnvironment 相同，但预先为size个变量分配空间
+// 函数调用时用形参的个数作为size，变量不多时完全不需要分配映射
+// 参数 outer: 外部环境指针
+// 参数 size: 预计在新环境中定义的变量个数
+// 返回值: 指向新创建的封闭环境的指针
+func NewEnclosedEnvironmentSize(outer *Environment, size int) *Environment {
+	env := &Environment{outer: outer}
+	if size > len(env.slots) {
+		env.store = make(map[string]Object, size)
+	}
 	return env
 }
 
 // NewEnvironment 创建一个新的空环境
-// 返回值: 指向新创建的环境的指针，包含空的变量存储映射
+// 返回值: 指向新创建的环境的指针，不包含任何变量
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{outer: nil}
+}
+
+// envSlots 环境中不使用映射就能保存的变量个数
+// 大多数函数只有很少的形参和局部变量，用固定的槽位保存可以避免每次调用都分配映射
+const envSlots = 2
+
+// binding 是保存在环境槽位中的一个变量
+type binding struct {
+	name  string
+	value Object
 }
 
 // Environment 结构体表示Monkey语言中的变量环境
 // 用于存储和管理变量名到对象的映射关系，支持嵌套作用域
 type Environment struct {
-	// store: 当前环境的变量存储映射，键为变量名，值为对应的Object对象
+	// slots: 变量不超过envSlots个时，按定义的顺序保存在这里，前nslots个有效
+	slots  [envSlots]binding
+	nslots int
+	// store: 当前环境的变量存储映射，键为变量名，值为对应的Object对象；
+	// 为nil时变量保存在slots中，槽位用完后所有变量移到映射中
 	store map[string]Object
 	// outer: 指向外部环境的指针，用于实现变量查找的链式搜索（作用域链）
 	outer *Environment
+	// strict: 是否开启严格模式，只在最外层环境设置，内层环境通过作用域链继承
+	strict bool
+	// noRedeclare: 是否禁止在同一个环境中重复声明变量，与strict一样通过作用域链继承
+	noRedeclare bool
+	// sites: 通过Declare定义的变量名到声明它的语法树节点的映射
+	sites map[string]ast.Node
+	// constants: 当前环境中通过DeclareConst声明的常量名集合
+	constants map[string]bool
 }
 
 // Get 从环境中获取指定名称的变量值
@@ -32,19 +69,208 @@ type Environment struct {
 //   - bool: 指示是否成功找到变量
 // 查找逻辑: 先在当前环境查找，如果未找到且存在外部环境，则递归到外部环境查找
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
+	obj, ok := e.local(name)
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(name)
 	}
 	return obj, ok
 }
 
+// Names 返回当前环境中可见的所有变量名，包括各层外部环境中定义的变量
+// 返回值: 按字典序排列、没有重复的变量名切片
+func (e *Environment) Names() []string {
+	seen := make(map[string]bool)
+	names := []string{}
+	for env := e; env != nil; env = env.outer {
+		env.each(func(name string) {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		})
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetStrict 开启或关闭严格模式
+// 严格模式下数组、字符串的索引越界和哈希表中不存在的键返回错误，而不是null
+// 参数 strict: 是否开启严格模式
+func (e *Environment) SetStrict(strict bool) {
+	e.strict = strict
+}
+
+// Strict 判断是否处于严格模式
+// 当前环境或任一外部环境开启了严格模式时返回true，因此函数调用创建的内层环境同样生效
+func (e *Environment) Strict() bool {
+	for env := e; env != nil; env = env.outer {
+		if env.strict {
+			return true
+		}
+	}
+	return false
+}
+
+// SetNoRedeclare 设置是否禁止在同一个环境中重复声明变量
+// 开启后，同一个环境中已经存在的变量不能被另一条let语句再次声明；在内层作用域中遮蔽外层变量不受影响。
+// 默认关闭，REPL中可以随时重新定义变量
+// 参数 noRedeclare: 是否禁止重复声明
+func (e *Environment) SetNoRedeclare(noRedeclare bool) {
+	e.noRedeclare = noRedeclare
+}
+
+// NoRedeclare 判断是否禁止重复声明
+// 当前环境或任一外部环境开启时返回true
+func (e *Environment) NoRedeclare() bool {
+	for env := e; env != nil; env = env.outer {
+		if env.noRedeclare {
+			return true
+		}
+	}
+	return false
+}
+
+// Redeclared 判断在当前环境中由site声明name是否属于被禁止的重复声明
+// 只检查当前环境：name已经存在、且不是由同一个节点声明的（如函数形参或另一条let语句）时返回true；
+// 同一条语句再次执行（如循环体中的let）不算重复声明；未开启NoRedeclare时总是返回false
+// 参数 name: 变量名称
+// 参数 site: 声明变量的语法树节点
+func (e *Environment) Redeclared(name string, site ast.Node) bool {
+	if !e.NoRedeclare() {
+		return false
+	}
+	if _, ok := e.local(name); !ok {
+		return false
+	}
+	return e.sites[name] != site
+}
+
+// RedeclaredConstant 判断在当前环境中由site声明name是否会替换同一环境中的常量
+// 与Redeclared不同，无论是否开启NoRedeclare都会检查；同一条const语句再次执行不算重复声明，
+// 在内层作用域中遮蔽外层常量也不受影响
+// 参数 name: 变量名称
+// 参数 site: 声明变量的语法树节点
+func (e *Environment) RedeclaredConstant(name string, site ast.Node) bool {
+	return e.constants[name] && e.sites[name] != site
+}
+
+// Declare 在当前环境中声明变量，并记录声明它的语法树节点
+// 调用方应先用Redeclared和RedeclaredConstant检查是否允许声明
+// 参数 name: 变量名称
+// 参数 val: 变量的值
+// 参数 site: 声明变量的语法树节点
+// 返回值: 设置的变量值
+func (e *Environment) Declare(name string, val Object, site ast.Node) Object {
+	if e.sites == nil {
+		e.sites = make(map[string]ast.Node)
+	}
+	e.sites[name] = site
+	return e.Set(name, val)
+}
+
+// DeclareConst 在当前环境中声明常量，并记录声明它的语法树节点
+// 常量不能再通过Assign修改，也不能被同一环境中的另一条声明替换，但可以在内层作用域中用let或const遮蔽
+// 参数 name: 常量名称
+// 参数 val: 常量的值
+// 参数 site: 声明常量的语法树节点
+// 返回值: 设置的常量值
+func (e *Environment) DeclareConst(name string, val Object, site ast.Node) Object {
+	e.Declare(name, val, site)
+	if e.constants == nil {
+		e.constants = make(map[string]bool)
+	}
+	e.constants[name] = true
+	return val
+}
+
+// Constant 判断变量名在当前环境中解析到的绑定是否为常量
+// 沿作用域链找到最近一个定义该变量的环境，返回它是否由DeclareConst声明；
+// 因此内层作用域中用let遮蔽的同名变量不是常量，闭包中访问的外层常量仍然是常量
+// 参数 name: 变量名称
+func (e *Environment) Constant(name string) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.local(name); ok {
+			return env.constants[name]
+		}
+	}
+	return false
+}
+
+// Assign 修改已经存在的变量的值
+// 沿作用域链查找定义该变量的环境，并在那个环境中修改，因此闭包可以修改捕获的外层变量
+// 参数 name: 变量名称
+// 参数 val: 新的Object值
+// 返回值: 找到变量时返回val和true；任何一层环境都没有该变量、或变量是常量时不做修改，返回nil和false
+// 调用方可以用Constant区分这两种情况
+func (e *Environment) Assign(name string, val Object) (Object, bool) {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.local(name); ok {
+			if env.constants[name] {
+				return nil, false
+			}
+			env.setLocal(name, val)
+			return val, true
+		}
+	}
+	return nil, false
+}
+
 // Set 在当前环境中设置或修改变量值
 // 参数 name: 变量名称
 // 参数 val: 要设置的Object值
 // 返回值: 设置的变量值
-// 注意: 该方法只在当前环境设置变量，不会影响外部环境
+// 注意: 该方法只在当前环境设置变量，不会影响外部环境；let语句使用Set，
+// 因此可以遮蔽外层的同名变量，而赋值表达式使用Assign修改定义该变量的那一层
 func (e *Environment) Set(name string, val Object) Object {
-	e.store[name] = val
+	e.setLocal(name, val)
 	return val
 }
+
+// local 只在当前环境中查找变量，不查找外部环境
+func (e *Environment) local(name string) (Object, bool) {
+	if e.store != nil {
+		obj, ok := e.store[name]
+		return obj, ok
+	}
+	for i := 0; i < e.nslots; i++ {
+		if e.slots[i].name == name {
+			return e.slots[i].value, true
+		}
+	}
+	return nil, false
+}
+
+// setLocal 在当前环境中设置变量，槽位用完时把所有变量移到映射中
+func (e *Environment) setLocal(name string, val Object) {
+	if e.store == nil {
+		for i := 0; i < e.nslots; i++ {
+			if e.slots[i].name == name {
+				e.slots[i].value = val
+				return
+			}
+		}
+		if e.nslots < len(e.slots) {
+			e.slots[e.nslots] = binding{name: name, value: val}
+			e.nslots++
+			return
+		}
+
+		e.store = make(map[string]Object, 2*len(e.slots))
+		for i := 0; i < e.nslots; i++ {
+			e.store[e.slots[i].name] = e.slots[i].value
+			e.slots[i] = binding{}
+		}
+		e.nslots = 0
+	}
+	e.store[name] = val
+}
+
+// each 对当前环境中的每个变量名调用fn，不包括外部环境
+func (e *Environment) each(fn func(name string)) {
+	for i := 0; i < e.nslots; i++ {
+		fn(e.slots[i].name)
+	}
+	for name := range e.store {
+		fn(name)
+	}
+}
@@ -1,17 +1,53 @@
 package object
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"io"
+	"math/rand"
 	"monkey/ast"
+	"monkey/lexer"
+	"monkey/token"
+	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
 // BuiltinFunction 定义内置函数的函数签名类型
 // 用于表示 Monkey 语言中的内置函数，这些函数由解释器直接实现而非用户定义
-// 函数签名：接受可变数量的 Object 参数，返回一个 Object 结果
-type BuiltinFunction func(args ...Object) Object
+// 函数签名：接受求值器提供的上下文和可变数量的 Object 参数，返回一个 Object 结果
+type BuiltinFunction func(ctx BuiltinContext, args ...Object) Object
+
+// BuiltinContext 是求值器在每次调用内置函数时提供的上下文
+// 内置函数通过它使用求值器的输入输出、随机数生成器，以及回调（Call）和求值代码（Eval）的能力；
+// 不需要这些能力的内置函数忽略它即可。上下文按值传递，调用内置函数时不必为它分配内存
+type BuiltinContext struct {
+	Out  io.Writer     // 求值器的输出，puts、print等写到这里
+	In   *bufio.Reader // 求值器的输入，input从这里读取
+	Rand *rand.Rand    // 求值器的随机数生成器，每个求值器各有一个，互不影响
+	Env  *Environment  // 调用内置函数处的环境
+	Host BuiltinHost   // 调用内置函数的求值器，Call和Eval通过它实现
+}
+
+// BuiltinHost 由求值器实现，为内置函数提供调用函数和求值代码的能力，见 BuiltinContext
+type BuiltinHost interface {
+	// CallFunction 调用fn，结果已经解除ReturnValue的包装，调用出错时返回错误对象
+	CallFunction(env *Environment, fn Object, args ...Object) Object
+	// EvalProgram 在env中求值程序，程序中的定义保存在env中，结果已经解除ReturnValue的包装
+	EvalProgram(env *Environment, program *ast.Program) Object
+}
+
+// Call 调用作为参数传入的Monkey函数，如sort的比较函数
+func (ctx BuiltinContext) Call(fn Object, args ...Object) Object {
+	return ctx.Host.CallFunction(ctx.Env, fn, args...)
+}
+
+// Eval 在调用内置函数处的环境中求值程序，如eval
+func (ctx BuiltinContext) Eval(program *ast.Program) Object {
+	return ctx.Host.EvalProgram(ctx.Env, program)
+}
 
 type ObjectType string
 
@@ -22,16 +58,24 @@ const (
 	ERROR_OBJ = "ERROR" // 错误对象类型标识符
 
 	INTEGER_OBJ = "INTEGER" // 整数对象类型标识符
+	FLOAT_OBJ   = "FLOAT"   // 浮点数对象类型标识符
 	BOOLEAN_OBJ = "BOOLEAN" // 布尔值对象类型标识符
 	STRING_OBJ  = "STRING"  // 字符串对象类型标识符
 
-	RETURN_VALUE_OBJ = "RETURN_VALUE" // 返回值包装对象类型标识符
+	RETURN_VALUE_OBJ    = "RETURN_VALUE"    // 返回值包装对象类型标识符
+	BREAK_SIGNAL_OBJ    = "BREAK_SIGNAL"    // break信号对象类型标识符
+	CONTINUE_SIGNAL_OBJ = "CONTINUE_SIGNAL" // continue信号对象类型标识符
+	EXIT_OBJ            = "EXIT"            // exit信号对象类型标识符
 
 	FUNCTION_OBJ = "FUNCTION" // 用户定义函数对象类型标识符
 	BUILTIN_OBJ  = "BUILTIN"  // 内置函数对象类型标识符
+	MEMOIZED_OBJ = "MEMOIZED" // 带缓存的函数对象类型标识符
 
 	ARRAY_OBJ = "ARRAY" // 数组对象类型标识符
 	HASH_OBJ  = "HASH"  // 哈希表对象类型标识符
+
+	QUOTE_OBJ = "QUOTE" // 未求值的语法树对象类型标识符
+	MACRO_OBJ = "MACRO" // 宏对象类型标识符
 )
 
 // HashKey 结构体用于表示哈希表的键
@@ -74,6 +118,23 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// Float 结构体表示 Monkey 语言中的浮点数对象
+// 浮点数不能作为哈希表的键
+type Float struct {
+	Value float64 // 存储64位浮点数值
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// Inspect 返回浮点数的最短表示，整数值也带小数点（如 2.0），以便与整数区分
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
 // Boolean 结构体表示 Monkey 语言中的布尔值对象
 // 用于存储和操作布尔值，支持逻辑运算和哈希表键功能
 type Boolean struct {
@@ -116,14 +177,78 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// BreakSignal 表示执行break语句产生的信号
+// 与ReturnValue一样沿语句块向外传递，直到被最内层的循环消耗；
+// 它不是Monkey语言中的值，不会出现在变量或数据结构中
+type BreakSignal struct{}
+
+func (bs *BreakSignal) Type() ObjectType { return BREAK_SIGNAL_OBJ }
+func (bs *BreakSignal) Inspect() string  { return "break" }
+
+// ContinueSignal 表示执行continue语句产生的信号，传递方式与BreakSignal相同
+type ContinueSignal struct{}
+
+func (cs *ContinueSignal) Type() ObjectType { return CONTINUE_SIGNAL_OBJ }
+func (cs *ContinueSignal) Inspect() string  { return "continue" }
+
+// Exit 表示调用exit内置函数产生的信号
+// 与错误一样中止求值并一直传递到最外层，不会被try捕获；
+// 由调用求值器的一方（如REPL）识别并结束执行，Code是退出状态
+type Exit struct {
+	Code int64
+}
+
+func (ex *Exit) Type() ObjectType { return EXIT_OBJ }
+func (ex *Exit) Inspect() string  { return fmt.Sprintf("exit(%d)", ex.Code) }
+
 // Error 结构体表示 Monkey 语言中的错误对象
 // 用于表示运行时错误和异常情况，支持错误信息的存储和传递
 type Error struct {
-	Message string // 存储错误消息，描述具体的错误原因和上下文信息
+	Message string         // 存储错误消息，描述具体的错误原因和上下文信息
+	Pos     token.Position // 出错的源代码位置，由求值器填写，零值表示位置未知
+	Stack   []Frame        // 出错时的函数调用栈，最内层的调用在前；在顶层代码中出错时为空
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+
+// maxInspectFrames 是Inspect输出的调用栈帧数上限，无限递归产生的错误只显示最内层的部分
+const maxInspectFrames = 20
+
+// Inspect 返回错误的字符串表示，位置已知时在消息前加上 "行:列"
+// 有调用栈时，之后每行输出一帧，最内层的调用在前
+func (e *Error) Inspect() string {
+	var out bytes.Buffer
+
+	out.WriteString("ERROR: ")
+	if e.Pos.IsValid() {
+		out.WriteString(e.Pos.String() + ": ")
+	}
+	out.WriteString(e.Message)
+
+	for i, frame := range e.Stack {
+		if i == maxInspectFrames {
+			out.WriteString(fmt.Sprintf("\n  ... %d more frames", len(e.Stack)-i))
+			break
+		}
+		out.WriteString("\n  at " + frame.String())
+	}
+
+	return out.String()
+}
+
+// Frame 表示函数调用栈中的一帧
+type Frame struct {
+	Function string         // 被调用函数的名称，无法确定名称时为 "<anonymous>"
+	Pos      token.Position // 调用处的源代码位置，零值表示位置未知
+}
+
+// String 返回 "函数名 (行:列)" 形式的字符串，位置未知时只有函数名
+func (f Frame) String() string {
+	if f.Pos.IsValid() {
+		return f.Function + " (" + f.Pos.String() + ")"
+	}
+	return f.Function
+}
 
 // Function 结构体表示 Monkey 语言中的用户定义函数对象
 // 用于存储和表示用户定义的函数，支持函数定义、参数列表和函数体执行
@@ -131,12 +256,14 @@ type Function struct {
 	Parameters []*ast.Identifier   // 函数参数列表，存储参数标识符的指针数组
 	Body       *ast.BlockStatement // 函数体，存储包含语句块的抽象语法树节点
 	Env        *Environment        // 函数执行环境，存储变量作用域和闭包信息
+	Name       string              // 函数名，即直接绑定函数字面量的let变量名；匿名函数为空
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 
 // Inspect 方法实现 Object 接口，返回函数对象的可读字符串表示
-// 用于调试输出、REPL 环境显示和错误消息，提供人类可读的函数定义表示
+// 用于调试输出、REPL 环境显示和错误消息，提供人类可读的函数定义表示；
+// 有名称的函数显示为 fn add(x, y) {...}
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
@@ -146,6 +273,9 @@ func (f *Function) Inspect() string {
 	}
 
 	out.WriteString("fn")
+	if f.Name != "" {
+		out.WriteString(" " + f.Name)
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") {\n")
@@ -157,20 +287,35 @@ func (f *Function) Inspect() string {
 
 // String 结构体表示 Monkey 语言中的字符串对象
 // 用于存储和操作字符串值，支持字符串操作和哈希表键功能
+// 字符串对象创建后不应修改Value，HashKey的结果会被缓存
 type String struct {
+	// hash: 缓存的FNV-1a哈希值，0表示尚未计算；放在第一个字段以保证原子操作所需的64位对齐
+	hash uint64
+
 	Value string // 存储字符串值，支持 Unicode 字符和任意长度的文本数据
 }
 
 func (s *String) Type() ObjectType { return STRING_OBJ }
-func (s *String) Inspect() string  { return s.Value }
+
+// Inspect 返回带双引号并经过转义的字符串，与源代码中的写法一致，
+// 以便在 REPL 中区分字符串 "5" 和整数 5；需要原始内容时使用 Value
+func (s *String) Inspect() string { return `"` + lexer.Escape(s.Value) + `"` }
 
 // HashKey 方法实现 Hashable 接口，返回字符串对象的哈希键
-// 用于哈希表键值对存储和快速查找，确保字符串对象可以作为哈希表的键使用
+// 用于哈希表键值对存储和快速查找，确保字符串对象可以作为哈希表的键使用；
+// 哈希值在第一次调用时计算并缓存，同一个字符串对象在循环中反复作为键时不必每次遍历整个字符串。
+// 缓存通过原子操作读写，多个goroutine共享同一个字符串对象时也是安全的
 func (s *String) HashKey() HashKey {
-	h := fnv.New64a()
-	h.Write([]byte(s.Value))
+	hash := atomic.LoadUint64(&s.hash)
+	if hash == 0 {
+		h := fnv.New64a()
+		h.Write([]byte(s.Value))
+		// 哈希值恰好为0时不缓存，每次重新计算，结果仍然正确
+		hash = h.Sum64()
+		atomic.StoreUint64(&s.hash, hash)
+	}
 
-	return HashKey{Type: s.Type(), Value: h.Sum64()}
+	return HashKey{Type: s.Type(), Value: hash}
 }
 
 // Builtin 结构体表示 Monkey 语言中的内置函数对象
@@ -187,10 +332,60 @@ func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 // 用于调试输出、REPL 环境显示和错误消息，提供统一的内置函数标识表示
 func (b *Builtin) Inspect() string { return "builtin function" }
 
+// Memoized 结构体表示由 memo 内置函数包装的带缓存的函数
+// 以相同参数再次调用时直接返回缓存的结果，不再执行函数体，因此只适用于纯函数；
+// 缓存保存在包装对象上，对同一个函数分别调用 memo 得到的包装对象互不共享缓存
+type Memoized struct {
+	Fn    *Function         // 被包装的用户定义函数
+	Cache map[string]Object // 以参数的哈希键为键的调用结果缓存
+}
+
+// Type 方法实现 Object 接口，返回带缓存的函数对象的类型标识符
+func (m *Memoized) Type() ObjectType { return MEMOIZED_OBJ }
+
+// Inspect 方法实现 Object 接口，返回带缓存的函数对象的可读字符串表示
+func (m *Memoized) Inspect() string { return "memo(" + m.Fn.Inspect() + ")" }
+
 // Array 结构体表示 Monkey 语言中的数组对象
 // 用于存储和操作对象数组，支持数组元素的存储、访问和遍历操作
+// Rest 和 Push 返回的数组可能与原数组共享底层存储，见各方法的说明
 type Array struct {
 	Elements []Object // 存储数组元素，支持任意类型的对象元素集合
+
+	// tail: 由Push创建的底层存储中已被使用的长度，多个数组共享同一个计数；
+	// 只有长度等于该计数的数组（最后一次Push的结果）可以直接追加到底层存储中，为nil时总是复制
+	tail *int
+}
+
+// Rest 返回去掉第一个元素后的数组，原数组为空时返回nil
+// 结果是原数组的视图，与原数组共享元素而不是复制，因此对递归处理数组的函数是O(1)的；
+// 通过索引赋值修改其中一个数组的元素，另一个数组中对应的元素也会改变。
+// 结果的容量被限制为自身长度，对它调用Push总是复制，不会覆盖原数组之后的元素
+func (ao *Array) Rest() *Array {
+	length := len(ao.Elements)
+	if length == 0 {
+		return nil
+	}
+	return &Array{Elements: ao.Elements[1:length:length]}
+}
+
+// Push 返回在末尾添加一个元素后的新数组，原数组的长度和元素保持不变
+// 对同一个数组连续Push（如在循环或递归中累积结果）时，新数组尽量追加到上一次分配的底层存储中，
+// 存储按倍数增长，均摊为O(1)；对同一个数组Push两次时第二次会复制，两个结果互不覆盖。
+// 与 Rest 一样，结果与原数组可能共享元素，通过索引赋值修改元素时对两者都可见
+// 参数 obj: 要添加的元素
+// 返回值: 新数组
+func (ao *Array) Push(obj Object) *Array {
+	length := len(ao.Elements)
+	if ao.tail != nil && *ao.tail == length && cap(ao.Elements) > length {
+		*ao.tail = length + 1
+		return &Array{Elements: append(ao.Elements, obj), tail: ao.tail}
+	}
+
+	// 限制容量后append必然分配新的底层存储，并按Go切片的策略预留增长空间
+	elements := append(ao.Elements[:length:length], obj)
+	tail := length + 1
+	return &Array{Elements: elements, tail: &tail}
 }
 
 // Type 方法实现 Object 接口，返回数组对象的类型标识符
@@ -198,13 +393,25 @@ type Array struct {
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
 
 // Inspect 方法实现 Object 接口，返回数组对象的可读字符串表示
-// 用于调试输出、REPL 环境显示和错误消息，提供人类可读的数组内容表示
+// 用于调试输出、REPL 环境显示和错误消息，提供人类可读的数组内容表示；
+// 通过索引赋值包含了自身的数组，在循环引用处显示为 [...]
 func (ao *Array) Inspect() string {
+	return ao.inspect(make(map[Object]bool))
+}
+
+// inspect 返回数组的字符串表示，visiting记录正在输出的外层数组和哈希表，用于发现循环引用
+func (ao *Array) inspect(visiting map[Object]bool) string {
+	if visiting[ao] {
+		return "[...]"
+	}
+	visiting[ao] = true
+	defer delete(visiting, ao)
+
 	var out bytes.Buffer
 
 	elements := []string{}
 	for _, e := range ao.Elements {
-		elements = append(elements, e.Inspect())
+		elements = append(elements, inspectElement(e, visiting))
 	}
 
 	out.WriteString("[")
@@ -214,6 +421,19 @@ func (ao *Array) Inspect() string {
 	return out.String()
 }
 
+// inspectElement 返回数组元素或哈希表值的字符串表示，
+// 元素是数组或哈希表时沿用外层的visiting以发现循环引用
+func inspectElement(obj Object, visiting map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.inspect(visiting)
+	case *Hash:
+		return obj.inspect(visiting)
+	default:
+		return obj.Inspect()
+	}
+}
+
 // HashPair 结构体表示 Monkey 语言中哈希表的键值对
 // 用于存储哈希表中的键值对关系，支持键值对的存储、访问和遍历操作
 type HashPair struct {
@@ -232,14 +452,26 @@ type Hash struct {
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
 
 // Inspect 方法实现 Object 接口，返回哈希表对象的可读字符串表示
-// 用于调试输出、REPL 环境显示和错误消息，提供人类可读的哈希表内容表示
+// 用于调试输出、REPL 环境显示和错误消息，提供人类可读的哈希表内容表示；
+// 通过索引赋值包含了自身的哈希表，在循环引用处显示为 {...}
 func (h *Hash) Inspect() string {
+	return h.inspect(make(map[Object]bool))
+}
+
+// inspect 返回哈希表的字符串表示，visiting记录正在输出的外层数组和哈希表，用于发现循环引用
+func (h *Hash) inspect(visiting map[Object]bool) string {
+	if visiting[h] {
+		return "{...}"
+	}
+	visiting[h] = true
+	defer delete(visiting, h)
+
 	var out bytes.Buffer
 
 	pairs := []string{}
 	for _, pair := range h.Pairs {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
-			pair.Key.Inspect(), pair.Value.Inspect()))
+			pair.Key.Inspect(), inspectElement(pair.Value, visiting)))
 	}
 
 	out.WriteString("{")
@@ -248,3 +480,47 @@ func (h *Hash) Inspect() string {
 
 	return out.String()
 }
+
+// Quote 结构体表示 quote 调用得到的未求值的抽象语法树
+// 宏以Quote对象的形式接收参数并返回展开结果
+type Quote struct {
+	Node ast.Node // 被引用的语法树节点，其中的 unquote 调用已经被替换为求值结果
+}
+
+// Type 方法实现 Object 接口，返回引用对象的类型标识符
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+
+// Inspect 方法实现 Object 接口，返回 QUOTE(<语法树的字符串表示>) 形式的字符串
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+// Macro 结构体表示 Monkey 语言中的宏对象
+// 由 DefineMacros 从顶层的 let 宏定义创建，宏调用在求值之前被展开为宏体返回的语法树
+type Macro struct {
+	Parameters []*ast.Identifier   // 宏参数列表，调用时绑定为参数的Quote对象
+	Body       *ast.BlockStatement // 宏体
+	Env        *Environment        // 定义宏时的环境
+}
+
+// Type 方法实现 Object 接口，返回宏对象的类型标识符
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+
+// Inspect 方法实现 Object 接口，返回与宏定义写法相同的字符串表示
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
@@ -1,6 +1,11 @@
 package object
 
-import "testing"
+import (
+	"monkey/ast"
+	"reflect"
+	"strings"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -21,6 +26,40 @@ func TestStringHashKey(t *testing.T) {
 	}
 }
 
+// BenchmarkStringHashKey 用1KB的字符串键在哈希表中查找10万次
+// cached 反复使用同一个字符串对象，只在第一次计算哈希值；
+// uncached 每次查找都创建新的字符串对象，相当于没有缓存时每次重新计算
+func BenchmarkStringHashKey(b *testing.B) {
+	const lookups = 100000
+	value := strings.Repeat("k", 1024)
+
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	key := &String{Value: value}
+	hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: &Integer{Value: 1}}
+
+	b.Run("cached", func(b *testing.B) {
+		key := &String{Value: value}
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < lookups; j++ {
+				if _, ok := hash.Pairs[key.HashKey()]; !ok {
+					b.Fatal("key not found")
+				}
+			}
+		}
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < lookups; j++ {
+				key := &String{Value: value}
+				if _, ok := hash.Pairs[key.HashKey()]; !ok {
+					b.Fatal("key not found")
+				}
+			}
+		}
+	})
+}
+
 func TestBooleanHashKey(t *testing.T) {
 	true1 := &Boolean{Value: true}
 	true2 := &Boolean{Value: true}
@@ -58,3 +97,232 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with twoerent content have same hash keys")
 	}
 }
+
+func TestStringInspect(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"hi", `"hi"`},
+		{"5", `"5"`},
+		{"", `""`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"a\nb", `"a\nb"`},
+	}
+
+	for _, tt := range tests {
+		str := &String{Value: tt.value}
+		if str.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect for %q. expected=%s, got=%s", tt.value, tt.expected, str.Inspect())
+		}
+	}
+
+	arr := &Array{Elements: []Object{&String{Value: "a"}, &Integer{Value: 1}}}
+	if arr.Inspect() != `["a", 1]` {
+		t.Errorf("wrong Inspect for array. got=%s", arr.Inspect())
+	}
+}
+
+func TestEnvironmentAssign(t *testing.T) {
+	global := NewEnvironment()
+	global.Set("a", &Integer{Value: 1})
+	global.Set("b", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(global)
+	inner.Set("b", &Integer{Value: 20})
+	innermost := NewEnclosedEnvironment(inner)
+
+	// 修改定义在最外层的变量
+	if _, ok := innermost.Assign("a", &Integer{Value: 10}); !ok {
+		t.Fatalf("Assign(a) failed")
+	}
+	if val, _ := global.Get("a"); val.(*Integer).Value != 10 {
+		t.Errorf("a not updated in global env. got=%s", val.Inspect())
+	}
+	if _, ok := inner.store["a"]; ok {
+		t.Errorf("Assign(a) created a binding in the inner env")
+	}
+
+	// 被遮蔽的变量只修改最近的一层
+	if _, ok := innermost.Assign("b", &Integer{Value: 30}); !ok {
+		t.Fatalf("Assign(b) failed")
+	}
+	if val, _ := inner.Get("b"); val.(*Integer).Value != 30 {
+		t.Errorf("b not updated in inner env. got=%s", val.Inspect())
+	}
+	if val, _ := global.Get("b"); val.(*Integer).Value != 2 {
+		t.Errorf("shadowed b in global env changed. got=%s", val.Inspect())
+	}
+
+	// 没有任何一层定义的变量不会被隐式创建
+	if val, ok := innermost.Assign("c", &Integer{Value: 1}); ok || val != nil {
+		t.Errorf("Assign(c) succeeded for undefined name. got=(%v, %t)", val, ok)
+	}
+	if _, ok := global.Get("c"); ok {
+		t.Errorf("Assign(c) created a global binding")
+	}
+}
+
+func TestEnvironmentManyVariables(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+
+	for _, env := range []*Environment{
+		NewEnvironment(),
+		NewEnclosedEnvironmentSize(NewEnvironment(), 2),
+		NewEnclosedEnvironmentSize(NewEnvironment(), len(names)),
+	} {
+		// 逐个定义变量，每次定义后之前的变量都仍然可见，超出槽位后同样如此
+		for i, name := range names {
+			env.Set(name, &Integer{Value: int64(i)})
+			for j, defined := range names[:i+1] {
+				obj, ok := env.Get(defined)
+				if !ok || obj.(*Integer).Value != int64(j) {
+					t.Fatalf("after setting %s: wrong value for %s. got=%v", name, defined, obj)
+				}
+			}
+		}
+
+		env.Set("a", &Integer{Value: 100})
+		if _, ok := env.Assign("j", &Integer{Value: 200}); !ok {
+			t.Errorf("Assign to j failed")
+		}
+		if obj, _ := env.Get("a"); obj.(*Integer).Value != 100 {
+			t.Errorf("a not overwritten. got=%d", obj.(*Integer).Value)
+		}
+		if obj, _ := env.Get("j"); obj.(*Integer).Value != 200 {
+			t.Errorf("j not assigned. got=%d", obj.(*Integer).Value)
+		}
+		if got := env.Names(); !reflect.DeepEqual(got, names) {
+			t.Errorf("wrong names. got=%v", got)
+		}
+		if _, ok := env.Get("k"); ok {
+			t.Errorf("undefined name found")
+		}
+	}
+}
+
+func TestEnvironmentNames(t *testing.T) {
+	global := NewEnvironment()
+	global.Set("b", &Integer{Value: 1})
+	global.Set("a", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(global)
+	inner.Set("c", &Integer{Value: 3})
+	inner.Set("a", &Integer{Value: 4})
+
+	// 外层与内层同名的变量只出现一次
+	expected := []string{"a", "b", "c"}
+	got := inner.Names()
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("inner.Names() wrong. want=%v, got=%v", expected, got)
+	}
+
+	// 外层环境看不到内层定义的变量
+	if got := global.Names(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("global.Names() wrong. got=%v", got)
+	}
+
+	if got := NewEnvironment().Names(); len(got) != 0 {
+		t.Errorf("empty environment has names. got=%v", got)
+	}
+}
+
+func TestEnvironmentConstants(t *testing.T) {
+	global := NewEnvironment()
+	global.DeclareConst("c", &Integer{Value: 1}, nil)
+	global.Declare("v", &Integer{Value: 2}, nil)
+
+	if !global.Constant("c") || global.Constant("v") || global.Constant("missing") {
+		t.Errorf("wrong constness in global environment")
+	}
+	if _, ok := global.Assign("c", &Integer{Value: 3}); ok {
+		t.Errorf("assignment to constant succeeded")
+	}
+	if obj, _ := global.Get("c"); obj.(*Integer).Value != 1 {
+		t.Errorf("constant modified. got=%d", obj.(*Integer).Value)
+	}
+
+	// 内层环境中解析到同一个常量
+	inner := NewEnclosedEnvironment(global)
+	if !inner.Constant("c") {
+		t.Errorf("constant not visible from inner environment")
+	}
+	if _, ok := inner.Assign("c", &Integer{Value: 3}); ok {
+		t.Errorf("assignment to outer constant succeeded")
+	}
+
+	// 遮蔽后的绑定不是常量
+	inner.Declare("c", &Integer{Value: 4}, nil)
+	if inner.Constant("c") || !global.Constant("c") {
+		t.Errorf("shadowing changed constness")
+	}
+	if _, ok := inner.Assign("c", &Integer{Value: 5}); !ok {
+		t.Errorf("assignment to shadowing variable failed")
+	}
+
+}
+
+func TestEnvironmentRedeclaredConstant(t *testing.T) {
+	first := &ast.LetStatement{}
+	second := &ast.LetStatement{}
+
+	global := NewEnvironment()
+	global.DeclareConst("c", &Integer{Value: 1}, first)
+	global.Declare("v", &Integer{Value: 2}, first)
+
+	// 不需要开启NoRedeclare
+	if !global.RedeclaredConstant("c", second) {
+		t.Errorf("redeclaring a constant not reported")
+	}
+	if global.RedeclaredConstant("c", first) {
+		t.Errorf("same statement reported as redeclaration")
+	}
+	if global.RedeclaredConstant("v", second) || global.RedeclaredConstant("missing", second) {
+		t.Errorf("non-constant reported as redeclared constant")
+	}
+
+	// 内层环境可以遮蔽外层常量
+	inner := NewEnclosedEnvironment(global)
+	if inner.RedeclaredConstant("c", second) {
+		t.Errorf("shadowing reported as redeclared constant")
+	}
+}
+
+func TestEnvironmentRedeclared(t *testing.T) {
+	first := &ast.LetStatement{}
+	second := &ast.LetStatement{}
+
+	global := NewEnvironment()
+	global.Declare("x", &Integer{Value: 1}, first)
+
+	// 默认允许重复声明
+	if global.Redeclared("x", second) {
+		t.Errorf("redeclaration reported without NoRedeclare")
+	}
+
+	global.SetNoRedeclare(true)
+	if !global.Redeclared("x", second) {
+		t.Errorf("redeclaration by another statement not reported")
+	}
+	if global.Redeclared("x", first) {
+		t.Errorf("same statement reported as redeclaration")
+	}
+	if global.Redeclared("y", second) {
+		t.Errorf("undeclared name reported as redeclaration")
+	}
+
+	// 内层环境继承设置，但遮蔽外层变量不算重复声明
+	inner := NewEnclosedEnvironment(global)
+	if !inner.NoRedeclare() {
+		t.Errorf("inner environment did not inherit NoRedeclare")
+	}
+	if inner.Redeclared("x", second) {
+		t.Errorf("shadowing reported as redeclaration")
+	}
+
+	// 没有通过Declare定义的变量（如函数形参）不能被let再次声明
+	inner.Set("p", &Integer{Value: 2})
+	if !inner.Redeclared("p", second) {
+		t.Errorf("redeclaring a parameter not reported")
+	}
+}
@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+)
+
+// Check 对解析得到的程序做轻量的静态检查，返回警告信息
+// 警告不影响程序执行，目前只检查return之后无法执行到的语句：
+// 程序或语句块中直接出现return时，报告其后第一条语句所在的行
+// 参数 program: 解析得到的程序
+// 返回值: 警告字符串切片，没有警告时为空切片
+func Check(program *ast.Program) []string {
+	c := &checker{warnings: []string{}}
+	ast.Walk(c, program)
+	return c.warnings
+}
+
+// checker 实现ast.Visitor，在遍历过程中收集警告
+type checker struct {
+	warnings []string
+}
+
+func (c *checker) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.Program:
+		c.checkUnreachable(node.Statements)
+	case *ast.BlockStatement:
+		c.checkUnreachable(node.Statements)
+	}
+	return c
+}
+
+// checkUnreachable 检查语句序列中return之后是否还有语句
+// 只看直接出现在该序列中的return，嵌套在if等语句块里的return不影响后续语句
+func (c *checker) checkUnreachable(statements []ast.Statement) {
+	for i, stmt := range statements {
+		if _, ok := stmt.(*ast.ReturnStatement); ok && i+1 < len(statements) {
+			c.warnings = append(c.warnings, fmt.Sprintf(
+				"line %d: unreachable statement after return", statementToken(statements[i+1]).Line))
+			return
+		}
+	}
+}
+
+// statementToken 返回语句的第一个token，用于确定语句所在的位置
+func statementToken(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.MultiLetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	case *ast.BlockStatement:
+		return stmt.Token
+	default:
+		return token.Token{}
+	}
+}
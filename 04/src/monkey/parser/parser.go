@@ -1,11 +1,13 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
 	"monkey/token"
 	"strconv"
+	"strings"
 )
 
 // 运算符优先级常量定义，使用iota从LOWEST开始递增
@@ -13,91 +15,170 @@ import (
 const (
 	_           int = iota
 	LOWEST          // 最低优先级，用于基础表达式
+	ASSIGN          // = 赋值运算符
+	LOGICAL_OR      // || 运算符
+	LOGICAL_AND     // && 运算符
 	EQUALS          // == 和 != 运算符
 	LESSGREATER     // > 和 < 运算符
 	SUM             // + 和 - 运算符
-	PRODUCT         // * 和 / 运算符
+	PRODUCT         // *、/ 和 % 运算符
 	PREFIX          // -X 或 !X 前缀运算符
 	CALL            // myFunction(X) 函数调用
-	INDEX           // array[index] 数组索引
+	INDEX           // array[index] 数组索引 和 hash.key 成员访问
 )
 
-// precedences 映射表定义了各种运算符的优先级
+// DefaultMaxDepth 表达式嵌套深度的默认上限
+// 超过上限时记录解析错误并停止解析，避免恶意输入（如上万个左括号）耗尽Go调用栈
+const DefaultMaxDepth = 10000
+
+// DefaultMaxErrors 解析错误数量的默认上限
+// 达到上限后停止解析并追加一条 "too many errors, aborting"，避免垃圾输入产生成千上万条错误
+const DefaultMaxErrors = 50
+
+// precedences 映射表定义了各种运算符的默认优先级
 // 键为token类型，值为对应的优先级常量
+// 每个Parser在创建时复制一份，通过SetPrecedence修改的只是该Parser自己的副本
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,      // == 运算符
-	token.NOT_EQ:   EQUALS,      // != 运算符
-	token.LT:       LESSGREATER, // < 运算符
-	token.GT:       LESSGREATER, // > 运算符
-	token.PLUS:     SUM,         // + 运算符
-	token.MINUS:    SUM,         // - 运算符
-	token.SLASH:    PRODUCT,     // / 运算符
-	token.ASTERISK: PRODUCT,     // * 运算符
-	token.LPAREN:   CALL,        // ( 函数调用
-	token.LBRACKET: INDEX,       // [ 数组索引
+	token.ASSIGN:    ASSIGN,      // = 赋值运算符
+	token.OR:        LOGICAL_OR,  // || 运算符
+	token.AND:       LOGICAL_AND, // && 运算符
+	token.EQ:        EQUALS,      // == 运算符
+	token.NOT_EQ:    EQUALS,      // != 运算符
+	token.LT:        LESSGREATER, // < 运算符
+	token.GT:        LESSGREATER, // > 运算符
+	token.LT_EQ:     LESSGREATER, // <= 运算符
+	token.GT_EQ:     LESSGREATER, // >= 运算符
+	token.PLUS:      SUM,         // + 运算符
+	token.MINUS:     SUM,         // - 运算符
+	token.SLASH:     PRODUCT,     // / 运算符
+	token.ASTERISK:  PRODUCT,     // * 运算符
+	token.PERCENT:   PRODUCT,     // % 运算符
+	token.FLOOR_DIV: PRODUCT,     // // 运算符
+	token.LPAREN:    CALL,        // ( 函数调用
+	token.LBRACKET:  INDEX,       // [ 数组索引
+	token.DOT:       INDEX,       // . 成员访问
 }
 
 // 解析函数类型定义
 type (
-	// prefixParseFn 前缀解析函数，处理前缀表达式（如标识符、字面量、前缀运算符）
-	prefixParseFn func() ast.Expression
+	// PrefixParseFn 前缀解析函数，处理前缀表达式（如标识符、字面量、前缀运算符）
+	// 调用时当前token是该前缀token，返回时当前token应是表达式的最后一个token
+	PrefixParseFn func() ast.Expression
 
-	// infixParseFn 中缀解析函数，处理中缀表达式（如二元运算符）
-	infixParseFn func(ast.Expression) ast.Expression
+	// InfixParseFn 中缀解析函数，处理中缀表达式（如二元运算符）
+	// 参数是已解析的左侧表达式，调用时当前token是该中缀运算符
+	InfixParseFn func(ast.Expression) ast.Expression
 )
 
+// TokenSource 是语法分析器的token来源
+// *lexer.Lexer 实现了该接口；嵌入方也可以提供自己的词法分析器来产生自定义token类型
+type TokenSource interface {
+	NextToken() token.Token
+}
+
 // Parser 结构体表示Monkey语言的语法分析器
 // 负责将词法分析器生成的token序列转换为抽象语法树(AST)
 type Parser struct {
-	l      *lexer.Lexer // 词法分析器实例
-	errors []string     // 解析过程中收集的错误信息
+	l      TokenSource // 词法分析器实例
+	errors []string    // 解析过程中收集的错误信息
 
 	curToken  token.Token // 当前处理的token
 	peekToken token.Token // 下一个token（前瞻token）
 
 	// 前缀解析函数映射表，根据token类型调用对应的解析函数
-	prefixParseFns map[token.TokenType]prefixParseFn
+	prefixParseFns map[token.TokenType]PrefixParseFn
 	// 中缀解析函数映射表，根据token类型调用对应的解析函数
-	infixParseFns map[token.TokenType]infixParseFn
+	infixParseFns map[token.TokenType]InfixParseFn
+	// 运算符优先级表，从默认的precedences复制而来
+	precedences map[token.TokenType]int
+
+	depth     int  // 当前parseExpression的递归嵌套深度
+	maxDepth  int  // 允许的最大嵌套深度
+	maxErrors int  // 允许记录的最大错误数
+	halted    bool // 遇到无法恢复的错误后置为true，此后不再解析也不再记录错误
+
+	incomplete bool // 当前语句的错误是否因输入提前结束（遇到EOF）而产生
+
+	comments  []*ast.Comment         // 读到的全部注释，按出现顺序排列
+	docGroups map[int][]*ast.Comment // 单独成行的连续注释，以最后一条注释所在的行号为键
+}
+
+// ErrIncomplete 表示语句因输入提前结束而无法完成解析（如语句块缺少右花括号、字符串缺少结束双引号），
+// 补充更多输入后可能成为合法语句；REPL的多行模式可据此继续读取下一行
+var ErrIncomplete = errors.New("incomplete input")
+
+// SyntaxError 表示语句中存在语法错误，补充输入也无法修正
+type SyntaxError struct {
+	Messages []string // 解析该语句时记录的错误信息
+}
+
+func (e *SyntaxError) Error() string {
+	return strings.Join(e.Messages, "; ")
 }
 
 // New 创建并初始化一个新的语法分析器
-// 参数 l: 词法分析器实例
+// 参数 l: 词法分析器实例（通常是 *lexer.Lexer）
 // 返回值: 初始化完成的Parser指针
-func New(l *lexer.Lexer) *Parser {
+func New(l TokenSource) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		l:         l,
+		errors:    []string{},
+		maxDepth:  DefaultMaxDepth,
+		maxErrors: DefaultMaxErrors,
+	}
+
+	// 复制默认优先级表，使各个Parser的SetPrecedence互不影响
+	p.precedences = make(map[token.TokenType]int, len(precedences))
+	for tt, precedence := range precedences {
+		p.precedences[tt] = precedence
 	}
 
 	// 初始化前缀解析函数映射表
-	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
-	p.registerPrefix(token.IDENT, p.parseIdentifier)         // 标识符解析
-	p.registerPrefix(token.INT, p.parseIntegerLiteral)       // 整数字面量解析
-	p.registerPrefix(token.STRING, p.parseStringLiteral)     // 字符串字面量解析
-	p.registerPrefix(token.BANG, p.parsePrefixExpression)    // ! 前缀运算符
-	p.registerPrefix(token.MINUS, p.parsePrefixExpression)   // - 前缀运算符
-	p.registerPrefix(token.TRUE, p.parseBoolean)             // true布尔值
-	p.registerPrefix(token.FALSE, p.parseBoolean)            // false布尔值
-	p.registerPrefix(token.LPAREN, p.parseGroupedExpression) // 分组表达式 (expr)
-	p.registerPrefix(token.IF, p.parseIfExpression)          // if条件表达式
-	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral) // 函数字面量
-	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)    // 数组字面量
-	p.registerPrefix(token.LBRACE, p.parseHashLiteral)       // 哈希字面量
+	p.prefixParseFns = make(map[token.TokenType]PrefixParseFn)
+	p.RegisterPrefix(token.IDENT, p.parseIdentifier)            // 标识符解析
+	p.RegisterPrefix(token.INT, p.parseIntegerLiteral)          // 整数字面量解析
+	p.RegisterPrefix(token.FLOAT, p.parseFloatLiteral)          // 浮点数字面量解析
+	p.RegisterPrefix(token.STRING, p.parseStringLiteral)        // 字符串字面量解析
+	p.RegisterPrefix(token.TEMPLATE, p.parseInterpolatedString) // 插值字符串解析
+	p.RegisterPrefix(token.BANG, p.parsePrefixExpression)       // ! 前缀运算符
+	p.RegisterPrefix(token.MINUS, p.parsePrefixExpression)      // - 前缀运算符
+	p.RegisterPrefix(token.TRUE, p.parseBoolean)                // true布尔值
+	p.RegisterPrefix(token.FALSE, p.parseBoolean)               // false布尔值
+	p.RegisterPrefix(token.LPAREN, p.parseGroupedExpression)    // 分组表达式 (expr)
+	p.RegisterPrefix(token.IF, p.parseIfExpression)             // if条件表达式
+	p.RegisterPrefix(token.WHILE, p.parseWhileExpression)       // while循环表达式
+	p.RegisterPrefix(token.SWITCH, p.parseSwitchExpression)     // switch多分支表达式
+	p.RegisterPrefix(token.TRY, p.parseTryExpression)           // try/rescue错误处理表达式
+	p.RegisterPrefix(token.FOR, p.parseForExpression)           // for循环表达式
+	p.RegisterPrefix(token.FUNCTION, p.parseFunctionLiteral)    // 函数字面量
+	p.RegisterPrefix(token.MACRO, p.parseMacroLiteral)          // 宏字面量
+	p.RegisterPrefix(token.LBRACKET, p.parseArrayLiteral)       // 数组字面量
+	p.RegisterPrefix(token.LBRACE, p.parseHashLiteral)          // 哈希字面量
+
+	p.RegisterPrefix(token.UNTERMINATED_STRING, p.parseUnterminatedString) // 缺少结束双引号的字符串
 
 	// 初始化中缀解析函数映射表
-	p.infixParseFns = make(map[token.TokenType]infixParseFn)
-	p.registerInfix(token.PLUS, p.parseInfixExpression)     // + 中缀运算符
-	p.registerInfix(token.MINUS, p.parseInfixExpression)    // - 中缀运算符
-	p.registerInfix(token.SLASH, p.parseInfixExpression)    // / 中缀运算符
-	p.registerInfix(token.ASTERISK, p.parseInfixExpression) // * 中缀运算符
-	p.registerInfix(token.EQ, p.parseInfixExpression)       // == 中缀运算符
-	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)   // != 中缀运算符
-	p.registerInfix(token.LT, p.parseInfixExpression)       // < 中缀运算符
-	p.registerInfix(token.GT, p.parseInfixExpression)       // > 中缀运算符
-
-	p.registerInfix(token.LPAREN, p.parseCallExpression)    // 函数调用
-	p.registerInfix(token.LBRACKET, p.parseIndexExpression) // 数组索引
+	p.infixParseFns = make(map[token.TokenType]InfixParseFn)
+	p.RegisterInfix(token.PLUS, p.parseInfixExpression)      // + 中缀运算符
+	p.RegisterInfix(token.MINUS, p.parseInfixExpression)     // - 中缀运算符
+	p.RegisterInfix(token.SLASH, p.parseInfixExpression)     // / 中缀运算符
+	p.RegisterInfix(token.ASTERISK, p.parseInfixExpression)  // * 中缀运算符
+	p.RegisterInfix(token.PERCENT, p.parseInfixExpression)   // % 中缀运算符
+	p.RegisterInfix(token.FLOOR_DIV, p.parseInfixExpression) // // 中缀运算符
+	p.RegisterInfix(token.AND, p.parseInfixExpression)       // && 中缀运算符
+	p.RegisterInfix(token.OR, p.parseInfixExpression)        // || 中缀运算符
+	p.RegisterInfix(token.EQ, p.parseInfixExpression)        // == 中缀运算符
+	p.RegisterInfix(token.NOT_EQ, p.parseInfixExpression)    // != 中缀运算符
+	p.RegisterInfix(token.LT, p.parseInfixExpression)        // < 中缀运算符
+	p.RegisterInfix(token.GT, p.parseInfixExpression)        // > 中缀运算符
+	p.RegisterInfix(token.LT_EQ, p.parseInfixExpression)     // <= 中缀运算符
+	p.RegisterInfix(token.GT_EQ, p.parseInfixExpression)     // >= 中缀运算符
+
+	p.RegisterInfix(token.ASSIGN, p.parseAssignExpression) // = 赋值
+
+	p.RegisterInfix(token.LPAREN, p.parseCallExpression)    // 函数调用
+	p.RegisterInfix(token.LBRACKET, p.parseIndexExpression) // 数组索引
+	p.RegisterInfix(token.DOT, p.parseDotExpression)        // 成员访问 hash.key
 
 	// 读取前两个token，初始化curToken和peekToken
 	p.nextToken()
@@ -110,7 +191,39 @@ func New(l *lexer.Lexer) *Parser {
 // 将peekToken设置为当前token，然后读取新的peekToken
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	p.peekToken = p.readToken()
+}
+
+// readToken 从词法分析器读取下一个非注释token
+// 词法分析器输出的COMMENT token被收集起来，不参与语法分析
+func (p *Parser) readToken() token.Token {
+	for {
+		tok := p.l.NextToken()
+		if tok.Type != token.COMMENT {
+			return tok
+		}
+		p.addComment(tok)
+	}
+}
+
+// addComment 记录一条注释
+// 单独成行的注释（与前一个token不在同一行）按行号连成注释组，
+// 紧挨在某条语句上方的注释组会成为该语句的Doc
+func (p *Parser) addComment(tok token.Token) {
+	comment := &ast.Comment{Token: tok, Text: tok.Literal}
+	p.comments = append(p.comments, comment)
+
+	// 此时peekToken还是注释之前的最后一个token；与它同行的是行尾注释
+	if p.peekToken.Line > 0 && p.peekToken.Line == tok.Line {
+		return
+	}
+
+	if p.docGroups == nil {
+		p.docGroups = make(map[int][]*ast.Comment)
+	}
+	group := append(p.docGroups[tok.Line-1], comment)
+	delete(p.docGroups, tok.Line-1)
+	p.docGroups[tok.Line] = group
 }
 
 // curTokenIs 检查当前token是否为指定类型
@@ -140,25 +253,65 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	}
 }
 
+// SetMaxDepth 设置表达式嵌套深度的上限，n小于等于0时使用DefaultMaxDepth
+// 参数 n: 允许的最大嵌套深度
+func (p *Parser) SetMaxDepth(n int) {
+	if n <= 0 {
+		n = DefaultMaxDepth
+	}
+	p.maxDepth = n
+}
+
+// SetMaxErrors 设置解析错误数量的上限，n小于等于0时使用DefaultMaxErrors
+// 参数 n: 允许记录的最大错误数
+func (p *Parser) SetMaxErrors(n int) {
+	if n <= 0 {
+		n = DefaultMaxErrors
+	}
+	p.maxErrors = n
+}
+
 // Errors 返回解析过程中收集的所有错误信息
 // 返回值: 错误字符串切片
 func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// addError 记录一条解析错误
+// 解析已中止时不再记录，避免展开深层递归时每一层都追加一条连带错误；
+// 错误数达到上限时追加一条中止信息并中止解析，ParseProgram返回已解析的部分程序
+// 参数 msg: 错误信息
+func (p *Parser) addError(msg string) {
+	if p.halted {
+		return
+	}
+	p.errors = append(p.errors, msg)
+
+	if len(p.errors) >= p.maxErrors {
+		p.errors = append(p.errors, "too many errors, aborting")
+		p.halted = true
+	}
+}
+
 // peekError 记录下一个token类型不匹配的错误
 // 参数 t: 期望的token类型
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(msg)
+	if p.peekTokenIs(token.EOF) {
+		p.incomplete = true
+	}
 }
 
 // noPrefixParseFnError 记录没有找到前缀解析函数的错误
 // 参数 t: 当前token类型
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(msg)
+	if t == token.EOF {
+		p.incomplete = true
+	}
 }
 
 // ParseProgram 解析整个程序，生成抽象语法树
@@ -167,43 +320,162 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
-	// 循环解析所有语句，直到遇到EOF
-	for !p.curTokenIs(token.EOF) {
-		stmt := p.parseStatement()
-		if stmt != nil {
+	// 循环解析所有语句，直到遇到EOF或解析被中止
+	for !p.curTokenIs(token.EOF) && !p.halted {
+		// 出错的语句被丢弃，错误信息已记录在p.errors中
+		stmt, err := p.ParseStatement()
+		if err == nil && stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
-		p.nextToken()
 	}
+	program.Comments = p.comments
 
 	return program
 }
 
+// ParseStatement 从当前位置解析单条语句，并把解析器移动到下一条语句的开头
+// 供REPL多行输入和编辑器工具逐条解析使用
+// 返回值: 解析出的语句；输入已结束时返回nil和nil；
+// 因输入提前结束而失败时返回ErrIncomplete，其他语法错误返回*SyntaxError，
+// 两种情况下错误信息同时记录在Errors()中
+func (p *Parser) ParseStatement() (ast.Statement, error) {
+	if p.curTokenIs(token.EOF) || p.halted {
+		return nil, nil
+	}
+
+	errCount := len(p.errors)
+	p.incomplete = false
+
+	stmt := p.parseStatement()
+	if len(p.errors) > errCount || p.halted {
+		// 语句解析出错：丢弃该语句并跳到下一条语句的开头
+		p.synchronize()
+		p.nextToken()
+
+		if p.incomplete && !p.halted {
+			return nil, ErrIncomplete
+		}
+		return nil, &SyntaxError{Messages: append([]string{}, p.errors[errCount:]...)}
+	}
+
+	p.nextToken()
+	return stmt, nil
+}
+
+// synchronize 在记录语法错误后进行错误恢复
+// 跳过剩余的token，直到当前token是分号或右花括号，或下一个token是语句的起始关键字、
+// 右花括号或EOF，使后续语句能从干净的位置重新开始解析，
+// 避免一个拼写错误引发一连串无意义的 "no prefix parse function" 错误
+func (p *Parser) synchronize() {
+	for !p.curTokenIs(token.EOF) && !p.curTokenIs(token.SEMICOLON) &&
+		!p.curTokenIs(token.RBRACE) {
+		switch p.peekToken.Type {
+		case token.LET, token.CONST, token.RETURN, token.BREAK, token.CONTINUE,
+			token.IF, token.WHILE, token.FOR, token.SWITCH, token.TRY, token.RBRACE, token.EOF:
+			return
+		}
+		p.nextToken()
+	}
+}
+
 // parseStatement 根据当前token类型解析对应的语句
-// 返回值: 解析出的语句节点
+// 各语句解析函数都返回ast.Statement接口，失败时返回的是nil接口值，
+// 而不是包装在接口中的带类型nil指针（后者不等于nil，会被误当作合法语句）
+// 返回值: 解析出的语句节点，解析失败返回nil
 func (p *Parser) parseStatement() ast.Statement {
+	// 紧挨在语句第一行上方的注释组作为语句的文档注释
+	doc, hasDoc := p.docGroups[p.curToken.Line-1]
+
+	var stmt ast.Statement
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement() // let语句
+		stmt = p.parseLetStatement() // let语句
+	case token.CONST:
+		stmt = p.parseConstStatement() // const语句
 	case token.RETURN:
-		return p.parseReturnStatement() // return语句
+		stmt = p.parseReturnStatement() // return语句
+	case token.BREAK:
+		stmt = p.parseBreakStatement() // break语句
+	case token.CONTINUE:
+		stmt = p.parseContinueStatement() // continue语句
 	default:
-		return p.parseExpressionStatement() // 表达式语句
+		stmt = p.parseExpressionStatement() // 表达式语句
+	}
+
+	if hasDoc && stmt != nil {
+		delete(p.docGroups, doc[len(doc)-1].Token.Line)
+		setDoc(stmt, doc)
+	}
+	return stmt
+}
+
+// setDoc 设置语句的文档注释
+func setDoc(stmt ast.Statement, doc []*ast.Comment) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		stmt.Doc = doc
+	case *ast.MultiLetStatement:
+		stmt.Doc = doc
+	case *ast.ReturnStatement:
+		stmt.Doc = doc
+	case *ast.BreakStatement:
+		stmt.Doc = doc
+	case *ast.ContinueStatement:
+		stmt.Doc = doc
+	case *ast.ExpressionStatement:
+		stmt.Doc = doc
 	}
 }
 
 // parseLetStatement 解析let语句：let <identifier> = <expression>;
-// 返回值: LetStatement节点，如果解析失败返回nil
-func (p *Parser) parseLetStatement() *ast.LetStatement {
+// 也支持解构形式：let [a, b] = <expression>; 和 let {name, age} = <expression>;
+// 声明多个变量的形式 let a, b = 1, 2; 交给parseMultiLetStatement处理
+// 返回值: LetStatement或MultiLetStatement节点，如果解析失败返回nil
+func (p *Parser) parseLetStatement() ast.Statement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
-	// 期望下一个token是标识符
-	if !p.expectPeek(token.IDENT) {
-		return nil
+	switch {
+	case p.peekTokenIs(token.LBRACKET):
+		// 数组解构模式
+		p.nextToken()
+		pattern := &ast.ArrayPattern{Token: p.curToken}
+		pattern.Names = p.parsePatternNames(token.RBRACKET)
+		if pattern.Names == nil {
+			return nil
+		}
+		pattern.RBracket = p.curToken
+		stmt.Pattern = pattern
+	case p.peekTokenIs(token.LBRACE):
+		// 哈希解构模式
+		p.nextToken()
+		pattern := &ast.HashPattern{Token: p.curToken}
+		pattern.Names = p.parsePatternNames(token.RBRACE)
+		if pattern.Names == nil {
+			return nil
+		}
+		pattern.RBrace = p.curToken
+		stmt.Pattern = pattern
+	default:
+		// 期望下一个token是标识符
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		// 解析标识符名称
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		// 名称后面是逗号：同时声明多个变量
+		if p.peekTokenIs(token.COMMA) {
+			return p.parseMultiLetStatement(stmt.Token, stmt.Name)
+		}
 	}
 
-	// 解析标识符名称
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	// 没有初始值的声明 let x; ，Value保持为nil，求值时绑定为NULL
+	// 解构模式必须有赋值表达式，不适用这种写法
+	if stmt.Pattern == nil && p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		return stmt
+	}
 
 	// 期望下一个token是赋值运算符
 	if !p.expectPeek(token.ASSIGN) {
@@ -214,6 +486,95 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	// 解析赋值表达式
 	stmt.Value = p.parseExpression(LOWEST)
+	if stmt.Name != nil {
+		nameFunction(stmt.Value, stmt.Name)
+	}
+
+	// 可选的分号
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseConstStatement 解析常量声明语句：const <identifier> = <expression>;
+// 常量必须有初始值，不支持解构和同时声明多个常量
+// 返回值: Token为const关键字的LetStatement节点，如果解析失败返回nil
+func (p *Parser) parseConstStatement() ast.Statement {
+	stmt := &ast.LetStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+	nameFunction(stmt.Value, stmt.Name)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseMultiLetStatement 解析声明多个变量的let语句：let a, b = 1, 2;
+// 调用时当前token是第一个变量名；名称与表达式的个数必须相同，名称不能重复
+// 参数 tok: let关键字的token
+// 参数 first: 已解析的第一个变量名
+// 返回值: MultiLetStatement节点，如果解析失败返回nil
+func (p *Parser) parseMultiLetStatement(tok token.Token, first *ast.Identifier) ast.Statement {
+	stmt := &ast.MultiLetStatement{Token: tok, Names: []*ast.Identifier{first}}
+
+	// 解析逗号分隔的其余变量名
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		for _, name := range stmt.Names {
+			if name.Value == ident.Value {
+				p.addError(fmt.Sprintf("duplicate name %s in let statement", ident.Value))
+				return nil
+			}
+		}
+		stmt.Names = append(stmt.Names, ident)
+	}
+
+	// 与 let x; 相同，没有初始值时所有变量都绑定为NULL
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		return stmt
+	}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	// 解析逗号分隔的赋值表达式
+	p.nextToken()
+	stmt.Values = []ast.Expression{p.parseExpression(LOWEST)}
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		stmt.Values = append(stmt.Values, p.parseExpression(LOWEST))
+	}
+
+	if len(stmt.Values) != len(stmt.Names) {
+		p.addError(fmt.Sprintf("let statement declares %d names but has %d values",
+			len(stmt.Names), len(stmt.Values)))
+		return nil
+	}
+	for i, value := range stmt.Values {
+		nameFunction(value, stmt.Names[i])
+	}
 
 	// 可选的分号
 	if p.peekTokenIs(token.SEMICOLON) {
@@ -223,11 +584,63 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+// nameFunction 直接用let绑定的函数字面量以变量名命名
+// 其他表达式（包括调用其他函数得到的闭包）中的函数字面量保持匿名
+// 参数 value: let语句的值
+// 参数 name: 绑定该值的变量名
+func nameFunction(value ast.Expression, name *ast.Identifier) {
+	if fn, ok := value.(*ast.FunctionLiteral); ok {
+		fn.Name = name.Value
+	}
+}
+
+// parsePatternNames 解析解构模式中逗号分隔的变量名列表
+// 模式中只允许出现标识符，且至少包含一个名称（暂不支持嵌套模式）
+// 参数 end: 模式结束的token类型（右方括号或右花括号）
+// 返回值: 标识符切片，如果解析失败返回nil
+func (p *Parser) parsePatternNames(end token.TokenType) []*ast.Identifier {
+	names := []*ast.Identifier{}
+
+	// 空模式没有意义，直接报错
+	if p.peekTokenIs(end) {
+		p.addError("destructuring pattern must bind at least one name")
+		return nil
+	}
+
+	for {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		names = append(names, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	// 期望模式结束token
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return names
+}
+
 // parseReturnStatement 解析return语句：return <expression>;
 // 返回值: ReturnStatement节点
-func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+func (p *Parser) parseReturnStatement() ast.Statement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
+	// 不带返回值的 return; ，ReturnValue保持为nil，求值时返回NULL
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		return stmt
+	}
+	if p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) {
+		return stmt
+	}
+
 	p.nextToken()
 
 	// 解析返回值表达式
@@ -241,9 +654,37 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+// parseBreakStatement 解析break语句：break;
+// 语法分析阶段不检查break是否位于循环中，循环之外的break在求值时报错
+// 返回值: BreakStatement节点
+func (p *Parser) parseBreakStatement() ast.Statement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+
+	// 可选的分号
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseContinueStatement 解析continue语句：continue;
+// 与break一样，循环之外的continue在求值时报错
+// 返回值: ContinueStatement节点
+func (p *Parser) parseContinueStatement() ast.Statement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+
+	// 可选的分号
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 // parseExpressionStatement 解析表达式语句：<expression>;
 // 返回值: ExpressionStatement节点
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+func (p *Parser) parseExpressionStatement() ast.Statement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
 	// 解析表达式
@@ -261,6 +702,20 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 // 参数 precedence: 当前优先级，控制运算符绑定
 // 返回值: 解析出的表达式节点
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	if p.halted {
+		return nil
+	}
+
+	// 所有嵌套的表达式（分组、前缀、函数体、数组元素等）都会递归经过这里，
+	// 在此统一限制嵌套深度
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > p.maxDepth {
+		p.addError(fmt.Sprintf("expression nesting exceeds maximum depth of %d", p.maxDepth))
+		p.halted = true
+		return nil
+	}
+
 	// 获取当前token对应的前缀解析函数
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
@@ -270,7 +725,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	leftExp := prefix()
 
 	// 循环处理中缀表达式，直到遇到分号或优先级不足
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+	for !p.halted && !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -287,7 +742,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 // peekPrecedence 获取下一个token的优先级
 // 返回值: 下一个token的优先级，如果未定义则返回LOWEST
 func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
+	if p, ok := p.precedences[p.peekToken.Type]; ok {
 		return p
 	}
 
@@ -297,7 +752,7 @@ func (p *Parser) peekPrecedence() int {
 // curPrecedence 获取当前token的优先级
 // 返回值: 当前token的优先级，如果未定义则返回LOWEST
 func (p *Parser) curPrecedence() int {
-	if p, ok := precedences[p.curToken.Type]; ok {
+	if p, ok := p.precedences[p.curToken.Type]; ok {
 		return p
 	}
 
@@ -310,6 +765,18 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseFloatLiteral 解析浮点数字面量表达式
+// 返回值: FloatLiteral节点，如果解析失败返回nil
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.addError(fmt.Sprintf("could not parse %q as float", p.curToken.Literal))
+		return nil
+	}
+
+	return &ast.FloatLiteral{Token: p.curToken, Value: value}
+}
+
 // parseIntegerLiteral 解析整数字面量表达式
 // 返回值: IntegerLiteral节点，如果解析失败返回nil
 func (p *Parser) parseIntegerLiteral() ast.Expression {
@@ -319,7 +786,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(msg)
 		return nil
 	}
 
@@ -331,7 +798,131 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 // parseStringLiteral 解析字符串字面量表达式
 // 返回值: StringLiteral节点
 func (p *Parser) parseStringLiteral() ast.Expression {
-	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	value, err := lexer.Unescape(p.curToken.Literal)
+	if err != nil {
+		p.addError(err.Error())
+		return nil
+	}
+	return &ast.StringLiteral{Token: p.curToken, Value: value}
+}
+
+// parseUnterminatedString 处理缺少结束双引号的字符串
+// 补充输入后字符串可能闭合，因此标记为输入不完整
+// 返回值: 总是nil
+func (p *Parser) parseUnterminatedString() ast.Expression {
+	p.addError("unterminated string literal")
+	p.incomplete = true
+	return nil
+}
+
+// parseInterpolatedString 解析插值字符串 "a ${x} b"
+// 展开为以TEMPLATE token为标记、向左嵌套的 + 表达式链 (("a " + x) + " b")，
+// 求值器把嵌入的值转换为字符串后拼接；以插值开头时链从空字符串开始，保证结果是字符串拼接
+// 返回值: InfixExpression节点，如果插值有误返回nil
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	tok := p.curToken
+
+	parts, ok := lexer.SplitTemplate(tok.Literal)
+	if !ok {
+		p.addError(fmt.Sprintf("unterminated interpolation in string %q", tok.Literal))
+		return nil
+	}
+
+	var exp ast.Expression
+	for _, part := range parts {
+		var operand ast.Expression
+		if part.IsExpr {
+			operand = p.parseInterpolation(tok, part)
+			if operand == nil {
+				return nil
+			}
+		} else {
+			text, err := lexer.Unescape(part.Text)
+			if err != nil {
+				p.addError(err.Error())
+				return nil
+			}
+			operand = templateText(templatePartToken(tok, part), text)
+		}
+
+		if exp == nil {
+			if !part.IsExpr {
+				exp = operand
+				continue
+			}
+			// 开头的空字符串不对应源代码中的文本，位置取字符串开头的双引号
+			start := tok
+			start.Length = 0
+			exp = templateText(start, "")
+		}
+		exp = &ast.InfixExpression{Token: tok, Operator: "+", Left: exp, Right: operand}
+	}
+
+	return exp
+}
+
+// parseInterpolation 解析 ${...} 中的表达式源码
+// 解析期间把token来源临时换成插值内容的词法分析器，解析完再恢复，
+// 这样插值中的表达式使用与外层相同的解析函数、优先级和嵌套深度，token的位置也相对于整个源代码
+// 参数 tok: 插值字符串的TEMPLATE token
+// 参数 part: 插值片段
+// 返回值: 表达式节点，如果插值为空或解析失败返回nil
+func (p *Parser) parseInterpolation(tok token.Token, part lexer.TemplatePart) ast.Expression {
+	if strings.TrimSpace(part.Text) == "" {
+		p.addError("empty interpolation in string")
+		return nil
+	}
+
+	l, curToken, peekToken, incomplete := p.l, p.curToken, p.peekToken, p.incomplete
+	errorCount := len(p.errors)
+
+	start := templatePartToken(tok, part)
+	p.l = lexer.NewAt(part.Text, start.Line, start.Column, start.Offset)
+	p.nextToken()
+	p.nextToken()
+
+	exp := p.parseExpression(LOWEST)
+	if len(p.errors) == errorCount && !p.peekTokenIs(token.EOF) {
+		p.addError(fmt.Sprintf("unexpected %s in string interpolation", p.peekToken.Type))
+	}
+
+	// 插值中遇到的EOF只是插值内容的结尾，不表示外层输入不完整
+	p.l, p.curToken, p.peekToken, p.incomplete = l, curToken, peekToken, incomplete
+	if len(p.errors) > errorCount || p.halted {
+		return nil
+	}
+
+	return exp
+}
+
+// templateText 创建插值字符串中的文本片段
+// 使用TEMPLATE token标记，以便String()还原插值写法时与嵌入的字符串表达式区分
+// 参数 tok: 提供文本片段位置的token
+// 参数 text: 解释转义序列后的文本
+func templateText(tok token.Token, text string) *ast.StringLiteral {
+	tok.Type = token.TEMPLATE
+	tok.Literal = text
+	return &ast.StringLiteral{Token: tok, Value: text}
+}
+
+// templatePartToken 返回记录插值片段在源代码中位置的token
+// 字面值从TEMPLATE token开头的双引号之后开始，片段之前的换行使行号增加、列号重新计数
+// 参数 tok: 插值字符串的TEMPLATE token
+// 参数 part: 插值片段
+// 返回值: 行号、列号、字节偏移量和长度对应片段原文的token
+func templatePartToken(tok token.Token, part lexer.TemplatePart) token.Token {
+	before := tok.Literal[:part.Offset]
+	start := token.Token{
+		Type:   token.TEMPLATE,
+		Line:   tok.Line + strings.Count(before, "\n"),
+		Column: tok.Column + 1 + len(before),
+		Offset: tok.Offset + 1 + len(before),
+		Length: len(part.Text),
+	}
+	if i := strings.LastIndex(before, "\n"); i >= 0 {
+		start.Column = len(before) - i
+	}
+	return start
 }
 
 // parsePrefixExpression 解析前缀表达式（如!true, -5）
@@ -369,6 +960,29 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseAssignExpression 解析赋值表达式（如 x = x + 1）
+// 赋值是右结合的，右侧以低于赋值的优先级解析，因此 a = b = 1 解析为 a = (b = 1)
+// 参数 left: 等号左侧已解析的表达式，必须是标识符或索引表达式（包括 h.key 形式）
+// 返回值: AssignExpression节点，赋值目标不合法时返回nil
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{Token: p.curToken, Target: left}
+
+	switch left.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	case nil:
+		// 左侧解析失败，错误已经记录
+		return nil
+	default:
+		p.addError(fmt.Sprintf("invalid assignment target: %s", left.String()))
+		return nil
+	}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGN - 1)
+
+	return expression
+}
+
 // parseBoolean 解析布尔值表达式
 // 返回值: Boolean节点，值为当前token是否为TRUE
 func (p *Parser) parseBoolean() ast.Expression {
@@ -422,6 +1036,26 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	if p.peekTokenIs(token.ELSE) {
 		p.nextToken()
 
+		// else if：递归解析后续的if表达式，并把它包装成只含一条语句的语句块，
+		// 这样求值器无需任何改动即可按顺序依次判断各个分支
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			ifToken := p.curToken
+
+			nested := p.parseIfExpression()
+			if nested == nil {
+				return nil
+			}
+
+			expression.Alternative = &ast.BlockStatement{
+				Token: ifToken,
+				Statements: []ast.Statement{
+					&ast.ExpressionStatement{Token: ifToken, Expression: nested},
+				},
+			}
+			return expression
+		}
+
 		// 期望左花括号
 		if !p.expectPeek(token.LBRACE) {
 			return nil
@@ -434,6 +1068,189 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// parseWhileExpression 解析while循环表达式
+// 返回值: WhileExpression节点
+func (p *Parser) parseWhileExpression() ast.Expression {
+	expression := &ast.WhileExpression{Token: p.curToken}
+
+	// 期望左括号
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	// 解析循环条件
+	expression.Condition = p.parseExpression(LOWEST)
+
+	// 期望右括号
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	// 期望左花括号
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	// 解析循环体
+	expression.Body = p.parseBlockStatement()
+
+	return expression
+}
+
+// parseSwitchExpression 解析switch多分支表达式
+// case分支可以有多个用逗号分隔的值，default分支最多一个，可以出现在任意位置
+// 返回值: SwitchExpression节点
+func (p *Parser) parseSwitchExpression() ast.Expression {
+	expression := &ast.SwitchExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Subject = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		switch p.curToken.Type {
+		case token.CASE:
+			c := ast.SwitchCase{Token: p.curToken}
+			p.nextToken()
+			c.Values = []ast.Expression{p.parseExpression(LOWEST)}
+			for p.peekTokenIs(token.COMMA) {
+				p.nextToken()
+				p.nextToken()
+				c.Values = append(c.Values, p.parseExpression(LOWEST))
+			}
+			if !p.expectPeek(token.LBRACE) {
+				return nil
+			}
+			c.Body = p.parseBlockStatement()
+			expression.Cases = append(expression.Cases, c)
+
+		case token.DEFAULT:
+			if expression.Default != nil {
+				p.addError("duplicate default in switch")
+				return nil
+			}
+			if !p.expectPeek(token.LBRACE) {
+				return nil
+			}
+			expression.Default = p.parseBlockStatement()
+
+		case token.EOF:
+			p.addError("expected case, default or } in switch, got EOF instead")
+			p.incomplete = true
+			return nil
+
+		default:
+			p.addError(fmt.Sprintf("expected case, default or } in switch, got %s instead",
+				p.curToken.Type))
+			return nil
+		}
+	}
+	p.nextToken()
+	expression.RBrace = p.curToken
+
+	return expression
+}
+
+// parseTryExpression 解析try/rescue错误处理表达式
+// rescue分支不能省略，括号中必须是一个标识符
+// 返回值: TryExpression节点
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Body = p.parseBlockStatement()
+
+	if !p.expectPeek(token.RESCUE) {
+		return nil
+	}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Rescue = p.parseBlockStatement()
+
+	return expression
+}
+
+// parseForExpression 解析C风格的for循环表达式
+// 括号内的初始化语句、条件和后置表达式都可以省略，但两个分号必须保留，如 for (;;)
+// 返回值: ForExpression节点
+func (p *Parser) parseForExpression() ast.Expression {
+	expression := &ast.ForExpression{Token: p.curToken}
+
+	// 期望左括号
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	// 初始化语句：let语句和表达式语句都会消耗结尾可选的分号
+	p.nextToken()
+	if !p.curTokenIs(token.SEMICOLON) {
+		if p.curTokenIs(token.LET) {
+			expression.Init = p.parseLetStatement()
+		} else {
+			expression.Init = p.parseExpressionStatement()
+		}
+		if expression.Init == nil {
+			return nil
+		}
+		if !p.curTokenIs(token.SEMICOLON) {
+			p.peekError(token.SEMICOLON)
+			return nil
+		}
+	}
+
+	// 循环条件
+	if !p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		expression.Condition = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+
+	// 后置表达式
+	if !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		expression.Post = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	// 期望左花括号
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	// 解析循环体
+	expression.Body = p.parseBlockStatement()
+
+	return expression
+}
+
 // parseBlockStatement 解析语句块（由花括号包围的语句序列）
 // 返回值: BlockStatement节点
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
@@ -442,15 +1259,32 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 
 	p.nextToken()
 
-	// 循环解析语句，直到遇到右花括号或EOF
-	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+	// 循环解析语句，直到遇到右花括号、EOF或解析被中止
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) && !p.halted {
+		errCount := len(p.errors)
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if len(p.errors) > errCount {
+			// 与ParseProgram一致：丢弃出错的语句并进行错误恢复
+			p.synchronize()
+			// 出错的表达式可能已经消耗了语句块的右花括号
+			if p.curTokenIs(token.RBRACE) {
+				break
+			}
+		} else if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 		p.nextToken()
 	}
 
+	// 在右花括号之前遇到EOF，语句块没有结束
+	if p.curTokenIs(token.EOF) {
+		p.addError(fmt.Sprintf("expected next token to be %s, got %s instead",
+			token.RBRACE, token.EOF))
+		p.incomplete = true
+	} else if p.curTokenIs(token.RBRACE) {
+		block.RBrace = p.curToken
+	}
+
 	return block
 }
 
@@ -478,6 +1312,24 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
+// parseMacroLiteral 解析宏字面量表达式，写法与函数字面量相同
+// 返回值: MacroLiteral节点
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	lit.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
 // parseFunctionParameters 解析函数参数列表
 // 返回值: 参数标识符切片
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
@@ -489,16 +1341,23 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		return identifiers
 	}
 
-	p.nextToken()
-
-	// 解析第一个参数
+	// 解析第一个参数，参数必须是标识符
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	identifiers = append(identifiers, ident)
 
 	// 循环解析逗号分隔的后续参数
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
-		p.nextToken()
+		// 允许参数列表末尾出现多余的逗号
+		if p.peekTokenIs(token.RPAREN) {
+			break
+		}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 		identifiers = append(identifiers, ident)
 	}
@@ -518,6 +1377,8 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	// 解析参数列表
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	// 列表解析成功时当前token就是右括号
+	exp.RParen = p.curToken
 	return exp
 }
 
@@ -535,13 +1396,17 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 
 	p.nextToken()
 	// 解析第一个表达式
-	list = append(list, p.parseExpression(LOWEST))
+	list = append(list, p.parseListElement(end))
 
 	// 循环解析逗号分隔的后续表达式
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
+		// 允许列表末尾出现多余的逗号，如 [1, 2, ]
+		if p.peekTokenIs(end) {
+			break
+		}
 		p.nextToken()
-		list = append(list, p.parseExpression(LOWEST))
+		list = append(list, p.parseListElement(end))
 	}
 
 	// 期望结束token
@@ -552,29 +1417,113 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return list
 }
 
+// parseListElement 解析表达式列表中的单个元素
+// 函数调用的实参（以右圆括号结束的列表）可以带 ... 后缀，表示展开数组实参
+// 参数 end: 列表结束的token类型
+// 返回值: 元素表达式，带展开后缀时返回SpreadExpression节点
+func (p *Parser) parseListElement(end token.TokenType) ast.Expression {
+	exp := p.parseExpression(LOWEST)
+
+	if end == token.RPAREN && p.peekTokenIs(token.ELLIPSIS) {
+		p.nextToken()
+		return &ast.SpreadExpression{Token: p.curToken, Value: exp}
+	}
+
+	return exp
+}
+
 // parseArrayLiteral 解析数组字面量表达式
 // 返回值: ArrayLiteral节点
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 	// 解析数组元素列表
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.RBracket = p.curToken
 	return array
 }
 
-// parseIndexExpression 解析数组索引表达式
+// parseIndexExpression 解析数组索引表达式，方括号中带冒号时解析为切片表达式
 // 参数 left: 数组表达式
-// 返回值: IndexExpression节点
+// 返回值: IndexExpression或SliceExpression节点
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	tok := p.curToken
 
 	p.nextToken()
+	// 以冒号开头是省略了起始下标的切片 left[:high]
+	if p.curTokenIs(token.COLON) {
+		return p.parseSliceExpression(tok, left, nil)
+	}
+
+	exp := &ast.IndexExpression{Token: tok, Left: left}
 	// 解析索引表达式
 	exp.Index = p.parseExpression(LOWEST)
 
+	// 索引后面跟着冒号时是切片 left[low:high]
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(tok, left, exp.Index)
+	}
+
 	// 期望右方括号
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	exp.RBracket = p.curToken
+
+	return exp
+}
+
+// parseSliceExpression 解析切片表达式冒号之后的部分，调用时当前token是冒号
+// 参数 tok: 左方括号的词法标记
+// 参数 left: 被切片的表达式
+// 参数 low: 已解析的起始下标，省略时为nil
+// 返回值: SliceExpression节点，如果缺少右方括号返回nil
+func (p *Parser) parseSliceExpression(tok token.Token, left, low ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, Left: left, Low: low}
+
+	// 冒号后直接是右方括号时省略了结束下标
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.High = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	exp.RBracket = p.curToken
+
+	return exp
+}
+
+// parseDotExpression 解析成员访问表达式 hash.key 和方法调用 recv.f(args)
+// hash.key 是 hash["key"] 的语法糖：点号右侧必须是标识符，
+// 解析结果是以该标识符名称为字符串索引的IndexExpression，求值器无需额外处理
+// recv.f(args) 是 f(recv, args) 的语法糖：标识符后紧跟调用时，接收者作为第一个实参；
+// 要调用哈希中保存的函数需写成 (hash.f)(args)
+// 参数 left: 点号左侧的表达式
+// 返回值: IndexExpression或CallExpression节点，如果点号后不是标识符返回nil
+func (p *Parser) parseDotExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	// 期望点号后是标识符
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.LPAREN) {
+		function := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		p.nextToken()
+		call := &ast.CallExpression{Token: p.curToken, Function: function}
+		args := p.parseExpressionList(token.RPAREN)
+		if args == nil {
+			return nil
+		}
+		call.Arguments = append([]ast.Expression{left}, args...)
+		call.RParen = p.curToken
+		return call
+	}
+
+	exp.Index = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 
 	return exp
 }
@@ -583,13 +1532,20 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 // 返回值: HashLiteral节点
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.curToken}
-	hash.Pairs = make(map[ast.Expression]ast.Expression)
+	hash.Pairs = []ast.HashPair{}
 
 	// 循环解析键值对，直到遇到右花括号
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
 		// 解析键表达式
-		key := p.parseExpression(LOWEST)
+		var key ast.Expression
+		if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COLON) {
+			// 裸标识符键 {name: 1} 是 {"name": 1} 的语法糖
+			// 保留IDENT token，使String()仍输出不带引号的写法
+			key = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+		} else {
+			key = p.parseExpression(LOWEST)
+		}
 
 		// 期望冒号分隔符
 		if !p.expectPeek(token.COLON) {
@@ -600,9 +1556,10 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		// 解析值表达式
 		value := p.parseExpression(LOWEST)
 
-		hash.Pairs[key] = value
+		p.checkDuplicateHashKey(hash.Pairs, key)
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
 
-		// 处理逗号分隔或结束
+		// 处理逗号分隔或结束，逗号后紧跟右花括号（末尾多余的逗号）时由循环条件结束
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
 		}
@@ -612,20 +1569,82 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.RBrace = p.curToken
 
 	return hash
 }
 
-// registerPrefix 注册前缀解析函数
+// checkDuplicateHashKey 检查字面量键是否与之前的键重复，重复时记录解析错误
+// 只检查字符串、整数和布尔字面量，计算出来的键要到求值时才知道，无法检查
+// 参数 pairs: 已解析的键值对
+// 参数 key: 新解析出的键表达式
+func (p *Parser) checkDuplicateHashKey(pairs []ast.HashPair, key ast.Expression) {
+	name, ok := literalHashKey(key)
+	if !ok {
+		return
+	}
+
+	for _, pair := range pairs {
+		if other, ok := literalHashKey(pair.Key); ok && other == name {
+			p.addError(fmt.Sprintf("duplicate key %s in hash literal", name))
+			return
+		}
+	}
+}
+
+// literalHashKey 返回字面量键的规范表示，用于比较两个键是否相同
+// 字符串带引号，因此 "1" 和 1 不会被视为同一个键
+// 参数 key: 键表达式
+// 返回值: 规范表示，以及key是否为可检查的字面量
+func literalHashKey(key ast.Expression) (string, bool) {
+	switch key := key.(type) {
+	case *ast.StringLiteral:
+		return strconv.Quote(key.Value), true
+	case *ast.IntegerLiteral:
+		return strconv.FormatInt(key.Value, 10), true
+	case *ast.Boolean:
+		return strconv.FormatBool(key.Value), true
+	default:
+		return "", false
+	}
+}
+
+// RegisterPrefix 注册前缀解析函数，已注册的同类型解析函数会被替换
+// 只影响当前Parser，嵌入方可借此支持自定义的token类型
 // 参数 tokenType: token类型
 // 参数 fn: 对应的解析函数
-func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
+func (p *Parser) RegisterPrefix(tokenType token.TokenType, fn PrefixParseFn) {
 	p.prefixParseFns[tokenType] = fn
 }
 
-// registerInfix 注册中缀解析函数
+// RegisterInfix 注册中缀解析函数，已注册的同类型解析函数会被替换
+// 中缀运算符还需要通过SetPrecedence设置优先级，否则按LOWEST处理而不会被调用
 // 参数 tokenType: token类型
 // 参数 fn: 对应的解析函数
-func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
+func (p *Parser) RegisterInfix(tokenType token.TokenType, fn InfixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
+
+// SetPrecedence 设置token作为中缀运算符时的优先级
+// 参数 tokenType: token类型
+// 参数 precedence: 优先级，取LOWEST到INDEX之间的常量
+func (p *Parser) SetPrecedence(tokenType token.TokenType, precedence int) {
+	p.precedences[tokenType] = precedence
+}
+
+// CurToken 返回当前处理的token，供自定义解析函数使用
+func (p *Parser) CurToken() token.Token {
+	return p.curToken
+}
+
+// NextToken 前进到下一个token，供自定义解析函数使用
+func (p *Parser) NextToken() {
+	p.nextToken()
+}
+
+// ParseExpression 按给定优先级解析一个表达式，供自定义解析函数解析操作数
+// 参数 precedence: 当前上下文的优先级
+// 返回值: 解析出的表达式节点
+func (p *Parser) ParseExpression(precedence int) ast.Expression {
+	return p.parseExpression(precedence)
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"monkey/token"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -41,6 +44,267 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedNames []string
+		isHash        bool
+		expected      string
+	}{
+		{"let [a, b] = pair;", []string{"a", "b"}, false, "let [a, b] = pair;"},
+		{"let [x] = [1, 2]", []string{"x"}, false, "let [x] = [1, 2];"},
+		{"let {name, age} = person;", []string{"name", "age"}, true,
+			"let {name, age} = person;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.LetStatement. got=%T", program.Statements[0])
+		}
+
+		var names []*ast.Identifier
+		if tt.isHash {
+			pattern, ok := stmt.Pattern.(*ast.HashPattern)
+			if !ok {
+				t.Fatalf("stmt.Pattern not *ast.HashPattern. got=%T", stmt.Pattern)
+			}
+			names = pattern.Names
+		} else {
+			pattern, ok := stmt.Pattern.(*ast.ArrayPattern)
+			if !ok {
+				t.Fatalf("stmt.Pattern not *ast.ArrayPattern. got=%T", stmt.Pattern)
+			}
+			names = pattern.Names
+		}
+
+		if len(names) != len(tt.expectedNames) {
+			t.Fatalf("wrong number of names. want=%d, got=%d",
+				len(tt.expectedNames), len(names))
+		}
+
+		for i, name := range tt.expectedNames {
+			testIdentifier(t, names[i], name)
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. expected=%q, got=%q",
+				tt.expected, program.String())
+		}
+	}
+}
+
+func TestDestructuringLetStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [] = pair;", "destructuring pattern must bind at least one name"},
+		{"let [a, 1] = pair;", "expected next token to be IDENT, got INT instead"},
+		{"let {a b} = pair;", "expected next token to be }, got IDENT instead"},
+		{"let [a, [b]] = pair;", "expected next token to be IDENT, got [ instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q, got none", tt.input)
+			continue
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q",
+				tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestLetStatementsWithoutValue(t *testing.T) {
+	l := lexer.New("let x; let y")
+	p := New(l)
+	program := p.ParseProgram()
+
+	// let x; 合法，而缺少分号和初始值的 let y 仍然是错误
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("wrong number of errors. want=1, got=%d (%q)", len(errors), errors)
+	}
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt := program.Statements[0]
+	if !testLetStatement(t, stmt, "x") {
+		return
+	}
+
+	if val := stmt.(*ast.LetStatement).Value; val != nil {
+		t.Errorf("stmt.Value is not nil. got=%T (%+v)", val, val)
+	}
+
+	if stmt.String() != "let x;" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedName  string
+		expectedValue interface{}
+		expected      string
+	}{
+		{"const x = 5;", "x", 5, "const x = 5;"},
+		{"const flag = true", "flag", true, "const flag = true;"},
+		{"const name = y;", "name", "y", "const name = y;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.LetStatement. got=%T", program.Statements[0])
+		}
+		if !stmt.IsConst() {
+			t.Errorf("stmt.IsConst() is false")
+		}
+		if stmt.TokenLiteral() != "const" {
+			t.Errorf("stmt.TokenLiteral not 'const'. got=%q", stmt.TokenLiteral())
+		}
+		testIdentifier(t, stmt.Name, tt.expectedName)
+		testLiteralExpression(t, stmt.Value, tt.expectedValue)
+
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+
+	// 常量与同名的let声明不相等
+	constProgram := New(lexer.New("const x = 5;")).ParseProgram()
+	letProgram := New(lexer.New("let x = 5;")).ParseProgram()
+	if ast.Equal(constProgram, letProgram) {
+		t.Errorf("const statement equal to let statement")
+	}
+
+	// 常量必须有初始值，也不支持解构
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"const x;", "expected next token to be =, got ; instead"},
+		{"const [a] = [1];", "expected next token to be IDENT, got [ instead"},
+	}
+
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("%q: expected parser errors, got none", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestMultiLetStatements(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedNames []string
+		expected      string
+	}{
+		{"let a, b = 1, 2;", []string{"a", "b"}, "let a, b = 1, 2;"},
+		{"let x, y, z = 1 + 2, f(3), [4]", []string{"x", "y", "z"}, "let x, y, z = (1 + 2), f(3), [4];"},
+		{"let a, b = b, a;", []string{"a", "b"}, "let a, b = b, a;"},
+		{"let a, b;", []string{"a", "b"}, "let a, b;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.MultiLetStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.MultiLetStatement. got=%T", program.Statements[0])
+		}
+
+		if len(stmt.Names) != len(tt.expectedNames) {
+			t.Fatalf("wrong number of names. want=%d, got=%d",
+				len(tt.expectedNames), len(stmt.Names))
+		}
+		for i, name := range tt.expectedNames {
+			testIdentifier(t, stmt.Names[i], name)
+		}
+
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestMultiLetStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a, b = 1;", "let statement declares 2 names but has 1 values"},
+		{"let a, b = 1, 2, 3;", "let statement declares 2 names but has 3 values"},
+		{"let a, a = 1, 2;", "duplicate name a in let statement"},
+		{"let a, 1 = 1, 2;", "expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("wrong number of errors for %q. want=1, got=%d (%q)",
+				tt.input, len(errors), errors)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -77,6 +341,38 @@ func TestReturnStatements(t *testing.T) {
 	}
 }
 
+func TestBareReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"return;", "return;"},
+		{"return", "return;"},
+		{"fn() { return }", "fn() { return; }"},
+		{"fn() { if (x) { return; } x }", "fn() { if (x) { return; }; x }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	program := New(lexer.New("return;")).ParseProgram()
+	returnStmt, ok := program.Statements[0].(*ast.ReturnStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ReturnStatement. got=%T", program.Statements[0])
+	}
+	if returnStmt.ReturnValue != nil {
+		t.Errorf("returnStmt.ReturnValue is not nil. got=%T", returnStmt.ReturnValue)
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar;"
 
@@ -108,6 +404,46 @@ func TestIdentifierExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+		literal  string
+	}{
+		{"3.14;", 3.14, "3.14"},
+		{"0.5;", 0.5, "0.5"},
+		{"10.0;", 10.0, "10.0"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program has not enough statements. got=%d",
+				len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+		if literal.TokenLiteral() != tt.literal {
+			t.Errorf("literal.TokenLiteral not %s. got=%s", tt.literal,
+				literal.TokenLiteral())
+		}
+	}
+}
+
 func TestIntegerLiteralExpression(t *testing.T) {
 	input := "5;"
 
@@ -195,14 +531,21 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 - 5;", 5, "-", 5},
 		{"5 * 5;", 5, "*", 5},
 		{"5 / 5;", 5, "/", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 // 5;", 5, "//", 5},
 		{"5 > 5;", 5, ">", 5},
 		{"5 < 5;", 5, "<", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"true && false;", true, "&&", false},
+		{"true || false;", true, "||", false},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
 		{"foobar + barfoo;", "foobar", "+", "barfoo"},
 		{"foobar - barfoo;", "foobar", "-", "barfoo"},
 		{"foobar * barfoo;", "foobar", "*", "barfoo"},
 		{"foobar / barfoo;", "foobar", "/", "barfoo"},
+		{"foobar % barfoo;", "foobar", "%", "barfoo"},
 		{"foobar > barfoo;", "foobar", ">", "barfoo"},
 		{"foobar < barfoo;", "foobar", "<", "barfoo"},
 		{"foobar == barfoo;", "foobar", "==", "barfoo"},
@@ -249,6 +592,46 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"!-a",
 			"(!(-a))",
 		},
+		{
+			"5 <= 4 != 3 >= 4",
+			"((5 <= 4) != (3 >= 4))",
+		},
+		{
+			"a + b >= c * d",
+			"((a + b) >= (c * d))",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"x = y + 1 * z",
+			"(x = (y + (1 * z)))",
+		},
+		{
+			"a = b = c || d",
+			"(a = (b = (c || d)))",
+		},
+		{
+			`h["count"] = h["count"] + 1`,
+			`((h["count"]) = ((h["count"]) + 1))`,
+		},
+		{
+			"h.a = b.c = 1",
+			"((h.a) = ((b.c) = 1))",
+		},
+		{
+			"f(x = 1)",
+			"f((x = 1))",
+		},
+		{
+			"!a && b == c || x < y",
+			"(((!a) && (b == c)) || (x < y))",
+		},
 		{
 			"a + b + c",
 			"((a + b) + c)",
@@ -269,13 +652,41 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a + b / c",
 			"(a + (b / c))",
 		},
+		{
+			"a + b % c",
+			"(a + (b % c))",
+		},
+		{
+			"a % b * c",
+			"((a % b) * c)",
+		},
+		{
+			"a * b % c",
+			"((a * b) % c)",
+		},
+		{
+			"-a % b",
+			"((-a) % b)",
+		},
+		{
+			"a % b == c % d",
+			"((a % b) == (c % d))",
+		},
+		{
+			"a + b // c",
+			"(a + (b // c))",
+		},
+		{
+			"a // b * c / d",
+			"(((a // b) * c) / d)",
+		},
 		{
 			"a + b * c + d / e - f",
 			"(((a + (b * c)) + (d / e)) - f)",
 		},
 		{
 			"3 + 4; -5 * 5",
-			"(3 + 4)((-5) * 5)",
+			"(3 + 4); ((-5) * 5)",
 		},
 		{
 			"5 > 4 == 3 < 4",
@@ -349,35 +760,103 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
-	}
-
-	for _, tt := range tests {
-		l := lexer.New(tt.input)
-		p := New(l)
-		program := p.ParseProgram()
-		checkParserErrors(t, p)
-
-		actual := program.String()
-		if actual != tt.expected {
-			t.Errorf("expected=%q, got=%q", tt.expected, actual)
-		}
-	}
-}
-
-func TestBooleanExpression(t *testing.T) {
-	tests := []struct {
-		input           string
-		expectedBoolean bool
-	}{
-		{"true;", true},
-		{"false;", false},
-	}
-
-	for _, tt := range tests {
-		l := lexer.New(tt.input)
-		p := New(l)
-		program := p.ParseProgram()
-		checkParserErrors(t, p)
+		{
+			"a[1:2]",
+			"(a[1:2])",
+		},
+		{
+			"a[:2] + a[2:] + a[:]",
+			"(((a[:2]) + (a[2:])) + (a[:]))",
+		},
+		{
+			"a[b + 1:len(a) - 1][0]",
+			"((a[(b + 1):(len(a) - 1)])[0])",
+		},
+		{
+			"a.b",
+			"(a.b)",
+		},
+		{
+			"a.b.c",
+			"((a.b).c)",
+		},
+		{
+			"a.b + c.d * e",
+			"((a.b) + ((c.d) * e))",
+		},
+		{
+			"-a.b",
+			"(-(a.b))",
+		},
+		{
+			"obj.f(1)",
+			"f(obj, 1)",
+		},
+		{
+			"obj.f(1).g",
+			"(f(obj, 1).g)",
+		},
+		{
+			"(obj.f)(1)",
+			"(obj.f)(1)",
+		},
+		{
+			"arr.filter(f).map(g)",
+			"map(filter(arr, f), g)",
+		},
+		{
+			"a.b.c()",
+			"c((a.b))",
+		},
+		{
+			"-arr.len() * 2",
+			"((-len(arr)) * 2)",
+		},
+		{
+			"a.b[c].d",
+			"(((a.b)[c]).d)",
+		},
+		{
+			"add(a, b..., c)",
+			"add(a, b..., c)",
+		},
+		{
+			"add(a + b...)",
+			"add((a + b)...)",
+		},
+		{
+			"add(f(x)..., a.b...)",
+			"add(f(x)..., (a.b)...)",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedBoolean bool
+	}{
+		{"true;", true},
+		{"false;", false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
 
 		if len(program.Statements) != 1 {
 			t.Fatalf("program has not enough statements. got=%d",
@@ -450,8 +929,8 @@ func TestIfExpression(t *testing.T) {
 	}
 }
 
-func TestIfElseExpression(t *testing.T) {
-	input := `if (x < y) { x } else { y }`
+func TestWhileExpression(t *testing.T) {
+	input := `while (x < y) { x }`
 
 	l := lexer.New(input)
 	p := New(l)
@@ -469,128 +948,206 @@ func TestIfElseExpression(t *testing.T) {
 			program.Statements[0])
 	}
 
-	exp, ok := stmt.Expression.(*ast.IfExpression)
+	exp, ok := stmt.Expression.(*ast.WhileExpression)
 	if !ok {
-		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+		t.Fatalf("stmt.Expression is not ast.WhileExpression. got=%T",
+			stmt.Expression)
 	}
 
 	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
 		return
 	}
 
-	if len(exp.Consequence.Statements) != 1 {
-		t.Errorf("consequence is not 1 statements. got=%d\n",
-			len(exp.Consequence.Statements))
+	if len(exp.Body.Statements) != 1 {
+		t.Fatalf("body is not 1 statements. got=%d\n",
+			len(exp.Body.Statements))
 	}
 
-	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	body, ok := exp.Body.Statements[0].(*ast.ExpressionStatement)
 	if !ok {
 		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
-			exp.Consequence.Statements[0])
-	}
-
-	if !testIdentifier(t, consequence.Expression, "x") {
-		return
+			exp.Body.Statements[0])
 	}
 
-	if len(exp.Alternative.Statements) != 1 {
-		t.Errorf("exp.Alternative.Statements does not contain 1 statements. got=%d\n",
-			len(exp.Alternative.Statements))
-	}
+	testIdentifier(t, body.Expression, "x")
+}
 
-	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
-	if !ok {
-		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
-			exp.Alternative.Statements[0])
+func TestForExpression(t *testing.T) {
+	tests := []struct {
+		input     string
+		init      string
+		condition string
+		post      string
+	}{
+		{"for (let i = 0; i < 10; i = i + 1) { i }", "let i = 0;", "(i < 10)", "(i = (i + 1))"},
+		{"for (i = 0; i < 10; i = i + 1) { i }", "(i = 0)", "(i < 10)", "(i = (i + 1))"},
+		{"for (; i < 10;) { i }", "", "(i < 10)", ""},
+		{"for (;;) { i }", "", "", ""},
+		{"for (let i = 0;;) { i }", "let i = 0;", "", ""},
 	}
 
-	if !testIdentifier(t, alternative.Expression, "y") {
-		return
-	}
-}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
 
-func TestFunctionLiteralParsing(t *testing.T) {
-	input := `fn(x, y) { x + y; }`
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+				1, len(program.Statements))
+		}
 
-	l := lexer.New(input)
-	p := New(l)
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
 
-	if len(program.Statements) != 1 {
-		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
-			1, len(program.Statements))
-	}
+		exp, ok := stmt.Expression.(*ast.ForExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.ForExpression. got=%T",
+				stmt.Expression)
+		}
 
-	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
-	if !ok {
-		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
-			program.Statements[0])
-	}
+		parts := []struct {
+			name     string
+			node     ast.Node
+			expected string
+		}{
+			{"init", exp.Init, tt.init},
+			{"condition", exp.Condition, tt.condition},
+			{"post", exp.Post, tt.post},
+		}
+		for _, part := range parts {
+			got := ""
+			if part.node != nil && !reflect.ValueOf(part.node).IsNil() {
+				got = part.node.String()
+			}
+			if got != part.expected {
+				t.Errorf("%q: %s wrong. want=%q, got=%q", tt.input, part.name, part.expected, got)
+			}
+		}
 
-	function, ok := stmt.Expression.(*ast.FunctionLiteral)
-	if !ok {
-		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T",
-			stmt.Expression)
+		if len(exp.Body.Statements) != 1 {
+			t.Errorf("%q: body is not 1 statements. got=%d", tt.input, len(exp.Body.Statements))
+		}
 	}
+}
 
-	if len(function.Parameters) != 2 {
-		t.Fatalf("function literal parameters wrong. want 2, got=%d\n",
-			len(function.Parameters))
+func TestForExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (let i = 0) { i }", "expected next token to be ;, got ) instead"},
+		{"for (i < 3) { i }", "expected next token to be ;, got ) instead"},
+		{"for (;; i = i + 1 { i }", "expected next token to be ), got { instead"},
+		{"for { i }", "expected next token to be (, got { instead"},
 	}
 
-	testLiteralExpression(t, function.Parameters[0], "x")
-	testLiteralExpression(t, function.Parameters[1], "y")
-
-	if len(function.Body.Statements) != 1 {
-		t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n",
-			len(function.Body.Statements))
-	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
 
-	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
-	if !ok {
-		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T",
-			function.Body.Statements[0])
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong errors. want first=%q, got=%q", tt.input, tt.expected, errors)
+		}
 	}
-
-	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
-func TestFunctionParameterParsing(t *testing.T) {
+func TestSwitchExpression(t *testing.T) {
 	tests := []struct {
-		input          string
-		expectedParams []string
+		input    string
+		subject  string
+		cases    [][]string
+		hasDflt  bool
+		expected string
 	}{
-		{input: "fn() {};", expectedParams: []string{}},
-		{input: "fn(x) {};", expectedParams: []string{"x"}},
-		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+		{"switch (x) { case 1 { a } }", "x", [][]string{{"1"}}, false,
+			"switch (x) { case 1 { a } }"},
+		{`switch (x + 1) { case 1, "two", [3] { a } case y { b } default { c } }`, "(x + 1)",
+			[][]string{{"1", `"two"`, "[3]"}, {"y"}}, true,
+			`switch ((x + 1)) { case 1, "two", [3] { a } case y { b } default { c } }`},
+		{"switch (x) { default { c } case 1 { a } }", "x", [][]string{{"1"}}, true,
+			"switch (x) { case 1 { a } default { c } }"},
+		{"switch (x) {}", "x", nil, false, "switch (x) { }"},
 	}
 
 	for _, tt := range tests {
-		l := lexer.New(tt.input)
-		p := New(l)
+		p := New(lexer.New(tt.input))
 		program := p.ParseProgram()
 		checkParserErrors(t, p)
 
-		stmt := program.Statements[0].(*ast.ExpressionStatement)
-		function := stmt.Expression.(*ast.FunctionLiteral)
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+				1, len(program.Statements))
+		}
 
-		if len(function.Parameters) != len(tt.expectedParams) {
-			t.Errorf("length parameters wrong. want %d, got=%d\n",
-				len(tt.expectedParams), len(function.Parameters))
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
 		}
 
-		for i, ident := range tt.expectedParams {
-			testLiteralExpression(t, function.Parameters[i], ident)
+		exp, ok := stmt.Expression.(*ast.SwitchExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.SwitchExpression. got=%T",
+				stmt.Expression)
+		}
+
+		if exp.Subject.String() != tt.subject {
+			t.Errorf("%q: subject wrong. want=%q, got=%q", tt.input, tt.subject, exp.Subject.String())
+		}
+		if len(exp.Cases) != len(tt.cases) {
+			t.Fatalf("%q: wrong number of cases. want=%d, got=%d", tt.input, len(tt.cases), len(exp.Cases))
+		}
+		for i, values := range tt.cases {
+			if len(exp.Cases[i].Values) != len(values) {
+				t.Fatalf("%q: case %d has wrong number of values. want=%d, got=%d",
+					tt.input, i, len(values), len(exp.Cases[i].Values))
+			}
+			for j, value := range values {
+				if got := exp.Cases[i].Values[j].String(); got != value {
+					t.Errorf("%q: case %d value %d wrong. want=%q, got=%q", tt.input, i, j, value, got)
+				}
+			}
+		}
+		if (exp.Default != nil) != tt.hasDflt {
+			t.Errorf("%q: default wrong. want=%t, got=%t", tt.input, tt.hasDflt, exp.Default != nil)
+		}
+		if got := exp.String(); got != tt.expected {
+			t.Errorf("%q: String() wrong. want=%q, got=%q", tt.input, tt.expected, got)
 		}
 	}
 }
 
-func TestCallExpressionParsing(t *testing.T) {
-	input := "add(1, 2 * 3, 4 + 5);"
+func TestSwitchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"switch x { case 1 { a } }", "expected next token to be (, got IDENT instead"},
+		{"switch (x) { case 1 a }", "expected next token to be {, got IDENT instead"},
+		{"switch (x) { a }", "expected case, default or } in switch, got IDENT instead"},
+		{"switch (x) { default { a } default { b } }", "duplicate default in switch"},
+		{"switch (x) { case 1 { a }", "expected case, default or } in switch, got EOF instead"},
+	}
 
-	l := lexer.New(input)
-	p := New(l)
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong errors. want first=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	input := `try { parse(x); 1 } rescue (err) { err.message }`
+
+	p := New(lexer.New(input))
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
@@ -601,340 +1158,2289 @@ func TestCallExpressionParsing(t *testing.T) {
 
 	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
 	if !ok {
-		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T",
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
 			program.Statements[0])
 	}
 
-	exp, ok := stmt.Expression.(*ast.CallExpression)
+	exp, ok := stmt.Expression.(*ast.TryExpression)
 	if !ok {
-		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T",
-			stmt.Expression)
+		t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T", stmt.Expression)
 	}
 
-	if !testIdentifier(t, exp.Function, "add") {
+	if len(exp.Body.Statements) != 2 {
+		t.Errorf("body is not 2 statements. got=%d", len(exp.Body.Statements))
+	}
+	if !testIdentifier(t, exp.Param, "err") {
 		return
 	}
-
-	if len(exp.Arguments) != 3 {
-		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	if len(exp.Rescue.Statements) != 1 {
+		t.Errorf("rescue is not 1 statements. got=%d", len(exp.Rescue.Statements))
 	}
 
-	testLiteralExpression(t, exp.Arguments[0], 1)
-	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
-	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
+	expected := `try { parse(x); 1 } rescue (err) { (err.message) }`
+	if got := exp.String(); got != expected {
+		t.Errorf("String() wrong. want=%q, got=%q", expected, got)
+	}
 }
 
-func TestCallExpressionParameterParsing(t *testing.T) {
+func TestTryExpressionErrors(t *testing.T) {
 	tests := []struct {
-		input         string
-		expectedIdent string
-		expectedArgs  []string
+		input    string
+		expected string
 	}{
-		{
-			input:         "add();",
-			expectedIdent: "add",
-			expectedArgs:  []string{},
-		},
-		{
-			input:         "add(1);",
-			expectedIdent: "add",
-			expectedArgs:  []string{"1"},
-		},
-		{
-			input:         "add(1, 2 * 3, 4 + 5);",
-			expectedIdent: "add",
-			expectedArgs:  []string{"1", "(2 * 3)", "(4 + 5)"},
-		},
+		{"try { 1 }", "expected next token to be RESCUE, got EOF instead"},
+		{"try { 1 } rescue { 2 }", "expected next token to be (, got { instead"},
+		{"try { 1 } rescue () { 2 }", "expected next token to be IDENT, got ) instead"},
+		{"try { 1 } rescue (a, b) { 2 }", "expected next token to be ), got , instead"},
+		{"try 1 rescue (e) { 2 }", "expected next token to be {, got INT instead"},
 	}
 
 	for _, tt := range tests {
-		l := lexer.New(tt.input)
-		p := New(l)
-		program := p.ParseProgram()
-		checkParserErrors(t, p)
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
 
-		stmt := program.Statements[0].(*ast.ExpressionStatement)
-		exp, ok := stmt.Expression.(*ast.CallExpression)
-		if !ok {
-			t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T",
-				stmt.Expression)
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong errors. want first=%q, got=%q", tt.input, tt.expected, errors)
 		}
+	}
+}
 
-		if !testIdentifier(t, exp.Function, tt.expectedIdent) {
-			return
-		}
+func TestBreakContinueStatements(t *testing.T) {
+	input := `
+break;
+continue;
+while (x) { if (y) { break } else { continue } }
+`
 
-		if len(exp.Arguments) != len(tt.expectedArgs) {
-			t.Fatalf("wrong number of arguments. want=%d, got=%d",
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d",
+			len(program.Statements))
+	}
+
+	if stmt, ok := program.Statements[0].(*ast.BreakStatement); !ok {
+		t.Errorf("program.Statements[0] is not ast.BreakStatement. got=%T",
+			program.Statements[0])
+	} else if stmt.TokenLiteral() != "break" {
+		t.Errorf("stmt.TokenLiteral not 'break', got %q", stmt.TokenLiteral())
+	}
+
+	if stmt, ok := program.Statements[1].(*ast.ContinueStatement); !ok {
+		t.Errorf("program.Statements[1] is not ast.ContinueStatement. got=%T",
+			program.Statements[1])
+	} else if stmt.TokenLiteral() != "continue" {
+		t.Errorf("stmt.TokenLiteral not 'continue', got %q", stmt.TokenLiteral())
+	}
+
+	expected := "break; continue; while (x) { if (y) { break; } else { continue; } }"
+	if program.String() != expected {
+		t.Errorf("program.String() wrong.\nwant=%q\ngot= %q", expected, program.String())
+	}
+}
+
+func TestAssignExpression(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedName  string
+		expectedValue interface{}
+	}{
+		{"x = 5;", "x", 5},
+		{"y = true;", "y", true},
+		{"foobar = y;", "foobar", "y"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+
+		exp, ok := stmt.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.AssignExpression. got=%T",
+				stmt.Expression)
+		}
+
+		if !testIdentifier(t, exp.Target, tt.expectedName) {
+			return
+		}
+		if !testLiteralExpression(t, exp.Value, tt.expectedValue) {
+			return
+		}
+	}
+}
+
+func TestInvalidAssignmentTarget(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 = 2", "invalid assignment target: 1"},
+		{"a + b = 3", "invalid assignment target: (a + b)"},
+		{"f() = 3", "invalid assignment target: f()"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%q: wrong errors. want first=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestIfElseExpression(t *testing.T) {
+	input := `if (x < y) { x } else { y }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(exp.Consequence.Statements) != 1 {
+		t.Errorf("consequence is not 1 statements. got=%d\n",
+			len(exp.Consequence.Statements))
+	}
+
+	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Consequence.Statements[0])
+	}
+
+	if !testIdentifier(t, consequence.Expression, "x") {
+		return
+	}
+
+	if len(exp.Alternative.Statements) != 1 {
+		t.Errorf("exp.Alternative.Statements does not contain 1 statements. got=%d\n",
+			len(exp.Alternative.Statements))
+	}
+
+	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Alternative.Statements[0])
+	}
+
+	if !testIdentifier(t, alternative.Expression, "y") {
+		return
+	}
+}
+
+func TestIfElseIfExpression(t *testing.T) {
+	input := `if (x < y) { x } else if (x > y) { y } else { z }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	nested := exp.ElseIf()
+	if nested == nil {
+		t.Fatalf("exp.Alternative is not an else-if branch. got=%+v",
+			exp.Alternative)
+	}
+
+	if !testInfixExpression(t, nested.Condition, "x", ">", "y") {
+		return
+	}
+
+	consequence, ok := nested.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			nested.Consequence.Statements[0])
+	}
+
+	if !testIdentifier(t, consequence.Expression, "y") {
+		return
+	}
+
+	if nested.Alternative == nil || nested.ElseIf() != nil {
+		t.Fatalf("nested.Alternative is not a plain else branch. got=%+v",
+			nested.Alternative)
+	}
+
+	alternative, ok := nested.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			nested.Alternative.Statements[0])
+	}
+
+	testIdentifier(t, alternative.Expression, "z")
+}
+
+func TestIfExpressionStringRoundTrip(t *testing.T) {
+	tests := []string{
+		`if (x) { y }`,
+		`if (x < y) { x } else { y }`,
+		`if (a) { 1 } else if (b) { 2 } else { 3 }`,
+		`if (a) { 1 } else if (b) { 2 } else if (c) { 3 }`,
+	}
+
+	for _, input := range tests {
+		first := New(lexer.New(input))
+		program := first.ParseProgram()
+		checkParserErrors(t, first)
+
+		second := New(lexer.New(program.String()))
+		reparsed := second.ParseProgram()
+		checkParserErrors(t, second)
+
+		if program.String() != reparsed.String() {
+			t.Errorf("round trip mismatch for %q. first=%q, second=%q",
+				input, program.String(), reparsed.String())
+		}
+	}
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	input := `fn(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d\n",
+			len(function.Parameters))
+	}
+
+	testLiteralExpression(t, function.Parameters[0], "x")
+	testLiteralExpression(t, function.Parameters[1], "y")
+
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n",
+			len(function.Body.Statements))
+	}
+
+	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T",
+			function.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestFunctionLiteralWithName(t *testing.T) {
+	input := `let myFunction = fn() { };
+let a, b = fn() { }, 1;
+let c = (fn() { });
+fn() { };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	functions := []*ast.FunctionLiteral{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if fn, ok := node.(*ast.FunctionLiteral); ok {
+			functions = append(functions, fn)
+		}
+		return true
+	})
+
+	// 括号不改变语法树，因此 let c = (fn() { }) 同样被命名
+	expected := []string{"myFunction", "a", "c", ""}
+	if len(functions) != len(expected) {
+		t.Fatalf("wrong number of function literals. want=%d, got=%d", len(expected), len(functions))
+	}
+	for i, name := range expected {
+		if functions[i].Name != name {
+			t.Errorf("functions[%d].Name wrong. want=%q, got=%q", i, name, functions[i].Name)
+		}
+	}
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+			len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n",
+			len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+
+	if macro.String() != "macro(x, y) { (x + y) }" {
+		t.Errorf("macro.String() wrong. got=%q", macro.String())
+	}
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{input: "fn() {};", expectedParams: []string{}},
+		{input: "fn(x) {};", expectedParams: []string{"x"}},
+		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("length parameters wrong. want %d, got=%d\n",
+				len(tt.expectedParams), len(function.Parameters))
+		}
+
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	input := "add(1, 2 * 3, 4 + 5);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Function, "add") {
+		return
+	}
+
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	testLiteralExpression(t, exp.Arguments[0], 1)
+	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
+	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
+}
+
+func TestCallExpressionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedIdent string
+		expectedArgs  []string
+	}{
+		{
+			input:         "add();",
+			expectedIdent: "add",
+			expectedArgs:  []string{},
+		},
+		{
+			input:         "add(1);",
+			expectedIdent: "add",
+			expectedArgs:  []string{"1"},
+		},
+		{
+			input:         "add(1, 2 * 3, 4 + 5);",
+			expectedIdent: "add",
+			expectedArgs:  []string{"1", "(2 * 3)", "(4 + 5)"},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.CallExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T",
+				stmt.Expression)
+		}
+
+		if !testIdentifier(t, exp.Function, tt.expectedIdent) {
+			return
+		}
+
+		if len(exp.Arguments) != len(tt.expectedArgs) {
+			t.Fatalf("wrong number of arguments. want=%d, got=%d",
 				len(tt.expectedArgs), len(exp.Arguments))
 		}
 
-		for i, arg := range tt.expectedArgs {
-			if exp.Arguments[i].String() != arg {
-				t.Errorf("argument %d wrong. want=%q, got=%q", i,
-					arg, exp.Arguments[i].String())
+		for i, arg := range tt.expectedArgs {
+			if exp.Arguments[i].String() != arg {
+				t.Errorf("argument %d wrong. want=%q, got=%q", i,
+					arg, exp.Arguments[i].String())
+			}
+		}
+	}
+}
+
+// TestStringLiteralExpression 测试字符串字面量表达式的解析功能
+// 验证解析器能够正确解析字符串字面量并生成相应的 AST 节点
+func TestCallExpressionSpreadArguments(t *testing.T) {
+	input := "add(1, args..., 2);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	testLiteralExpression(t, exp.Arguments[0], 1)
+
+	spread, ok := exp.Arguments[1].(*ast.SpreadExpression)
+	if !ok {
+		t.Fatalf("exp.Arguments[1] is not ast.SpreadExpression. got=%T",
+			exp.Arguments[1])
+	}
+	testIdentifier(t, spread.Value, "args")
+
+	testLiteralExpression(t, exp.Arguments[2], 2)
+}
+
+func TestSpreadOutsideCallArguments(t *testing.T) {
+	tests := []string{
+		"[args...]",
+		"args...",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q, got none", input)
+		}
+	}
+}
+
+func TestFailedStatementsAreNotAppended(t *testing.T) {
+	tests := []string{
+		"let = 5;",
+		"let x 5;",
+		"let [] = a;",
+		"let a, b = 1;",
+		"return 1 +;",
+		"fn(x) { let = 1; x }",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q, got none", input)
+		}
+
+		// 出错的语句不能以带类型的nil指针形式留在AST中
+		checkNotNil := func(stmts []ast.Statement) {
+			for i, stmt := range stmts {
+				if stmt == nil || reflect.ValueOf(stmt).IsNil() {
+					t.Errorf("statements[%d] is nil for %q", i, input)
+				}
+			}
+		}
+		checkNotNil(program.Statements)
+
+		// String()不应panic
+		_ = program.String()
+	}
+}
+
+func TestParserErrorRecovery(t *testing.T) {
+	input := `
+let = 5;
+let y 10;
+let z = 3 + ;
+let ok = 1;
+if (x) { x + }
+let w = 2;
+`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	expected := []string{
+		"expected next token to be IDENT, got = instead",
+		"expected next token to be =, got INT instead",
+		"no prefix parse function for ; found",
+		"no prefix parse function for } found",
+	}
+
+	errors := p.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. want=%d, got=%d (%q)",
+			len(expected), len(errors), errors)
+	}
+
+	for i, msg := range expected {
+		if errors[i] != msg {
+			t.Errorf("errors[%d] wrong. want=%q, got=%q", i, msg, errors[i])
+		}
+	}
+
+	// 出错语句之后的合法语句仍然能被正确解析
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+	if !testLetStatement(t, program.Statements[0], "ok") {
+		return
+	}
+	testLetStatement(t, program.Statements[1], "w")
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello world";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+}
+
+func TestInterpolatedStringExpression(t *testing.T) {
+	input := `"a ${x} b"`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.InfixExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.InfixExpression. got=%T", stmt.Expression)
+	}
+
+	// (("a " + x) + " b")
+	left, ok := exp.Left.(*ast.InfixExpression)
+	if !ok {
+		t.Fatalf("exp.Left not *ast.InfixExpression. got=%T", exp.Left)
+	}
+	if left.Left.(*ast.StringLiteral).Value != "a " {
+		t.Errorf("first part wrong. got=%q", left.Left.String())
+	}
+	testIdentifier(t, left.Right, "x")
+	if exp.Right.(*ast.StringLiteral).Value != " b" {
+		t.Errorf("last part wrong. got=%q", exp.Right.String())
+	}
+}
+
+func TestInterpolatedStringRoundTrip(t *testing.T) {
+	tests := []string{
+		`"a ${x} b"`,
+		`"${x}"`,
+		`"${x}${y}"`,
+		`"sum: ${(a + b)}"`,
+		`"${f("inner ${y}")} outer"`,
+		`"${(h[k])}"`,
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != input {
+			t.Errorf("round trip wrong. want=%q, got=%q", input, program.String())
+		}
+	}
+}
+
+func TestInterpolatedStringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"${}"`, "empty interpolation in string"},
+		{`"a ${  } b"`, "empty interpolation in string"},
+		{`"${1 +}"`, "no prefix parse function for EOF found"},
+		{`"${1 2}"`, "unexpected INT in string interpolation"},
+		{`"${"${}"}"`, "empty interpolation in string"},
+		{`"${x} \q"`, `unknown escape sequence \q in string`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("wrong number of errors for %q. want=1, got=%d (%q)",
+				tt.input, len(errors), errors)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestParsingEmptyArrayLiterals(t *testing.T) {
+	input := "[]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 0 {
+		t.Errorf("len(array.Elements) not 0. got=%d", len(array.Elements))
+	}
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+}
+
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedLow  interface{}
+		expectedHigh interface{}
+	}{
+		{"arr[1:3]", 1, 3},
+		{"arr[:2]", nil, 2},
+		{"arr[2:]", 2, nil},
+		{"arr[:]", nil, nil},
+		{"arr[i:j]", "i", "j"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		slice, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.SliceExpression. got=%T", stmt.Expression)
+		}
+		if !testIdentifier(t, slice.Left, "arr") {
+			return
+		}
+
+		bounds := []struct {
+			exp      ast.Expression
+			expected interface{}
+		}{{slice.Low, tt.expectedLow}, {slice.High, tt.expectedHigh}}
+		for _, b := range bounds {
+			if b.expected == nil {
+				if b.exp != nil {
+					t.Errorf("%s: omitted bound is not nil. got=%s", tt.input, b.exp)
+				}
+				continue
+			}
+			testLiteralExpression(t, b.exp, b.expected)
+		}
+	}
+
+	for _, input := range []string{"arr[1:2", "arr[1:2:3]", "arr[:,]"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors", input)
+		}
+	}
+}
+
+func TestParsingDotExpressions(t *testing.T) {
+	input := "person.name"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "person") {
+		return
+	}
+
+	literal, ok := indexExp.Index.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("indexExp.Index not *ast.StringLiteral. got=%T", indexExp.Index)
+	}
+
+	if literal.Value != "name" {
+		t.Errorf("literal.Value not %q. got=%q", "name", literal.Value)
+	}
+}
+
+func TestParsingDotExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"person.1", "expected next token to be IDENT, got INT instead"},
+		{"person.", "expected next token to be IDENT, got EOF instead"},
+		{`person."name"`, "expected next token to be IDENT, got STRING instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q, got none", tt.input)
+			continue
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q",
+				tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestParsingEmptyHashLiteral(t *testing.T) {
+	input := "{}"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 0 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+}
+
+func TestHashLiteralSourceOrder(t *testing.T) {
+	input := `{"z": 1, "a": 2, "m": 3, 10: 4, true: 5, "b": fn(x) { x }}`
+	expected := `{"z":1, "a":2, "m":3, 10:4, true:5, "b":fn(x) { x }}`
+
+	// 多次解析同一个字面量，String()输出都应保持源代码中的顺序
+	for i := 0; i < 20; i++ {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != expected {
+			t.Fatalf("hash literal String() wrong on parse %d. want=%q, got=%q",
+				i, expected, program.String())
+		}
+	}
+}
+
+func TestParsingHashLiteralsStringKeys(t *testing.T) {
+	input := `{"one": 1, "two": 2, "three": 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	expected := map[string]int64{
+		"one":   1,
+		"two":   2,
+		"three": 3,
+	}
+
+	if len(hash.Pairs) != len(expected) {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
+		literal, ok := key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+			continue
+		}
+
+		expectedValue := expected[literal.Value]
+		testIntegerLiteral(t, value, expectedValue)
+	}
+}
+
+func TestParsingHashLiteralsBooleanKeys(t *testing.T) {
+	input := `{true: 1, false: 2}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	expected := map[string]int64{
+		"true":  1,
+		"false": 2,
+	}
+
+	if len(hash.Pairs) != len(expected) {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
+		boolean, ok := key.(*ast.Boolean)
+		if !ok {
+			t.Errorf("key is not ast.BooleanLiteral. got=%T", key)
+			continue
+		}
+
+		expectedValue := expected[boolean.String()]
+		testIntegerLiteral(t, value, expectedValue)
+	}
+}
+
+func TestParsingHashLiteralsIntegerKeys(t *testing.T) {
+	input := `{1: 1, 2: 2, 3: 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	expected := map[string]int64{
+		"1": 1,
+		"2": 2,
+		"3": 3,
+	}
+
+	if len(hash.Pairs) != len(expected) {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
+		integer, ok := key.(*ast.IntegerLiteral)
+		if !ok {
+			t.Errorf("key is not ast.IntegerLiteral. got=%T", key)
+			continue
+		}
+
+		expectedValue := expected[integer.String()]
+
+		testIntegerLiteral(t, value, expectedValue)
+	}
+}
+
+func TestParsingHashLiteralsWithExpressions(t *testing.T) {
+	input := `{"one": 0 + 1, "two": 10 - 8, "three": 15 / 5}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	tests := map[string]func(ast.Expression){
+		"one": func(e ast.Expression) {
+			testInfixExpression(t, e, 0, "+", 1)
+		},
+		"two": func(e ast.Expression) {
+			testInfixExpression(t, e, 10, "-", 8)
+		},
+		"three": func(e ast.Expression) {
+			testInfixExpression(t, e, 15, "/", 5)
+		},
+	}
+
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
+		literal, ok := key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+			continue
+		}
+
+		testFunc, ok := tests[literal.Value]
+		if !ok {
+			t.Errorf("No test function for key %q found", literal.Value)
+			continue
+		}
+
+		testFunc(value)
+	}
+}
+
+func TestParsingHashLiteralsIdentifierKeys(t *testing.T) {
+	input := `{name: "Ann", age: 3, x + 1: 2, true: 4}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 4 {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	for i, name := range []string{"name", "age"} {
+		literal, ok := hash.Pairs[i].Key.(*ast.StringLiteral)
+		if !ok {
+			t.Fatalf("key %d is not ast.StringLiteral. got=%T", i, hash.Pairs[i].Key)
+		}
+		if literal.Value != name {
+			t.Errorf("literal.Value not %q. got=%q", name, literal.Value)
+		}
+	}
+
+	// 标识符后面不是冒号时仍按普通表达式解析
+	testInfixExpression(t, hash.Pairs[2].Key, "x", "+", 1)
+	testBooleanLiteral(t, hash.Pairs[3].Key, true)
+
+	expected := `{name:"Ann", age:3, (x + 1):2, true:4}`
+	if hash.String() != expected {
+		t.Errorf("hash.String() wrong. want=%q, got=%q", expected, hash.String())
+	}
+}
+
+func TestParsingHashLiteralDuplicateKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"a": 1, "a": 2}`, `duplicate key "a" in hash literal`},
+		{`{"a": 1, "b": 2, "a": 3}`, `duplicate key "a" in hash literal`},
+		{`{1: "one", 2: "two", 1: "uno"}`, `duplicate key 1 in hash literal`},
+		{`{true: 1, false: 2, true: 3}`, `duplicate key true in hash literal`},
+		{`{name: 1, "name": 2}`, `duplicate key "name" in hash literal`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("wrong number of errors for %q. want=1, got=%d (%q)",
+				tt.input, len(errors), errors)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestParsingHashLiteralDistinctKeys(t *testing.T) {
+	// 类型不同的字面量键以及计算出来的键都不会被当作重复
+	tests := []string{
+		`{"1": 1, 1: 2}`,
+		`{"true": 1, true: 2}`,
+		`{1 + 1: 1, 1 + 1: 2}`,
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+		checkParserErrors(t, p)
+	}
+}
+
+func TestEquivalentPrograms(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"a + b * c", "a + (b * c)", true},
+		{"a + b * c", "(a + b) * c", false},
+		{"a - b - c", "(a - b) - c", true},
+		{"a - b - c", "a - (b - c)", false},
+		{"a.b", `a["b"]`, true},
+		{`{name: 1}`, `{"name": 1}`, true},
+		{"[1, 2,]", "[1, 2]", true},
+		{"if (x) { 1 } else { 2 }", "if (x) { 1 }", false},
+		{"if (x) { 1 }", "if (x) { 1 } else { 2 }", false},
+		{"if (a) { 1 } else if (b) { 2 }", "if (a) { 1 } else { if (b) { 2 } }", true},
+		{"arr.map(f)", "map(arr, f)", true},
+		{"let x = 1;\nlet y = 2;", "let x = 1; let y = 2;", true},
+	}
+
+	for _, tt := range tests {
+		a := New(lexer.New(tt.a))
+		programA := a.ParseProgram()
+		checkParserErrors(t, a)
+
+		b := New(lexer.New(tt.b))
+		programB := b.ParseProgram()
+		checkParserErrors(t, b)
+
+		if got := ast.Equal(programA, programB); got != tt.expected {
+			t.Errorf("ast.Equal(%q, %q) wrong. want=%t, got=%t", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	// 解析String()的输出应得到结构相同的程序
+	tests := []string{
+		"let x = 5; let y; return x; return;",
+		"let [a, b] = pair; let {name, age} = person;",
+		"let a, b = 1, 2; let c, d;",
+		"-a * b + !c; a - b - c; a + (b - c) % d; x; -1",
+		"if (a < b) { a } else if (a > b) { b } else { c }",
+		"if (x) { } else { }; if (!x) { let y = 1; y; -y }",
+		"let f = fn(x, y) { let z = x + y; z * 2 }; f(1, 2); fn() { }();",
+		"let f = fn() { x; -1 }; f()",
+		"add(xs...); arr.map(f).len(); (obj.f)(1); fn(x) { x }(2)",
+		"[1, [2, 3], []][0][1]; h.a.b; h[k]",
+		"{a: 1, b: {c: true}, 1: false, true: [x]}; {}",
+		`"a ${x + 1} b ${h[k]}"; "${x}"`,
+		"let fact = fn(n) { if (n == 0) { return 1; } n * fact(n - 1) };",
+		`let s = "a b"; "${s} \"q\" \${x}\ttab"; "line\\"`,
+		"\"multi\nline\"; {\"k\": \"v\", kk: \"\"}[\"k\"]",
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		output := program.String()
+		reparser := New(lexer.New(output))
+		reparsed := reparser.ParseProgram()
+		if len(reparser.Errors()) != 0 {
+			t.Errorf("String() output of %q does not parse: %q %v", input, output, reparser.Errors())
+			continue
+		}
+
+		if !ast.Equal(program, reparsed) {
+			t.Errorf("String() output of %q does not round-trip. got=%q", input, output)
+		}
+	}
+}
+
+func TestTrailingCommas(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3,]", "[1, 2, 3]"},
+		{"[\n  1,\n  2,\n]", "[1, 2]"},
+		{"add(1, 2,)", "add(1, 2)"},
+		{`{"one": 1,}`, `{"one":1}`},
+		{"fn(x, y,) { x }", "fn(x, y) { x }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestTrailingCommaErrors(t *testing.T) {
+	tests := []string{
+		"[,]",
+		"{,}",
+		"add(,)",
+		"fn(,) { 1 }",
+		"[1, 2,",
+		`{"a": 1,`,
+		"add(1,",
+		"fn(x,",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q, got none", input)
+		}
+	}
+}
+
+func TestParseStatementIncrementally(t *testing.T) {
+	input := `
+let x = 5;
+x + 1
+let add = fn(a, b) { a + b; };
+if (x > 1) { add(x, 1) } else { 0 };
+return x;
+`
+
+	whole := New(lexer.New(input)).ParseProgram()
+
+	p := New(lexer.New(input))
+	statements := []ast.Statement{}
+	for {
+		stmt, err := p.ParseStatement()
+		if err != nil {
+			t.Fatalf("ParseStatement returned error: %v", err)
+		}
+		if stmt == nil {
+			break
+		}
+		statements = append(statements, stmt)
+	}
+
+	if len(statements) != len(whole.Statements) {
+		t.Fatalf("wrong number of statements. want=%d, got=%d",
+			len(whole.Statements), len(statements))
+	}
+
+	for i, stmt := range statements {
+		if !ast.Equal(stmt, whole.Statements[i]) {
+			t.Errorf("statements[%d] wrong. want=%q, got=%q",
+				i, whole.Statements[i].String(), stmt.String())
+		}
+	}
+}
+
+func TestParseStatementErrors(t *testing.T) {
+	tests := []struct {
+		input      string
+		incomplete bool
+	}{
+		{"let x = ", true},
+		{"5 + ", true},
+		{"let f = fn(x) { x", true},
+		{"if (x) { 1 } else {", true},
+		{"[1, 2", true},
+		// 字符串还没有结束，下一行可能补上结束双引号
+		{`"abc`, true},
+		{`let s = "a;`, true},
+		{`puts("x ${y}`, true},
+		{`"a ${"b`, true},
+		{`"a\`, true},
+		{"let = 5;", false},
+		{"let x 5;", false},
+		{"let y = 3 + ;", false},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		stmt, err := p.ParseStatement()
+		if stmt != nil {
+			t.Errorf("expected no statement for %q. got=%q", tt.input, stmt.String())
+		}
+
+		if tt.incomplete {
+			if err != ErrIncomplete {
+				t.Errorf("expected ErrIncomplete for %q. got=%v", tt.input, err)
+			}
+			continue
+		}
+
+		syntaxErr, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("expected *SyntaxError for %q. got=%T (%v)", tt.input, err, err)
+			continue
+		}
+		if len(syntaxErr.Messages) == 0 {
+			t.Errorf("SyntaxError for %q has no messages", tt.input)
+		}
+	}
+}
+
+func TestParseStatementContinuesAfterError(t *testing.T) {
+	p := New(lexer.New("let = 1; let ok = 2;"))
+
+	if _, err := p.ParseStatement(); err == nil {
+		t.Fatalf("expected an error for the first statement")
+	}
+
+	stmt, err := p.ParseStatement()
+	if err != nil {
+		t.Fatalf("unexpected error for the second statement: %v", err)
+	}
+	testLetStatement(t, stmt, "ok")
+
+	if stmt, err := p.ParseStatement(); stmt != nil || err != nil {
+		t.Errorf("expected nil, nil at end of input. got=%v, %v", stmt, err)
+	}
+}
+
+func TestDeeplyNestedExpressions(t *testing.T) {
+	tests := []string{
+		strings.Repeat("(", 100000) + "1",
+		strings.Repeat("(", 100000) + "1" + strings.Repeat(")", 100000),
+		strings.Repeat("-", 100000) + "1",
+		strings.Repeat("[", 100000) + "1",
+		strings.Repeat("fn() { ", 100000) + "1",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		// 只报告一次超出深度的错误，不会在展开递归时产生大量连带错误
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("wrong number of errors. want=1, got=%d", len(errors))
+		}
+		expected := fmt.Sprintf("expression nesting exceeds maximum depth of %d", DefaultMaxDepth)
+		if errors[0] != expected {
+			t.Errorf("wrong error. want=%q, got=%q", expected, errors[0])
+		}
+	}
+}
+
+func TestSetMaxDepth(t *testing.T) {
+	input := "((((1))))"
+
+	p := New(lexer.New(input))
+	p.SetMaxDepth(3)
+	p.ParseProgram()
+	if len(p.Errors()) != 1 {
+		t.Fatalf("expected 1 error with max depth 3. got=%q", p.Errors())
+	}
+
+	p = New(lexer.New(input))
+	p.SetMaxDepth(5)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if program.String() != "1" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestCheckUnreachableStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let f = fn() { return 1; }; f();", []string{}},
+		{"let f = fn(x) { if (x) { return 1; } 2 };", []string{}},
+		{
+			"let f = fn() {\n  return 1;\n  2;\n  3;\n};",
+			[]string{"line 3: unreachable statement after return"},
+		},
+		{
+			"let f = fn(x) {\n  if (x) {\n    return 1;\n    let y = 2;\n  }\n  x\n};",
+			[]string{"line 4: unreachable statement after return"},
+		},
+		{
+			"let f = fn() {\n  return;\n  1\n};\nlet g = fn() {\n  return 2;\n  3\n};",
+			[]string{
+				"line 3: unreachable statement after return",
+				"line 7: unreachable statement after return",
+			},
+		},
+		{"return 1;\nputs(2);", []string{"line 2: unreachable statement after return"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		warnings := Check(program)
+		if len(warnings) != len(tt.expected) {
+			t.Errorf("wrong number of warnings for %q. want=%d, got=%d (%q)",
+				tt.input, len(tt.expected), len(warnings), warnings)
+			continue
+		}
+
+		for i, msg := range tt.expected {
+			if warnings[i] != msg {
+				t.Errorf("warnings[%d] wrong. want=%q, got=%q", i, msg, warnings[i])
 			}
 		}
 	}
 }
 
-// TestStringLiteralExpression 测试字符串字面量表达式的解析功能
-// 验证解析器能够正确解析字符串字面量并生成相应的 AST 节点
-func TestStringLiteralExpression(t *testing.T) {
-	input := `"hello world";`
-
-	l := lexer.New(input)
-	p := New(l)
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
-
-	stmt := program.Statements[0].(*ast.ExpressionStatement)
-	literal, ok := stmt.Expression.(*ast.StringLiteral)
-	if !ok {
-		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
-	}
+func TestMaxErrors(t *testing.T) {
+	input := strings.Repeat("let 1;\n", 1000) + "let ok = 1;"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != DefaultMaxErrors+1 {
+		t.Fatalf("wrong number of errors. want=%d, got=%d", DefaultMaxErrors+1, len(errors))
+	}
+	if errors[len(errors)-1] != "too many errors, aborting" {
+		t.Errorf("last error wrong. got=%q", errors[len(errors)-1])
+	}
+
+	// 中止后不再继续解析后面的语句
+	if len(program.Statements) != 0 {
+		t.Errorf("expected no statements after aborting. got=%d", len(program.Statements))
+	}
+
+	// 部分程序中保留中止前解析成功的语句
+	p = New(lexer.New("let a = 1; let 1; let 2; let 3; let b = 2;"))
+	p.SetMaxErrors(2)
+	program = p.ParseProgram()
+
+	expected := []string{
+		"expected next token to be IDENT, got INT instead",
+		"expected next token to be IDENT, got INT instead",
+		"too many errors, aborting",
+	}
+	errors = p.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. want=%d, got=%d (%q)", len(expected), len(errors), errors)
+	}
+	for i, msg := range expected {
+		if errors[i] != msg {
+			t.Errorf("errors[%d] wrong. want=%q, got=%q", i, msg, errors[i])
+		}
+	}
+	if program.String() != "let a = 1;" {
+		t.Errorf("partial program wrong. got=%q", program.String())
+	}
+}
+
+func TestFormat(t *testing.T) {
+	input := `let config = {"name": "monkey", size: 3 * (1 + 2), "tags": [1,2,3]};
+let classify = fn(x, y) { if (x > y) { return -(x - y); } else if (x == y) { 0 } else {
+let d = y - x; d * 2 } };
+let [a, b] = [classify(1, 2), config.size];
+const limit=a+b
+let kind = switch (a) { case 1, 2 { "small" }
+default { "large" } };
+let safe = try { classify(a, b) } rescue (err) { err.message };
+puts(a, b - (1 - 2), !true, config["tags"][0]); return;`
+
+	expected := `let config = {"name": "monkey", size: 3 * (1 + 2), "tags": [1, 2, 3]};
+let classify = fn(x, y) {
+  if (x > y) {
+    return -(x - y);
+  } else if (x == y) {
+    0;
+  } else {
+    let d = y - x;
+    d * 2;
+  };
+};
+let [a, b] = [classify(1, 2), config.size];
+const limit = a + b;
+let kind = switch (a) {
+  case 1, 2 {
+    "small";
+  }
+  default {
+    "large";
+  }
+};
+let safe = try {
+  classify(a, b);
+} rescue (err) {
+  err.message;
+};
+puts(a, b - (1 - 2), !true, config["tags"][0]);
+return;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	formatted := ast.Format(program)
+	if formatted != expected {
+		t.Fatalf("formatted output wrong.\nwant:\n%s\ngot:\n%s", expected, formatted)
+	}
+
+	// 格式化的结果重新解析后与原程序相同
+	reparsed := New(lexer.New(formatted))
+	again := reparsed.ParseProgram()
+	checkParserErrors(t, reparsed)
+	if !ast.Equal(again, program) {
+		t.Errorf("reparsed program differs.\nwant=%q\ngot=%q", program.String(), again.String())
+	}
+}
+
+func TestFormatParentheses(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a + b * c", "a + b * c;"},
+		{"(a + b) * c", "(a + b) * c;"},
+		{"a - (b - c)", "a - (b - c);"},
+		{"(a - b) - c", "a - b - c;"},
+		{"-(a + b)", "-(a + b);"},
+		{"-a.b", "-a.b;"},
+		{"(-a)[0]", "(-a)[0];"},
+		{"(a + b)[1:n - 1]", "(a + b)[1:n - 1];"},
+		{"a[ : ]", "a[:];"},
+		{"(obj.f)(1)", "(obj.f)(1);"},
+		{"obj.f(1)", "obj.f(1);"},
+		{"f(obj, 1)", "f(obj, 1);"},
+		{"(a + b).f()", "(a + b).f();"},
+		{"a < b == (c > d)", "a < b == c > d;"},
+		{"(a == b) < c", "(a == b) < c;"},
+		{"a || (b && c)", "a || b && c;"},
+		{"(a || b) && c", "(a || b) && c;"},
+		{"a <= b && (c >= d)", "a <= b && c >= d;"},
+		{"fn() { }", "fn() { };"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if formatted := ast.Format(program); formatted != tt.expected {
+			t.Errorf("ast.Format(%q) wrong. want=%q, got=%q", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+// tokenSlice 按顺序返回预先准备好的token，模拟能产生自定义token的词法分析器
+type tokenSlice struct {
+	tokens []token.Token
+	pos    int
+}
 
-	if literal.Value != "hello world" {
-		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+func (ts *tokenSlice) NextToken() token.Token {
+	if ts.pos >= len(ts.tokens) {
+		return token.Token{Type: token.EOF, Literal: ""}
 	}
+	tok := ts.tokens[ts.pos]
+	ts.pos++
+	return tok
 }
 
-func TestParsingEmptyArrayLiterals(t *testing.T) {
-	input := "[]"
+func TestComments(t *testing.T) {
+	input := `# header
+# second line
+
+# doc for x
+let x = 1; # trailing x
+let f = fn(a) {
+  # doc for return
+  return a; # trailing return
+  # dangling
+};
+let h = {
+  a: 1, # interior
+  b: 2
+};
+# footer`
 
 	l := lexer.New(input)
+	l.SetEmitComments(true)
 	p := New(l)
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
-	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
-	array, ok := stmt.Expression.(*ast.ArrayLiteral)
-	if !ok {
-		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d",
+			len(program.Statements))
 	}
 
-	if len(array.Elements) != 0 {
-		t.Errorf("len(array.Elements) not 0. got=%d", len(array.Elements))
+	expectedComments := []string{"# header", "# second line", "# doc for x", "# trailing x",
+		"# doc for return", "# trailing return", "# dangling", "# interior", "# footer"}
+	if len(program.Comments) != len(expectedComments) {
+		t.Fatalf("program.Comments has wrong length. want=%d, got=%d",
+			len(expectedComments), len(program.Comments))
+	}
+	for i, c := range program.Comments {
+		if c.Text != expectedComments[i] {
+			t.Errorf("program.Comments[%d] wrong. want=%q, got=%q", i, expectedComments[i], c.Text)
+		}
+	}
+	if pos := program.Comments[7].Pos().String(); pos != "12:9" {
+		t.Errorf("interior comment has wrong position. want=12:9, got=%s", pos)
 	}
-}
 
-func TestParsingArrayLiterals(t *testing.T) {
-	input := "[1, 2 * 2, 3 + 3]"
+	// 空行隔开的注释和行尾注释都不是文档注释
+	fn := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	tests := []struct {
+		stmt        ast.Statement
+		expectedDoc []string
+	}{
+		{program.Statements[0], []string{"# doc for x"}},
+		{program.Statements[1], nil},
+		{fn.Body.Statements[0], []string{"# doc for return"}},
+		{program.Statements[2], nil},
+	}
+	for _, tt := range tests {
+		doc := ast.Doc(tt.stmt)
+		if len(doc) != len(tt.expectedDoc) {
+			t.Errorf("%q: wrong number of doc comments. want=%d, got=%d",
+				tt.stmt.String(), len(tt.expectedDoc), len(doc))
+			continue
+		}
+		for i, c := range doc {
+			if c.Text != tt.expectedDoc[i] {
+				t.Errorf("%q: doc[%d] wrong. want=%q, got=%q", tt.stmt.String(), i, tt.expectedDoc[i], c.Text)
+			}
+		}
+	}
 
-	l := lexer.New(input)
-	p := New(l)
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
+	expected := `# header
+# second line
 
-	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
-	array, ok := stmt.Expression.(*ast.ArrayLiteral)
-	if !ok {
-		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+# doc for x
+let x = 1; # trailing x
+let f = fn(a) {
+  # doc for return
+  return a; # trailing return
+  # dangling
+};
+let h = {
+  a: 1, # interior
+  b: 2,
+};
+# footer`
+	if formatted := ast.Format(program); formatted != expected {
+		t.Errorf("ast.Format wrong.\nwant:\n%s\ngot:\n%s", expected, formatted)
 	}
 
-	if len(array.Elements) != 3 {
-		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	// 单独格式化语句时只能输出它的文档注释
+	if formatted := ast.Format(program.Statements[0]); formatted != "# doc for x\nlet x = 1;" {
+		t.Errorf("ast.Format of statement wrong. got=%q", formatted)
 	}
 
-	testIntegerLiteral(t, array.Elements[0], 1)
-	testInfixExpression(t, array.Elements[1], 2, "*", 2)
-	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+	// 默认不输出注释，解析结果中也没有注释
+	program = New(lexer.New(input)).ParseProgram()
+	if len(program.Comments) != 0 || ast.Doc(program.Statements[0]) != nil {
+		t.Errorf("comments collected without SetEmitComments")
+	}
 }
 
-func TestParsingIndexExpressions(t *testing.T) {
-	input := "myArray[1 + 1]"
-
-	l := lexer.New(input)
-	p := New(l)
+func TestNodeKinds(t *testing.T) {
+	input := `let [a] = x; let {b} = y; let c, d = 1, "s";
+let f = fn(n) { return -n + 1; };
+if (true) { f(a...) } else { [c][0] };
+{k: d};
+x[1:];
+1.5;
+while (c) { c = false };
+for (;;) { break; continue };
+switch (c) { case 1 { c } default { d } };
+try { c } rescue (e) { e };
+let m = macro(q) { q };
+return;`
+
+	p := New(lexer.New(input))
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
-	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
-	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
-	if !ok {
-		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
-	}
+	expected := []string{
+		"Program",
+		"LetStatement", "ArrayPattern", "Identifier", "Identifier",
+		"LetStatement", "HashPattern", "Identifier", "Identifier",
+		"MultiLetStatement", "Identifier", "Identifier", "IntegerLiteral", "StringLiteral",
+		"LetStatement", "Identifier", "FunctionLiteral", "Identifier", "BlockStatement",
+		"ReturnStatement", "InfixExpression", "PrefixExpression", "Identifier", "IntegerLiteral",
+		"ExpressionStatement", "IfExpression", "Boolean",
+		"BlockStatement", "ExpressionStatement", "CallExpression", "Identifier",
+		"SpreadExpression", "Identifier",
+		"BlockStatement", "ExpressionStatement", "IndexExpression", "ArrayLiteral",
+		"Identifier", "IntegerLiteral",
+		"ExpressionStatement", "HashLiteral", "StringLiteral", "Identifier",
+		"ExpressionStatement", "SliceExpression", "Identifier", "IntegerLiteral",
+		"ExpressionStatement", "FloatLiteral",
+		"ExpressionStatement", "WhileExpression", "Identifier", "BlockStatement",
+		"ExpressionStatement", "AssignExpression", "Identifier", "Boolean",
+		"ExpressionStatement", "ForExpression", "BlockStatement",
+		"BreakStatement", "ContinueStatement",
+		"ExpressionStatement", "SwitchExpression", "Identifier", "IntegerLiteral",
+		"BlockStatement", "ExpressionStatement", "Identifier",
+		"BlockStatement", "ExpressionStatement", "Identifier",
+		"ExpressionStatement", "TryExpression", "BlockStatement", "ExpressionStatement", "Identifier",
+		"Identifier", "BlockStatement", "ExpressionStatement", "Identifier",
+		"LetStatement", "Identifier", "MacroLiteral", "Identifier", "BlockStatement",
+		"ExpressionStatement", "Identifier",
+		"ReturnStatement",
+	}
+
+	var kinds []string
+	seen := map[string]bool{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node != nil {
+			kinds = append(kinds, node.Kind())
+			seen[node.Kind()] = true
+		}
+		return true
+	})
 
-	if !testIdentifier(t, indexExp.Left, "myArray") {
-		return
+	if len(kinds) != len(expected) {
+		t.Fatalf("wrong number of nodes. want=%d, got=%d (%q)", len(expected), len(kinds), kinds)
+	}
+	for i, kind := range expected {
+		if kinds[i] != kind {
+			t.Errorf("kinds[%d] wrong. want=%q, got=%q", i, kind, kinds[i])
+		}
 	}
 
-	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
-		return
+	// 示例程序覆盖了Kinds()中的每一种节点
+	for _, kind := range ast.Kinds() {
+		if !seen[kind] {
+			t.Errorf("kind %q not produced by the program", kind)
+		}
+	}
+	if len(seen) != len(ast.Kinds()) {
+		t.Errorf("program produced kinds missing from ast.Kinds(): %v", seen)
 	}
 }
 
-func TestParsingEmptyHashLiteral(t *testing.T) {
-	input := "{}"
+func TestStats(t *testing.T) {
+	input := `let add = fn(a, b) { a + b };
+let x = add(1, add(2, 3));
+puts(x, [4, 5]);`
 
-	l := lexer.New(input)
-	p := New(l)
+	p := New(lexer.New(input))
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
-	stmt := program.Statements[0].(*ast.ExpressionStatement)
-	hash, ok := stmt.Expression.(*ast.HashLiteral)
-	if !ok {
-		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	stats := ast.Stats(program)
+	tests := []struct {
+		kind     string
+		expected int
+	}{
+		{"Identifier", 10},
+		{"IntegerLiteral", 5},
+		{"CallExpression", 3},
+		{"LetStatement", 2},
+		{"FunctionLiteral", 1},
+		{"IfExpression", 0},
+	}
+	for _, tt := range tests {
+		if stats[tt.kind] != tt.expected {
+			t.Errorf("stats[%q] wrong. want=%d, got=%d", tt.kind, tt.expected, stats[tt.kind])
+		}
 	}
 
-	if len(hash.Pairs) != 0 {
-		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	if n := ast.CountNodes(program); n != 27 {
+		t.Errorf("ast.CountNodes wrong. want=27, got=%d", n)
+	}
+	// Program > LetStatement > FunctionLiteral > BlockStatement > ExpressionStatement > InfixExpression > Identifier
+	if d := ast.Depth(program); d != 7 {
+		t.Errorf("ast.Depth wrong. want=7, got=%d", d)
+	}
+	if d := ast.Depth(nil); d != 0 {
+		t.Errorf("ast.Depth(nil) wrong. want=0, got=%d", d)
 	}
 }
 
-func TestParsingHashLiteralsStringKeys(t *testing.T) {
-	input := `{"one": 1, "two": 2, "three": 3}`
+func TestStringAfterParseErrors(t *testing.T) {
+	// 这些输入会让语法分析器留下子节点为nil的语法树，输出时不应panic
+	inputs := []string{
+		"-;",
+		"a + ;",
+		"a[;",
+		"a.;",
+		"f(1, ;",
+		"if (",
+		"if (x) {",
+		"fn(a, b",
+		"let = 5;",
+		"let x = ;",
+		"return ];",
+		"{1: };",
+		"[1, ;",
+		"\"a ${} b\"",
+	}
+
+	for _, input := range inputs {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors", input)
+		}
 
-	l := lexer.New(input)
-	p := New(l)
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%q: String() panicked: %v", input, r)
+				}
+			}()
+			_ = program.String()
+		}()
+	}
+}
 
-	stmt := program.Statements[0].(*ast.ExpressionStatement)
-	hash, ok := stmt.Expression.(*ast.HashLiteral)
-	if !ok {
-		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+func TestSexpr(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1 + 2 * 3;", "(let x (+ 1 (* 2 3)))"},
+		{"-a * b", "(* (- a) b)"},
+		{"!(true == false)", "(! (== true false))"},
+		{"a + b * c + d / e - f", "(- (+ (+ a (* b c)) (/ d e)) f)"},
+		{"let [a, b] = pair; let {name} = p; let c, d = 1, 2; let e;",
+			"(let [a b] pair) (let {name} p) (let (c d) 1 2) (let e)"},
+		{"return; return x;", "(return) (return x)"},
+		{"if (x < y) { x } else { y; z }", "(if (< x y) (block x) (block y z))"},
+		{"fn(a, b) { a + b }(1, xs...)", "(call (fn (a b) (block (+ a b))) 1 (... xs))"},
+		{"let m = macro(x) { quote(x) }", "(let m (macro (x) (block (call quote x))))"},
+		{"const max = 10;", "(const max 10)"},
+		{"a * [1, 2, 3][b * c] * d", "(* (* a (index (array 1 2 3) (* b c))) d)"},
+		{"h.name; h[\"name\"]; arr.map(f)", `(index h "name") (index h "name") (call map arr f)`},
+		{`{"one": 1, two: 2 * 3, 3: "a\"b"}`, `(hash ("one" 1) ("two" (* 2 3)) (3 "a\"b"))`},
+		{`{}[k]`, "(index (hash) k)"},
+		{"a[1:]; a[:b + 1]", "(slice a 1 nil) (slice a nil (+ b 1))"},
+		{"while (i < 3) { i = i + 1 }", "(while (< i 3) (block (= i (+ i 1))))"},
+		{"for (let i = 0; i < 3; i = i + 1) { i }", "(for (let i 0) (< i 3) (= i (+ i 1)) (block i))"},
+		{"for (;;) {}", "(for nil nil nil (block))"},
+		{"while (true) { break; continue }", "(while true (block (break) (continue)))"},
+		{"switch (x) { case 1, 2 { a } default { b } }",
+			"(switch x (case (1 2) (block a)) (default (block b)))"},
+		{"switch (x) { case y { } }", "(switch x (case (y) (block)))"},
+		{"try { f(x) } rescue (e) { e }", "(try (block (call f x)) (rescue e (block e)))"},
 	}
 
-	expected := map[string]int64{
-		"one":   1,
-		"two":   2,
-		"three": 3,
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if got := ast.Sexpr(program); got != tt.expected {
+			t.Errorf("ast.Sexpr(%q) wrong.\nwant=%s\ngot= %s", tt.input, tt.expected, got)
+		}
 	}
 
-	if len(hash.Pairs) != len(expected) {
-		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	if got := ast.Sexpr(nil); got != "nil" {
+		t.Errorf("ast.Sexpr(nil) wrong. want=nil, got=%s", got)
 	}
+}
 
-	for key, value := range hash.Pairs {
-		literal, ok := key.(*ast.StringLiteral)
-		if !ok {
-			t.Errorf("key is not ast.StringLiteral. got=%T", key)
-			continue
+func TestWalkMatchesChildren(t *testing.T) {
+	inputs := []string{
+		`let add = fn(a, b) { a + b }; let [x, y] = pair; let {name} = person;`,
+		`let a, b = 1, 2; return add(a, b...);`,
+		`if (x < y) { -x } else if (x > y) { !y } else { [1, 2][0] }`,
+		`let h = {"one": 1, name: "two", 3: fn() { h.one }}; h["one"]; "a ${b} c";`,
+		`arr.map(fn(x) { x * 2 }).filter(f)[0];`,
+	}
+
+	for _, input := range inputs {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		// 手工基于Children做深度优先遍历，得到的顺序应与Walk一致
+		var expected []ast.Node
+		var dfs func(node ast.Node)
+		dfs = func(node ast.Node) {
+			expected = append(expected, node)
+			for _, child := range ast.Children(node) {
+				dfs(child)
+			}
 		}
+		dfs(program)
 
-		expectedValue := expected[literal.String()]
-		testIntegerLiteral(t, value, expectedValue)
+		var visited []ast.Node
+		ast.Inspect(program, func(node ast.Node) bool {
+			if node != nil {
+				visited = append(visited, node)
+			}
+			return true
+		})
+
+		if len(visited) != len(expected) {
+			t.Errorf("%q: wrong number of visited nodes. want=%d, got=%d", input, len(expected), len(visited))
+			continue
+		}
+		for i := range expected {
+			if visited[i] != expected[i] {
+				t.Errorf("%q: visited[%d] wrong. want=%s, got=%s", input, i, expected[i].Kind(), visited[i].Kind())
+			}
+		}
 	}
 }
 
-func TestParsingHashLiteralsBooleanKeys(t *testing.T) {
-	input := `{true: 1, false: 2}`
+func TestNodeRanges(t *testing.T) {
+	input := `let math = {
+  "double": fn(x) { x * 2 },
+  "tag": "é\"",
+};
+let r = [math["double"](21), 1 + 2];`
 
-	l := lexer.New(input)
-	p := New(l)
+	p := New(lexer.New(input))
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
-	stmt := program.Statements[0].(*ast.ExpressionStatement)
-	hash, ok := stmt.Expression.(*ast.HashLiteral)
-	if !ok {
-		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	hash := program.Statements[0].(*ast.LetStatement).Value.(*ast.HashLiteral)
+	array := program.Statements[1].(*ast.LetStatement).Value.(*ast.ArrayLiteral)
+	call := array.Elements[0].(*ast.CallExpression)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{hash.Pairs[0].Value, "fn(x) { x * 2 }"},
+		{hash.Pairs[0].Value.(*ast.FunctionLiteral).Body, "{ x * 2 }"},
+		{hash.Pairs[1].Value, `"é\""`},
+		{hash, input[strings.Index(input, "{"):strings.Index(input, ";")]},
+		{call, `math["double"](21)`},
+		{call.Function, `math["double"]`},
+		{array.Elements[1], "1 + 2"},
+		{array, `[math["double"](21), 1 + 2]`},
+		{program.Statements[1], `let r = [math["double"](21), 1 + 2]`},
 	}
 
-	expected := map[string]int64{
-		"true":  1,
-		"false": 2,
+	for _, tt := range tests {
+		start, end := ast.Range(tt.node)
+		if got := input[start:end]; got != tt.expected {
+			t.Errorf("%s range wrong. want=%q, got=%q (%d:%d)", tt.node.Kind(), tt.expected, got, start, end)
+		}
 	}
 
-	if len(hash.Pairs) != len(expected) {
-		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	if start, end := ast.Range(nil); start != 0 || end != 0 {
+		t.Errorf("ast.Range(nil) wrong. got=%d:%d", start, end)
+	}
+}
+
+func TestMergePrograms(t *testing.T) {
+	sources := []string{
+		"# helpers\nlet add = fn(a, b) { a + b };\n\nlet one = 1; # the unit",
+		"let config = {\n  name: \"monkey\",\n  size: add(one, 2),\n};",
+		"puts(config.name);\n# done",
 	}
 
-	for key, value := range hash.Pairs {
-		boolean, ok := key.(*ast.Boolean)
-		if !ok {
-			t.Errorf("key is not ast.BooleanLiteral. got=%T", key)
-			continue
+	parse := func(input string) *ast.Program {
+		l := lexer.New(input)
+		l.SetEmitComments(true)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		return program
+	}
+
+	programs := []*ast.Program{}
+	for _, src := range sources {
+		programs = append(programs, parse(src))
+	}
+	merged := ast.Merge(programs[0], nil, programs[1], programs[2])
+	expected := parse(strings.Join(sources, "\n"))
+
+	if !ast.Equal(merged, expected) {
+		t.Fatalf("merged program differs.\nwant=%s\ngot= %s", expected, merged)
+	}
+	if merged.String() != expected.String() {
+		t.Errorf("String() wrong.\nwant=%q\ngot= %q", expected.String(), merged.String())
+	}
+	if ast.Format(merged) != ast.Format(expected) {
+		t.Errorf("Format wrong.\nwant:\n%s\ngot:\n%s", ast.Format(expected), ast.Format(merged))
+	}
+	if merged.TokenLiteral() != "let" {
+		t.Errorf("TokenLiteral wrong. want=let, got=%q", merged.TokenLiteral())
+	}
+	for i, stmt := range expected.Statements {
+		if got := merged.Statements[i].Pos(); got != stmt.Pos() {
+			t.Errorf("statements[%d] position wrong. want=%s, got=%s", i, stmt.Pos(), got)
 		}
+	}
 
-		expectedValue := expected[boolean.String()]
-		testIntegerLiteral(t, value, expectedValue)
+	// 合并不修改原来的程序
+	if pos := programs[2].Statements[0].Pos(); pos.Line != 1 {
+		t.Errorf("Merge changed its argument. statement position=%s", pos)
+	}
+	if len(programs[0].Statements) != 2 {
+		t.Errorf("Merge changed its argument. got %d statements", len(programs[0].Statements))
+	}
+
+	program := parse("let x = 1;")
+	program.Append(parse("x + 1;").Statements...)
+	if program.String() != "let x = 1; (x + 1)" {
+		t.Errorf("String() after Append wrong. got=%q", program.String())
 	}
 }
 
-func TestParsingHashLiteralsIntegerKeys(t *testing.T) {
-	input := `{1: 1, 2: 2, 3: 3}`
+func TestNodePositions(t *testing.T) {
+	input := `let x = 5;
+if (x > 1) { x } else { 0 };
+foo(x, [1, 2])[0];
+x.f(1);`
 
 	l := lexer.New(input)
 	p := New(l)
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
-	stmt := program.Statements[0].(*ast.ExpressionStatement)
-	hash, ok := stmt.Expression.(*ast.HashLiteral)
-	if !ok {
-		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	if len(program.Statements) != 4 {
+		t.Fatalf("program.Statements does not contain 4 statements. got=%d",
+			len(program.Statements))
 	}
 
-	expected := map[string]int64{
-		"1": 1,
-		"2": 2,
-		"3": 3,
-	}
+	ifExp := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	index := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.IndexExpression)
+	call := index.Left.(*ast.CallExpression)
+	method := program.Statements[3].(*ast.ExpressionStatement).Expression
 
-	if len(hash.Pairs) != len(expected) {
-		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	tests := []struct {
+		node        ast.Node
+		expectedPos string
+		expectedEnd string
+	}{
+		{program, "1:1", "4:6"},
+		{program.Statements[0], "1:1", "1:9"},
+		{program.Statements[1], "2:1", "2:27"},
+		{ifExp.Condition, "2:5", "2:9"},
+		{ifExp.Consequence, "2:12", "2:16"},
+		{ifExp.Alternative, "2:23", "2:27"},
+		{index, "3:1", "3:17"},
+		{call, "3:1", "3:14"},
+		{call.Arguments[1], "3:8", "3:13"},
+		{method, "4:1", "4:6"},
 	}
 
-	for key, value := range hash.Pairs {
-		integer, ok := key.(*ast.IntegerLiteral)
-		if !ok {
-			t.Errorf("key is not ast.IntegerLiteral. got=%T", key)
-			continue
+	for _, tt := range tests {
+		if pos := tt.node.Pos().String(); pos != tt.expectedPos {
+			t.Errorf("%q: wrong Pos. expected=%s, got=%s", tt.node.String(), tt.expectedPos, pos)
+		}
+		if end := tt.node.End().String(); end != tt.expectedEnd {
+			t.Errorf("%q: wrong End. expected=%s, got=%s", tt.node.String(), tt.expectedEnd, end)
 		}
-
-		expectedValue := expected[integer.String()]
-
-		testIntegerLiteral(t, value, expectedValue)
 	}
 }
 
-func TestParsingHashLiteralsWithExpressions(t *testing.T) {
-	input := `{"one": 0 + 1, "two": 10 - 8, "three": 15 / 5}`
+func TestInterpolationPositions(t *testing.T) {
+	input := `let a = 1;
+let t = "x ${a + q}";
+"${"in ${b}"} y
+${c}"`
 
 	l := lexer.New(input)
 	p := New(l)
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
-	stmt := program.Statements[0].(*ast.ExpressionStatement)
-	hash, ok := stmt.Expression.(*ast.HashLiteral)
-	if !ok {
-		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d",
+			len(program.Statements))
 	}
 
-	if len(hash.Pairs) != 3 {
-		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
-	}
+	// ("x " + (a + q))
+	second := program.Statements[1].(*ast.LetStatement).Value.(*ast.InfixExpression)
+	sum := second.Right.(*ast.InfixExpression)
+	// (("" + ("in " + b)) + " y\n") + c
+	third := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	text := third.Left.(*ast.InfixExpression).Right
+	nested := third.Left.(*ast.InfixExpression).Left.(*ast.InfixExpression).Right.(*ast.InfixExpression)
 
-	tests := map[string]func(ast.Expression){
-		"one": func(e ast.Expression) {
-			testInfixExpression(t, e, 0, "+", 1)
-		},
-		"two": func(e ast.Expression) {
-			testInfixExpression(t, e, 10, "-", 8)
-		},
-		"three": func(e ast.Expression) {
-			testInfixExpression(t, e, 15, "/", 5)
-		},
+	tests := []struct {
+		node        ast.Node
+		expectedPos string
+		expectedEnd string
+		expectedSrc string
+	}{
+		{second, "2:9", "2:9", `"x ${a + q}"`},
+		{second.Left, "2:10", "2:10", "x "},
+		{sum, "2:14", "2:18", "a + q"},
+		{sum.Right, "2:18", "2:18", "q"},
+		{nested, "3:4", "3:4", `"in ${b}"`},
+		{nested.Right, "3:10", "3:10", "b"},
+		{text, "3:14", "3:14", " y\n"},
+		{third.Right, "4:3", "4:3", "c"},
 	}
 
-	for key, value := range hash.Pairs {
-		literal, ok := key.(*ast.StringLiteral)
-		if !ok {
-			t.Errorf("key is not ast.StringLiteral. got=%T", key)
-			continue
+	for _, tt := range tests {
+		if pos := tt.node.Pos().String(); pos != tt.expectedPos {
+			t.Errorf("%q: wrong Pos. expected=%s, got=%s", tt.node.String(), tt.expectedPos, pos)
 		}
+		if end := tt.node.End().String(); end != tt.expectedEnd {
+			t.Errorf("%q: wrong End. expected=%s, got=%s", tt.node.String(), tt.expectedEnd, end)
+		}
+		start, end := ast.Range(tt.node)
+		if src := input[start:end]; src != tt.expectedSrc {
+			t.Errorf("%q: wrong Range. expected=%q, got=%q", tt.node.String(), tt.expectedSrc, src)
+		}
+	}
+}
 
-		testFunc, ok := tests[literal.String()]
-		if !ok {
-			t.Errorf("No test function for key %q found", literal.String())
-			continue
+func TestInterpolationUsesParserSettings(t *testing.T) {
+	// 插值中的表达式使用外层Parser修改过的优先级
+	p := New(lexer.New(`"${1 * 2 + 3}"`))
+	p.SetPrecedence(token.PLUS, PREFIX)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if program.String() != `"${(1 * (2 + 3))}"` {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestRegisterCustomInfixOperator(t *testing.T) {
+	const PIPE = token.TokenType("|>")
+
+	// 1 + 2 |> double;
+	tokens := func() *tokenSlice {
+		return &tokenSlice{tokens: []token.Token{
+			{Type: token.INT, Literal: "1"},
+			{Type: token.PLUS, Literal: "+"},
+			{Type: token.INT, Literal: "2"},
+			{Type: PIPE, Literal: "|>"},
+			{Type: token.IDENT, Literal: "double"},
+			{Type: token.SEMICOLON, Literal: ";"},
+		}}
+	}
+
+	p := New(tokens())
+	p.SetPrecedence(PIPE, EQUALS)
+	p.RegisterInfix(PIPE, func(left ast.Expression) ast.Expression {
+		tok := p.CurToken()
+		p.NextToken()
+		function := p.ParseExpression(EQUALS)
+		// x |> f 等价于 f(x)
+		return &ast.CallExpression{
+			Token:     tok,
+			Function:  function,
+			Arguments: []ast.Expression{left},
 		}
+	})
 
-		testFunc(value)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if program.String() != "double((1 + 2))" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+
+	// 注册只影响该Parser，新建的Parser不认识 |>
+	other := New(tokens())
+	other.ParseProgram()
+	if len(other.Errors()) == 0 {
+		t.Errorf("expected errors from a parser without the |> registration")
+	}
+	if _, ok := precedences[PIPE]; ok {
+		t.Errorf("SetPrecedence leaked into the default precedence table")
 	}
 }
 
@@ -4,14 +4,20 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"monkey/ast"
 	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strings"
 )
 
 const PROMPT = ">> "
 
+// PROFILE_COMMAND 开启或关闭执行计数的REPL命令
+// 开启后每次求值输入的代码都会在结果之后输出本次求值的执行计数（见 evaluator.Profile）
+const PROFILE_COMMAND = ":profile"
+
 // Start 启动 Monkey 语言的 REPL（Read-Eval-Print Loop）交互式解释器
 // 参数:
 //   - in: 输入流，用于读取用户输入（通常为 os.Stdin）
@@ -24,25 +30,60 @@ const PROMPT = ">> "
 //  4. 对输入的代码进行完整的词法分析、语法分析和求值过程
 //  5. 处理语法错误并显示友好的错误信息
 //  6. 输出求值结果或错误信息
-func Start(in io.Reader, out io.Writer) {
-	// 创建输入扫描器，用于逐行读取用户输入
-	scanner := bufio.NewScanner(in)
+//
+// 返回值: 退出状态，输入结束时为0，调用exit内置函数结束会话时为传给exit的值
+func Start(in io.Reader, out io.Writer) int {
 	// 创建新的求值环境，用于存储变量和函数定义
-	env := object.NewEnvironment()
+	// 环境默认允许重复声明，在REPL中可以随时用let重新定义变量
+	return StartWithEnvironment(in, out, object.NewEnvironment())
+}
+
+// StartWithEnvironment 与 Start 相同，但在给定的环境中求值
+// 调用方可以预先定义变量或设置严格模式等选项
+func StartWithEnvironment(in io.Reader, out io.Writer, env *object.Environment) int {
+	return StartWithOptions(in, out, env, evaluator.Options{})
+}
+
+// StartWithOptions 与 StartWithEnvironment 相同，但使用给定选项创建求值器
+// 如开启LooseTruthiness后，0、空字符串和空数组在条件中视为假值；
+// 没有设置Output时，puts和print的输出也写到out；没有设置Input时，input内置函数从in读取
+func StartWithOptions(in io.Reader, out io.Writer, env *object.Environment, opts evaluator.Options) int {
+	// 创建带缓冲的输入，用于逐行读取用户输入
+	reader := bufio.NewReader(in)
+	// 整个会话共用一个求值器，puts等内置函数默认输出到REPL的输出流
+	if opts.Output == nil {
+		opts.Output = out
+	}
+	// input内置函数与REPL共用同一个缓冲，读取的是紧接着当前输入的下一行
+	if opts.Input == nil {
+		opts.Input = reader
+	}
+	ev := evaluator.New(opts)
+	// 是否通过 :profile 开启了执行计数
+	profiling := false
 
 	// REPL 主循环：持续接收、解析和求值用户输入
 	for {
 		// 显示提示符，等待用户输入
 		fmt.Fprintf(out, PROMPT)
-		// 扫描用户输入，检查是否成功读取
-		scanned := scanner.Scan()
-		if !scanned {
+		// 读取用户输入的代码行
+		line, ok := readLine(reader)
+		if !ok {
 			// 输入结束（如遇到 EOF），退出 REPL
-			return
+			return 0
 		}
 
-		// 获取用户输入的代码行
-		line := scanner.Text()
+		if strings.TrimSpace(line) == PROFILE_COMMAND {
+			profiling = !profiling
+			if profiling {
+				io.WriteString(out, "profiling on\n")
+			} else {
+				// 恢复调用方通过选项设置的Profile
+				ev.SetProfile(opts.Profile)
+				io.WriteString(out, "profiling off\n")
+			}
+			continue
+		}
 		// 创建词法分析器，将源代码转换为 token 序列
 		l := lexer.New(line)
 		// 创建语法分析器，将 token 序列转换为抽象语法树（AST）
@@ -56,15 +97,35 @@ func Start(in io.Reader, out io.Writer) {
 			printParserErrors(out, p.Errors())
 			continue
 		}
+		// 静态检查的警告不阻止执行，只提示用户
+		printWarnings(out, parser.Check(program))
+
+		// 取出宏定义并展开宏调用，宏与变量保存在同一个环境中，可以在之后的输入中使用
+		evaluator.DefineMacros(program, env)
+		expanded := evaluator.ExpandMacros(program, env)
+
+		// 开启执行计数时，每次输入单独计数
+		var profile *evaluator.Profile
+		if profiling {
+			profile = evaluator.NewProfile()
+			ev.SetProfile(profile)
+		}
 
-		// 对抽象语法树进行求值，得到结果对象
-		evaluated := evaluator.Eval(program, env)
-		// 检查求值结果是否非空（nil 表示没有返回值或错误）
-		if evaluated != nil {
+		// 对抽象语法树进行求值，得到结果对象；顶层的return结束本次输入，输出它的值
+		evaluated := evaluator.UnwrapResult(ev.Eval(expanded, env))
+		// 调用了exit：不再输出结果，结束会话并返回退出状态
+		if exit, ok := evaluated.(*object.Exit); ok {
+			return int(exit.Code)
+		}
+		// 以声明结尾或没有任何语句的输入求值结果为NULL，不输出；出错或顶层return时仍然输出结果
+		if evaluated != evaluator.NULL || producesValue(program) {
 			// 输出求值结果的字符串表示
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
 		}
+		if profile != nil {
+			io.WriteString(out, profile.String())
+		}
 	}
 }
 
@@ -109,3 +170,36 @@ func printParserErrors(out io.Writer, errors []string) {
 		io.WriteString(out, "\t"+msg+"\n")
 	}
 }
+
+// producesValue 判断输入的结果是否值得显示
+// 没有语句（如空行或只定义了宏）、或最后一条语句是let/const声明时返回false
+func producesValue(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return false
+	}
+	switch program.Statements[len(program.Statements)-1].(type) {
+	case *ast.LetStatement, *ast.MultiLetStatement:
+		return false
+	default:
+		return true
+	}
+}
+
+// readLine 读取一行输入，去掉末尾的换行符（\n或\r\n）
+// 最后一行没有换行符时也照常返回；输入结束或读取出错时返回false
+func readLine(reader *bufio.Reader) (string, bool) {
+	line, err := reader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", false
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), true
+}
+
+// printWarnings 显示静态检查发现的警告
+// 与语法错误不同，警告不会阻止代码执行，因此只输出简短的提示
+func printWarnings(out io.Writer, warnings []string) {
+	for _, msg := range warnings {
+		io.WriteString(out, "warning: "+msg+"\n")
+	}
+}
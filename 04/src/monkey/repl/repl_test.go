@@ -0,0 +1,250 @@
+package repl
+
+import (
+	"bytes"
+	"monkey/evaluator"
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+func TestStartEchoesResults(t *testing.T) {
+	// 字符串带引号显示，与整数区分开
+	input := "\"hi\"\n5\n\"5\"\nlet s = \"a\" + \"b\"; [s, 1]\n"
+	expected := ">> \"hi\"\n>> 5\n>> \"5\"\n>> [\"ab\", 1]\n>> "
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	if out.String() != expected {
+		t.Errorf("wrong REPL output. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestStartSurvivesWrongArgumentCount(t *testing.T) {
+	input := "let add = fn(x, y) { x + y };\nadd(1)\nadd(1, 2, 3)\nadd(1, 2)\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	got := out.String()
+	for _, msg := range []string{
+		"wrong number of arguments to `add`: expected 2, got 1",
+		"wrong number of arguments to `add`: expected 2, got 3",
+	} {
+		if !strings.Contains(got, msg) {
+			t.Errorf("REPL output missing %q. got=%q", msg, got)
+		}
+	}
+	// 出错之后会话继续，后面的调用正常求值
+	if !strings.HasSuffix(got, ">> 3\n>> ") {
+		t.Errorf("REPL did not keep running after the error. got=%q", got)
+	}
+}
+
+func TestStartSurvivesInfiniteRecursion(t *testing.T) {
+	input := "let f = fn(x) { f(x) };\nf(1)\n1 + 1\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	got := out.String()
+	if !strings.Contains(got, "maximum call depth of 5000 exceeded in call to `f`") {
+		t.Errorf("REPL output missing call depth error. got=%q", got)
+	}
+	if !strings.HasSuffix(got, ">> 2\n>> ") {
+		t.Errorf("REPL did not keep running after the error. got=%q", got)
+	}
+}
+
+func TestStartWithStrictEnvironment(t *testing.T) {
+	input := "[1, 2][5]\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	if expected := ">> null\n>> "; out.String() != expected {
+		t.Errorf("wrong REPL output. expected=%q, got=%q", expected, out.String())
+	}
+
+	env := object.NewEnvironment()
+	env.SetStrict(true)
+	out.Reset()
+	StartWithEnvironment(strings.NewReader(input), &out, env)
+	if !strings.Contains(out.String(), "index out of range: 5 (array length 2)") {
+		t.Errorf("strict REPL did not report the error. got=%q", out.String())
+	}
+}
+
+func TestStartWithLooseTruthiness(t *testing.T) {
+	input := "if (0) { 1 } else { 2 }\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	if expected := ">> 1\n>> "; out.String() != expected {
+		t.Errorf("wrong REPL output. expected=%q, got=%q", expected, out.String())
+	}
+
+	out.Reset()
+	opts := evaluator.Options{LooseTruthiness: true}
+	StartWithOptions(strings.NewReader(input), &out, object.NewEnvironment(), opts)
+	if expected := ">> 2\n>> "; out.String() != expected {
+		t.Errorf("wrong REPL output. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestStartWritesOutputToOut(t *testing.T) {
+	input := "print(\"a\", 1)\nputs(\"b\")\n"
+	expected := ">> \"a\" 1null\n>> b\nnull\n>> "
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	// puts和print的输出与结果写到同一个输出流
+	if out.String() != expected {
+		t.Errorf("wrong REPL output. expected=%q, got=%q", expected, out.String())
+	}
+
+	// 选项中指定的Output优先
+	var out2, printed bytes.Buffer
+	StartWithOptions(strings.NewReader(input), &out2, object.NewEnvironment(),
+		evaluator.Options{Output: &printed})
+	if expected := ">> null\n>> null\n>> "; out2.String() != expected {
+		t.Errorf("wrong REPL output. expected=%q, got=%q", expected, out2.String())
+	}
+	if expected := "\"a\" 1b\n"; printed.String() != expected {
+		t.Errorf("wrong printed output. expected=%q, got=%q", expected, printed.String())
+	}
+}
+
+func TestStartInput(t *testing.T) {
+	// input读取的是紧接着当前代码行的下一行，读过的行不再作为代码求值
+	input := "let name = input(\"name: \")\nAda\n\"hi \" + name\ninput()\n"
+	expected := ">> name: >> \"hi Ada\"\n>> null\n>> "
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	if out.String() != expected {
+		t.Errorf("wrong REPL output. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestStartExit(t *testing.T) {
+	// exit结束会话，之后的输入不再求值，退出状态作为返回值
+	input := "puts(\"a\")\nlet f = fn() { exit(3) };\nf()\nputs(\"b\")\n"
+	expected := ">> a\nnull\n>> >> "
+
+	var out bytes.Buffer
+	code := Start(strings.NewReader(input), &out)
+
+	if out.String() != expected {
+		t.Errorf("wrong REPL output. expected=%q, got=%q", expected, out.String())
+	}
+	if code != 3 {
+		t.Errorf("wrong exit code. expected=3, got=%d", code)
+	}
+
+	// 输入结束时退出状态为0
+	if code := Start(strings.NewReader("1\n"), &out); code != 0 {
+		t.Errorf("wrong exit code at end of input. expected=0, got=%d", code)
+	}
+	if code := Start(strings.NewReader("exit()\n"), &out); code != 0 {
+		t.Errorf("wrong exit code for exit(). expected=0, got=%d", code)
+	}
+}
+
+func TestStartProfile(t *testing.T) {
+	input := ":profile\nlet f = fn(x) { x }; f(1) + f(2)\n:profile\nf(3)\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	expected := `>> profiling on
+>> 3
+nodes:
+  Identifier               4
+  ExpressionStatement      3
+  BlockStatement           2
+  CallExpression           2
+  IntegerLiteral           2
+  FunctionLiteral          1
+  InfixExpression          1
+  LetStatement             1
+  Program                  1
+calls:
+  f                        2
+objects:
+  INTEGER                  3
+  FUNCTION                 1
+>> profiling off
+>> 3
+>> `
+	if out.String() != expected {
+		t.Errorf("wrong REPL output.\nwant:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestStartOmitsDeclarationResults(t *testing.T) {
+	input := "let x = 1;\n\nlet a, b = 2, 3\nx\nlet y = z\nreturn 5; let w = 1;\nputs()\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	// 声明和空行不输出结果；声明出错、顶层return以及返回null的表达式仍然输出
+	expected := ">> >> >> >> 1\n>> ERROR: 1:9: identifier not found: z\n" +
+		">> warning: line 1: unreachable statement after return\n5\n>> null\n>> "
+	if out.String() != expected {
+		t.Errorf("wrong REPL output. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestStartExpandsMacros(t *testing.T) {
+	input := "let unless = macro(cond, c, a) { quote(if (!(unquote(cond))) { unquote(c) } else { unquote(a) }) };\n" +
+		"unless(10 > 5, \"no\", \"yes\")\n"
+	expected := ">> >> \"yes\"\n>> "
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	if out.String() != expected {
+		t.Errorf("wrong REPL output. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestStartAssertions(t *testing.T) {
+	input := "let x = 2;\nassert_eq(x * 2, 4)\nassert_eq(x, 3)\nassert(x > 1)\n"
+	expected := ">> >> true\n>> ERROR: 1:1: assertion failed: got 2 (INTEGER), expected 3 (INTEGER)\n" +
+		">> true\n>> "
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	// 失败的断言只报告错误，会话继续
+	if out.String() != expected {
+		t.Errorf("wrong REPL output. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestStartTopLevelReturn(t *testing.T) {
+	input := "return;\nreturn 5\nif (true) { return 1 }; 2\n3\n"
+	expected := ">> null\n>> 5\n>> 1\n>> 3\n>> "
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	if out.String() != expected {
+		t.Errorf("wrong REPL output. expected=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestStartAllowsRedeclaration(t *testing.T) {
+	input := "let x = 1;\nlet x = 2;\nx\n"
+	expected := ">> >> >> 2\n>> "
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	if out.String() != expected {
+		t.Errorf("wrong REPL output. expected=%q, got=%q", expected, out.String())
+	}
+}
@@ -1,5 +1,7 @@
 package token
 
+import "strconv"
+
 // TokenType 定义了 Monkey 编程语言中所有可能的词法单元类型
 type TokenType string
 
@@ -12,7 +14,15 @@ const (
 	// 标识符和字面量
 	IDENT  = "IDENT"  // 标识符：变量名、函数名等（如：add, foobar, x, y, ...）
 	INT    = "INT"    // 整数字面量（如：1343456）
+	FLOAT  = "FLOAT"  // 浮点数字面量（如：3.14），小数点两侧都必须有数字
 	STRING = "STRING" // 字符串字面量（如："foobar"）
+	// 带插值的字符串字面量（如："a ${x} b"），字面值为两端双引号之间的原始内容
+	TEMPLATE = "TEMPLATE"
+	// 缺少结束双引号、一直延续到输入末尾的字符串，字面值为开头双引号之后的全部内容
+	UNTERMINATED_STRING = "UNTERMINATED_STRING"
+	// 注释（如：# note），字面值包含开头的 # 但不含行尾换行符
+	// 只有开启注释输出时词法分析器才会产生，否则注释被当作空白跳过
+	COMMENT = "COMMENT"
 
 	// 运算符
 	ASSIGN   = "=" // 赋值运算符
@@ -21,19 +31,30 @@ const (
 	BANG     = "!" // 逻辑非运算符
 	ASTERISK = "*" // 乘法运算符
 	SLASH    = "/" // 除法运算符
+	PERCENT  = "%" // 取模运算符
+
+	FLOOR_DIV = "//" // 向下取整除法运算符
 
 	// 比较运算符
-	LT = "<" // 小于运算符
-	GT = ">" // 大于运算符
+	LT    = "<"  // 小于运算符
+	GT    = ">"  // 大于运算符
+	LT_EQ = "<=" // 小于等于运算符
+	GT_EQ = ">=" // 大于等于运算符
+
+	// 逻辑运算符
+	AND = "&&" // 逻辑与运算符
+	OR  = "||" // 逻辑或运算符
 
 	// 相等性运算符
 	EQ     = "==" // 等于运算符
 	NOT_EQ = "!=" // 不等于运算符
 
 	// 分隔符
-	COMMA     = "," // 逗号分隔符
-	SEMICOLON = ";" // 分号分隔符
-	COLON     = ":" // 冒号分隔符
+	COMMA     = ","   // 逗号分隔符
+	SEMICOLON = ";"   // 分号分隔符
+	COLON     = ":"   // 冒号分隔符
+	DOT       = "."   // 点号，用于 hash.key 形式的成员访问
+	ELLIPSIS  = "..." // 省略号，用于在函数调用中展开数组实参
 
 	// 括号和分组符号
 	LPAREN   = "(" // 左圆括号
@@ -51,6 +72,17 @@ const (
 	IF       = "IF"       // 条件语句关键字
 	ELSE     = "ELSE"     // 条件语句关键字
 	RETURN   = "RETURN"   // 返回值关键字
+	WHILE    = "WHILE"    // 循环语句关键字
+	FOR      = "FOR"      // 循环语句关键字
+	BREAK    = "BREAK"    // 跳出循环关键字
+	CONTINUE = "CONTINUE" // 跳过本次循环关键字
+	MACRO    = "MACRO"    // 宏定义关键字
+	CONST    = "CONST"    // 常量声明关键字
+	SWITCH   = "SWITCH"   // 多分支选择关键字
+	CASE     = "CASE"     // switch分支关键字
+	DEFAULT  = "DEFAULT"  // switch默认分支关键字
+	TRY      = "TRY"      // 错误处理关键字
+	RESCUE   = "RESCUE"   // 错误恢复分支关键字
 )
 
 // Token 结构体表示 Monkey 编程语言中的一个词法单元
@@ -66,18 +98,68 @@ type Token struct {
 	// 对于运算符：存储运算符字符（如 "+"、"=="）
 	// 对于关键字：存储关键字字符串（如 "let"、"if"）
 	Literal string
+
+	// Line 和 Column 记录 Token 第一个字符在源代码中的位置，均从 1 开始计数
+	// 由词法分析器填写；语法分析器合成的 Token 为 0，表示位置未知
+	Line   int
+	Column int
+
+	// Offset 是 Token 第一个字节在源代码中的字节偏移量，从 0 开始计数
+	// Length 是 Token 在源代码中占用的字节数，字符串包含两侧的引号和转义序列
+	// 与行列号一样由词法分析器填写，供编辑器等工具计算字节范围
+	Offset int
+	Length int
+}
+
+// Pos 返回 Token 在源代码中的位置
+func (t Token) Pos() Position {
+	return Position{Line: t.Line, Column: t.Column}
+}
+
+// Position 表示源代码中的一个位置，行号和列号均从 1 开始计数
+// 零值表示位置未知（例如语法分析器合成的 Token）
+type Position struct {
+	Line   int
+	Column int
+}
+
+// IsValid 判断位置是否已知
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// Before 判断位置 p 是否在位置 q 之前
+func (p Position) Before(q Position) bool {
+	return p.Line < q.Line || p.Line == q.Line && p.Column < q.Column
+}
+
+// String 返回 "行:列" 形式的位置，位置未知时返回 "-"
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Column)
 }
 
 // keywords 是一个映射表，用于将 Monkey 语言的关键字字符串映射到对应的 Token 类型
 // 这个映射表在词法分析阶段用于区分关键字和普通标识符
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION, // 函数定义关键字 -> FUNCTION Token 类型
-	"let":    LET,      // 变量声明关键字 -> LET Token 类型
-	"true":   TRUE,     // 布尔真值关键字 -> TRUE Token 类型
-	"false":  FALSE,    // 布尔假值关键字 -> FALSE Token 类型
-	"if":     IF,       // 条件语句关键字 -> IF Token 类型
-	"else":   ELSE,     // 条件语句关键字 -> ELSE Token 类型
-	"return": RETURN,   // 返回值关键字 -> RETURN Token 类型
+	"fn":       FUNCTION, // 函数定义关键字 -> FUNCTION Token 类型
+	"let":      LET,      // 变量声明关键字 -> LET Token 类型
+	"true":     TRUE,     // 布尔真值关键字 -> TRUE Token 类型
+	"false":    FALSE,    // 布尔假值关键字 -> FALSE Token 类型
+	"if":       IF,       // 条件语句关键字 -> IF Token 类型
+	"else":     ELSE,     // 条件语句关键字 -> ELSE Token 类型
+	"return":   RETURN,   // 返回值关键字 -> RETURN Token 类型
+	"while":    WHILE,    // 循环语句关键字 -> WHILE Token 类型
+	"for":      FOR,      // 循环语句关键字 -> FOR Token 类型
+	"break":    BREAK,    // 跳出循环关键字 -> BREAK Token 类型
+	"continue": CONTINUE, // 跳过本次循环关键字 -> CONTINUE Token 类型
+	"macro":    MACRO,    // 宏定义关键字 -> MACRO Token 类型
+	"const":    CONST,    // 常量声明关键字 -> CONST Token 类型
+	"switch":   SWITCH,   // 多分支选择关键字 -> SWITCH Token 类型
+	"case":     CASE,     // switch分支关键字 -> CASE Token 类型
+	"default":  DEFAULT,  // switch默认分支关键字 -> DEFAULT Token 类型
+	"try":      TRY,      // 错误处理关键字 -> TRY Token 类型
+	"rescue":   RESCUE,   // 错误恢复分支关键字 -> RESCUE Token 类型
 }
 
 // LookupIdent 函数用于查找标识符对应的 Token 类型